@@ -30,6 +30,9 @@ func NewCommand() *cobra.Command {
 	}
 	cmd.AddCommand(
 		newServerCommand(),
+		newFsCommand(),
+		newNamespaceCommand(),
+		newFsckCommand(),
 	)
 	return cmd
 }
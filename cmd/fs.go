@@ -0,0 +1,1000 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/client"
+	"github.com/spf13/cobra"
+)
+
+// Exit codes of the fs commands, chosen by the exception of the failed request.
+const (
+	exitError          = 1
+	exitNotFound       = 2
+	exitAlreadyExists  = 3
+	exitAccessDenied   = 4
+	exitBadParameter   = 5
+	exitNotEmpty       = 6
+	exitQuotaExceeded  = 7
+	exitNotImplemented = 8
+)
+
+var exitCodes = map[string]int{
+	"FileNotFoundException":            exitNotFound,
+	"FileAlreadyExistsException":       exitAlreadyExists,
+	"AccessControlException":           exitAccessDenied,
+	"SecurityException":                exitAccessDenied,
+	"IllegalArgumentException":         exitBadParameter,
+	"PathIsNotEmptyDirectoryException": exitNotEmpty,
+	"QuotaExceededException":           exitQuotaExceeded,
+	"UnsupportedOperationException":    exitNotImplemented,
+	"ParentNotDirectoryException":      exitBadParameter,
+	"PathIsNotDirectoryException":      exitBadParameter,
+	"PathIsDirectoryException":         exitBadParameter,
+	"NSQuotaExceededException":         exitQuotaExceeded,
+	"DSQuotaExceededException":         exitQuotaExceeded,
+}
+
+// ExitCode returns the exit code of the process which failed with err:
+// exitError unless the server failed the request with one of the exceptions
+// of exitCodes.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if e, ok := err.(*client.RemoteError); ok {
+		if code, ok := exitCodes[e.Exception]; ok {
+			return code
+		}
+	}
+	return exitError
+}
+
+// fsOptions are the options shared by all fs commands.
+type fsOptions struct {
+	endpoint  string
+	json      bool
+	accessKey string
+	secretKey string
+	token     string
+}
+
+func (o *fsOptions) client() (*client.Client, error) {
+	c, err := client.New(strings.Split(o.endpoint, ",")...)
+	if err != nil {
+		return nil, err
+	}
+	c.AccessKey = valueOrEnv(o.accessKey, "GOFS_ACCESS_KEY")
+	c.SecretKey = valueOrEnv(o.secretKey, "GOFS_SECRET_KEY")
+	c.Token = valueOrEnv(o.token, "GOFS_TOKEN")
+	return c, nil
+}
+
+// valueOrEnv returns v, or the environment variable env if v is empty.
+func valueOrEnv(v, env string) string {
+	if v == "" {
+		return os.Getenv(env)
+	}
+	return v
+}
+
+// print writes v as JSON if --json is set, or calls text otherwise.
+func (o *fsOptions) print(v interface{}, text func()) error {
+	if o.json {
+		return json.NewEncoder(os.Stdout).Encode(v)
+	}
+	text()
+	return nil
+}
+
+func newFsCommand() *cobra.Command {
+	opts := &fsOptions{}
+	var cmd = &cobra.Command{
+		Use:   "fs",
+		Short: "Operate the files of a namespace",
+		Long:  `Operate the files and directories of a GoFS namespace. Paths start with the namespace, e.g. /ns/dir/file.`,
+	}
+	flags := cmd.PersistentFlags()
+	flags.StringVar(&opts.endpoint, "endpoint", "http://127.0.0.1:9876", "Comma separated endpoints of the GoFS servers")
+	flags.BoolVar(&opts.json, "json", false, "Print the output as JSON")
+	flags.StringVar(&opts.accessKey, "access-key", "", "Access key of the namespace, defaults to $GOFS_ACCESS_KEY")
+	flags.StringVar(&opts.secretKey, "secret-key", "", "Secret key of the namespace, defaults to $GOFS_SECRET_KEY")
+	flags.StringVar(&opts.token, "token", "", "Bearer token of a service account, defaults to $GOFS_TOKEN")
+	cmd.AddCommand(
+		newFsLsCommand(opts),
+		newFsStatCommand(opts),
+		newFsMkdirCommand(opts),
+		newFsPutCommand(opts),
+		newFsAppendCommand(opts),
+		newFsTruncateCommand(opts),
+		newFsGetCommand(opts),
+		newFsCatCommand(opts),
+		newFsRmCommand(opts),
+		newFsTrashCommand(opts),
+		newFsMvCommand(opts),
+		newFsChmodCommand(opts),
+		newFsChownCommand(opts),
+		newFsTouchCommand(opts),
+		newFsLnCommand(opts),
+		newFsDuCommand(opts),
+		newFsChecksumCommand(opts),
+		newFsRepairCommand(opts),
+		newFsQuotaCommand(opts),
+		newFsSetquotaCommand(opts),
+		newFsClrquotaCommand(opts),
+		newFsGetfaclCommand(opts),
+		newFsSetfaclCommand(opts),
+		newFsGetfattrCommand(opts),
+		newFsSetfattrCommand(opts),
+		newFsSnapshotCommand(opts),
+		newFsVersionsCommand(opts),
+	)
+	return cmd
+}
+
+// newFsSubCommand returns a command running fn with a client, once the
+// number of arguments is checked.
+func newFsSubCommand(opts *fsOptions, use, short string, minArgs, maxArgs int, fn func(ctx context.Context, c *client.Client, args []string) error) *cobra.Command {
+	return &cobra.Command{
+		Use:           use,
+		Short:         short,
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < minArgs || (maxArgs >= 0 && len(args) > maxArgs) {
+				return fmt.Errorf("bad parameter: usage: %s", cmd.UseLine())
+			}
+			c, err := opts.client()
+			if err != nil {
+				return err
+			}
+			return fn(context.Background(), c, args)
+		},
+	}
+}
+
+// fileEntry is a FileStatus with its full path.
+type fileEntry struct {
+	Path string `json:"path"`
+	api.FileStatus
+}
+
+func newFsLsCommand(opts *fsOptions) *cobra.Command {
+	var recursive bool
+	cmd := newFsSubCommand(opts, "ls [-r] PATH...", "List directories", 1, -1, func(ctx context.Context, c *client.Client, args []string) error {
+		entries := []fileEntry{}
+		for _, p := range args {
+			list, err := listEntries(ctx, c, p, recursive)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, list...)
+		}
+		return opts.print(entries, func() {
+			for _, e := range entries {
+				printEntry(e)
+			}
+		})
+	})
+	cmd.Flags().BoolVarP(&recursive, "recursive", "r", false, "List the subdirectories recursively")
+	return cmd
+}
+
+// listEntries returns the entries of the directory p, or p itself if it is
+// a file.
+func listEntries(ctx context.Context, c *client.Client, p string, recursive bool) ([]fileEntry, error) {
+	st, err := c.GetFileStatus(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	if st.Type != api.FileTypeDirectory {
+		return []fileEntry{{Path: p, FileStatus: *st}}, nil
+	}
+	list, err := c.ListStatus(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	entries := []fileEntry{}
+	for _, st := range list {
+		e := fileEntry{Path: path.Join(p, st.PathSuffix), FileStatus: st}
+		entries = append(entries, e)
+		if recursive && st.Type == api.FileTypeDirectory {
+			sub, err := listEntries(ctx, c, e.Path, recursive)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, sub...)
+		}
+	}
+	return entries, nil
+}
+
+func printEntry(e fileEntry) {
+	name := e.Path
+	if e.Type == api.FileTypeSymlink {
+		name += " -> " + e.Symlink
+	}
+	fmt.Printf("%s %8s %8s %12d %s %s\n", modeString(e.FileStatus), e.Owner, e.Group, e.Length,
+		time.Unix(0, e.ModificationTime*int64(time.Millisecond)).Format("2006-01-02 15:04"), name)
+}
+
+func modeString(st api.FileStatus) string {
+	perm, _ := strconv.ParseUint(st.Permission, 8, 32)
+	mode := os.FileMode(perm)
+	switch st.Type {
+	case api.FileTypeDirectory:
+		mode |= os.ModeDir
+	case api.FileTypeSymlink:
+		mode |= os.ModeSymlink
+	}
+	return mode.String()
+}
+
+func newFsStatCommand(opts *fsOptions) *cobra.Command {
+	return newFsSubCommand(opts, "stat PATH", "Show the status of a file or directory", 1, 1, func(ctx context.Context, c *client.Client, args []string) error {
+		st, err := c.GetFileStatus(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		e := fileEntry{Path: args[0], FileStatus: *st}
+		return opts.print(e, func() {
+			fmt.Printf("Path:         %s\n", e.Path)
+			fmt.Printf("Type:         %s\n", e.Type)
+			fmt.Printf("Size:         %d\n", e.Length)
+			fmt.Printf("Inode:        %d\n", e.FileID)
+			fmt.Printf("Permission:   %s (%s)\n", modeString(e.FileStatus), e.Permission)
+			fmt.Printf("Owner:        %s\n", e.Owner)
+			fmt.Printf("Group:        %s\n", e.Group)
+			fmt.Printf("Access:       %s\n", time.Unix(0, e.AccessTime*int64(time.Millisecond)))
+			fmt.Printf("Modify:       %s\n", time.Unix(0, e.ModificationTime*int64(time.Millisecond)))
+		})
+	})
+}
+
+func newFsMkdirCommand(opts *fsOptions) *cobra.Command {
+	var mode string
+	cmd := newFsSubCommand(opts, "mkdir [-m MODE] PATH...", "Create directories along with their parents", 1, -1, func(ctx context.Context, c *client.Client, args []string) error {
+		perm, err := strconv.ParseUint(mode, 8, 32)
+		if err != nil {
+			return fmt.Errorf("bad parameter: invalid mode %q", mode)
+		}
+		for _, p := range args {
+			if err := c.Mkdirs(ctx, p, os.FileMode(perm)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	cmd.Flags().StringVarP(&mode, "mode", "m", "755", "Permission of the new directories")
+	return cmd
+}
+
+// putOptions are the options of put.
+type putOptions struct {
+	recursive bool
+	create    client.CreateOptions
+	// chunkThreshold is the size above which the files are uploaded in
+	// chunks.
+	chunkThreshold int64
+	chunks         client.ChunkOptions
+}
+
+func newFsPutCommand(opts *fsOptions) *cobra.Command {
+	var options putOptions
+	cmd := newFsSubCommand(opts, "put [-r] [-f] [--sha256] LOCAL PATH", "Upload a local file or directory", 2, 2, func(ctx context.Context, c *client.Client, args []string) error {
+		src, dst := args[0], args[1]
+		if st, err := c.GetFileStatus(ctx, dst); err == nil && st.Type == api.FileTypeDirectory {
+			dst = path.Join(dst, filepath.Base(src))
+		}
+		return put(ctx, c, src, dst, options)
+	})
+	flags := cmd.Flags()
+	flags.BoolVarP(&options.recursive, "recursive", "r", false, "Upload directories recursively")
+	flags.BoolVarP(&options.create.Overwrite, "force", "f", false, "Overwrite the existing files")
+	flags.BoolVar(&options.create.SHA256, "sha256", false, "Record the SHA-256 of the files along with their MD5 and CRC32C, unless they are uploaded in chunks")
+	flags.Int64Var(&options.chunkThreshold, "chunk-threshold", 256<<20, "Size in bytes above which the files are uploaded in chunks, whose checksums are checked one by one")
+	flags.Int64Var(&options.chunks.ChunkSize, "chunk-size", client.DefaultChunkSize, "Size in bytes of the chunks")
+	flags.IntVar(&options.chunks.Parallel, "parallel", 4, "Number of chunks uploaded at once")
+	return cmd
+}
+
+func newFsAppendCommand(opts *fsOptions) *cobra.Command {
+	return newFsSubCommand(opts, "append LOCAL PATH", "Append a local file to a file, - reading the standard input", 2, 2, func(ctx context.Context, c *client.Client, args []string) error {
+		var r io.Reader = os.Stdin
+		if args[0] != "-" {
+			f, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			r = f
+		}
+		return c.Append(ctx, args[1], r)
+	})
+}
+
+func newFsTruncateCommand(opts *fsOptions) *cobra.Command {
+	return newFsSubCommand(opts, "truncate SIZE PATH...", "Truncate files to a size in bytes", 2, -1, func(ctx context.Context, c *client.Client, args []string) error {
+		size, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil || size < 0 {
+			return fmt.Errorf("bad parameter: invalid size %q", args[0])
+		}
+		for _, p := range args[1:] {
+			if err = c.Truncate(ctx, p, size); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// put uploads the file or directory src to dst, with the options opts of
+// which the permission is that of every local file.
+func put(ctx context.Context, c *client.Client, src, dst string, opts putOptions) error {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		f, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		opts.create.Permission = fi.Mode().Perm()
+		if fi.Mode().IsRegular() && fi.Size() > opts.chunkThreshold {
+			return c.CreateChunked(ctx, dst, f, fi.Size(), opts.create, opts.chunks)
+		}
+		return c.Create(ctx, dst, f, opts.create)
+	}
+	if !opts.recursive {
+		return fmt.Errorf("bad parameter: %s is a directory, use -r to upload it", src)
+	}
+	if err = c.Mkdirs(ctx, dst, fi.Mode().Perm()); err != nil {
+		return err
+	}
+	names, err := readDirNames(src)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err = put(ctx, c, filepath.Join(src, name), path.Join(dst, name), opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readDirNames(dir string) ([]string, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Readdirnames(-1)
+}
+
+func newFsGetCommand(opts *fsOptions) *cobra.Command {
+	var recursive bool
+	cmd := newFsSubCommand(opts, "get [-r] PATH LOCAL", "Download a file or directory", 2, 2, func(ctx context.Context, c *client.Client, args []string) error {
+		src, dst := args[0], args[1]
+		if fi, err := os.Stat(dst); err == nil && fi.IsDir() {
+			dst = filepath.Join(dst, path.Base(src))
+		}
+		return get(ctx, c, src, dst, recursive)
+	})
+	cmd.Flags().BoolVarP(&recursive, "recursive", "r", false, "Download directories recursively")
+	return cmd
+}
+
+func get(ctx context.Context, c *client.Client, src, dst string, recursive bool) error {
+	st, err := c.GetFileStatus(ctx, src)
+	if err != nil {
+		return err
+	}
+	perm, _ := strconv.ParseUint(st.Permission, 8, 32)
+	if st.Type != api.FileTypeDirectory {
+		rc, err := c.Open(ctx, src)
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		f, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.FileMode(perm))
+		if err != nil {
+			return err
+		}
+		if _, err = io.Copy(f, rc); err != nil {
+			f.Close()
+			if client.IsChecksumError(err) {
+				// do not leave the corrupted data behind
+				os.Remove(dst)
+			}
+			return err
+		}
+		return f.Close()
+	}
+	if !recursive {
+		return fmt.Errorf("bad parameter: %s is a directory, use -r to download it", src)
+	}
+	if err = os.MkdirAll(dst, os.FileMode(perm)|0700); err != nil {
+		return err
+	}
+	list, err := c.ListStatus(ctx, src)
+	if err != nil {
+		return err
+	}
+	for _, st := range list {
+		if err = get(ctx, c, path.Join(src, st.PathSuffix), filepath.Join(dst, st.PathSuffix), recursive); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newFsCatCommand(opts *fsOptions) *cobra.Command {
+	var offset, length int64
+	cmd := newFsSubCommand(opts, "cat [--offset N] [--length N] PATH...", "Print the content of files, or a range of it", 1, -1, func(ctx context.Context, c *client.Client, args []string) error {
+		for _, p := range args {
+			var rc io.ReadCloser
+			var err error
+			if offset > 0 || length >= 0 {
+				rc, err = c.OpenRange(ctx, p, offset, length)
+			} else {
+				// the whole content is verified against its checksums
+				rc, err = c.Open(ctx, p)
+			}
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(os.Stdout, rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	cmd.Flags().Int64Var(&offset, "offset", 0, "Offset in bytes of the content printed")
+	cmd.Flags().Int64Var(&length, "length", -1, "Number of bytes printed, -1 for all of them up to the end")
+	return cmd
+}
+
+func newFsRmCommand(opts *fsOptions) *cobra.Command {
+	var recursive, skipTrash bool
+	cmd := newFsSubCommand(opts, "rm [-r] PATH...", "Remove files or directories", 1, -1, func(ctx context.Context, c *client.Client, args []string) error {
+		for _, p := range args {
+			rm := c.Delete
+			if skipTrash {
+				rm = c.DeleteSkipTrash
+			}
+			ok, err := rm(ctx, p, recursive)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return &client.RemoteError{
+					RemoteException: api.RemoteException{
+						Exception: "FileNotFoundException",
+						Message:   fmt.Sprintf("no such file or directory: %s", p),
+					},
+				}
+			}
+		}
+		return nil
+	})
+	cmd.Flags().BoolVarP(&recursive, "recursive", "r", false, "Remove directories and their contents recursively")
+	cmd.Flags().BoolVar(&skipTrash, "skip-trash", false, "Remove the files at once rather than moving them to the trash, which only admins may")
+	return cmd
+}
+
+func newFsTrashCommand(opts *fsOptions) *cobra.Command {
+	return newFsSubCommand(opts, "trash NAMESPACE", "Show the trash root of the user in a namespace", 1, 1, func(ctx context.Context, c *client.Client, args []string) error {
+		root, err := c.GetTrashRoot(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		resp := api.PathResponse{Path: root}
+		return opts.print(resp, func() {
+			fmt.Println(resp.Path)
+		})
+	})
+}
+
+func newFsMvCommand(opts *fsOptions) *cobra.Command {
+	var force bool
+	cmd := newFsSubCommand(opts, "mv SRC DST", "Move a file or directory", 2, 2, func(ctx context.Context, c *client.Client, args []string) error {
+		if force {
+			return c.Rename2(ctx, args[0], args[1], true)
+		}
+		ok, err := c.Rename(ctx, args[0], args[1])
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("failed to move %s to %s", args[0], args[1])
+		}
+		return nil
+	})
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "Replace DST, a file or an empty directory, instead of moving SRC into it")
+	return cmd
+}
+
+func newFsChmodCommand(opts *fsOptions) *cobra.Command {
+	return newFsSubCommand(opts, "chmod MODE PATH...", "Change the permission of files and directories", 2, -1, func(ctx context.Context, c *client.Client, args []string) error {
+		n, err := strconv.ParseUint(args[0], 8, 32)
+		if err != nil || n > 01777 {
+			return fmt.Errorf("bad parameter: invalid mode %q", args[0])
+		}
+		perm := os.FileMode(n & 0777)
+		if n&01000 != 0 {
+			perm |= os.ModeSticky
+		}
+		for _, p := range args[1:] {
+			if err = c.SetPermission(ctx, p, perm); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func newFsChownCommand(opts *fsOptions) *cobra.Command {
+	return newFsSubCommand(opts, "chown [OWNER][:GROUP] PATH...", "Change the owner and the group of files and directories", 2, -1, func(ctx context.Context, c *client.Client, args []string) error {
+		owner, group := args[0], ""
+		if i := strings.Index(owner, ":"); i >= 0 {
+			owner, group = owner[:i], owner[i+1:]
+		}
+		for _, p := range args[1:] {
+			if err := c.SetOwner(ctx, p, owner, group); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func newFsTouchCommand(opts *fsOptions) *cobra.Command {
+	return newFsSubCommand(opts, "touch PATH...", "Update the times of files, creating the missing ones", 1, -1, func(ctx context.Context, c *client.Client, args []string) error {
+		now := time.Now()
+		for _, p := range args {
+			err := c.SetTimes(ctx, p, now, now)
+			if client.IsNotFound(err) {
+				err = c.Create(ctx, p, strings.NewReader(""), client.CreateOptions{})
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func newFsLnCommand(opts *fsOptions) *cobra.Command {
+	var symbolic bool
+	cmd := newFsSubCommand(opts, "ln [-s] TARGET LINK", "Create a link to a file", 2, 2, func(ctx context.Context, c *client.Client, args []string) error {
+		if symbolic {
+			return c.CreateSymlink(ctx, args[1], args[0], false)
+		}
+		return c.CreateHardLink(ctx, args[1], args[0])
+	})
+	cmd.Flags().BoolVarP(&symbolic, "symbolic", "s", false, "Create a symbolic link instead of a hard link")
+	return cmd
+}
+
+// duEntry is a ContentSummary with its full path.
+type duEntry struct {
+	Path string `json:"path"`
+	api.ContentSummary
+}
+
+func newFsDuCommand(opts *fsOptions) *cobra.Command {
+	var summary bool
+	cmd := newFsSubCommand(opts, "du [-s] PATH...", "Show the space used by files and directories", 1, -1, func(ctx context.Context, c *client.Client, args []string) error {
+		entries := []duEntry{}
+		for _, p := range args {
+			paths := []string{p}
+			if !summary {
+				list, err := listEntries(ctx, c, p, false)
+				if err != nil {
+					return err
+				}
+				paths = paths[:0]
+				for _, e := range list {
+					paths = append(paths, e.Path)
+				}
+			}
+			for _, p := range paths {
+				cs, err := c.GetContentSummary(ctx, p)
+				if err != nil {
+					return err
+				}
+				entries = append(entries, duEntry{Path: p, ContentSummary: *cs})
+			}
+		}
+		return opts.print(entries, func() {
+			for _, e := range entries {
+				fmt.Printf("%-12d %s\n", e.Length, e.Path)
+			}
+		})
+	})
+	cmd.Flags().BoolVarP(&summary, "summary", "s", false, "Show a total for each argument only")
+	return cmd
+}
+
+// checksumEntry is a FileChecksum with its full path.
+type checksumEntry struct {
+	Path string `json:"path"`
+	api.FileChecksum
+}
+
+func newFsChecksumCommand(opts *fsOptions) *cobra.Command {
+	var algorithm string
+	cmd := newFsSubCommand(opts, "checksum [-a ALGORITHM] PATH...", "Show the checksums of files", 1, -1, func(ctx context.Context, c *client.Client, args []string) error {
+		entries := []checksumEntry{}
+		for _, p := range args {
+			cs, err := c.GetFileChecksum(ctx, p, algorithm)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, checksumEntry{Path: p, FileChecksum: *cs})
+		}
+		return opts.print(entries, func() {
+			for _, e := range entries {
+				fmt.Printf("%s %s %s\n", e.Algorithm, e.Bytes, e.Path)
+			}
+		})
+	})
+	cmd.Flags().StringVarP(&algorithm, "algorithm", "a", "", "Algorithm of the checksums: COMPOSITE-CRC32C (default), MD5 or SHA-256")
+	return cmd
+}
+
+func newFsRepairCommand(opts *fsOptions) *cobra.Command {
+	return newFsSubCommand(opts, "repair DIR...", "Recompute the content summaries of directory trees", 1, -1, func(ctx context.Context, c *client.Client, args []string) error {
+		entries := []duEntry{}
+		for _, p := range args {
+			cs, err := c.RepairContentSummary(ctx, p)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, duEntry{Path: p, ContentSummary: *cs})
+		}
+		return opts.print(entries, func() {
+			for _, e := range entries {
+				fmt.Printf("%12d %12d %12d %s\n", e.DirectoryCount, e.FileCount, e.Length, e.Path)
+			}
+		})
+	})
+}
+
+// quotaEntry is a QuotaUsage with its full path.
+type quotaEntry struct {
+	Path string `json:"path"`
+	api.QuotaUsage
+}
+
+func newFsQuotaCommand(opts *fsOptions) *cobra.Command {
+	return newFsSubCommand(opts, "quota PATH...", "Show the quotas of directories and their usage", 1, -1, func(ctx context.Context, c *client.Client, args []string) error {
+		entries := []quotaEntry{}
+		for _, p := range args {
+			u, err := c.GetQuotaUsage(ctx, p)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, quotaEntry{Path: p, QuotaUsage: *u})
+		}
+		return opts.print(entries, func() {
+			for _, e := range entries {
+				fmt.Printf("%12s %12d %12s %12d %s\n", quotaString(e.Quota), e.FileAndDirectoryCount, quotaString(e.SpaceQuota), e.SpaceConsumed, e.Path)
+			}
+		})
+	})
+}
+
+func quotaString(q int64) string {
+	if q < 0 {
+		return "none"
+	}
+	return strconv.FormatInt(q, 10)
+}
+
+func newFsSetquotaCommand(opts *fsOptions) *cobra.Command {
+	var names, space int64
+	cmd := newFsSubCommand(opts, "setquota [-n NAMES] [-s BYTES] DIR...", "Set the quotas of directories", 1, -1, func(ctx context.Context, c *client.Client, args []string) error {
+		if names == 0 && space == 0 {
+			return fmt.Errorf("bad parameter: a name or space quota is required")
+		}
+		for _, p := range args {
+			if err := c.SetQuota(ctx, p, names, space); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	cmd.Flags().Int64VarP(&names, "names", "n", 0, "Maximum number of files and directories in the tree, -1 to clear it")
+	cmd.Flags().Int64VarP(&space, "space", "s", 0, "Maximum size in bytes of the files in the tree, -1 to clear it")
+	return cmd
+}
+
+func newFsClrquotaCommand(opts *fsOptions) *cobra.Command {
+	return newFsSubCommand(opts, "clrquota DIR...", "Clear the quotas of directories", 1, -1, func(ctx context.Context, c *client.Client, args []string) error {
+		for _, p := range args {
+			if err := c.ClearQuota(ctx, p); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// aclEntry is an ACLStatus with its full path.
+type aclEntry struct {
+	Path string `json:"path"`
+	api.ACLStatus
+}
+
+func newFsGetfaclCommand(opts *fsOptions) *cobra.Command {
+	return newFsSubCommand(opts, "getfacl PATH...", "Show the ACLs of files and directories", 1, -1, func(ctx context.Context, c *client.Client, args []string) error {
+		entries := []aclEntry{}
+		for _, p := range args {
+			st, err := c.GetACLStatus(ctx, p)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, aclEntry{Path: p, ACLStatus: *st})
+		}
+		return opts.print(entries, func() {
+			for _, e := range entries {
+				fmt.Printf("# file: %s\n# owner: %s\n# group: %s\n", e.Path, e.Owner, e.Group)
+				for _, entry := range e.Entries {
+					fmt.Println(entry)
+				}
+				fmt.Println()
+			}
+		})
+	})
+}
+
+func newFsSetfaclCommand(opts *fsOptions) *cobra.Command {
+	var modify, remove, set string
+	var removeAll, removeDefault bool
+	cmd := newFsSubCommand(opts, "setfacl {-m|-x|--set ACLSPEC | -b | -k} PATH...", "Change the ACLs of files and directories", 1, -1, func(ctx context.Context, c *client.Client, args []string) error {
+		var op, spec string
+		n := 0
+		for _, o := range []struct {
+			set         bool
+			op, aclspec string
+		}{
+			{modify != "", api.OpsModifyACLEntries, modify},
+			{remove != "", api.OpsRemoveACLEntries, remove},
+			{set != "", api.OpsSetACL, set},
+			{removeAll, api.OpsRemoveACL, ""},
+			{removeDefault, api.OpsRemoveDefaultACL, ""},
+		} {
+			if o.set {
+				op, spec = o.op, o.aclspec
+				n++
+			}
+		}
+		if n != 1 {
+			return fmt.Errorf("bad parameter: exactly one of -m, -x, --set, -b and -k is required")
+		}
+		for _, p := range args {
+			if err := c.UpdateACL(ctx, p, op, spec); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	flags := cmd.Flags()
+	flags.StringVarP(&modify, "modify", "m", "", "Add or change the ACL entries")
+	flags.StringVarP(&remove, "remove", "x", "", "Remove the ACL entries")
+	flags.StringVar(&set, "set", "", "Replace the whole ACL")
+	flags.BoolVarP(&removeAll, "remove-all", "b", false, "Remove all the ACL entries but the base ones")
+	flags.BoolVarP(&removeDefault, "remove-default", "k", false, "Remove the default ACL")
+	return cmd
+}
+
+// xattrEntry are the extended attributes of a path.
+type xattrEntry struct {
+	Path   string            `json:"path"`
+	Xattrs map[string]string `json:"xattrs"`
+}
+
+func newFsGetfattrCommand(opts *fsOptions) *cobra.Command {
+	var names []string
+	var encoding string
+	cmd := newFsSubCommand(opts, "getfattr [-n NAME]... [-e ENCODING] PATH...", "Show the extended attributes of files and directories", 1, -1, func(ctx context.Context, c *client.Client, args []string) error {
+		entries := []xattrEntry{}
+		for _, p := range args {
+			xattrs, err := c.GetXAttrs(ctx, p, names...)
+			if err != nil {
+				return err
+			}
+			e := xattrEntry{Path: p, Xattrs: map[string]string{}}
+			for name, v := range xattrs {
+				if e.Xattrs[name], err = api.EncodeXAttrValue(v, encoding); err != nil {
+					return fmt.Errorf("bad parameter: %v", err)
+				}
+			}
+			entries = append(entries, e)
+		}
+		return opts.print(entries, func() {
+			for _, e := range entries {
+				fmt.Printf("# file: %s\n", e.Path)
+				names := make([]string, 0, len(e.Xattrs))
+				for name := range e.Xattrs {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				for _, name := range names {
+					fmt.Printf("%s=%s\n", name, e.Xattrs[name])
+				}
+				fmt.Println()
+			}
+		})
+	})
+	cmd.Flags().StringSliceVarP(&names, "name", "n", nil, "Show only the named attribute")
+	cmd.Flags().StringVarP(&encoding, "encoding", "e", api.XAttrEncodingText, "Encoding of the values: text, hex or base64")
+	return cmd
+}
+
+func newFsSetfattrCommand(opts *fsOptions) *cobra.Command {
+	var name, value, remove string
+	cmd := newFsSubCommand(opts, "setfattr {-n NAME [-v VALUE] | -x NAME} PATH...", "Change the extended attributes of files and directories", 1, -1, func(ctx context.Context, c *client.Client, args []string) error {
+		if (name == "") == (remove == "") {
+			return fmt.Errorf("bad parameter: exactly one of -n and -x is required")
+		}
+		v, err := api.DecodeXAttrValue(value)
+		if err != nil {
+			return fmt.Errorf("bad parameter: invalid value: %v", err)
+		}
+		for _, p := range args {
+			if remove != "" {
+				err = c.RemoveXAttr(ctx, p, remove)
+			} else {
+				err = c.SetXAttr(ctx, p, name, v, "")
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	flags := cmd.Flags()
+	flags.StringVarP(&name, "name", "n", "", "Name of the attribute to set")
+	flags.StringVarP(&value, "value", "v", "", "Value of the attribute, as text, or prefixed with 0x or 0s when hex or base64 encoded")
+	flags.StringVarP(&remove, "remove", "x", "", "Name of the attribute to remove")
+	return cmd
+}
+
+func newFsSnapshotCommand(opts *fsOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Manage the snapshots of directories",
+		Long:  `Manage the read-only snapshots of the snapshottable directories, which are browsed in DIR/.snapshot/NAME.`,
+	}
+	cmd.AddCommand(
+		newFsSubCommand(opts, "allow DIR", "Make a directory snapshottable, which only admins may", 1, 1, func(ctx context.Context, c *client.Client, args []string) error {
+			return c.AllowSnapshot(ctx, args[0])
+		}),
+		newFsSubCommand(opts, "disallow DIR", "Make a directory without snapshots not snapshottable", 1, 1, func(ctx context.Context, c *client.Client, args []string) error {
+			return c.DisallowSnapshot(ctx, args[0])
+		}),
+		newFsSubCommand(opts, "create DIR [NAME]", "Create a snapshot of a directory, named after the time by default", 1, 2, func(ctx context.Context, c *client.Client, args []string) error {
+			name := ""
+			if len(args) > 1 {
+				name = args[1]
+			}
+			p, err := c.CreateSnapshot(ctx, args[0], name)
+			if err != nil {
+				return err
+			}
+			resp := api.PathResponse{Path: p}
+			return opts.print(resp, func() {
+				fmt.Println(resp.Path)
+			})
+		}),
+		newFsSubCommand(opts, "delete DIR NAME", "Delete a snapshot of a directory", 2, 2, func(ctx context.Context, c *client.Client, args []string) error {
+			return c.DeleteSnapshot(ctx, args[0], args[1])
+		}),
+		newFsSubCommand(opts, "rename DIR OLD NEW", "Rename a snapshot of a directory", 3, 3, func(ctx context.Context, c *client.Client, args []string) error {
+			return c.RenameSnapshot(ctx, args[0], args[1], args[2])
+		}),
+		newFsSubCommand(opts, "diff DIR FROM TO", "Show the changes between two snapshots of a directory, \".\" being the current tree", 3, 3, func(ctx context.Context, c *client.Client, args []string) error {
+			from, to := args[1], args[2]
+			if from == "." {
+				from = ""
+			}
+			if to == "." {
+				to = ""
+			}
+			report, err := c.GetSnapshotDiff(ctx, args[0], from, to)
+			if err != nil {
+				return err
+			}
+			return opts.print(report, func() {
+				// the output of hdfs snapshotDiff
+				types := map[string]string{api.DiffCreate: "+", api.DiffModify: "M", api.DiffDelete: "-", api.DiffRename: "R"}
+				for _, d := range report.DiffList {
+					if d.Type == api.DiffRename {
+						fmt.Printf("%s\t./%s -> ./%s\n", types[d.Type], d.SourcePath, d.TargetPath)
+					} else {
+						fmt.Printf("%s\t./%s\n", types[d.Type], d.SourcePath)
+					}
+				}
+			})
+		}),
+	)
+	return cmd
+}
+
+func newFsVersionsCommand(opts *fsOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "versions",
+		Short: "Manage the versions of files",
+		Long:  `Manage the versioning of directory trees, whose files keep their previous contents as numbered versions when they are overwritten.`,
+	}
+	var disable bool
+	var maxVersions int
+	var maxAge int64
+	set := newFsSubCommand(opts, "set [--disable] [-n VERSIONS] [-a MINUTES] DIR", "Enable or disable the versioning of a directory tree", 1, 1, func(ctx context.Context, c *client.Client, args []string) error {
+		return c.SetVersioning(ctx, args[0], !disable, maxVersions, maxAge)
+	})
+	flags := set.Flags()
+	flags.BoolVar(&disable, "disable", false, "Disable the versioning of the tree")
+	flags.IntVarP(&maxVersions, "max-versions", "n", 0, "Maximum number of versions kept of a file, 0 for unlimited")
+	flags.Int64VarP(&maxAge, "max-age", "a", 0, "Maximum age in minutes of the versions kept, 0 for unlimited")
+	cmd.AddCommand(
+		set,
+		newFsSubCommand(opts, "inherit DIR", "Clear the versioning of a directory, which then inherits that of its parent", 1, 1, func(ctx context.Context, c *client.Client, args []string) error {
+			return c.ClearVersioning(ctx, args[0])
+		}),
+		newFsSubCommand(opts, "list FILE", "List the versions of a file, oldest first", 1, 1, func(ctx context.Context, c *client.Client, args []string) error {
+			versions, err := c.ListVersions(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			return opts.print(versions, func() {
+				for _, v := range versions {
+					fmt.Printf("%6d %12d %s %s\n", v.Version, v.Length,
+						time.Unix(0, v.ReplacedTime*int64(time.Millisecond)).Format("2006-01-02 15:04"), v.Checksum)
+				}
+			})
+		}),
+		newFsSubCommand(opts, "restore FILE VERSION", "Restore a version of a file, keeping its current content as a version", 2, 2, func(ctx context.Context, c *client.Client, args []string) error {
+			n, err := strconv.ParseInt(args[1], 10, 64)
+			if err != nil {
+				return fmt.Errorf("bad parameter: invalid version %q", args[1])
+			}
+			return c.RestoreVersion(ctx, args[0], n)
+		}),
+	)
+	return cmd
+}
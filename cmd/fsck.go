@@ -0,0 +1,65 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/client"
+	"github.com/spf13/cobra"
+)
+
+func newFsckCommand() *cobra.Command {
+	opts := &fsOptions{}
+	var repair bool
+	cmd := newFsSubCommand(opts, "fsck [--repair] NAMESPACE", "Check a namespace", 1, 1, func(ctx context.Context, c *client.Client, args []string) error {
+		report, err := c.Fsck(ctx, args[0], repair)
+		if err != nil {
+			return err
+		}
+		if err = opts.print(report, func() {
+			printFsckReport(report)
+		}); err != nil {
+			return err
+		}
+		if left := int64(len(report.Problems)) - report.Repaired; left > 0 {
+			return fmt.Errorf("namespace %s has %d problems left", report.Namespace, left)
+		}
+		return nil
+	})
+	cmd.Long = `Check that the metadata of a GoFS namespace is consistent and agrees with its bucket: the objects of the files exist with their size and MD5, the entries are linked to their directories, the inode numbers are unique, the hard links and their files refer to each other, and the summaries of the directories match their content. Only the admins may, with the bearer token of a service account of the admins group.`
+	flags := cmd.Flags()
+	flags.StringVar(&opts.endpoint, "endpoint", "http://127.0.0.1:9876", "Comma separated endpoints of the GoFS servers")
+	flags.BoolVar(&opts.json, "json", false, "Print the output as JSON")
+	flags.StringVar(&opts.token, "token", "", "Bearer token of a service account, defaults to $GOFS_TOKEN")
+	flags.BoolVar(&repair, "repair", false, "Repair the summaries, the parent links and the inode numbers")
+	return cmd
+}
+
+func printFsckReport(r *api.FsckReport) {
+	for _, pb := range r.Problems {
+		repaired := ""
+		if pb.Repaired {
+			repaired = " (repaired)"
+		}
+		fmt.Printf("%s: %s: %s%s\n", pb.Path, pb.Kind, pb.Message, repaired)
+	}
+	fmt.Printf("%s: %d files, %d directories, %d objects checked, %d problems, %d repaired\n",
+		r.Namespace, r.Files, r.Directories, r.Objects, len(r.Problems), r.Repaired)
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/client"
+	"github.com/spf13/cobra"
+)
+
+func newNamespaceCommand() *cobra.Command {
+	opts := &fsOptions{}
+	var cmd = &cobra.Command{
+		Use:   "namespace",
+		Short: "Manage the namespaces",
+		Long:  `Manage the GoFS namespaces, each bound to a bucket of an object storage. Only the admins may, with the bearer token of a service account of the admins group.`,
+	}
+	flags := cmd.PersistentFlags()
+	flags.StringVar(&opts.endpoint, "endpoint", "http://127.0.0.1:9876", "Comma separated endpoints of the GoFS servers")
+	flags.BoolVar(&opts.json, "json", false, "Print the output as JSON")
+	flags.StringVar(&opts.token, "token", "", "Bearer token of a service account, defaults to $GOFS_TOKEN")
+	cmd.AddCommand(
+		newNamespaceCreateCommand(opts),
+		newNamespaceLsCommand(opts),
+		newNamespaceRmCommand(opts),
+		newNamespaceGCCommand(opts),
+	)
+	return cmd
+}
+
+func newNamespaceCreateCommand(opts *fsOptions) *cobra.Command {
+	var (
+		cfg     api.Config
+		keyUid  int64
+		keyGids []string
+	)
+	cmd := newFsSubCommand(opts, "create ID", "Create a namespace", 1, 1, func(ctx context.Context, c *client.Client, args []string) error {
+		cfg.AccessKey = valueOrEnv(cfg.AccessKey, "GOFS_BUCKET_ACCESS_KEY")
+		cfg.SecretKey = valueOrEnv(cfg.SecretKey, "GOFS_BUCKET_SECRET_KEY")
+		if keyUid >= 0 {
+			uid := uint32(keyUid)
+			cfg.KeyUid = &uid
+		}
+		for _, g := range keyGids {
+			n, err := strconv.ParseUint(g, 10, 32)
+			if err != nil {
+				return fmt.Errorf("bad parameter: invalid gid %q", g)
+			}
+			cfg.KeyGids = append(cfg.KeyGids, uint32(n))
+		}
+		ns, err := c.CreateNamespace(ctx, args[0], &cfg)
+		if err != nil {
+			return err
+		}
+		return opts.print(ns, func() {
+			printNamespace(*ns)
+		})
+	})
+	flags := cmd.Flags()
+	flags.StringVar(&cfg.Endpoint, "storage-endpoint", "", "Address of the object storage, e.g. s3.amazonaws.com")
+	flags.StringVar(&cfg.Bucket, "bucket", "", "Bucket storing the data of the namespace")
+	flags.StringVar(&cfg.Location, "location", "", "Location of the bucket")
+	flags.StringVar(&cfg.AccessKey, "bucket-access-key", "", "Access key of the bucket, defaults to $GOFS_BUCKET_ACCESS_KEY")
+	flags.StringVar(&cfg.SecretKey, "bucket-secret-key", "", "Secret key of the bucket, defaults to $GOFS_BUCKET_SECRET_KEY")
+	flags.Int64Var(&cfg.TrashInterval, "trash-interval", 0, "Minutes the deleted files are kept in the trash, 0 to delete them at once")
+	flags.Int64Var(&keyUid, "key-uid", -1, "Uid the requests signed with the bucket keys act for, nobody if negative")
+	flags.StringSliceVar(&keyGids, "key-gids", nil, "Gids the requests signed with the bucket keys act for, the primary one first, nobody if empty")
+	flags.BoolVar(&cfg.TrustedKeys, "trusted-keys", false, "Let the requests signed with the bucket keys act for the local users of their host, as the FUSE clients do")
+	return cmd
+}
+
+func newNamespaceLsCommand(opts *fsOptions) *cobra.Command {
+	return newFsSubCommand(opts, "ls [ID...]", "List namespaces", 0, -1, func(ctx context.Context, c *client.Client, args []string) error {
+		var list []api.Namespace
+		if len(args) == 0 {
+			var err error
+			if list, err = c.ListNamespaces(ctx); err != nil {
+				return err
+			}
+		}
+		for _, id := range args {
+			ns, err := c.GetNamespace(ctx, id)
+			if err != nil {
+				return err
+			}
+			list = append(list, *ns)
+		}
+		return opts.print(list, func() {
+			for _, ns := range list {
+				printNamespace(ns)
+			}
+		})
+	})
+}
+
+func newNamespaceRmCommand(opts *fsOptions) *cobra.Command {
+	var force bool
+	cmd := newFsSubCommand(opts, "rm [-f] ID...", "Remove namespaces", 1, -1, func(ctx context.Context, c *client.Client, args []string) error {
+		for _, id := range args {
+			if err := c.DeleteNamespace(ctx, id, force); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "Remove the namespaces even if they have files, along with their data")
+	return cmd
+}
+
+func newNamespaceGCCommand(opts *fsOptions) *cobra.Command {
+	var dryRun, status bool
+	cmd := newFsSubCommand(opts, "gc [--dry-run|--status] ID", "Collect the orphaned objects of a namespace", 1, 1, func(ctx context.Context, c *client.Client, args []string) error {
+		if status {
+			s, err := c.GCStatus(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			return opts.print(s, func() {
+				fmt.Printf("runs: %d, deleted: %d (%d bytes), failed: %d\n", s.Runs, s.Deleted, s.DeletedSize, s.Failed)
+				if s.LastRun != nil {
+					printGCReport(s.LastRun)
+				}
+			})
+		}
+		report, err := c.CollectGarbage(ctx, args[0], dryRun)
+		if err != nil {
+			return err
+		}
+		return opts.print(report, func() {
+			printGCReport(report)
+		})
+	})
+	flags := cmd.Flags()
+	flags.BoolVar(&dryRun, "dry-run", false, "Only report the orphaned objects")
+	flags.BoolVar(&status, "status", false, "Print the statistics of the collections instead")
+	return cmd
+}
+
+func printGCReport(r *api.GCReport) {
+	fmt.Printf("listed: %d, referenced: %d, young: %d, orphaned: %d (%d bytes), deleted: %d, failed: %d\n",
+		r.Listed, r.Referenced, r.Young, r.Orphaned, r.OrphanedSize, r.Deleted, r.Failed)
+	for _, key := range r.Objects {
+		fmt.Println(key)
+	}
+	if r.Error != "" {
+		fmt.Printf("error: %s\n", r.Error)
+	}
+}
+
+func printNamespace(ns api.Namespace) {
+	fmt.Printf("%-24s %-32s %s\n", ns.ID, ns.Bucket, ns.Endpoint)
+}
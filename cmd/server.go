@@ -17,15 +17,19 @@ limitations under the License.
 package cmd
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"strings"
 	"syscall"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/gostor/gofs/pkg/apiserver"
+	"github.com/gostor/gofs/pkg/auth"
 	"github.com/gostor/gofs/pkg/master"
 	"github.com/spf13/cobra"
 )
@@ -35,22 +39,54 @@ func newServerCommand() *cobra.Command {
 	var driver string
 	var logLevel string
 	var peers string
+	var opts serverOptions
 	var cmd = &cobra.Command{
 		Use:   "server",
 		Short: "Setup a server",
 		Long:  `Setup the GoFS's metadata server`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return createDaemon(host, driver, logLevel, peers)
+			return createDaemon(host, driver, logLevel, peers, &opts)
 		},
 	}
 	flags := cmd.Flags()
 	flags.StringVar(&logLevel, "log", "info", "Log level")
 	flags.StringVar(&host, "host", "tcp://127.0.0.1:9876", "Host for GoFS server")
 	flags.StringVar(&peers, "join", "", "Peers")
+	flags.BoolVar(&opts.accessLog, "access-log", true, "Log every API request")
+	flags.BoolVar(&opts.enableCors, "api-enable-cors", false, "Enable CORS headers in the API")
+	flags.StringVar(&opts.corsHeaders, "api-cors-header", "", "Set CORS headers in the API")
+	flags.Int64Var(&opts.maxRequestBodySize, "max-request-body-size", 1<<20, "Maximum size in bytes of the metadata request bodies, 0 for no limit")
+	flags.BoolVar(&opts.auth, "auth", true, "Authenticate the API requests")
+	flags.StringVar(&opts.clusterSecret, "cluster-secret", "", "Secret shared by the raft peers, which they authenticate each other with, defaults to $GOFS_CLUSTER_SECRET")
+	flags.StringVar(&opts.tokenFile, "token-file", "", "CSV file of the service account tokens, with lines token,name[,group...], the admins group administering the cluster")
+	flags.StringSliceVar(&opts.authzPlugins, "authorization-plugin", nil, "Authorization plugins, e.g. policy=<file> or webhook=<url>")
+	flags.Int64Var(&opts.maxFileSize, "max-file-size", 0, "Maximum size in bytes of the uploaded files, 0 for no limit")
+	flags.DurationVar(&opts.gc.Interval, "gc-interval", time.Hour, "Interval between the collections of the orphaned objects, 0 to disable them")
+	flags.DurationVar(&opts.gc.GracePeriod, "gc-grace-period", 24*time.Hour, "Minimum age of the orphaned objects collected, to spare the uploads in progress")
+	flags.IntVar(&opts.gc.DeleteRate, "gc-delete-rate", 100, "Maximum number of orphaned objects deleted per second, 0 for no limit")
+	flags.BoolVar(&opts.gc.DryRun, "gc-dry-run", false, "Only report the orphaned objects found by the periodic collections")
+	flags.DurationVar(&opts.compaction.Interval, "compact-interval", 10*time.Minute, "Interval between the compactions of the files appended to, 0 to disable them")
+	flags.DurationVar(&opts.compaction.QuietPeriod, "compact-quiet-period", time.Hour, "Time since their last modification after which the files are compacted")
+	flags.Int64Var(&opts.compaction.SegmentSize, "compact-segment-size", 64<<20, "Size in bytes below which the segments of the files are merged")
 	return cmd
 }
 
-func createDaemon(host, driver, level, peers string) error {
+// serverOptions are the options of the API server.
+type serverOptions struct {
+	accessLog          bool
+	enableCors         bool
+	corsHeaders        string
+	maxRequestBodySize int64
+	maxFileSize        int64
+	auth               bool
+	clusterSecret      string
+	tokenFile          string
+	authzPlugins       []string
+	gc                 master.GCConfig
+	compaction         master.CompactionConfig
+}
+
+func createDaemon(host, driver, level, peers string, opts *serverOptions) error {
 	switch level {
 	case "info":
 		log.SetLevel(log.InfoLevel)
@@ -68,7 +104,13 @@ func createDaemon(host, driver, level, peers string) error {
 		hosts = append(hosts, host)
 	}
 	serverConfig := &apiserver.Config{
-		Addrs: []apiserver.Addr{},
+		Logging:                  opts.accessLog,
+		EnableCors:               opts.enableCors,
+		CorsHeaders:              opts.corsHeaders,
+		MaxRequestBodySize:       opts.maxRequestBodySize,
+		MaxFileSize:              opts.maxFileSize,
+		AuthorizationPluginNames: opts.authzPlugins,
+		Addrs:                    []apiserver.Addr{},
 	}
 	for _, protoAddr := range hosts {
 		protoAddrParts := strings.SplitN(protoAddr, "://", 2)
@@ -80,28 +122,70 @@ func createDaemon(host, driver, level, peers string) error {
 		serverConfig.Addrs = append(serverConfig.Addrs, apiserver.Addr{Proto: protoAddrParts[0], Addr: protoAddrParts[1]})
 	}
 
+	if len(serverConfig.Addrs) == 0 {
+		err := fmt.Errorf("no host to serve the API")
+		log.Error(err)
+		return err
+	}
+
 	s, err := apiserver.New(serverConfig)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
 	os.Mkdir(filepath.Join(os.TempDir(), "gofs"), 0700)
+	clusterSecret := valueOrEnv(opts.clusterSecret, "GOFS_CLUSTER_SECRET")
+	if opts.auth && clusterSecret == "" {
+		if peers != "" {
+			err = fmt.Errorf("the raft peers need a --cluster-secret to join each other with the authentication enabled")
+			log.Error(err)
+			return err
+		}
+		// a secret no peer shares keeps them all out
+		b := make([]byte, 32)
+		if _, err = rand.Read(b); err != nil {
+			log.Error(err)
+			return err
+		}
+		clusterSecret = hex.EncodeToString(b)
+		log.Warning("No cluster secret is set, no raft peer can join the server")
+	}
+	// raft peers and clients reach the server by the address without the protocol
+	addr := serverConfig.Addrs[0].Addr
 	cfg := master.MasterConfig{
-		Peers:       strings.Split(peers, ","),
-		HttpAddr:    host,
-		DataDir:     filepath.Join(os.TempDir(), "gofs"),
-		PuleSeconds: 2,
-		Name:        host,
-		Router:      s.GetMuxRouter(),
-		HttpServers: s.GetHttpServer(),
-		CacheType:   "memory",
-		CacheDir:    filepath.Join(os.TempDir(), "gofs", "cache"),
+		Peers:         strings.Split(peers, ","),
+		HttpAddr:      addr,
+		DataDir:       filepath.Join(os.TempDir(), "gofs"),
+		PuleSeconds:   2,
+		Name:          addr,
+		Router:        s.GetMuxRouter(),
+		HttpServers:   s.GetHttpServer(),
+		ClusterSecret: clusterSecret,
+		CacheType:     "memory",
+		CacheDir:      filepath.Join(os.TempDir(), "gofs", "cache"),
+		GC:            opts.gc,
+		Compaction:    opts.compaction,
 	}
 	master, err := master.NewMaster(&cfg)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
+	if opts.auth {
+		var tokens auth.TokenStore
+		if opts.tokenFile != "" {
+			if tokens, err = auth.LoadTokenFile(opts.tokenFile); err != nil {
+				log.Error(err)
+				return err
+			}
+		}
+		serverConfig.Authenticator = auth.NewAuthenticator(master, tokens)
+		serverConfig.ClusterSecret = clusterSecret
+	}
+	if err = s.InitMiddlewares(); err != nil {
+		log.Error(err)
+		return err
+	}
 	s.InitRouters(master)
 	// The serve API routine never exits unless an error occurs
 	// We need to start it as a goroutine and wait on it so
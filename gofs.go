@@ -26,6 +26,6 @@ import (
 func main() {
 	if err := cmd.NewCommand().Execute(); err != nil {
 		fmt.Println(err)
-		os.Exit(-1)
+		os.Exit(cmd.ExitCode(err))
 	}
 }
@@ -0,0 +1,20 @@
+package api
+
+// The algorithms of the checksums returned by GETFILECHECKSUM. The CRC32C of
+// the whole file is the composite CRC of HDFS, which does not depend on the
+// block size, and is returned by default. MD5 and SHA-256 are GoFS
+// extensions, selected with the algorithm parameter.
+const (
+	ChecksumCompositeCRC32C = "COMPOSITE-CRC32C"
+	ChecksumMD5             = "MD5"
+	ChecksumSHA256          = "SHA-256"
+)
+
+// The headers of the OPEN responses which carry the checksums of the
+// content, so that the clients may verify it: the base64 MD5 of RFC 1864,
+// and the hex CRC32C and SHA-256.
+const (
+	ContentMD5Header     = "Content-MD5"
+	ChecksumCRC32CHeader = "X-Gofs-Checksum-Crc32c"
+	ChecksumSHA256Header = "X-Gofs-Checksum-Sha256"
+)
@@ -130,6 +130,9 @@ type CreateRequest struct {
 	Mode  os.FileMode
 	// Umask of the request. Not supported on OS X.
 	Umask os.FileMode
+	// Uid and Gid of the caller, who owns the new file.
+	Uid uint32
+	Gid uint32
 }
 
 type MkdirRequest struct {
@@ -137,6 +140,9 @@ type MkdirRequest struct {
 	Mode os.FileMode
 	// Umask of the request. Not supported on OS X.
 	Umask os.FileMode
+	// Uid and Gid of the caller, who owns the new directory.
+	Uid uint32
+	Gid uint32
 }
 
 // The ReleaseFlags are used in the Release exchange.
@@ -169,6 +175,9 @@ type RemoveRequest struct {
 type SymlinkRequest struct {
 	NewName string
 	Target  string
+	// Uid and Gid of the caller, who owns the new symlink.
+	Uid uint32
+	Gid uint32
 }
 
 // A LinkRequest is a request to create a hard link.
@@ -197,3 +206,56 @@ type FsyncRequest struct {
 	Flags uint32
 	Dir   bool
 }
+
+// A GetxattrRequest asks for the extended attributes associated with r.Node.
+type GetxattrRequest struct {
+	// Name of the attribute requested.
+	Name string
+}
+
+// A GetxattrResponse is the response to a GetxattrRequest.
+type GetxattrResponse struct {
+	Xattr []byte
+}
+
+// A ListxattrRequest asks to list the extended attributes associated with r.Node.
+type ListxattrRequest struct {
+}
+
+// A ListxattrResponse is the response to a ListxattrRequest.
+type ListxattrResponse struct {
+	// The names of the attributes, each followed by a NUL byte.
+	Xattr []byte
+}
+
+// Append adds an extended attribute name to the response.
+func (r *ListxattrResponse) Append(names ...string) {
+	for _, name := range names {
+		r.Xattr = append(r.Xattr, name...)
+		r.Xattr = append(r.Xattr, '\x00')
+	}
+}
+
+// The flags of a SetxattrRequest, as in setxattr(2).
+const (
+	// XattrCreate fails if the attribute already exists.
+	XattrCreate = 1 << 0
+	// XattrReplace fails if the attribute does not exist.
+	XattrReplace = 1 << 1
+)
+
+// A SetxattrRequest asks to set an extended attribute associated with a file.
+type SetxattrRequest struct {
+	// Flags can make the request fail if attribute does/not already
+	// exist. Unfortunately, the constants are platform-specific and
+	// not exposed by Go1.2. Look for XATTR_CREATE, XATTR_REPLACE.
+	Flags uint32
+
+	Name  string
+	Xattr []byte
+}
+
+// A RemovexattrRequest asks to remove an extended attribute associated with r.Node.
+type RemovexattrRequest struct {
+	Name string // name of extended attribute
+}
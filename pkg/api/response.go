@@ -20,3 +20,329 @@ type RaftClusterStatusResponse struct {
 	Leader   string
 	Peers    []string
 }
+
+// VersionResponse is returned by GET /version.
+type VersionResponse struct {
+	Version       string
+	APIVersion    string
+	MinAPIVersion string
+	GoVersion     string
+	Os            string
+	Arch          string
+}
+
+// Namespace describes a namespace, without its secret key.
+type Namespace struct {
+	ID        string
+	Bucket    string
+	Location  string
+	Endpoint  string
+	AccessKey string
+	// TrashInterval is the number of minutes the deleted files are kept
+	// in the trash.
+	TrashInterval int64
+	// KeyUid, KeyGids and TrustedKeys are the identity the requests signed
+	// with the keys of the namespace act for, see Config.
+	KeyUid      *uint32  `json:",omitempty"`
+	KeyGids     []uint32 `json:",omitempty"`
+	TrustedKeys bool     `json:",omitempty"`
+}
+
+// NamespacesResponse is returned by GET /namespaces.
+type NamespacesResponse struct {
+	Namespaces []Namespace
+}
+
+// GCReport is the report of a collection of the orphaned objects of a
+// namespace, those of its bucket which no file refers to. The times are in
+// milliseconds.
+type GCReport struct {
+	Namespace string
+	DryRun    bool
+	Started   int64
+	Finished  int64
+	// Listed are the objects listed, Referenced those the files refer to,
+	// and Young the orphans kept since they are within the grace period,
+	// which may be uploads in flight.
+	Listed     int64
+	Referenced int64
+	Young      int64
+	// Orphaned are the orphans past the grace period, which are deleted
+	// unless DryRun is set.
+	Orphaned     int64
+	OrphanedSize int64
+	Deleted      int64
+	DeletedSize  int64
+	Failed       int64
+	// Objects are the keys of the orphans, reported by a dry run.
+	Objects []string `json:",omitempty"`
+	Error   string   `json:",omitempty"`
+}
+
+// GCStatusResponse is returned by GET /namespaces/{id}/gc, with the totals
+// of the collections run by the server.
+type GCStatusResponse struct {
+	Runs        int64
+	Deleted     int64
+	DeletedSize int64
+	Failed      int64
+	LastRun     *GCReport `json:",omitempty"`
+}
+
+// FsckReport is the report of a consistency check of the metadata of a
+// namespace against its bucket. The times are in milliseconds.
+type FsckReport struct {
+	Namespace   string
+	Repair      bool
+	Started     int64
+	Finished    int64
+	Files       int64
+	Directories int64
+	Objects     int64
+	Problems    []FsckProblem `json:",omitempty"`
+	Repaired    int64
+}
+
+// FsckProblem is an inconsistency found by a consistency check.
+type FsckProblem struct {
+	Path     string
+	Kind     string
+	Message  string
+	Repaired bool `json:",omitempty"`
+}
+
+// Kinds of the problems found by a consistency check.
+const (
+	// the object of a file or of one of its versions is missing
+	FsckMissingObject = "MISSING_OBJECT"
+	// the size of an object differs from the size of its file
+	FsckSizeMismatch = "SIZE_MISMATCH"
+	// the ETag of an object differs from the MD5 of its file
+	FsckETagMismatch = "ETAG_MISMATCH"
+	// an entry is not linked to the directory it is listed in
+	FsckBrokenParent = "BROKEN_PARENT"
+	// several files have the same inode number
+	FsckDuplicateInode = "DUPLICATE_INODE"
+	// a hard link and the file it refers to disagree
+	FsckBrokenLink = "BROKEN_LINK"
+	// the summary of a directory differs from its content
+	FsckSummaryMismatch = "SUMMARY_MISMATCH"
+)
+
+// File types reported in FileStatus.Type.
+const (
+	FileTypeFile      = "FILE"
+	FileTypeDirectory = "DIRECTORY"
+	FileTypeSymlink   = "SYMLINK"
+)
+
+// FileStatus is the WebHDFS representation of a file or directory.
+type FileStatus struct {
+	AccessTime       int64  `json:"accessTime"`
+	BlockSize        int64  `json:"blockSize"`
+	ChildrenNum      int    `json:"childrenNum"`
+	FileID           uint64 `json:"fileId"`
+	Group            string `json:"group"`
+	Length           int64  `json:"length"`
+	ModificationTime int64  `json:"modificationTime"`
+	Owner            string `json:"owner"`
+	PathSuffix       string `json:"pathSuffix"`
+	Permission       string `json:"permission"`
+	Replication      int    `json:"replication"`
+	Type             string `json:"type"`
+	ACLBit           bool   `json:"aclBit,omitempty"`
+	Symlink          string `json:"symlink,omitempty"`
+}
+
+// FileStatusResponse is returned by GETFILESTATUS.
+type FileStatusResponse struct {
+	FileStatus FileStatus `json:"FileStatus"`
+}
+
+// FileStatuses is a list of FileStatus.
+type FileStatuses struct {
+	FileStatus []FileStatus `json:"FileStatus"`
+}
+
+// FileStatusesResponse is returned by LISTSTATUS.
+type FileStatusesResponse struct {
+	FileStatuses FileStatuses `json:"FileStatuses"`
+}
+
+// DirectoryListing is one batch of the entries of a directory.
+type DirectoryListing struct {
+	PartialListing   FileStatusesResponse `json:"partialListing"`
+	RemainingEntries int                  `json:"remainingEntries"`
+}
+
+// DirectoryListingResponse is returned by LISTSTATUS_BATCH.
+type DirectoryListingResponse struct {
+	DirectoryListing DirectoryListing `json:"DirectoryListing"`
+}
+
+// ContentSummary is the space usage of a directory tree.
+type ContentSummary struct {
+	DirectoryCount int64 `json:"directoryCount"`
+	FileCount      int64 `json:"fileCount"`
+	Length         int64 `json:"length"`
+	Quota          int64 `json:"quota"`
+	SpaceConsumed  int64 `json:"spaceConsumed"`
+	SpaceQuota     int64 `json:"spaceQuota"`
+}
+
+// ContentSummaryResponse is returned by GETCONTENTSUMMARY.
+type ContentSummaryResponse struct {
+	ContentSummary ContentSummary `json:"ContentSummary"`
+}
+
+// FileChecksum is the checksum of the content of a file, in hex.
+type FileChecksum struct {
+	Algorithm string `json:"algorithm"`
+	Bytes     string `json:"bytes"`
+	Length    int    `json:"length"`
+}
+
+// FileChecksumResponse is returned by GETFILECHECKSUM.
+type FileChecksumResponse struct {
+	FileChecksum FileChecksum `json:"FileChecksum"`
+}
+
+// QuotaUsage is the usage of a directory tree, and its quota. The quotas
+// are -1 when unset.
+type QuotaUsage struct {
+	FileAndDirectoryCount int64 `json:"fileAndDirectoryCount"`
+	Quota                 int64 `json:"quota"`
+	SpaceConsumed         int64 `json:"spaceConsumed"`
+	SpaceQuota            int64 `json:"spaceQuota"`
+}
+
+// QuotaUsageResponse is returned by GETQUOTAUSAGE.
+type QuotaUsageResponse struct {
+	QuotaUsage QuotaUsage `json:"QuotaUsage"`
+}
+
+// ACLStatus is the ACL of a file or directory. Its entries exclude those
+// represented by the permission bits.
+type ACLStatus struct {
+	Entries    []string `json:"entries"`
+	Group      string   `json:"group"`
+	Owner      string   `json:"owner"`
+	Permission string   `json:"permission"`
+	StickyBit  bool     `json:"stickyBit"`
+}
+
+// ACLStatusResponse is returned by GETACLSTATUS.
+type ACLStatusResponse struct {
+	ACLStatus ACLStatus `json:"AclStatus"`
+}
+
+// XAttr is an extended attribute, whose value is encoded as requested.
+type XAttr struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// XAttrsResponse is returned by GETXATTRS.
+type XAttrsResponse struct {
+	XAttrs []XAttr `json:"XAttrs"`
+}
+
+// XAttrNamesResponse is returned by LISTXATTRS. As in WebHDFS, XAttrNames is
+// the JSON encoded array of the names.
+type XAttrNamesResponse struct {
+	XAttrNames string `json:"XAttrNames"`
+}
+
+// PathResponse is returned by GETTRASHROOT and CREATESNAPSHOT.
+type PathResponse struct {
+	Path string `json:"Path"`
+}
+
+// The types of the entries of a snapshot diff report.
+const (
+	DiffCreate = "CREATE"
+	DiffModify = "MODIFY"
+	DiffDelete = "DELETE"
+	DiffRename = "RENAME"
+)
+
+// DiffReportEntry is a path which changed between two snapshots. The paths
+// are relative to the snapshottable directory, and TargetPath is the new
+// path of a renamed file.
+type DiffReportEntry struct {
+	SourcePath string `json:"sourcePath"`
+	TargetPath string `json:"targetPath,omitempty"`
+	Type       string `json:"type"`
+}
+
+// SnapshotDiffReport lists the changes from the snapshot FromSnapshot to
+// ToSnapshot of the directory SnapshotRoot. An empty snapshot name is the
+// current tree.
+type SnapshotDiffReport struct {
+	DiffList     []DiffReportEntry `json:"diffList"`
+	SnapshotRoot string            `json:"snapshotRoot"`
+	FromSnapshot string            `json:"fromSnapshot"`
+	ToSnapshot   string            `json:"toSnapshot"`
+}
+
+// SnapshotDiffReportResponse is returned by GETSNAPSHOTDIFF.
+type SnapshotDiffReportResponse struct {
+	SnapshotDiffReport SnapshotDiffReport `json:"SnapshotDiffReport"`
+}
+
+// FileVersion is a previous content of a file, kept when it was
+// overwritten at ReplacedTime. The times are in milliseconds.
+type FileVersion struct {
+	Version          int64  `json:"version"`
+	Length           int64  `json:"length"`
+	ModificationTime int64  `json:"modificationTime"`
+	ReplacedTime     int64  `json:"replacedTime"`
+	Checksum         string `json:"checksum,omitempty"`
+}
+
+// FileVersions are the versions of a file, oldest first.
+type FileVersions struct {
+	FileVersion []FileVersion `json:"FileVersion"`
+}
+
+// FileVersionsResponse is returned by LISTVERSIONS.
+type FileVersionsResponse struct {
+	FileVersions FileVersions `json:"FileVersions"`
+}
+
+// Chunk is a chunk of a large file uploaded by UPLOADCHUNK, a GoFS
+// extension, before COMMITCHUNKS makes it a part of the file. MD5 is the MD5
+// of its content, in hex.
+type Chunk struct {
+	Object string `json:"object"`
+	Length int64  `json:"length"`
+	MD5    string `json:"md5"`
+}
+
+// ChunkResponse is returned by UPLOADCHUNK.
+type ChunkResponse struct {
+	Chunk Chunk `json:"Chunk"`
+}
+
+// Chunks are the chunks of a file, in order, which COMMITCHUNKS takes as its
+// request body.
+type Chunks struct {
+	Chunk []Chunk `json:"Chunk"`
+}
+
+// BooleanResponse is returned by MKDIRS, RENAME and DELETE.
+type BooleanResponse struct {
+	Boolean bool `json:"boolean"`
+}
+
+// RemoteException describes an error returned by the metadata API.
+type RemoteException struct {
+	Exception     string `json:"exception"`
+	JavaClassName string `json:"javaClassName"`
+	Message       string `json:"message"`
+}
+
+// RemoteExceptionResponse is the body of every failed request.
+type RemoteExceptionResponse struct {
+	RemoteException RemoteException `json:"RemoteException"`
+}
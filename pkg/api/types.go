@@ -5,19 +5,60 @@ type Config struct {
 	Location  string
 	AccessKey string
 	SecretKey string
+	// Endpoint is the address of the object storage serving the bucket.
+	Endpoint string
+	// TrashInterval is the number of minutes the deleted files are kept in
+	// the trash before they are expunged. The files are deleted at once if
+	// it is 0.
+	TrashInterval int64
+	// KeyUid and KeyGids are the POSIX identity the requests signed with
+	// the keys of the namespace act for, the primary gid first. They act for
+	// nobody if KeyUid is nil.
+	KeyUid  *uint32
+	KeyGids []uint32
+	// TrustedKeys lets the requests signed with the keys of the namespace
+	// act for the local users of their host, like the FUSE clients do.
+	TrustedKeys bool
 }
 
 const (
 	// GET operation
 	OpsGetFileStatus = "GETFILESTATUS"
 	OpsListStatus    = "LISTSTATUS"
+	// List a Directory in batches
+	OpsListStatusBatch = "LISTSTATUS_BATCH"
+	// Open and Read a File
+	OpsOpen = "OPEN"
 	// Get Content Summary of a Directory
 	OpsGetContentSummary = "GETCONTENTSUMMARY"
 	// Get File Checksum
 	OpsGetFileChecksum = "GETFILECHECKSUM"
+	// Get ACL Status
+	OpsGetACLStatus = "GETACLSTATUS"
+	// Get XAttrs
+	OpsGetXAttrs = "GETXATTRS"
+	// List all XAttrs
+	OpsListXAttrs = "LISTXATTRS"
+	// Get Quota Usage
+	OpsGetQuotaUsage = "GETQUOTAUSAGE"
+	// Get Trash Root
+	OpsGetTrashRoot = "GETTRASHROOT"
+	// Get Snapshot Diff, SNAPSHOTDIFF is accepted as well
+	OpsGetSnapshotDiff = "GETSNAPSHOTDIFF"
+	OpsSnapshotDiff    = "SNAPSHOTDIFF"
+	// List the Versions of a File, a GoFS extension
+	OpsListVersions = "LISTVERSIONS"
 
 	// DELETE operation
 	OpsDelete = "DELETE"
+	// Delete Snapshot
+	OpsDeleteSnapshot = "DELETESNAPSHOT"
+
+	// POST operation
+	// Append to a File
+	OpsAppend = "APPEND"
+	// Truncate a File
+	OpsTruncate = "TRUNCATE"
 
 	// PUT operation
 	// Create and Write to a File
@@ -28,6 +69,59 @@ const (
 	OpsRename = "RENAME"
 	// Set Permission
 	OpsSetPermission = "SETPERMISSION"
+	// Set Owner
+	OpsSetOwner = "SETOWNER"
 	// Set Access or Modification Time
 	OpsSetTimes = "SETTIMES"
+	// Set ACL
+	OpsSetACL = "SETACL"
+	// Modify ACL Entries
+	OpsModifyACLEntries = "MODIFYACLENTRIES"
+	// Remove ACL Entries
+	OpsRemoveACLEntries = "REMOVEACLENTRIES"
+	// Remove Default ACL
+	OpsRemoveDefaultACL = "REMOVEDEFAULTACL"
+	// Remove ACL
+	OpsRemoveACL = "REMOVEACL"
+	// Set XAttr
+	OpsSetXAttr = "SETXATTR"
+	// Remove XAttr
+	OpsRemoveXAttr = "REMOVEXATTR"
+	// Create a Symbolic Link
+	OpsCreateSymlink = "CREATESYMLINK"
+	// Create a Hard Link, a GoFS extension
+	OpsCreateHardLink = "CREATEHARDLINK"
+	// Set Quota
+	OpsSetQuota = "SETQUOTA"
+	// Clear Quota, a GoFS extension
+	OpsClearQuota = "CLRQUOTA"
+	// Repair the Content Summary of a Directory, a GoFS extension
+	OpsRepairContentSummary = "REPAIRCONTENTSUMMARY"
+	// Create Snapshot
+	OpsCreateSnapshot = "CREATESNAPSHOT"
+	// Rename Snapshot
+	OpsRenameSnapshot = "RENAMESNAPSHOT"
+	// Allow and Disallow Snapshots of a Directory
+	OpsAllowSnapshot    = "ALLOWSNAPSHOT"
+	OpsDisallowSnapshot = "DISALLOWSNAPSHOT"
+	// Set the Versioning of a Directory, a GoFS extension
+	OpsSetVersioning = "SETVERSIONING"
+	// Restore a Version of a File, a GoFS extension
+	OpsRestoreVersion = "RESTOREVERSION"
+	// Upload a Chunk of a File, and Create the File from its Chunks, GoFS
+	// extensions
+	OpsUploadChunk  = "UPLOADCHUNK"
+	OpsCommitChunks = "COMMITCHUNKS"
+
+	// The namespace operations, only replicated through raft
+	OpsCreateNamespace = "CREATENAMESPACE"
+	OpsDeleteNamespace = "DELETENAMESPACE"
+	// Prune the expired versions of a file, only replicated through raft
+	OpsPruneVersions = "PRUNEVERSIONS"
+	// Repairs of the metadata found inconsistent by fsck, only replicated
+	// through raft
+	OpsRepairParent = "REPAIRPARENT"
+	OpsRenumber     = "RENUMBER"
+	// Merge the small segments of a file, only replicated through raft
+	OpsCompact = "COMPACT"
 )
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// The encodings of the values of the extended attributes in WebHDFS.
+const (
+	XAttrEncodingText   = "text"
+	XAttrEncodingHex    = "hex"
+	XAttrEncodingBase64 = "base64"
+)
+
+// The values of the flag parameter of SETXATTR.
+const (
+	XAttrFlagCreate  = "CREATE"
+	XAttrFlagReplace = "REPLACE"
+)
+
+// EncodeXAttrValue encodes the value of an extended attribute: a quoted
+// string with the text encoding, and prefixed with 0x or 0s with the hex and
+// base64 encodings.
+func EncodeXAttrValue(v []byte, encoding string) (string, error) {
+	switch strings.ToLower(encoding) {
+	case "", XAttrEncodingText:
+		return `"` + string(v) + `"`, nil
+	case XAttrEncodingHex:
+		return "0x" + hex.EncodeToString(v), nil
+	case XAttrEncodingBase64:
+		return "0s" + base64.StdEncoding.EncodeToString(v), nil
+	}
+	return "", fmt.Errorf("invalid encoding %q", encoding)
+}
+
+// DecodeXAttrValue decodes a value encoded by EncodeXAttrValue. A value
+// which is neither quoted nor prefixed is a plain string.
+func DecodeXAttrValue(s string) ([]byte, error) {
+	if len(s) >= 2 {
+		switch strings.ToLower(s[:2]) {
+		case "0x":
+			return hex.DecodeString(s[2:])
+		case "0s":
+			return base64.StdEncoding.DecodeString(s[2:])
+		}
+		if s[0] == '"' && s[len(s)-1] == '"' {
+			return []byte(s[1 : len(s)-1]), nil
+		}
+	}
+	return []byte(s), nil
+}
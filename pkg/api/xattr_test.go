@@ -0,0 +1,29 @@
+package api
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestXAttrValue(t *testing.T) {
+	v := []byte("gofs\x00")
+	for _, encoding := range []string{XAttrEncodingText, XAttrEncodingHex, XAttrEncodingBase64} {
+		s, err := EncodeXAttrValue(v, encoding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := DecodeXAttrValue(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(d, v) {
+			t.Fatalf("%s: expected %q, got %q from %s", encoding, v, d, s)
+		}
+	}
+	if d, _ := DecodeXAttrValue("plain"); string(d) != "plain" {
+		t.Fatalf("unexpected value %q", d)
+	}
+	if _, err := EncodeXAttrValue(v, "rot13"); err == nil {
+		t.Fatal("expected an error for an unknown encoding")
+	}
+}
@@ -18,6 +18,7 @@ limitations under the License.
 package apiserver
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"net"
@@ -30,11 +31,15 @@ import (
 	"github.com/docker/go-connections/sockets"
 	"github.com/gorilla/mux"
 	"github.com/gostor/gofs/pkg/apiserver/httputils"
+	"github.com/gostor/gofs/pkg/apiserver/middleware"
 	"github.com/gostor/gofs/pkg/apiserver/router"
 	"github.com/gostor/gofs/pkg/apiserver/router/metadata"
+	"github.com/gostor/gofs/pkg/apiserver/router/namespace"
 	raftrouter "github.com/gostor/gofs/pkg/apiserver/router/raft"
+	"github.com/gostor/gofs/pkg/apiserver/router/system"
+	"github.com/gostor/gofs/pkg/auth"
+	"github.com/gostor/gofs/pkg/authorization"
 	"github.com/gostor/gofs/pkg/master"
-	"golang.org/x/net/context"
 )
 
 // versionMatcher defines a variable matcher to be parsed by the router
@@ -52,6 +57,16 @@ type Config struct {
 	TLSConfig                *tls.Config
 	Addrs                    []Addr
 	APIrouter                string
+	// MaxRequestBodySize limits the body of the metadata requests, 0 for no limit.
+	MaxRequestBodySize int64
+	// MaxFileSize limits the content of the uploaded files, 0 for no limit.
+	MaxFileSize int64
+	// Authenticator authenticates the requests, which are all accepted if
+	// it is nil.
+	Authenticator auth.Authenticator
+	// ClusterSecret authenticates the requests of the raft peers along with
+	// the Authenticator.
+	ClusterSecret string
 }
 
 // Addr contains string representation of address and its protocol (tcp, unix...).
@@ -66,6 +81,7 @@ type Server struct {
 	servers       []*HTTPServer
 	routers       []router.Router
 	routerSwapper *routerSwapper
+	middlewares   []middleware.Middleware
 }
 
 // New returns a new instance of the server based on the specified configuration.
@@ -73,6 +89,9 @@ type Server struct {
 func New(cfg *Config) (*Server, error) {
 	s := &Server{
 		cfg: cfg,
+		routerSwapper: &routerSwapper{
+			router: mux.NewRouter(),
+		},
 	}
 	for _, addr := range cfg.Addrs {
 		srv, err := s.newServer(addr.Proto, addr.Addr)
@@ -154,16 +173,17 @@ func (s *Server) initTCPSocket(addr string) (l net.Listener, err error) {
 func (s *Server) makeHTTPHandler(handler httputils.APIFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// log the handler call
-		log.Infof("Calling %s %s", r.Method, r.URL.Path)
+		log.Debugf("Calling %s %s", r.Method, r.URL.Path)
 
 		// Define the context that we'll pass around to share info
-		// like the docker-request-id.
+		// like the request id.
 		//
 		// The 'context' will be used for global data that should
 		// apply to all requests. Data that is specific to the
 		// immediate function being called should still be passed
-		// as 'args' on the function call.
-		ctx := context.Background()
+		// as 'args' on the function call. It is canceled when the
+		// client goes away.
+		ctx := r.Context()
 		handlerFunc := s.handleWithGlobalMiddlewares(handler)
 
 		vars := mux.Vars(r)
@@ -172,18 +192,26 @@ func (s *Server) makeHTTPHandler(handler httputils.APIFunc) http.HandlerFunc {
 		}
 
 		if err := handlerFunc(ctx, w, r, vars); err != nil {
-			log.Errorf("Handler for %s %s returned error: %v", r.Method, r.URL.Path, err)
+			if ctx.Err() == context.Canceled {
+				log.Debugf("Handler for %s %s canceled: %v", r.Method, r.URL.Path, err)
+				return
+			}
+			log.WithField("request_id", httputils.RequestIDFromContext(ctx)).Errorf("Handler for %s %s returned error: %v", r.Method, r.URL.Path, err)
 			httputils.WriteError(w, err)
 		}
 	}
 }
 
 // InitRouters initializes a list of routers for the server.
+// The metadata router matches every path, so it must be added last.
 func (s *Server) InitRouters(master *master.Master) {
-	s.addRouter(metadata.NewRouter(master))
+	s.addRouter(system.NewRouter())
 	if master.RaftServer != nil {
 		s.addRouter(raftrouter.NewRouter(master))
 	}
+	// the namespace routes are matched before the paths of the files
+	s.addRouter(namespace.NewRouter(master))
+	s.addRouter(metadata.NewRouter(master))
 }
 
 // addRouter adds a new router to the server.
@@ -191,10 +219,12 @@ func (s *Server) addRouter(r router.Router) {
 	s.routers = append(s.routers, r)
 }
 
-// createMux initializes the main router the server uses.
+// createMux registers the API routes on the main router the server uses.
+// The router already serves the raft transport, installed when the master
+// is created.
 // we keep enableCors just for legacy usage, need to be removed in the future
 func (s *Server) createMux() *mux.Router {
-	m := mux.NewRouter()
+	m := s.routerSwapper.router
 
 	log.Infof("Registering routers")
 	for _, apiRouter := range s.routers {
@@ -223,9 +253,7 @@ func (s *Server) Wait(waitChan chan error) {
 }
 
 func (s *Server) initRouterSwapper() {
-	s.routerSwapper = &routerSwapper{
-		router: s.createMux(),
-	}
+	s.routerSwapper.Swap(s.createMux())
 }
 
 func (s *Server) GetMuxRouter() *mux.Router {
@@ -239,8 +267,48 @@ func (s *Server) GetHttpServer() []*http.Server {
 	return hs
 }
 
+// UseMiddleware appends a new middleware to the request chain.
+// The middlewares added last are the first to see the requests.
+// This needs to be called before the API routes are configured.
+func (s *Server) UseMiddleware(m middleware.Middleware) {
+	s.middlewares = append(s.middlewares, m)
+}
+
+// handleWithGlobalMiddlewares wraps the handler function for a request with
+// the server's global middlewares.
 func (s *Server) handleWithGlobalMiddlewares(handler httputils.APIFunc) httputils.APIFunc {
-	return handler
+	next := handler
+	for _, m := range s.middlewares {
+		next = m.WrapHandler(next)
+	}
+	return next
+}
+
+// InitMiddlewares installs the middlewares enabled by the configuration.
+func (s *Server) InitMiddlewares() error {
+	s.UseMiddleware(middleware.NewVersionMiddleware())
+	s.UseMiddleware(middleware.NewBodySizeMiddleware(s.cfg.MaxRequestBodySize, s.cfg.MaxFileSize))
+	if len(s.cfg.AuthorizationPluginNames) > 0 {
+		plugins, err := authorization.NewPlugins(s.cfg.AuthorizationPluginNames)
+		if err != nil {
+			return err
+		}
+		s.UseMiddleware(middleware.NewAuthorizationMiddleware(plugins))
+	}
+	if s.cfg.Authenticator != nil {
+		s.UseMiddleware(middleware.NewAuthenticationMiddleware(s.cfg.Authenticator, s.cfg.ClusterSecret))
+	} else {
+		log.Warning("/!\\ AUTHENTICATION IS DISABLED, ANYONE REACHING THE API CAN MODIFY EVERY NAMESPACE /!\\")
+	}
+	if s.cfg.EnableCors || s.cfg.CorsHeaders != "" {
+		s.UseMiddleware(middleware.NewCORSMiddleware(s.cfg.CorsHeaders))
+	}
+	s.UseMiddleware(middleware.NewRecoveryMiddleware())
+	if s.cfg.Logging {
+		s.UseMiddleware(middleware.NewLoggingMiddleware())
+	}
+	s.UseMiddleware(middleware.NewRequestIDMiddleware())
+	return nil
 }
 
 // newServer sets up the required HTTPServers and does protocol specific checking.
@@ -16,11 +16,12 @@ limitations under the License.
 package httputils
 
 import (
-	"fmt"
 	"net/http"
 	"path/filepath"
 	"strconv"
 	"strings"
+
+	"github.com/gostor/gofs/pkg/errors"
 )
 
 // BoolValue transforms a form value in different formats into a boolean type.
@@ -79,9 +80,9 @@ func ArchiveFormValues(r *http.Request, vars map[string]string) (ArchiveOptions,
 
 	switch {
 	case name == "":
-		return ArchiveOptions{}, fmt.Errorf("bad parameter: 'name' cannot be empty")
+		return ArchiveOptions{}, errors.BadParameter("'name' cannot be empty")
 	case path == "":
-		return ArchiveOptions{}, fmt.Errorf("bad parameter: 'path' cannot be empty")
+		return ArchiveOptions{}, errors.BadParameter("'path' cannot be empty")
 	}
 
 	return ArchiveOptions{name, path}, nil
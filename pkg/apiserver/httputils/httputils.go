@@ -20,19 +20,26 @@ package httputils
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 	"io"
 	"mime"
 	"net/http"
 	"strings"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/errors"
 	"github.com/gostor/gofs/pkg/version"
 )
 
 // APIVersionKey is the client's requested API version.
 const APIVersionKey = "api-version"
 
+// RequestIDKey is the ID of the request in the context.
+const RequestIDKey = "request-id"
+
+// RequestIDHeader is the header carrying the ID of a request.
+const RequestIDHeader = "X-Request-Id"
+
 // APIFunc is an adapter to allow the use of ordinary functions as Docker API endpoints.
 // Any function that has the appropriate signature can be register as a API endpoint (e.g. getVersion).
 type APIFunc func(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error
@@ -86,7 +93,7 @@ func CheckForJSON(r *http.Request) error {
 	if MatchesContentType(ct, "application/json") {
 		return nil
 	}
-	return fmt.Errorf("Content-Type specified (%s) must be 'application/json'", ct)
+	return errors.BadParameter("Content-Type specified (%s) must be 'application/json'", ct)
 }
 
 // ParseForm ensures the request form is parsed even with invalid content types.
@@ -109,43 +116,15 @@ func ParseMultipartForm(r *http.Request) error {
 	return nil
 }
 
-// WriteError decodes a specific docker error and sends it in the response.
+// WriteError sends err in the response as a WebHDFS RemoteException, with
+// the status code of its kind.
 func WriteError(w http.ResponseWriter, err error) {
 	if err == nil || w == nil {
 		logrus.WithFields(logrus.Fields{"error": err, "writer": w}).Error("unexpected HTTP error handling")
 		return
 	}
 
-	statusCode := http.StatusInternalServerError
-	errMsg := err.Error()
-
-	// This part of will be removed once we've
-	// converted everything over to use the errcode package
-
-	// FIXME: this is brittle and should not be necessary.
-	// If we need to differentiate between different possible error types,
-	// we should create appropriate error types with clearly defined meaning
-	errStr := strings.ToLower(err.Error())
-	for keyword, status := range map[string]int{
-		"not found":             http.StatusNotFound,
-		"no such":               http.StatusNotFound,
-		"bad parameter":         http.StatusBadRequest,
-		"conflict":              http.StatusConflict,
-		"impossible":            http.StatusNotAcceptable,
-		"wrong login/password":  http.StatusUnauthorized,
-		"hasn't been activated": http.StatusForbidden,
-	} {
-		if strings.Contains(errStr, keyword) {
-			statusCode = status
-			break
-		}
-	}
-
-	if statusCode == 0 {
-		statusCode = http.StatusInternalServerError
-	}
-
-	http.Error(w, errMsg, statusCode)
+	WriteJSON(w, errors.StatusCode(err), &api.RemoteExceptionResponse{RemoteException: errors.ToRemoteException(err)})
 }
 
 // WriteJSON writes the value v to the http response stream as json with standard json encoding.
@@ -156,14 +135,24 @@ func WriteJSON(w http.ResponseWriter, code int, v interface{}) error {
 }
 
 // VersionFromContext returns an API version from the context using APIVersionKey.
-// It panics if the context value does not have version.Version type.
+// It panics if the context value does not have version.APIVersion type.
 func VersionFromContext(ctx context.Context) string {
 	if ctx == nil {
-		return version.Version
+		return version.APIVersion
 	}
 	val := ctx.Value(APIVersionKey)
 	if val == nil {
-		return version.Version
+		return version.APIVersion
 	}
 	return val.(string)
 }
+
+// RequestIDFromContext returns the ID of the request from the context using
+// RequestIDKey, or an empty string if the request has no ID.
+func RequestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(RequestIDKey).(string)
+	return id
+}
@@ -0,0 +1,43 @@
+package httputils
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/errors"
+)
+
+func TestWriteError(t *testing.T) {
+	cases := []struct {
+		err       error
+		status    int
+		exception string
+		class     string
+	}{
+		{errors.NotFound("no such file: /ns/f"), http.StatusNotFound, "FileNotFoundException", "java.io.FileNotFoundException"},
+		{errors.AlreadyExists("/ns/f already exists"), http.StatusForbidden, "FileAlreadyExistsException", "org.apache.hadoop.fs.FileAlreadyExistsException"},
+		{errors.NotLeader("not the leader"), http.StatusForbidden, "StandbyException", "org.apache.hadoop.ipc.StandbyException"},
+		{errors.BadParameter("invalid permission"), http.StatusBadRequest, "IllegalArgumentException", "java.lang.IllegalArgumentException"},
+		{fmt.Errorf("no such thing, but untyped"), http.StatusInternalServerError, "RuntimeException", "java.lang.RuntimeException"},
+	}
+
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		WriteError(w, tc.err)
+		if w.Code != tc.status {
+			t.Fatalf("%v: expected status %d, got %d", tc.err, tc.status, w.Code)
+		}
+		var resp api.RemoteExceptionResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%v: invalid body %q: %v", tc.err, w.Body.String(), err)
+		}
+		e := resp.RemoteException
+		if e.Exception != tc.exception || e.JavaClassName != tc.class || e.Message != tc.err.Error() {
+			t.Fatalf("%v: unexpected exception %#v", tc.err, e)
+		}
+	}
+}
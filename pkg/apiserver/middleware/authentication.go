@@ -0,0 +1,93 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gostor/gofs/pkg/apiserver/httputils"
+	"github.com/gostor/gofs/pkg/auth"
+)
+
+// AuthenticationMiddleware rejects the requests which are not
+// authenticated, and adds the principal of the others to the context.
+type AuthenticationMiddleware struct {
+	authenticator auth.Authenticator
+	clusterSecret string
+}
+
+// NewAuthenticationMiddleware creates a new AuthenticationMiddleware. The
+// requests of the raft peers are authenticated with the secret they share.
+func NewAuthenticationMiddleware(a auth.Authenticator, clusterSecret string) AuthenticationMiddleware {
+	return AuthenticationMiddleware{authenticator: a, clusterSecret: clusterSecret}
+}
+
+// WrapHandler returns a new handler function wrapping the previous one in the request chain.
+func (m AuthenticationMiddleware) WrapHandler(handler httputils.APIFunc) httputils.APIFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+		p := routePath(r, vars)
+		if isPublic(r.Method, p) {
+			return handler(ctx, w, r, vars)
+		}
+		if isPeer(p) {
+			if err := auth.CheckPeer(r, m.clusterSecret); err != nil {
+				logrus.WithField("request_id", httputils.RequestIDFromContext(ctx)).Infof("Rejected %s %s from %s: %v", r.Method, r.URL.Path, r.RemoteAddr, err)
+				return err
+			}
+			return handler(ctx, w, r, vars)
+		}
+		principal, err := m.authenticator.Authenticate(r, namespaceOf(p))
+		if err == nil {
+			principal, err = auth.Impersonate(r, principal)
+		}
+		if err != nil {
+			logrus.WithField("request_id", httputils.RequestIDFromContext(ctx)).Infof("Rejected %s %s from %s: %v", r.Method, r.URL.Path, r.RemoteAddr, err)
+			return err
+		}
+		return handler(auth.WithPrincipal(ctx, principal), w, r, vars)
+	}
+}
+
+// routePath returns the path of the request without the version prefix.
+func routePath(r *http.Request, vars map[string]string) string {
+	p := r.URL.Path
+	if v, ok := vars["version"]; ok {
+		p = strings.TrimPrefix(p, "/v"+v)
+	}
+	return p
+}
+
+// isPublic returns true for the requests served without authentication:
+// the server version, the CORS preflight requests, and the status of the
+// cluster the clients find its leader with.
+func isPublic(method, p string) bool {
+	return method == "OPTIONS" || p == "/version" || p == "/cluster/status"
+}
+
+// isPeer returns true for the cluster requests exchanged by the raft peers,
+// like their joins.
+func isPeer(p string) bool {
+	return strings.HasPrefix(p, "/cluster/") && p != "/cluster/status"
+}
+
+// namespaceOf returns the namespace of the file at p.
+func namespaceOf(p string) string {
+	return strings.SplitN(strings.TrimPrefix(p, "/"), "/", 2)[0]
+}
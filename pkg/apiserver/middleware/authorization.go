@@ -0,0 +1,86 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/apiserver/httputils"
+	"github.com/gostor/gofs/pkg/auth"
+	"github.com/gostor/gofs/pkg/authorization"
+)
+
+// AuthorizationMiddleware asks the authorization plugins whether the
+// principal of a request may do its operation.
+type AuthorizationMiddleware struct {
+	plugins []authorization.Plugin
+}
+
+// NewAuthorizationMiddleware creates a new AuthorizationMiddleware.
+func NewAuthorizationMiddleware(plugins []authorization.Plugin) AuthorizationMiddleware {
+	return AuthorizationMiddleware{plugins: plugins}
+}
+
+// WrapHandler returns a new handler function wrapping the previous one in the request chain.
+func (m AuthorizationMiddleware) WrapHandler(handler httputils.APIFunc) httputils.APIFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+		p := routePath(r, vars)
+		if isPublic(r.Method, p) || isPeer(p) {
+			return handler(ctx, w, r, vars)
+		}
+		q := r.URL.Query()
+		op := strings.ToUpper(q.Get("op"))
+		paths := []string{p}
+		if dst := q.Get("destination"); dst != "" && op != api.OpsCreateSymlink {
+			// a rename or a hard link needs the permission on both of its
+			// paths, unlike a symlink whose target is not accessed
+			paths = append(paths, dst)
+		}
+		authorize := func(p string) error {
+			ns, rel := splitNamespace(p)
+			req := &authorization.Request{
+				Principal: auth.PrincipalFromContext(ctx),
+				Namespace: ns,
+				Path:      rel,
+				Op:        op,
+				Method:    r.Method,
+			}
+			return authorization.Authorize(ctx, m.plugins, req)
+		}
+		for _, p := range paths {
+			if err := authorize(p); err != nil {
+				return err
+			}
+		}
+		// the master authorizes the paths the symlinks resolve to, and
+		// the live paths of the snapshots and of the trash
+		return handler(authorization.WithAuthorizer(ctx, authorize), w, r, vars)
+	}
+}
+
+// splitNamespace splits p into its namespace and the path inside it.
+func splitNamespace(p string) (string, string) {
+	parts := strings.SplitN(strings.TrimPrefix(path.Clean("/"+p), "/"), "/", 2)
+	if len(parts) == 1 {
+		return parts[0], "/"
+	}
+	return parts[0], "/" + parts[1]
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package middleware
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/apiserver/httputils"
+	"github.com/gostor/gofs/pkg/errors"
+)
+
+// dataOps are the operations whose body is the content of a file.
+var dataOps = map[string]bool{
+	api.OpsFileCreate:  true,
+	api.OpsAppend:      true,
+	api.OpsUploadChunk: true,
+}
+
+// BodySizeMiddleware limits the size of the request bodies. The content of
+// the files has its own limit, since it is usually much larger than the
+// metadata requests. A limit of 0 means no limit.
+type BodySizeMiddleware struct {
+	limit     int64
+	dataLimit int64
+}
+
+// NewBodySizeMiddleware creates a new BodySizeMiddleware.
+func NewBodySizeMiddleware(limit, dataLimit int64) BodySizeMiddleware {
+	return BodySizeMiddleware{limit: limit, dataLimit: dataLimit}
+}
+
+// WrapHandler returns a new handler function wrapping the previous one in the request chain.
+func (m BodySizeMiddleware) WrapHandler(handler httputils.APIFunc) httputils.APIFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+		limit := m.limit
+		if dataOps[strings.ToUpper(r.URL.Query().Get("op"))] {
+			limit = m.dataLimit
+		}
+		if limit > 0 && r.Body != nil {
+			if r.ContentLength > limit {
+				return errors.TooLarge("request body of %d bytes exceeds the limit of %d bytes", r.ContentLength, limit)
+			}
+			r.Body = &limitedBody{ReadCloser: r.Body, n: limit, limit: limit}
+		}
+		return handler(ctx, w, r, vars)
+	}
+}
+
+// limitedBody fails the reads going past the limit.
+type limitedBody struct {
+	io.ReadCloser
+	n     int64
+	limit int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	// read one more byte than allowed to tell a body of exactly the limit
+	// from a larger one
+	if int64(len(p)) > b.n+1 {
+		p = p[:b.n+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if int64(n) <= b.n {
+		b.n -= int64(n)
+		return n, err
+	}
+	n = int(b.n)
+	b.n = 0
+	return n, errors.TooLarge("request body exceeds the limit of %d bytes", b.limit)
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gostor/gofs/pkg/apiserver/httputils"
+	"github.com/gostor/gofs/pkg/errors"
+)
+
+// LoggingMiddleware writes an access log entry for every request, with its
+// status and latency.
+type LoggingMiddleware struct{}
+
+// NewLoggingMiddleware creates a new LoggingMiddleware.
+func NewLoggingMiddleware() LoggingMiddleware {
+	return LoggingMiddleware{}
+}
+
+// WrapHandler returns a new handler function wrapping the previous one in the request chain.
+func (m LoggingMiddleware) WrapHandler(handler httputils.APIFunc) httputils.APIFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+		start := time.Now()
+		rw := &responseWriter{ResponseWriter: w}
+		err := handler(ctx, rw, r, vars)
+
+		status := rw.status
+		if err != nil && status == 0 {
+			// the error is written once the chain returns
+			status = errors.StatusCode(err)
+		}
+		if status == 0 {
+			status = http.StatusOK
+		}
+		logrus.WithFields(logrus.Fields{
+			"request_id": httputils.RequestIDFromContext(ctx),
+			"remote":     r.RemoteAddr,
+			"method":     r.Method,
+			"path":       r.URL.Path,
+			"op":         r.URL.Query().Get("op"),
+			"status":     status,
+			"bytes":      rw.written,
+			"latency":    time.Since(start),
+		}).Info("API request")
+		return err
+	}
+}
+
+// responseWriter records the status and the size of a response.
+type responseWriter struct {
+	http.ResponseWriter
+	status  int
+	written int64
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.written += int64(n)
+	return n, err
+}
+
+// Flush sends the buffered data to the client, if the underlying writer
+// supports it.
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,34 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package middleware contains the middlewares wrapping every API handler.
+package middleware
+
+import "github.com/gostor/gofs/pkg/apiserver/httputils"
+
+// Middleware is an interface to allow the use of ordinary functions as API filters.
+// Any struct that has the appropriate signature can be registered as a middleware.
+type Middleware interface {
+	WrapHandler(handler httputils.APIFunc) httputils.APIFunc
+}
+
+// Func is an adapter to allow the use of ordinary functions as middlewares.
+type Func func(handler httputils.APIFunc) httputils.APIFunc
+
+// WrapHandler calls f(handler).
+func (f Func) WrapHandler(handler httputils.APIFunc) httputils.APIFunc {
+	return f(handler)
+}
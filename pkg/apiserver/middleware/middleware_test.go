@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/apiserver/httputils"
+	"github.com/gostor/gofs/pkg/auth"
+	"github.com/gostor/gofs/pkg/errors"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var id string
+	handler := NewRequestIDMiddleware().WrapHandler(func(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+		id = httputils.RequestIDFromContext(ctx)
+		return nil
+	})
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/ns", nil)
+	handler(context.Background(), w, r, nil)
+	if id == "" || w.Header().Get(httputils.RequestIDHeader) != id {
+		t.Fatalf("expected a generated request ID, got %q and header %q", id, w.Header().Get(httputils.RequestIDHeader))
+	}
+
+	w = httptest.NewRecorder()
+	r.Header.Set(httputils.RequestIDHeader, "abc")
+	handler(context.Background(), w, r, nil)
+	if id != "abc" || w.Header().Get(httputils.RequestIDHeader) != "abc" {
+		t.Fatalf("expected the client request ID, got %q", id)
+	}
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	handler := NewRecoveryMiddleware().WrapHandler(func(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+		panic("boom")
+	})
+
+	r, _ := http.NewRequest("GET", "/ns", nil)
+	err := handler(context.Background(), httptest.NewRecorder(), r, nil)
+	if errors.StatusCode(err) != http.StatusInternalServerError {
+		t.Fatalf("expected an internal error, got %v", err)
+	}
+}
+
+func TestBodySizeMiddleware(t *testing.T) {
+	handler := NewBodySizeMiddleware(4, 8).WrapHandler(func(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+		_, err := ioutil.ReadAll(r.Body)
+		return err
+	})
+
+	cases := []struct {
+		op   string
+		body string
+		ok   bool
+	}{
+		{api.OpsDirCreate, "1234", true},
+		{api.OpsDirCreate, "12345", false},
+		{api.OpsFileCreate, "12345678", true},
+		{api.OpsFileCreate, "123456789", false},
+	}
+	for _, tc := range cases {
+		for _, chunked := range []bool{false, true} {
+			r, _ := http.NewRequest("PUT", "/ns/f?op="+tc.op, strings.NewReader(tc.body))
+			if chunked {
+				// the size of the body is not known in advance
+				r.ContentLength = -1
+			}
+			err := handler(context.Background(), httptest.NewRecorder(), r, nil)
+			if tc.ok && err != nil {
+				t.Fatalf("%s %q: unexpected error %v", tc.op, tc.body, err)
+			}
+			if !tc.ok && errors.StatusCode(err) != http.StatusRequestEntityTooLarge {
+				t.Fatalf("%s %q: expected a too large error, got %v", tc.op, tc.body, err)
+			}
+		}
+	}
+}
+
+func TestAuthenticationMiddleware(t *testing.T) {
+	handler := NewAuthenticationMiddleware(auth.NewAuthenticator(nil, auth.StaticTokens{}), "s3cr3t").WrapHandler(func(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+		return nil
+	})
+
+	cases := []struct {
+		method, path, secret string
+		ok                   bool
+	}{
+		{"GET", "/version", "", true},
+		{"GET", "/cluster/status", "", true},
+		// only the raft peers may join the cluster
+		{"POST", "/cluster/join", "", false},
+		{"POST", "/cluster/join", "wrong", false},
+		{"POST", "/cluster/join", "s3cr3t", true},
+		{"GET", "/ns/f", "s3cr3t", false},
+	}
+	for _, tc := range cases {
+		r, _ := http.NewRequest(tc.method, tc.path, nil)
+		if tc.secret != "" {
+			r.Header.Set(auth.ClusterSecretHeader, tc.secret)
+		}
+		err := handler(context.Background(), httptest.NewRecorder(), r, nil)
+		if tc.ok && err != nil {
+			t.Fatalf("%s %s: unexpected error %v", tc.method, tc.path, err)
+		}
+		if !tc.ok && !errors.Is(err, errors.KindUnauthenticated) {
+			t.Fatalf("%s %s: expected an Unauthenticated error, got %v", tc.method, tc.path, err)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gostor/gofs/pkg/apiserver/httputils"
+	"github.com/gostor/gofs/pkg/errors"
+)
+
+// RecoveryMiddleware turns the panics of the handlers into internal server
+// errors, so that a bad request does not bring the server down.
+type RecoveryMiddleware struct{}
+
+// NewRecoveryMiddleware creates a new RecoveryMiddleware.
+func NewRecoveryMiddleware() RecoveryMiddleware {
+	return RecoveryMiddleware{}
+}
+
+// WrapHandler returns a new handler function wrapping the previous one in the request chain.
+func (m RecoveryMiddleware) WrapHandler(handler httputils.APIFunc) httputils.APIFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) (err error) {
+		defer func() {
+			if v := recover(); v != nil {
+				logrus.WithField("request_id", httputils.RequestIDFromContext(ctx)).Errorf("Panic serving %s %s: %v\n%s", r.Method, r.URL.Path, v, debug.Stack())
+				err = errors.New(errors.KindInternal, "internal server error")
+			}
+		}()
+		return handler(ctx, w, r, vars)
+	}
+}
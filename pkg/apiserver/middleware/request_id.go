@@ -0,0 +1,60 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/gostor/gofs/pkg/apiserver/httputils"
+)
+
+// maxRequestIDLength is the longest request ID accepted from the clients.
+const maxRequestIDLength = 128
+
+// RequestIDMiddleware identifies every request. The ID sent by the client in
+// the X-Request-Id header is used if there is one, otherwise a new one is
+// generated. The ID is added to the context, and sent back in the response.
+type RequestIDMiddleware struct{}
+
+// NewRequestIDMiddleware creates a new RequestIDMiddleware.
+func NewRequestIDMiddleware() RequestIDMiddleware {
+	return RequestIDMiddleware{}
+}
+
+// WrapHandler returns a new handler function wrapping the previous one in the request chain.
+func (m RequestIDMiddleware) WrapHandler(handler httputils.APIFunc) httputils.APIFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+		id := r.Header.Get(httputils.RequestIDHeader)
+		if id == "" || len(id) > maxRequestIDLength {
+			id = newRequestID()
+		}
+		w.Header().Set(httputils.RequestIDHeader, id)
+		ctx = context.WithValue(ctx, httputils.RequestIDKey, id)
+		return handler(ctx, w, r, vars)
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
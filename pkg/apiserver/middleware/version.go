@@ -0,0 +1,56 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gostor/gofs/pkg/apiserver/httputils"
+	"github.com/gostor/gofs/pkg/errors"
+	"github.com/gostor/gofs/pkg/version"
+)
+
+// VersionMiddleware checks the API version requested in the path, and adds
+// it to the context. Requests without a version are served by the current
+// API version.
+type VersionMiddleware struct{}
+
+// NewVersionMiddleware creates a new VersionMiddleware.
+func NewVersionMiddleware() VersionMiddleware {
+	return VersionMiddleware{}
+}
+
+// WrapHandler returns a new handler function wrapping the previous one in the request chain.
+func (v VersionMiddleware) WrapHandler(handler httputils.APIFunc) httputils.APIFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+		apiVersion := vars["version"]
+		if apiVersion == "" {
+			apiVersion = version.APIVersion
+		}
+		w.Header().Set("API-Version", version.APIVersion)
+
+		if version.LessThan(apiVersion, version.MinAPIVersion) {
+			return errors.BadParameter("client version %s is too old. Minimum supported API version is %s, please upgrade your client", apiVersion, version.MinAPIVersion)
+		}
+		if version.GreaterThan(apiVersion, version.APIVersion) {
+			return errors.BadParameter("client version %s is too new. Maximum supported API version is %s", apiVersion, version.APIVersion)
+		}
+
+		ctx = context.WithValue(ctx, httputils.APIVersionKey, apiVersion)
+		return handler(ctx, w, r, vars)
+	}
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gostor/gofs/pkg/apiserver/httputils"
+	"github.com/gostor/gofs/pkg/version"
+)
+
+func TestVersionMiddleware(t *testing.T) {
+	var served string
+	handler := NewVersionMiddleware().WrapHandler(func(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+		served = httputils.VersionFromContext(ctx)
+		return nil
+	})
+
+	cases := map[string]bool{
+		"":                 true,
+		version.APIVersion: true,
+		"0.1":              false,
+		"99.0":             false,
+	}
+	for v, ok := range cases {
+		served = ""
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", "/v"+v+"/ns", nil)
+		err := handler(context.Background(), w, r, map[string]string{"version": v})
+		if ok && err != nil {
+			t.Fatalf("version %q: unexpected error %v", v, err)
+		}
+		if !ok && err == nil {
+			t.Fatalf("version %q: expected an error", v)
+		}
+		if ok && v != "" && served != v {
+			t.Fatalf("version %q: handler served version %q", v, served)
+		}
+		if w.Header().Get("API-Version") != version.APIVersion {
+			t.Fatalf("version %q: unexpected API-Version header %q", v, w.Header().Get("API-Version"))
+		}
+	}
+}
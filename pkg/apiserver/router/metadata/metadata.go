@@ -17,8 +17,11 @@ package metadata
 
 import (
 	"context"
+	"io"
 	"net/http"
+	"strings"
 
+	"github.com/gostor/gofs/pkg/api"
 	"github.com/gostor/gofs/pkg/apiserver/httputils"
 	"github.com/gostor/gofs/pkg/apiserver/router"
 	"github.com/gostor/gofs/pkg/master"
@@ -50,58 +53,94 @@ func (r *mdRouter) initRoutes() {
 		// POST
 		router.NewPostRoute("/{path:.*}", r.postMetadataOperation),
 		// PUT
-		router.NewPostRoute("/{path:.*}", r.putMetadataOperation),
+		router.NewPutRoute("/{path:.*}", r.putMetadataOperation),
 		// DELETE
 		router.NewDeleteRoute("/{path:.*}", r.deleteMetadataOperation),
 	}
 }
 
 func (r *mdRouter) getMetadataOperation(ctx context.Context, w http.ResponseWriter, req *http.Request, vars map[string]string) error {
-	if err := httputils.ParseForm(r); err != nil {
+	if err := httputils.ParseForm(req); err != nil {
 		return err
 	}
 	path := vars["path"]
-	operation := r.Form.Get("op")
+	operation := strings.ToUpper(req.Form.Get("op"))
+
+	if operation == api.OpsOpen {
+		rc, header, err := r.master.OpenPathHandler(ctx, path, req.Form)
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		for k, v := range header {
+			w.Header()[k] = v
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.WriteHeader(http.StatusOK)
+		_, err = io.Copy(w, rc)
+		return err
+	}
 
-	resp, err := r.master.GetPathHandler(path, operation)
+	resp, err := r.master.GetPathHandler(ctx, path, operation, req.Form)
 	if err != nil {
 		return err
 	}
-	httputils.WriteJSON(w, http.StatusOK, resp)
-	return nil
+	return httputils.WriteJSON(w, http.StatusOK, resp)
 }
 
 func (r *mdRouter) postMetadataOperation(ctx context.Context, w http.ResponseWriter, req *http.Request, vars map[string]string) error {
-	if err := httputils.ParseForm(r); err != nil {
+	if err := httputils.ParseForm(req); err != nil {
 		return err
 	}
 	path := vars["path"]
-	operation := r.Form.Get("op")
+	operation := strings.ToUpper(req.Form.Get("op"))
 
-	err := r.master.PostPathHandler(path, operation)
+	resp, err := r.master.PostPathHandler(ctx, path, operation, req.Form, req.Body)
 	if err != nil {
 		return err
 	}
-	httputils.WriteJSON(w, http.StatusOK, nil)
-	return nil
+	if resp == nil {
+		// APPEND has no response body
+		w.WriteHeader(http.StatusOK)
+		return nil
+	}
+	return httputils.WriteJSON(w, http.StatusOK, resp)
 }
 
 func (r *mdRouter) putMetadataOperation(ctx context.Context, w http.ResponseWriter, req *http.Request, vars map[string]string) error {
-	return nil
+	if err := httputils.ParseForm(req); err != nil {
+		return err
+	}
+	path := vars["path"]
+	operation := strings.ToUpper(req.Form.Get("op"))
+
+	resp, err := r.master.PutPathHandler(ctx, path, operation, req.Form, req.Body)
+	if err != nil {
+		return err
+	}
+	if operation == api.OpsFileCreate || operation == api.OpsCommitChunks {
+		w.Header().Set("Location", req.URL.Path)
+		w.WriteHeader(http.StatusCreated)
+		return nil
+	}
+	if resp == nil {
+		// the operations like SETACL have no response body
+		w.WriteHeader(http.StatusOK)
+		return nil
+	}
+	return httputils.WriteJSON(w, http.StatusOK, resp)
 }
 
 func (r *mdRouter) deleteMetadataOperation(ctx context.Context, w http.ResponseWriter, req *http.Request, vars map[string]string) error {
-	if err := httputils.ParseForm(r); err != nil {
+	if err := httputils.ParseForm(req); err != nil {
 		return err
 	}
 	path := vars["path"]
-	operation := r.Form.Get("op")
-	recursive := httputils.BoolValueOrDefault(req, "recursive", false)
+	operation := strings.ToUpper(req.Form.Get("op"))
 
-	err := r.master.DeletePathHandler(path, operation, recursive)
+	resp, err := r.master.DeletePathHandler(ctx, path, operation, req.Form)
 	if err != nil {
 		return err
 	}
-	httputils.WriteJSON(w, http.StatusOK, nil)
-	return nil
+	return httputils.WriteJSON(w, http.StatusOK, resp)
 }
@@ -0,0 +1,53 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package namespace
+
+import (
+	"github.com/gostor/gofs/pkg/apiserver/router"
+	"github.com/gostor/gofs/pkg/master"
+)
+
+// namespaceRouter is a router to manage the namespaces
+type namespaceRouter struct {
+	routes []router.Route
+	master *master.Master
+}
+
+// NewRouter initializes a new namespace router
+func NewRouter(master *master.Master) router.Router {
+	r := &namespaceRouter{master: master}
+	r.initRoutes()
+	return r
+}
+
+// Routes returns the available routes of the namespace router
+func (r *namespaceRouter) Routes() []router.Route {
+	return r.routes
+}
+
+// initRoutes initializes the routes in namespace router
+func (r *namespaceRouter) initRoutes() {
+	r.routes = []router.Route{
+		router.NewGetRoute("/namespaces", r.listNamespaces),
+		router.NewGetRoute("/namespaces/{id}", r.getNamespace),
+		router.NewPostRoute("/namespaces/{id}", r.createNamespace),
+		router.NewDeleteRoute("/namespaces/{id}", r.deleteNamespace),
+		router.NewGetRoute("/namespaces/{id}/gc", r.getGCStatus),
+		router.NewPostRoute("/namespaces/{id}/gc", r.collectGarbage),
+		router.NewGetRoute("/namespaces/{id}/fsck", r.checkNamespace),
+		router.NewPostRoute("/namespaces/{id}/fsck", r.repairNamespace),
+	}
+}
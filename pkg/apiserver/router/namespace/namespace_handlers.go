@@ -0,0 +1,113 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package namespace
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/apiserver/httputils"
+	"github.com/gostor/gofs/pkg/errors"
+)
+
+func (r *namespaceRouter) listNamespaces(ctx context.Context, w http.ResponseWriter, req *http.Request, vars map[string]string) error {
+	resp, err := r.master.ListNamespaces(ctx)
+	if err != nil {
+		return err
+	}
+	return httputils.WriteJSON(w, http.StatusOK, resp)
+}
+
+func (r *namespaceRouter) getNamespace(ctx context.Context, w http.ResponseWriter, req *http.Request, vars map[string]string) error {
+	resp, err := r.master.GetNamespace(ctx, vars["id"])
+	if err != nil {
+		return err
+	}
+	return httputils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// createNamespace creates a namespace, whose api.Config is the JSON body.
+func (r *namespaceRouter) createNamespace(ctx context.Context, w http.ResponseWriter, req *http.Request, vars map[string]string) error {
+	if err := httputils.CheckForJSON(req); err != nil {
+		return err
+	}
+	var cfg api.Config
+	if err := json.NewDecoder(req.Body).Decode(&cfg); err != nil {
+		return errors.BadParameter("invalid namespace configuration: %v", err)
+	}
+	resp, err := r.master.CreateNamespace(ctx, vars["id"], &cfg)
+	if err != nil {
+		return err
+	}
+	return httputils.WriteJSON(w, http.StatusCreated, resp)
+}
+
+// deleteNamespace removes a namespace, which must be empty unless the force
+// parameter is set.
+func (r *namespaceRouter) deleteNamespace(ctx context.Context, w http.ResponseWriter, req *http.Request, vars map[string]string) error {
+	if err := httputils.ParseForm(req); err != nil {
+		return err
+	}
+	resp, err := r.master.DeleteNamespace(ctx, vars["id"], httputils.BoolValue(req, "force"))
+	if err != nil {
+		return err
+	}
+	return httputils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// getGCStatus returns the statistics of the collections of the orphaned
+// objects of a namespace.
+func (r *namespaceRouter) getGCStatus(ctx context.Context, w http.ResponseWriter, req *http.Request, vars map[string]string) error {
+	resp, err := r.master.GCStatus(ctx, vars["id"])
+	if err != nil {
+		return err
+	}
+	return httputils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// collectGarbage collects the orphaned objects of a namespace, or only
+// reports them if the dryrun parameter is set.
+func (r *namespaceRouter) collectGarbage(ctx context.Context, w http.ResponseWriter, req *http.Request, vars map[string]string) error {
+	if err := httputils.ParseForm(req); err != nil {
+		return err
+	}
+	resp, err := r.master.CollectGarbage(ctx, vars["id"], httputils.BoolValue(req, "dryrun"))
+	if err != nil {
+		return err
+	}
+	return httputils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// checkNamespace checks the consistency of a namespace and of its bucket.
+func (r *namespaceRouter) checkNamespace(ctx context.Context, w http.ResponseWriter, req *http.Request, vars map[string]string) error {
+	resp, err := r.master.Fsck(ctx, vars["id"], false)
+	if err != nil {
+		return err
+	}
+	return httputils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// repairNamespace checks the consistency of a namespace and of its bucket,
+// and repairs what it can.
+func (r *namespaceRouter) repairNamespace(ctx context.Context, w http.ResponseWriter, req *http.Request, vars map[string]string) error {
+	resp, err := r.master.Fsck(ctx, vars["id"], true)
+	if err != nil {
+		return err
+	}
+	return httputils.WriteJSON(w, http.StatusOK, resp)
+}
@@ -18,7 +18,6 @@ package raft
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 	"io/ioutil"
 	"net/http"
 	"strings"
@@ -26,6 +25,7 @@ import (
 	log "github.com/Sirupsen/logrus"
 	"github.com/goraft/raft"
 	"github.com/gostor/gofs/pkg/apiserver/httputils"
+	"github.com/gostor/gofs/pkg/errors"
 )
 
 // Handles incoming RAFT joins.
@@ -59,7 +59,7 @@ func (r *raftRouter) redirectToLeader(w http.ResponseWriter, req *http.Request)
 		httputils.WriteJSON(w, http.StatusOK, learderLocation)
 	} else {
 		log.Infof("Error: Leader Unknown, %v", err)
-		httputils.WriteError(w, fmt.Errorf("Leader unknown, %v", err))
+		httputils.WriteError(w, errors.Retriable("Leader unknown, %v", err))
 	}
 }
 
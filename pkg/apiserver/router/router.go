@@ -70,7 +70,17 @@ func NewPostRoute(path string, handler httputils.APIFunc) Route {
 	return NewRoute("POST", path, handler)
 }
 
-// NewPostRoute initializes a new route with the http method POST.
+// NewPutRoute initializes a new route with the http method PUT.
+func NewPutRoute(path string, handler httputils.APIFunc) Route {
+	return NewRoute("PUT", path, handler)
+}
+
+// NewOptionsRoute initializes a new route with the http method OPTIONS.
+func NewOptionsRoute(path string, handler httputils.APIFunc) Route {
+	return NewRoute("OPTIONS", path, handler)
+}
+
+// NewDeleteRoute initializes a new route with the http method DELETE.
 func NewDeleteRoute(path string, handler httputils.APIFunc) Route {
 	return NewRoute("DELETE", path, handler)
 }
@@ -0,0 +1,43 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package system
+
+import "github.com/gostor/gofs/pkg/apiserver/router"
+
+// systemRouter provides information about the server itself
+type systemRouter struct {
+	routes []router.Route
+}
+
+// NewRouter initializes a new system router
+func NewRouter() router.Router {
+	r := &systemRouter{}
+	r.initRoutes()
+	return r
+}
+
+// Routes returns the available routes of the system router
+func (r *systemRouter) Routes() []router.Route {
+	return r.routes
+}
+
+// initRoutes initializes the routes in system router
+func (r *systemRouter) initRoutes() {
+	r.routes = []router.Route{
+		router.NewOptionsRoute("/{anyroute:.*}", optionsHandler),
+		router.NewGetRoute("/version", r.getVersion),
+	}
+}
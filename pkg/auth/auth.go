@@ -0,0 +1,237 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package auth authenticates the requests of the metadata API.
+//
+// A request is either signed with the access and secret keys of the
+// namespace it operates on, see Sign, or it carries the bearer token of a
+// service account.
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gostor/gofs/pkg/errors"
+)
+
+// principalKey is the authenticated principal in the context.
+const principalKey = "principal"
+
+// Principal is the identity a request is authenticated as.
+type Principal struct {
+	// Name is the access key, or the name of the service account.
+	Name string `json:"name"`
+	// Groups are the groups of a service account.
+	Groups []string `json:"groups,omitempty"`
+	// Namespace is the namespace whose keys signed the request. It is empty
+	// for service accounts, which are not bound to a namespace.
+	Namespace string `json:"namespace,omitempty"`
+	// ServiceAccount is true if the request carries a bearer token.
+	ServiceAccount bool `json:"serviceAccount,omitempty"`
+	// Uid and Gids are the POSIX identity the file permissions are checked
+	// for.
+	Uid  uint32   `json:"uid"`
+	Gids []uint32 `json:"gids,omitempty"`
+	// Trusted principals may act on behalf of the local users of their
+	// host, like the FUSE clients do, see Impersonate.
+	Trusted bool `json:"trusted,omitempty"`
+}
+
+// Nobody is the uid and gid of the principals without a POSIX identity.
+const Nobody = 65534
+
+// AdminGroup is the group of the service accounts which may administer the
+// cluster.
+const AdminGroup = "admins"
+
+// IsAdmin returns true if p may administer the cluster. Only the service
+// accounts of AdminGroup may: the uid a principal acts for, which a trusted
+// one sets itself, does not matter.
+func (p *Principal) IsAdmin() bool {
+	if !p.ServiceAccount {
+		return false
+	}
+	for _, g := range p.Groups {
+		if g == AdminGroup {
+			return true
+		}
+	}
+	return false
+}
+
+// WithPrincipal returns a copy of ctx carrying p.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey, p)
+}
+
+// PrincipalFromContext returns the principal of the request, nil if it is
+// not authenticated.
+func PrincipalFromContext(ctx context.Context) *Principal {
+	if ctx == nil {
+		return nil
+	}
+	p, _ := ctx.Value(principalKey).(*Principal)
+	return p
+}
+
+// Authenticator tells who sent a request.
+type Authenticator interface {
+	// Authenticate returns the principal of the request r, which operates
+	// on the namespace ns. ns is empty if the request is not bound to a
+	// namespace.
+	Authenticate(r *http.Request, ns string) (*Principal, error)
+}
+
+// KeyStore looks up the keys of the namespaces.
+type KeyStore interface {
+	// SecretKey returns the secret key paired with accessKey in the
+	// namespace ns, and the principal the requests signed with it are
+	// authenticated as, of which only Uid, Gids and Trusted are used.
+	SecretKey(ns, accessKey string) (string, *Principal, error)
+}
+
+// MaxClockSkew is the largest difference accepted between the date of a
+// signed request and the clock of the server.
+const MaxClockSkew = 15 * time.Minute
+
+type authenticator struct {
+	keys   KeyStore
+	tokens TokenStore
+	now    func() time.Time
+}
+
+// NewAuthenticator returns an Authenticator checking the signatures with
+// the keys, and the bearer tokens with the tokens. Either may be nil.
+func NewAuthenticator(keys KeyStore, tokens TokenStore) Authenticator {
+	return &authenticator{keys: keys, tokens: tokens, now: time.Now}
+}
+
+func (a *authenticator) Authenticate(r *http.Request, ns string) (*Principal, error) {
+	h := r.Header.Get("Authorization")
+	switch {
+	case h == "":
+		return nil, errors.Unauthenticated("authentication required")
+	case strings.HasPrefix(h, "Bearer "):
+		if a.tokens == nil {
+			return nil, errors.Unauthenticated("bearer tokens are not accepted")
+		}
+		p, ok := a.tokens.Lookup(strings.TrimSpace(strings.TrimPrefix(h, "Bearer ")))
+		if !ok {
+			return nil, errors.Unauthenticated("invalid bearer token")
+		}
+		return p, nil
+	case strings.HasPrefix(h, Algorithm+" "):
+		if a.keys == nil {
+			return nil, errors.Unauthenticated("signed requests are not accepted")
+		}
+		return a.verify(r, ns)
+	}
+	return nil, errors.Unauthenticated("unsupported authorization scheme")
+}
+
+// verify checks the signature of r against the keys of ns.
+func (a *authenticator) verify(r *http.Request, ns string) (*Principal, error) {
+	sig, err := parseAuthorization(r.Header.Get("Authorization"))
+	if err != nil {
+		return nil, err
+	}
+	if ns == "" || sig.namespace != ns {
+		return nil, errors.Unauthenticated("credential scope %s does not match the namespace %q", sig.scope(), ns)
+	}
+	date, err := time.Parse(timeFormat, r.Header.Get(DateHeader))
+	if err != nil {
+		return nil, errors.Unauthenticated("invalid or missing %s header", DateHeader)
+	}
+	if date.Format(dateFormat) != sig.date {
+		return nil, errors.Unauthenticated("credential scope %s does not match the request date", sig.scope())
+	}
+	if skew := a.now().Sub(date); skew > MaxClockSkew || skew < -MaxClockSkew {
+		return nil, errors.Unauthenticated("request date %s is too far from the server time", date)
+	}
+	secretKey, key, err := a.keys.SecretKey(ns, sig.accessKey)
+	if err != nil {
+		return nil, errors.Unauthenticated("invalid access key %s", sig.accessKey)
+	}
+	// the identity a trusted client acts for must not be replayed for
+	// another one
+	if r.Header.Get(UidHeader) != "" || r.Header.Get(GidsHeader) != "" {
+		for _, h := range []string{UidHeader, GidsHeader} {
+			if !sig.signs(h) {
+				return nil, errors.Unauthenticated("the %s header is not signed", h)
+			}
+		}
+	}
+	payloadHash := r.Header.Get(ContentSHA256Header)
+	if payloadHash == "" {
+		return nil, errors.Unauthenticated("missing %s header", ContentSHA256Header)
+	}
+	expected := signature(secretKey, ns, date, canonicalRequest(r, sig.signedHeaders, payloadHash))
+	if !hmacEqual(expected, sig.signature) {
+		return nil, errors.Unauthenticated("signature does not match")
+	}
+	if payloadHash != UnsignedPayload && r.Body != nil {
+		r.Body = newVerifyingBody(r.Body, payloadHash)
+	}
+	p := &Principal{Name: sig.accessKey, Namespace: ns, Uid: Nobody, Gids: []uint32{Nobody}}
+	if key != nil {
+		p.Uid, p.Gids, p.Trusted = key.Uid, key.Gids, key.Trusted
+	}
+	return p, nil
+}
+
+const (
+	// UidHeader is the header carrying the uid a trusted client acts for.
+	UidHeader = "X-Gofs-Uid"
+	// GidsHeader is the header carrying the comma separated gids a trusted
+	// client acts for, the primary one first.
+	GidsHeader = "X-Gofs-Gids"
+)
+
+// Impersonate returns the principal the request r acts for. It is p itself,
+// unless p is trusted and the request carries the identity of a local user
+// in UidHeader and GidsHeader. Authenticate refuses the signed requests which
+// carry them unsigned.
+func Impersonate(r *http.Request, p *Principal) (*Principal, error) {
+	uid := r.Header.Get(UidHeader)
+	if uid == "" {
+		return p, nil
+	}
+	if !p.Trusted {
+		return nil, errors.PermissionDenied("%s is not trusted to act for uid %s", p.Name, uid)
+	}
+	n, err := strconv.ParseUint(uid, 10, 32)
+	if err != nil {
+		return nil, errors.BadParameter("invalid %s header %q", UidHeader, uid)
+	}
+	c := *p
+	c.Uid = uint32(n)
+	c.Gids = nil
+	for _, g := range strings.Split(r.Header.Get(GidsHeader), ",") {
+		if g = strings.TrimSpace(g); g == "" {
+			continue
+		}
+		n, err := strconv.ParseUint(g, 10, 32)
+		if err != nil {
+			return nil, errors.BadParameter("invalid %s header %q", GidsHeader, r.Header.Get(GidsHeader))
+		}
+		c.Gids = append(c.Gids, uint32(n))
+	}
+	return &c, nil
+}
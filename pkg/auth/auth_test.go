@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gostor/gofs/pkg/errors"
+)
+
+type testKeys map[string]string
+
+func (k testKeys) SecretKey(ns, accessKey string) (string, *Principal, error) {
+	if s, ok := k[ns+"/"+accessKey]; ok {
+		return s, &Principal{Uid: 1000, Gids: []uint32{1000}}, nil
+	}
+	return "", nil, fmt.Errorf("no such key")
+}
+
+func newTestAuthenticator(now time.Time) *authenticator {
+	tokens, err := readTokens(strings.NewReader("# service accounts\ns3cr3t,backup,admins,ops\nfus3,fuse,uid=1000,gid=1000,trusted=true\n"))
+	if err != nil {
+		panic(err)
+	}
+	return &authenticator{
+		keys:   testKeys{"ns/AK": "SK"},
+		tokens: tokens,
+		now:    func() time.Time { return now },
+	}
+}
+
+func TestSignedRequest(t *testing.T) {
+	now := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+	a := newTestAuthenticator(now)
+
+	cases := []struct {
+		name   string
+		ns     string
+		modify func(r *http.Request)
+		ok     bool
+	}{
+		{"valid", "ns", func(r *http.Request) {}, true},
+		{"other namespace", "other", func(r *http.Request) {}, false},
+		{"tampered query", "ns", func(r *http.Request) { r.URL.RawQuery = "op=DELETE&recursive=true" }, false},
+		{"tampered method", "ns", func(r *http.Request) { r.Method = "DELETE" }, false},
+		{"tampered date", "ns", func(r *http.Request) { r.Header.Set(DateHeader, "20170301T120100Z") }, false},
+		{"no authorization", "ns", func(r *http.Request) { r.Header.Del("Authorization") }, false},
+		{"added uid", "ns", func(r *http.Request) { r.Header.Set(UidHeader, "0") }, false},
+		{"added gids", "ns", func(r *http.Request) { r.Header.Set(GidsHeader, "0") }, false},
+	}
+	for _, tc := range cases {
+		r, _ := http.NewRequest("GET", "http://127.0.0.1:9876/ns/dir?op=LISTSTATUS", nil)
+		Sign(r, "ns", "AK", "SK", now)
+		tc.modify(r)
+		p, err := a.Authenticate(r, tc.ns)
+		if tc.ok && (err != nil || p.Name != "AK" || p.Namespace != "ns") {
+			t.Fatalf("%s: unexpected principal %v and error %v", tc.name, p, err)
+		}
+		if !tc.ok && !errors.Is(err, errors.KindUnauthenticated) {
+			t.Fatalf("%s: expected an Unauthenticated error, got %v", tc.name, err)
+		}
+	}
+
+	// the identity a signed request acts for is signed along
+	r, _ := http.NewRequest("GET", "http://127.0.0.1:9876/ns/dir?op=LISTSTATUS", nil)
+	r.Header.Set(UidHeader, "1000")
+	r.Header.Set(GidsHeader, "1000,10")
+	Sign(r, "ns", "AK", "SK", now)
+	p, err := a.Authenticate(r, "ns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the keys act for the identity configured, and are not trusted unless
+	// configured so
+	if p.Uid != 1000 || len(p.Gids) != 1 || p.Trusted {
+		t.Fatalf("unexpected principal %v", p)
+	}
+	if _, err = Impersonate(r, p); !errors.Is(err, errors.KindPermissionDenied) {
+		t.Fatalf("expected a PermissionDenied error, got %v", err)
+	}
+	r.Header.Set(UidHeader, "0")
+	if _, err := a.Authenticate(r, "ns"); !errors.Is(err, errors.KindUnauthenticated) {
+		t.Fatalf("expected an Unauthenticated error for a replaced uid, got %v", err)
+	}
+
+	// the signature expires
+	r, _ = http.NewRequest("GET", "http://127.0.0.1:9876/ns/dir?op=LISTSTATUS", nil)
+	Sign(r, "ns", "AK", "SK", now.Add(-time.Hour))
+	if _, err := a.Authenticate(r, "ns"); err == nil {
+		t.Fatal("expected an error for an expired signature")
+	}
+	// the secret key must match
+	r, _ = http.NewRequest("GET", "http://127.0.0.1:9876/ns/dir?op=LISTSTATUS", nil)
+	Sign(r, "ns", "AK", "wrong", now)
+	if _, err := a.Authenticate(r, "ns"); err == nil {
+		t.Fatal("expected an error for a wrong secret key")
+	}
+}
+
+func TestSignedPayload(t *testing.T) {
+	now := time.Now()
+	a := newTestAuthenticator(now)
+
+	for _, body := range []string{"hello", "tampered"} {
+		r, _ := http.NewRequest("PUT", "http://127.0.0.1:9876/ns/f?op=CREATE", strings.NewReader(body))
+		// the hash of "hello"
+		r.Header.Set(ContentSHA256Header, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824")
+		Sign(r, "ns", "AK", "SK", now)
+		if _, err := a.Authenticate(r, "ns"); err != nil {
+			t.Fatal(err)
+		}
+		_, err := ioutil.ReadAll(r.Body)
+		if body == "hello" && err != nil {
+			t.Fatalf("unexpected error reading the signed body: %v", err)
+		}
+		if body != "hello" && err == nil {
+			t.Fatal("expected an error reading a tampered body")
+		}
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	a := newTestAuthenticator(time.Now())
+
+	r, _ := http.NewRequest("GET", "http://127.0.0.1:9876/ns/dir", nil)
+	r.Header.Set("Authorization", "Bearer s3cr3t")
+	p, err := a.Authenticate(r, "ns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "backup" || !p.ServiceAccount || len(p.Groups) != 2 || p.Groups[0] != "admins" {
+		t.Fatalf("unexpected principal %#v", p)
+	}
+
+	r.Header.Set("Authorization", "Bearer wrong")
+	if _, err = a.Authenticate(r, "ns"); err == nil {
+		t.Fatal("expected an error for an unknown token")
+	}
+}
+
+func TestImpersonate(t *testing.T) {
+	a := newTestAuthenticator(time.Now())
+
+	cases := []struct {
+		token, uid, gids string
+		ok               bool
+		expected         uint32
+	}{
+		{"fus3", "", "", true, 1000},
+		{"fus3", "42", "42,7", true, 42},
+		{"fus3", "root", "", false, 0},
+		{"s3cr3t", "", "", true, Nobody},
+		{"s3cr3t", "0", "0", false, 0},
+	}
+	for _, tc := range cases {
+		r, _ := http.NewRequest("GET", "http://127.0.0.1:9876/ns/dir", nil)
+		r.Header.Set("Authorization", "Bearer "+tc.token)
+		if tc.uid != "" {
+			r.Header.Set(UidHeader, tc.uid)
+			r.Header.Set(GidsHeader, tc.gids)
+		}
+		p, err := a.Authenticate(r, "ns")
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err = Impersonate(r, p)
+		if tc.ok && (err != nil || p.Uid != tc.expected) {
+			t.Fatalf("%s as %q: unexpected principal %v and error %v", tc.token, tc.uid, p, err)
+		}
+		if !tc.ok && err == nil {
+			t.Fatalf("%s as %q: expected an error", tc.token, tc.uid)
+		}
+	}
+}
+
+func TestPeer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := CheckPeer(r, "s3cr3t"); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		secret string
+		status int
+	}{
+		{"", http.StatusUnauthorized},
+		{"wrong", http.StatusUnauthorized},
+		{"s3cr3t", http.StatusOK},
+	} {
+		c := &http.Client{Transport: &PeerTransport{Secret: tc.secret, Base: http.DefaultTransport}}
+		resp, err := c.Get(srv.URL + "/cluster/appendEntries")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.status {
+			t.Fatalf("secret %q: unexpected status %d, expected %d", tc.secret, resp.StatusCode, tc.status)
+		}
+	}
+	// the requests are not checked without a secret
+	r, _ := http.NewRequest("GET", "http://127.0.0.1:9876/cluster/appendEntries", nil)
+	if err := CheckPeer(r, ""); err != nil {
+		t.Fatal(err)
+	}
+}
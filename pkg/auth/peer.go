@@ -0,0 +1,61 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"net/http"
+
+	"github.com/gostor/gofs/pkg/errors"
+)
+
+// ClusterSecretHeader is the header carrying the secret shared by the raft
+// peers, which authenticates the requests they send to each other.
+const ClusterSecretHeader = "X-Gofs-Cluster-Secret"
+
+// CheckPeer checks that the request r comes from a raft peer, which shares
+// the secret. Every request does if secret is empty, which the server only
+// allows with the authentication disabled.
+func CheckPeer(r *http.Request, secret string) error {
+	if secret == "" {
+		return nil
+	}
+	if !hmacEqual(r.Header.Get(ClusterSecretHeader), secret) {
+		return errors.Unauthenticated("invalid or missing cluster secret")
+	}
+	return nil
+}
+
+// PeerTransport is an http.RoundTripper sending the requests through Base,
+// with the secret shared by the raft peers.
+type PeerTransport struct {
+	Secret string
+	Base   http.RoundTripper
+}
+
+// RoundTrip sends a copy of r carrying the secret.
+func (t *PeerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if t.Secret == "" {
+		return t.Base.RoundTrip(r)
+	}
+	c := *r
+	c.Header = make(http.Header, len(r.Header)+1)
+	for k, v := range r.Header {
+		c.Header[k] = v
+	}
+	c.Header.Set(ClusterSecretHeader, t.Secret)
+	return t.Base.RoundTrip(&c)
+}
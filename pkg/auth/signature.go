@@ -0,0 +1,228 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gostor/gofs/pkg/errors"
+)
+
+// The requests are signed like the AWS Signature Version 4, with the
+// namespace in place of the region:
+//
+//	Authorization: GOFS-HMAC-SHA256 Credential=<access key>/<yyyymmdd>/<namespace>/gofs_request,
+//	    SignedHeaders=host;x-gofs-content-sha256;x-gofs-date, Signature=<hex>
+const (
+	// Algorithm is the authorization scheme of the signed requests.
+	Algorithm = "GOFS-HMAC-SHA256"
+	// DateHeader is the header carrying the signing time.
+	DateHeader = "X-Gofs-Date"
+	// ContentSHA256Header is the header carrying the hex SHA-256 of the body.
+	ContentSHA256Header = "X-Gofs-Content-Sha256"
+	// UnsignedPayload is sent in ContentSHA256Header when the body is not
+	// part of the signature, e.g. when it is streamed.
+	UnsignedPayload = "UNSIGNED-PAYLOAD"
+	// EmptyPayloadHash is the SHA-256 of an empty body.
+	EmptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	terminator = "gofs_request"
+	timeFormat = "20060102T150405Z"
+	dateFormat = "20060102"
+)
+
+// Sign signs the request r to the namespace ns with the keys. The body is
+// signed if ContentSHA256Header is already set to its hash, otherwise it is
+// left unsigned. UidHeader and GidsHeader are signed if they are set.
+func Sign(r *http.Request, ns, accessKey, secretKey string, t time.Time) {
+	t = t.UTC()
+	r.Header.Set(DateHeader, t.Format(timeFormat))
+	payloadHash := r.Header.Get(ContentSHA256Header)
+	if payloadHash == "" {
+		payloadHash = EmptyPayloadHash
+		if r.Body != nil && r.Body != http.NoBody {
+			payloadHash = UnsignedPayload
+		}
+		r.Header.Set(ContentSHA256Header, payloadHash)
+	}
+	signedHeaders := []string{"host", strings.ToLower(ContentSHA256Header), strings.ToLower(DateHeader)}
+	if r.Header.Get(UidHeader) != "" || r.Header.Get(GidsHeader) != "" {
+		// the identity of the local user is signed along
+		signedHeaders = append(signedHeaders, strings.ToLower(GidsHeader), strings.ToLower(UidHeader))
+	}
+	sig := signature(secretKey, ns, t, canonicalRequest(r, signedHeaders, payloadHash))
+	r.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s/%s/%s, SignedHeaders=%s, Signature=%s",
+		Algorithm, accessKey, t.Format(dateFormat), ns, terminator, strings.Join(signedHeaders, ";"), sig))
+}
+
+// canonicalRequest returns the canonical form of r which is signed.
+func canonicalRequest(r *http.Request, signedHeaders []string, payloadHash string) string {
+	var headers []string
+	for _, h := range signedHeaders {
+		v := r.Header.Get(h)
+		if h == "host" {
+			v = r.Host
+			if v == "" {
+				v = r.URL.Host
+			}
+		}
+		headers = append(headers, h+":"+strings.Join(strings.Fields(v), " ")+"\n")
+	}
+	uri := r.URL.EscapedPath()
+	if uri == "" {
+		uri = "/"
+	}
+	return strings.Join([]string{
+		r.Method,
+		uri,
+		canonicalQuery(r.URL.Query()),
+		strings.Join(headers, ""),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+}
+
+// canonicalQuery returns the query parameters sorted by name and value.
+func canonicalQuery(q url.Values) string {
+	var params []string
+	for k, vs := range q {
+		for _, v := range vs {
+			params = append(params, escape(k)+"="+escape(v))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+func escape(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
+
+// signature returns the hex signature of the canonical request.
+func signature(secretKey, ns string, t time.Time, canonical string) string {
+	t = t.UTC()
+	scope := strings.Join([]string{t.Format(dateFormat), ns, terminator}, "/")
+	sum := sha256.Sum256([]byte(canonical))
+	stringToSign := strings.Join([]string{Algorithm, t.Format(timeFormat), scope, hex.EncodeToString(sum[:])}, "\n")
+
+	key := hmacSHA256([]byte("GOFS"+secretKey), t.Format(dateFormat))
+	key = hmacSHA256(key, ns)
+	key = hmacSHA256(key, terminator)
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func hmacEqual(a, b string) bool {
+	return hmac.Equal([]byte(a), []byte(b))
+}
+
+// signedAuthorization is a parsed Authorization header of a signed request.
+type signedAuthorization struct {
+	accessKey     string
+	date          string
+	namespace     string
+	signedHeaders []string
+	signature     string
+}
+
+func (s *signedAuthorization) scope() string {
+	return strings.Join([]string{s.date, s.namespace, terminator}, "/")
+}
+
+// signs returns true if the header h is signed.
+func (s *signedAuthorization) signs(h string) bool {
+	h = strings.ToLower(h)
+	for _, signed := range s.signedHeaders {
+		if signed == h {
+			return true
+		}
+	}
+	return false
+}
+
+func parseAuthorization(h string) (*signedAuthorization, error) {
+	fields := map[string]string{}
+	for _, f := range strings.Split(strings.TrimPrefix(h, Algorithm+" "), ",") {
+		kv := strings.SplitN(strings.TrimSpace(f), "=", 2)
+		if len(kv) != 2 {
+			return nil, errors.Unauthenticated("malformed authorization header")
+		}
+		fields[kv[0]] = kv[1]
+	}
+	cred := strings.Split(fields["Credential"], "/")
+	if len(cred) != 4 || cred[3] != terminator {
+		return nil, errors.Unauthenticated("malformed credential %q", fields["Credential"])
+	}
+	s := &signedAuthorization{
+		accessKey:     cred[0],
+		date:          cred[1],
+		namespace:     cred[2],
+		signedHeaders: strings.Split(fields["SignedHeaders"], ";"),
+		signature:     fields["Signature"],
+	}
+	required := map[string]bool{"host": false, strings.ToLower(DateHeader): false, strings.ToLower(ContentSHA256Header): false}
+	for _, h := range s.signedHeaders {
+		if _, ok := required[h]; ok {
+			required[h] = true
+		}
+	}
+	for h, signed := range required {
+		if !signed {
+			return nil, errors.Unauthenticated("header %s must be signed", h)
+		}
+	}
+	if s.signature == "" {
+		return nil, errors.Unauthenticated("missing signature")
+	}
+	return s, nil
+}
+
+// verifyingBody fails the read of the end of the body if it does not match
+// the signed hash.
+type verifyingBody struct {
+	io.ReadCloser
+	hash     hash.Hash
+	expected string
+}
+
+func newVerifyingBody(rc io.ReadCloser, expected string) io.ReadCloser {
+	return &verifyingBody{ReadCloser: rc, hash: sha256.New(), expected: strings.ToLower(expected)}
+}
+
+func (b *verifyingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.hash.Write(p[:n])
+	if err == io.EOF && hex.EncodeToString(b.hash.Sum(nil)) != b.expected {
+		return n, errors.BadParameter("request body does not match its %s header", ContentSHA256Header)
+	}
+	return n, err
+}
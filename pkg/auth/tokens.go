@@ -0,0 +1,135 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// TokenStore looks up the service accounts by their bearer token.
+type TokenStore interface {
+	Lookup(token string) (*Principal, bool)
+}
+
+// StaticTokens is a TokenStore with a fixed set of service accounts. The
+// tokens are kept hashed, so that they do not linger in memory.
+type StaticTokens map[[sha256.Size]byte]*Principal
+
+// Add adds the service account with the token.
+func (t StaticTokens) Add(token string, p *Principal) {
+	p.ServiceAccount = true
+	t[sha256.Sum256([]byte(token))] = p
+}
+
+// Lookup returns the service account of the token.
+func (t StaticTokens) Lookup(token string) (*Principal, bool) {
+	if token == "" {
+		return nil, false
+	}
+	p, ok := t[sha256.Sum256([]byte(token))]
+	if !ok {
+		return nil, false
+	}
+	c := *p
+	return &c, true
+}
+
+// LoadTokenFile reads the service accounts from a CSV file, with a line per
+// account:
+//
+//	token,name[,group...][,uid=<uid>][,gid=<gid>...][,trusted=true]
+//
+// The groups are used by the authorization plugins, the accounts of
+// AdminGroup administering the cluster, and the uid and gids, the primary one
+// first, by the file permissions. Accounts without a uid
+// act as nobody. Empty lines and lines starting with # are ignored.
+func LoadTokenFile(path string) (StaticTokens, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readTokens(f)
+}
+
+func readTokens(r io.Reader) (StaticTokens, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	tokens := StaticTokens{}
+	for n := 1; ; n++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return tokens, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 2 || strings.TrimSpace(record[0]) == "" || strings.TrimSpace(record[1]) == "" {
+			return nil, fmt.Errorf("invalid token file entry %d: expected token,name[,group...]", n)
+		}
+		p := &Principal{Name: strings.TrimSpace(record[1]), Uid: Nobody}
+		for _, f := range record[2:] {
+			if err = p.parseField(strings.TrimSpace(f)); err != nil {
+				return nil, fmt.Errorf("invalid token file entry %d: %v", n, err)
+			}
+		}
+		if len(p.Gids) == 0 {
+			p.Gids = []uint32{Nobody}
+		}
+		tokens.Add(strings.TrimSpace(record[0]), p)
+	}
+}
+
+// parseField parses a group, or a key=value field of a token file entry.
+func (p *Principal) parseField(f string) error {
+	kv := strings.SplitN(f, "=", 2)
+	if len(kv) == 1 {
+		if f != "" {
+			p.Groups = append(p.Groups, f)
+		}
+		return nil
+	}
+	switch kv[0] {
+	case "uid", "gid":
+		n, err := strconv.ParseUint(kv[1], 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q", kv[0], kv[1])
+		}
+		if kv[0] == "uid" {
+			p.Uid = uint32(n)
+		} else {
+			p.Gids = append(p.Gids, uint32(n))
+		}
+	case "trusted":
+		b, err := strconv.ParseBool(kv[1])
+		if err != nil {
+			return fmt.Errorf("invalid trusted %q", kv[1])
+		}
+		p.Trusted = b
+	default:
+		return fmt.Errorf("unknown field %q", kv[0])
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package authorization decides which principal may do which operation on
+// which files.
+//
+// The decisions are taken by plugins, configured by name with an optional
+// argument, e.g. "policy=/etc/gofs/policy.yaml" or
+// "webhook=https://authz.example.com/authorize". A request is allowed only
+// if every plugin allows it. The plugins are asked about the paths of the
+// request, and then about the files they resolve to, see Authorizer: the
+// files of the snapshots and of the trash are authorized at their live path.
+package authorization
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gostor/gofs/pkg/auth"
+	"github.com/gostor/gofs/pkg/errors"
+)
+
+// Request is an operation to authorize.
+type Request struct {
+	// Principal is the authenticated sender of the request, nil if the
+	// authentication is disabled.
+	Principal *auth.Principal `json:"principal,omitempty"`
+	// Namespace is the namespace of the file.
+	Namespace string `json:"namespace"`
+	// Path is the path of the file inside the namespace, "/" for its root.
+	Path string `json:"path"`
+	// Op is the operation, e.g. api.OpsGetFileStatus or api.OpsDelete.
+	Op string `json:"op"`
+	// Method is the HTTP method of the request.
+	Method string `json:"method"`
+}
+
+// Response is the decision of a plugin.
+type Response struct {
+	// Allow is true if the request is allowed.
+	Allow bool `json:"allow"`
+	// Reason explains why the request is denied.
+	Reason string `json:"reason,omitempty"`
+}
+
+// Plugin authorizes the requests.
+type Plugin interface {
+	// Name returns the name of the plugin.
+	Name() string
+	// Authorize returns the decision of the plugin on req. An error means
+	// that no decision could be taken, and the request fails.
+	Authorize(ctx context.Context, req *Request) (*Response, error)
+}
+
+// InitFunc creates a plugin from its argument.
+type InitFunc func(arg string) (Plugin, error)
+
+var (
+	lock    sync.Mutex
+	plugins = map[string]InitFunc{}
+)
+
+// Register makes a plugin available by name.
+func Register(name string, init InitFunc) {
+	lock.Lock()
+	defer lock.Unlock()
+	if _, ok := plugins[name]; ok {
+		panic(fmt.Sprintf("authorization plugin %s registered twice", name))
+	}
+	plugins[name] = init
+}
+
+// Plugins returns the names of the registered plugins.
+func Plugins() []string {
+	lock.Lock()
+	defer lock.Unlock()
+	var names []string
+	for name := range plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewPlugins creates the plugins from their names, in the "name[=arg]" form.
+func NewPlugins(names []string) ([]Plugin, error) {
+	lock.Lock()
+	defer lock.Unlock()
+	var list []Plugin
+	for _, n := range names {
+		parts := strings.SplitN(n, "=", 2)
+		init, ok := plugins[parts[0]]
+		if !ok {
+			return nil, fmt.Errorf("unknown authorization plugin %q", parts[0])
+		}
+		arg := ""
+		if len(parts) == 2 {
+			arg = parts[1]
+		}
+		p, err := init(arg)
+		if err != nil {
+			return nil, fmt.Errorf("authorization plugin %s: %v", parts[0], err)
+		}
+		list = append(list, p)
+	}
+	return list, nil
+}
+
+// authorizerKey is the Authorizer of the request in the context.
+const authorizerKey = "authorizer"
+
+// Authorizer asks the plugins whether the operation of a request may access
+// the file at full path p, like the file its path resolves to.
+type Authorizer func(p string) error
+
+// WithAuthorizer returns a copy of ctx carrying a.
+func WithAuthorizer(ctx context.Context, a Authorizer) context.Context {
+	return context.WithValue(ctx, authorizerKey, a)
+}
+
+// AuthorizerFromContext returns the Authorizer of the request, nil if there
+// are no authorization plugins.
+func AuthorizerFromContext(ctx context.Context) Authorizer {
+	if ctx == nil {
+		return nil
+	}
+	a, _ := ctx.Value(authorizerKey).(Authorizer)
+	return a
+}
+
+// Authorize asks every plugin about req, and fails with a PermissionDenied
+// error as soon as one of them denies it.
+func Authorize(ctx context.Context, list []Plugin, req *Request) error {
+	for _, p := range list {
+		resp, err := p.Authorize(ctx, req)
+		if err != nil {
+			return errors.New(errors.KindInternal, "authorization plugin %s failed: %v", p.Name(), err)
+		}
+		if !resp.Allow {
+			reason := resp.Reason
+			if reason == "" {
+				reason = "denied"
+			}
+			return errors.PermissionDenied("%s %s/%s: %s", req.Op, req.Namespace, strings.TrimPrefix(req.Path, "/"), reason)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package authorization
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/auth"
+	"github.com/gostor/gofs/pkg/errors"
+)
+
+const testPolicy = `
+rules:
+- principals: ["group:admins"]
+  effect: allow
+- principals: ["backup"]
+  namespaces: ["ns"]
+  ops: ["GETFILESTATUS", "LISTSTATUS"]
+  effect: allow
+- paths: ["/private"]
+  effect: deny
+  reason: private files
+`
+
+func TestPolicyPlugin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gofs-policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "policy.yaml")
+	if err = ioutil.WriteFile(file, []byte(testPolicy), 0600); err != nil {
+		t.Fatal(err)
+	}
+	plugins, err := NewPlugins([]string{"policy=" + file})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	admin := &auth.Principal{Name: "root", Groups: []string{"admins"}}
+	backup := &auth.Principal{Name: "backup"}
+	cases := []struct {
+		principal *auth.Principal
+		ns, path  string
+		op        string
+		allow     bool
+	}{
+		{admin, "ns", "/dir", api.OpsDelete, true},
+		{admin, "ns", "/private/f", api.OpsGetFileStatus, false},
+		{backup, "ns", "/dir", api.OpsListStatus, true},
+		{backup, "ns", "/dir", api.OpsDelete, false},
+		{backup, "other", "/dir", api.OpsListStatus, false},
+		{backup, "ns", "/privateer", api.OpsGetFileStatus, true},
+		{nil, "ns", "/dir", api.OpsGetFileStatus, false},
+	}
+	for _, tc := range cases {
+		err := Authorize(context.Background(), plugins, &Request{Principal: tc.principal, Namespace: tc.ns, Path: tc.path, Op: tc.op})
+		if tc.allow && err != nil {
+			t.Fatalf("%v %s %s%s: unexpected error %v", tc.principal, tc.op, tc.ns, tc.path, err)
+		}
+		if !tc.allow && !errors.IsPermissionDenied(err) {
+			t.Fatalf("%v %s %s%s: expected a PermissionDenied error, got %v", tc.principal, tc.op, tc.ns, tc.path, err)
+		}
+	}
+}
+
+func TestWebhookPlugin(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		json.NewEncoder(w).Encode(&Response{Allow: req.Op != api.OpsDelete, Reason: "read only"})
+	}))
+	defer srv.Close()
+
+	plugins, err := NewPlugins([]string{"webhook=" + srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = Authorize(context.Background(), plugins, &Request{Namespace: "ns", Path: "/f", Op: api.OpsOpen}); err != nil {
+		t.Fatal(err)
+	}
+	err = Authorize(context.Background(), plugins, &Request{Namespace: "ns", Path: "/f", Op: api.OpsDelete})
+	if !errors.IsPermissionDenied(err) {
+		t.Fatalf("expected a PermissionDenied error, got %v", err)
+	}
+
+	if _, err = NewPlugins([]string{"unknown"}); err == nil {
+		t.Fatal("expected an error for an unknown plugin")
+	}
+}
@@ -0,0 +1,201 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package authorization
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+func init() {
+	Register("policy", newPolicyPlugin)
+}
+
+// Policy is a list of rules. A request is denied if a deny rule matches it,
+// otherwise it is allowed if an allow rule matches it. Requests matched by
+// no rule are denied.
+//
+// In YAML:
+//
+//	rules:
+//	- principals: ["group:admins"]
+//	  effect: allow
+//	- principals: ["backup"]
+//	  namespaces: ["ns"]
+//	  ops: ["GETFILESTATUS", "LISTSTATUS", "LISTSTATUS_BATCH", "OPEN"]
+//	  effect: allow
+//	- paths: ["/private"]
+//	  effect: deny
+//	  reason: private files
+type Policy struct {
+	Rules []Rule `json:"rules" yaml:"rules"`
+}
+
+// Rule matches the requests whose principal, namespace, path and op match
+// one of its patterns. An empty list of patterns matches everything.
+type Rule struct {
+	// Principals are names, "group:<name>" for the members of a group, or
+	// "*" for every principal.
+	Principals []string `json:"principals" yaml:"principals"`
+	// Namespaces are namespace IDs, or "*".
+	Namespaces []string `json:"namespaces" yaml:"namespaces"`
+	// Paths are path prefixes inside the namespace, "/dir" matching /dir
+	// and everything below it.
+	Paths []string `json:"paths" yaml:"paths"`
+	// Ops are operations, or "*".
+	Ops []string `json:"ops" yaml:"ops"`
+	// Effect is "allow" or "deny".
+	Effect string `json:"effect" yaml:"effect"`
+	// Reason is reported to the clients whose request is denied.
+	Reason string `json:"reason" yaml:"reason"`
+}
+
+const (
+	effectAllow = "allow"
+	effectDeny  = "deny"
+)
+
+// LoadPolicy reads a policy from a JSON or YAML file, depending on its
+// extension.
+func LoadPolicy(file string) (*Policy, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var p Policy
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".json":
+		err = json.Unmarshal(data, &p)
+	default:
+		err = yaml.Unmarshal(data, &p)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %v", file, err)
+	}
+	if err = p.validate(); err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %v", file, err)
+	}
+	return &p, nil
+}
+
+func (p *Policy) validate() error {
+	for i, r := range p.Rules {
+		if r.Effect != effectAllow && r.Effect != effectDeny {
+			return fmt.Errorf("rule %d: effect must be %q or %q, not %q", i+1, effectAllow, effectDeny, r.Effect)
+		}
+	}
+	return nil
+}
+
+// Evaluate returns the decision of the policy on req.
+func (p *Policy) Evaluate(req *Request) *Response {
+	var allowed bool
+	for _, r := range p.Rules {
+		if !r.matches(req) {
+			continue
+		}
+		if r.Effect == effectDeny {
+			reason := r.Reason
+			if reason == "" {
+				reason = "denied by policy"
+			}
+			return &Response{Reason: reason}
+		}
+		allowed = true
+	}
+	if !allowed {
+		return &Response{Reason: "no policy rule allows it"}
+	}
+	return &Response{Allow: true}
+}
+
+func (r *Rule) matches(req *Request) bool {
+	return r.matchPrincipal(req) &&
+		matchAny(r.Namespaces, func(ns string) bool { return ns == "*" || ns == req.Namespace }) &&
+		matchAny(r.Paths, func(prefix string) bool { return hasPathPrefix(req.Path, prefix) }) &&
+		matchAny(r.Ops, func(op string) bool { return op == "*" || strings.EqualFold(op, req.Op) })
+}
+
+func (r *Rule) matchPrincipal(req *Request) bool {
+	return matchAny(r.Principals, func(pattern string) bool {
+		if pattern == "*" {
+			return true
+		}
+		if req.Principal == nil {
+			return false
+		}
+		if strings.HasPrefix(pattern, "group:") {
+			for _, g := range req.Principal.Groups {
+				if g == strings.TrimPrefix(pattern, "group:") {
+					return true
+				}
+			}
+			return false
+		}
+		return pattern == req.Principal.Name
+	})
+}
+
+// matchAny returns true if patterns is empty, or if one of them matches.
+func matchAny(patterns []string, match func(string) bool) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		if match(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasPathPrefix returns true if p is prefix or is below it.
+func hasPathPrefix(p, prefix string) bool {
+	prefix = path.Clean("/" + prefix)
+	return prefix == "/" || p == prefix || strings.HasPrefix(p, prefix+"/")
+}
+
+// policyPlugin authorizes the requests with a policy file.
+type policyPlugin struct {
+	policy *Policy
+}
+
+func newPolicyPlugin(file string) (Plugin, error) {
+	if file == "" {
+		return nil, fmt.Errorf("missing policy file, use policy=<file>")
+	}
+	p, err := LoadPolicy(file)
+	if err != nil {
+		return nil, err
+	}
+	return &policyPlugin{policy: p}, nil
+}
+
+func (p *policyPlugin) Name() string {
+	return "policy"
+}
+
+func (p *policyPlugin) Authorize(ctx context.Context, req *Request) (*Response, error) {
+	return p.policy.Evaluate(req), nil
+}
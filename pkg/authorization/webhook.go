@@ -0,0 +1,83 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package authorization
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+func init() {
+	Register("webhook", newWebhookPlugin)
+}
+
+// webhookTimeout is the longest time a webhook may take to answer.
+const webhookTimeout = 5 * time.Second
+
+// webhookPlugin posts every Request as JSON to a URL, which answers with a
+// Response.
+type webhookPlugin struct {
+	url    string
+	client *http.Client
+}
+
+func newWebhookPlugin(arg string) (Plugin, error) {
+	u, err := url.Parse(arg)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid webhook URL %q, use webhook=<http(s) URL>", arg)
+	}
+	return &webhookPlugin{
+		url:    u.String(),
+		client: &http.Client{Timeout: webhookTimeout},
+	}, nil
+}
+
+func (p *webhookPlugin) Name() string {
+	return "webhook"
+}
+
+func (p *webhookPlugin) Authorize(ctx context.Context, req *Request) (*Response, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	hreq, err := http.NewRequest("POST", p.url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	hreq.Header.Set("Content-Type", "application/json")
+	resp, err := p.client.Do(hreq.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("webhook returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	var r Response
+	if err = json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return nil, fmt.Errorf("invalid webhook response: %v", err)
+	}
+	return &r, nil
+}
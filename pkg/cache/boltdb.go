@@ -17,18 +17,26 @@ limitations under the License.
 package cache
 
 import (
+	"bytes"
 	"encoding/json"
-	"fmt"
 	"os"
 	"path/filepath"
 
 	"github.com/boltdb/bolt"
+	"github.com/gostor/gofs/pkg/errors"
 	"github.com/gostor/gofs/pkg/fs"
 )
 
+// namespacesBucket is the bucket of the namespace registry. The bucket of
+// the files of a namespace is named after its ID, which cannot start with a
+// dot.
+var namespacesBucket = []byte(".namespaces")
+
 // DB -
 type BoltDB struct {
 	*bolt.DB
+	// tx is the transaction of the batch the cache is the view of.
+	tx *bolt.Tx
 }
 
 func init() {
@@ -50,17 +58,56 @@ func Open(path string, mode os.FileMode) (Cache, error) {
 	}
 
 	return &BoltDB{
-		db,
+		DB: db,
 	}, nil
 }
 
-func (db *BoltDB) Add(ns string, f *fs.File) error {
-	tx, err := db.DB.Begin(true)
+// Batch runs fn in a single transaction.
+func (db *BoltDB) Batch(fn func(c Cache) error) error {
+	if db.tx != nil {
+		return fn(db)
+	}
+	tx, err := db.begin(true)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
+	if err = fn(&BoltDB{DB: db.DB, tx: tx}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// begin returns a new transaction, or the one of the batch db is the view
+// of, which the batch commits or rolls back.
+func (db *BoltDB) begin(writable bool) (*bolt.Tx, error) {
+	if db.tx != nil {
+		return db.tx, nil
+	}
+	return db.DB.Begin(writable)
+}
+
+func (db *BoltDB) rollback(tx *bolt.Tx) {
+	if tx != db.tx {
+		tx.Rollback()
+	}
+}
+
+func (db *BoltDB) commit(tx *bolt.Tx) error {
+	if tx == db.tx {
+		return nil
+	}
+	return tx.Commit()
+}
+
+func (db *BoltDB) Add(ns string, f *fs.File) error {
+	tx, err := db.begin(true)
+	if err != nil {
+		return err
+	}
+	defer db.rollback(tx)
+
 	bucket := tx.Bucket([]byte(ns))
 	if bucket == nil {
 		bucket, err = tx.CreateBucket([]byte(ns))
@@ -76,60 +123,267 @@ func (db *BoltDB) Add(ns string, f *fs.File) error {
 		return err
 	}
 	// Commit the transaction and check for error.
-	if err = tx.Commit(); err != nil {
+	if err = db.commit(tx); err != nil {
 		return err
 	}
 	return nil
 }
 
 func (db *BoltDB) Get(ns, name string) (*fs.File, error) {
-	tx, err := db.DB.Begin(true)
+	tx, err := db.begin(false)
 	if err != nil {
 		return nil, err
 	}
-	defer tx.Rollback()
+	defer db.rollback(tx)
 
 	bucket := tx.Bucket([]byte(ns))
 	if bucket == nil {
-		return nil, fmt.Errorf("No such bucket")
+		return nil, errors.NotFound("no such namespace: %s", ns)
+	}
+	data := bucket.Get([]byte(name))
+	if data == nil {
+		return nil, errors.NotFound("no such file: %s", name)
 	}
 	var f fs.File
-	data := bucket.Get([]byte(f.FullPath()))
-	if data != nil {
-		return nil, fmt.Errorf("No such key")
+	if err = json.Unmarshal(data, &f); err != nil {
+		return nil, err
 	}
-	err = json.Unmarshal(data, &f)
+	return &f, nil
+}
+
+func (db *BoltDB) Update(ns, name string, new *fs.File) (*fs.File, error) {
+	tx, err := db.begin(true)
 	if err != nil {
 		return nil, err
 	}
+	defer db.rollback(tx)
+
+	bucket := tx.Bucket([]byte(ns))
+	if bucket == nil {
+		return nil, errors.NotFound("no such namespace: %s", ns)
+	}
+	old := bucket.Get([]byte(name))
+	if old == nil {
+		return nil, errors.NotFound("no such file: %s", name)
+	}
+	var f fs.File
+	if err = json.Unmarshal(old, &f); err != nil {
+		return nil, err
+	}
+	if err = bucket.Delete([]byte(name)); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(new)
+	if err != nil {
+		return nil, err
+	}
+	if err = bucket.Put([]byte(new.FullPath()), data); err != nil {
+		return nil, err
+	}
 	// Commit the transaction and check for error.
-	if err = tx.Commit(); err != nil {
+	if err = db.commit(tx); err != nil {
 		return nil, err
 	}
 	return &f, nil
 }
 
-func (db *BoltDB) Update(ns, name string, new *fs.File) (*fs.File, error) {
-	return nil, nil
-}
-
 func (db *BoltDB) Delete(ns, name string) error {
-	tx, err := db.DB.Begin(true)
+	tx, err := db.begin(true)
 	if err != nil {
 		return err
 	}
-	defer tx.Rollback()
+	defer db.rollback(tx)
 
 	bucket := tx.Bucket([]byte(ns))
 	if bucket == nil {
-		return fmt.Errorf("No such bucket")
+		return errors.NotFound("no such namespace: %s", ns)
 	}
 	if err = bucket.Delete([]byte(name)); err != nil {
 		return err
 	}
 	// Commit the transaction and check for error.
-	if err = tx.Commit(); err != nil {
+	if err = db.commit(tx); err != nil {
 		return err
 	}
 	return nil
 }
+
+func (db *BoltDB) List(ns, dir string) ([]*fs.File, error) {
+	list, _, err := db.ListAfter(ns, dir, "", -1)
+	return list, err
+}
+
+// ListAfter lists the entries of dir after the name after, at most limit of
+// them unless it is negative. It seeks past the subtree of every entry, so
+// that only the entries of dir are read.
+func (db *BoltDB) ListAfter(ns, dir, after string, limit int) ([]*fs.File, int, error) {
+	tx, err := db.begin(false)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer db.rollback(tx)
+
+	list := []*fs.File{}
+	bucket := tx.Bucket([]byte(ns))
+	if bucket == nil {
+		return list, 0, nil
+	}
+	prefix := []byte(dir + "/")
+	remaining := 0
+	c := bucket.Cursor()
+	k, v := c.Seek(append(prefix, after...))
+	for k != nil && bytes.HasPrefix(k, prefix) {
+		name := k[len(prefix):]
+		if i := bytes.IndexByte(name, '/'); i >= 0 {
+			// the keys of the subtree of an entry sort before its name
+			// followed by '0', the byte after '/'
+			k, v = c.Seek(append(append([]byte{}, k[:len(prefix)+i]...), '0'))
+			continue
+		}
+		if string(name) > after {
+			if limit >= 0 && len(list) >= limit {
+				remaining++
+			} else {
+				var f fs.File
+				if err = json.Unmarshal(v, &f); err != nil {
+					return nil, 0, err
+				}
+				list = append(list, &f)
+			}
+		}
+		k, v = c.Next()
+	}
+	return list, remaining, nil
+}
+
+func (db *BoltDB) NextInode(ns string) (uint64, error) {
+	tx, err := db.begin(true)
+	if err != nil {
+		return 0, err
+	}
+	defer db.rollback(tx)
+
+	bucket, err := tx.CreateBucketIfNotExists([]byte(ns))
+	if err != nil {
+		return 0, err
+	}
+	id, err := bucket.NextSequence()
+	if err != nil {
+		return 0, err
+	}
+	// Commit the transaction and check for error.
+	if err = db.commit(tx); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (db *BoltDB) SetInode(ns string, ino uint64) error {
+	tx, err := db.begin(true)
+	if err != nil {
+		return err
+	}
+	defer db.rollback(tx)
+
+	bucket, err := tx.CreateBucketIfNotExists([]byte(ns))
+	if err != nil {
+		return err
+	}
+	if err = bucket.SetSequence(ino); err != nil {
+		return err
+	}
+	return db.commit(tx)
+}
+
+func (db *BoltDB) AddNamespace(ns *fs.Namespace) error {
+	tx, err := db.begin(true)
+	if err != nil {
+		return err
+	}
+	defer db.rollback(tx)
+
+	bucket, err := tx.CreateBucketIfNotExists(namespacesBucket)
+	if err != nil {
+		return err
+	}
+	if bucket.Get([]byte(ns.ID)) != nil {
+		return errors.AlreadyExists("namespace %s already exists", ns.ID)
+	}
+	data, err := json.Marshal(ns)
+	if err != nil {
+		return err
+	}
+	if err = bucket.Put([]byte(ns.ID), data); err != nil {
+		return err
+	}
+	return db.commit(tx)
+}
+
+func (db *BoltDB) GetNamespace(id string) (*fs.Namespace, error) {
+	tx, err := db.begin(false)
+	if err != nil {
+		return nil, err
+	}
+	defer db.rollback(tx)
+
+	var data []byte
+	if bucket := tx.Bucket(namespacesBucket); bucket != nil {
+		data = bucket.Get([]byte(id))
+	}
+	if data == nil {
+		return nil, errors.NotFound("no such namespace: %s", id)
+	}
+	var ns fs.Namespace
+	if err = json.Unmarshal(data, &ns); err != nil {
+		return nil, err
+	}
+	return &ns, nil
+}
+
+func (db *BoltDB) ListNamespaces() ([]*fs.Namespace, error) {
+	tx, err := db.begin(false)
+	if err != nil {
+		return nil, err
+	}
+	defer db.rollback(tx)
+
+	list := []*fs.Namespace{}
+	bucket := tx.Bucket(namespacesBucket)
+	if bucket == nil {
+		return list, nil
+	}
+	err = bucket.ForEach(func(k, v []byte) error {
+		var ns fs.Namespace
+		if err := json.Unmarshal(v, &ns); err != nil {
+			return err
+		}
+		list = append(list, &ns)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (db *BoltDB) DeleteNamespace(id string) error {
+	tx, err := db.begin(true)
+	if err != nil {
+		return err
+	}
+	defer db.rollback(tx)
+
+	bucket := tx.Bucket(namespacesBucket)
+	if bucket == nil || bucket.Get([]byte(id)) == nil {
+		return errors.NotFound("no such namespace: %s", id)
+	}
+	if err = bucket.Delete([]byte(id)); err != nil {
+		return err
+	}
+	if tx.Bucket([]byte(id)) != nil {
+		if err = tx.DeleteBucket([]byte(id)); err != nil {
+			return err
+		}
+	}
+	return db.commit(tx)
+}
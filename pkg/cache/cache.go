@@ -29,6 +29,29 @@ type Cache interface {
 	Get(ns, name string) (*fs.File, error)
 	Update(ns, name string, new *fs.File) (*fs.File, error)
 	Delete(ns, name string) error
+	// List returns the entries of the directory dir, sorted by name.
+	List(ns, dir string) ([]*fs.File, error)
+	// ListAfter returns at most limit entries of the directory dir whose
+	// names sort after the name after, sorted by name, and the number of
+	// entries left after them.
+	ListAfter(ns, dir, after string, limit int) ([]*fs.File, int, error)
+	// NextInode allocates a new inode number in the namespace.
+	NextInode(ns string) (uint64, error)
+	// SetInode sets the last inode number allocated in the namespace.
+	SetInode(ns string, ino uint64) error
+
+	// AddNamespace registers the namespace ns, whose ID must be unused.
+	AddNamespace(ns *fs.Namespace) error
+	// GetNamespace returns the namespace id.
+	GetNamespace(id string) (*fs.Namespace, error)
+	// ListNamespaces returns the namespaces, sorted by ID.
+	ListNamespaces() ([]*fs.Namespace, error)
+	// DeleteNamespace removes the namespace id along with its files.
+	DeleteNamespace(id string) error
+
+	// Batch calls fn with a view of the cache whose changes are all made
+	// at once if fn succeeds, and none of them otherwise.
+	Batch(fn func(c Cache) error) error
 }
 
 type cacheInitFunc func(p string, m os.FileMode) (Cache, error)
@@ -42,3 +65,24 @@ func NewCache(t, p string, mode os.FileMode) (Cache, error) {
 
 	return nil, fmt.Errorf("Unknown cache type: %v", t)
 }
+
+// Summarize walks the tree of f to return its summary, f included, without
+// relying on the summaries its directories keep.
+func Summarize(c Cache, ns string, f *fs.File) (fs.Summary, error) {
+	s := f.Entry()
+	if !f.IsDirectory() {
+		return s, nil
+	}
+	children, err := c.List(ns, f.FullPath())
+	if err != nil {
+		return fs.Summary{}, err
+	}
+	for _, child := range children {
+		cs, err := Summarize(c, ns, child)
+		if err != nil {
+			return fs.Summary{}, err
+		}
+		s = s.Add(cs)
+	}
+	return s, nil
+}
@@ -17,10 +17,12 @@ limitations under the License.
 package cache
 
 import (
-	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
 	"sync"
 
+	"github.com/gostor/gofs/pkg/errors"
 	"github.com/gostor/gofs/pkg/fs"
 )
 
@@ -28,7 +30,15 @@ import (
 type Memory struct {
 	Namespace map[string]*fs.Namespace
 	Files     map[string]map[string]*fs.File
+	// children are the sorted names of the entries of the directories, by
+	// namespace and full path of the directory, so that listing a
+	// directory does not scan the whole namespace.
+	children map[string]map[string][]string
+	inodes   map[string]uint64
 	lock      sync.RWMutex
+	// undo restores, in reverse order, what the changes of the batch the
+	// cache is the view of replaced. The batch holds the lock.
+	undo *[]func()
 }
 
 func init() {
@@ -43,55 +53,281 @@ func memoryOpen(path string, mode os.FileMode) (Cache, error) {
 	return &Memory{
 		Namespace: map[string]*fs.Namespace{},
 		Files:     map[string]map[string]*fs.File{},
+		children:  map[string]map[string][]string{},
+		inodes:    map[string]uint64{},
 	}, nil
 }
 
-func (db *Memory) Add(ns string, f *fs.File) error {
+// Batch runs fn with the cache locked, and reverts the changes of fn if it
+// fails.
+func (db *Memory) Batch(fn func(c Cache) error) error {
+	if db.undo != nil {
+		return fn(db)
+	}
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	undo := []func(){}
+	err := fn(&Memory{Namespace: db.Namespace, Files: db.Files, children: db.children, inodes: db.inodes, undo: &undo})
+	if err != nil {
+		for i := len(undo) - 1; i >= 0; i-- {
+			undo[i]()
+		}
+	}
+	return err
+}
+
+func (db *Memory) writeLock() func() {
+	if db.undo != nil {
+		return func() {}
+	}
+	db.lock.Lock()
+	return db.lock.Unlock
+}
+
+func (db *Memory) readLock() func() {
+	if db.undo != nil {
+		return func() {}
+	}
 	db.lock.RLock()
-	defer db.lock.RUnlock()
-	if _, ok := db.Files[ns]; !ok {
-		db.Files[ns] = map[string]*fs.File{}
+	return db.lock.RUnlock
+}
+
+// saveFile records how to restore the entry name of the namespace ns, if
+// the cache is the view of a batch.
+func (db *Memory) saveFile(ns, name string) {
+	if db.undo == nil {
+		return
 	}
-	db.Files[ns][f.FullPath()] = f
+	files, ok := db.Files[ns]
+	f, exists := files[name]
+	*db.undo = append(*db.undo, func() {
+		switch {
+		case !ok:
+			delete(db.Files, ns)
+			delete(db.children, ns)
+		case exists:
+			db.put(ns, name, f)
+		default:
+			db.remove(ns, name)
+		}
+	})
+}
+
+// put sets the entry name of the namespace ns to f, and adds it to the
+// children of its directory if it is new.
+func (db *Memory) put(ns, name string, f *fs.File) {
+	files, ok := db.Files[ns]
+	if !ok {
+		files = map[string]*fs.File{}
+		db.Files[ns] = files
+	}
+	if _, exists := files[name]; !exists {
+		dirs, ok := db.children[ns]
+		if !ok {
+			dirs = map[string][]string{}
+			db.children[ns] = dirs
+		}
+		dir, base := filepath.Dir(name), filepath.Base(name)
+		names := dirs[dir]
+		i := sort.SearchStrings(names, base)
+		names = append(names, "")
+		copy(names[i+1:], names[i:])
+		names[i] = base
+		dirs[dir] = names
+	}
+	files[name] = f
+}
+
+// remove removes the entry name of the namespace ns, and from the children
+// of its directory.
+func (db *Memory) remove(ns, name string) {
+	files := db.Files[ns]
+	if _, ok := files[name]; !ok {
+		return
+	}
+	delete(files, name)
+	dirs := db.children[ns]
+	dir, base := filepath.Dir(name), filepath.Base(name)
+	names := dirs[dir]
+	if i := sort.SearchStrings(names, base); i < len(names) && names[i] == base {
+		names = append(names[:i], names[i+1:]...)
+	}
+	if len(names) == 0 {
+		delete(dirs, dir)
+	} else {
+		dirs[dir] = names
+	}
+}
+
+// saveNamespace records how to restore the namespace id, its files and its
+// last inode, if the cache is the view of a batch.
+func (db *Memory) saveNamespace(id string) {
+	if db.undo == nil {
+		return
+	}
+	ns, ok := db.Namespace[id]
+	files, hasFiles := db.Files[id]
+	dirs, hasDirs := db.children[id]
+	ino, hasIno := db.inodes[id]
+	*db.undo = append(*db.undo, func() {
+		if ok {
+			db.Namespace[id] = ns
+		} else {
+			delete(db.Namespace, id)
+		}
+		if hasFiles {
+			db.Files[id] = files
+		} else {
+			delete(db.Files, id)
+		}
+		if hasDirs {
+			db.children[id] = dirs
+		} else {
+			delete(db.children, id)
+		}
+		if hasIno {
+			db.inodes[id] = ino
+		} else {
+			delete(db.inodes, id)
+		}
+	})
+}
+
+func (db *Memory) Add(ns string, f *fs.File) error {
+	defer db.writeLock()()
+	db.saveFile(ns, f.FullPath())
+	db.put(ns, f.FullPath(), f)
 	return nil
 }
 
 func (db *Memory) Get(ns, name string) (*fs.File, error) {
-	var f *fs.File
-	db.lock.RLock()
-	defer db.lock.RUnlock()
-	if files, ok := db.Files[ns]; ok {
-		f = files[name]
-	} else {
-		return nil, fmt.Errorf("no such file")
+	defer db.readLock()()
+	files, ok := db.Files[ns]
+	if !ok {
+		return nil, errors.NotFound("no such file: %s", name)
 	}
-	return f, nil
+	f, ok := files[name]
+	if !ok {
+		return nil, errors.NotFound("no such file: %s", name)
+	}
+	c := *f
+	return &c, nil
 }
 
 func (db *Memory) Update(ns, name string, new *fs.File) (*fs.File, error) {
-	db.lock.Lock()
-	defer db.lock.Unlock()
-	if files, ok := db.Files[ns]; !ok {
-		return nil, fmt.Errorf("no such file")
-	} else {
-		if _, ok = files[name]; !ok {
-			return nil, fmt.Errorf("no such file")
-		}
+	defer db.writeLock()()
+	files, ok := db.Files[ns]
+	if !ok {
+		return nil, errors.NotFound("no such file: %s", name)
+	}
+	old, ok := files[name]
+	if !ok {
+		return nil, errors.NotFound("no such file: %s", name)
 	}
-	db.Files[ns][new.FullPath()] = new
-	return nil, nil
+	db.saveFile(ns, name)
+	db.saveFile(ns, new.FullPath())
+	db.remove(ns, name)
+	db.put(ns, new.FullPath(), new)
+	return old, nil
 }
 
 func (db *Memory) Delete(ns, name string) error {
-	db.lock.Lock()
-	defer db.lock.Unlock()
+	defer db.writeLock()()
 	if files, ok := db.Files[ns]; !ok {
-		return fmt.Errorf("no such file")
+		return errors.NotFound("no such file: %s", name)
 	} else {
 		if _, ok = files[name]; !ok {
-			return fmt.Errorf("no such file")
+			return errors.NotFound("no such file: %s", name)
 		}
 	}
-	delete(db.Files[ns], name)
+	db.saveFile(ns, name)
+	db.remove(ns, name)
+	return nil
+}
+
+func (db *Memory) List(ns, dir string) ([]*fs.File, error) {
+	defer db.readLock()()
+	return db.copies(ns, dir, db.children[ns][dir]), nil
+}
+
+func (db *Memory) ListAfter(ns, dir, after string, limit int) ([]*fs.File, int, error) {
+	defer db.readLock()()
+	names := db.children[ns][dir]
+	names = names[sort.Search(len(names), func(i int) bool { return names[i] > after }):]
+	remaining := 0
+	if len(names) > limit {
+		names, remaining = names[:limit], len(names)-limit
+	}
+	return db.copies(ns, dir, names), remaining, nil
+}
+
+// copies returns copies of the entries names of the directory dir.
+func (db *Memory) copies(ns, dir string, names []string) []*fs.File {
+	list := make([]*fs.File, 0, len(names))
+	for _, name := range names {
+		c := *db.Files[ns][filepath.Join(dir, name)]
+		list = append(list, &c)
+	}
+	return list
+}
+
+func (db *Memory) NextInode(ns string) (uint64, error) {
+	defer db.writeLock()()
+	db.saveNamespace(ns)
+	db.inodes[ns]++
+	return db.inodes[ns], nil
+}
+
+func (db *Memory) SetInode(ns string, ino uint64) error {
+	defer db.writeLock()()
+	db.saveNamespace(ns)
+	db.inodes[ns] = ino
+	return nil
+}
+
+func (db *Memory) AddNamespace(ns *fs.Namespace) error {
+	defer db.writeLock()()
+	if _, ok := db.Namespace[ns.ID]; ok {
+		return errors.AlreadyExists("namespace %s already exists", ns.ID)
+	}
+	db.saveNamespace(ns.ID)
+	db.Namespace[ns.ID] = fs.NewNamespace(ns.ID, &ns.Config, nil)
+	return nil
+}
+
+func (db *Memory) GetNamespace(id string) (*fs.Namespace, error) {
+	defer db.readLock()()
+	ns, ok := db.Namespace[id]
+	if !ok {
+		return nil, errors.NotFound("no such namespace: %s", id)
+	}
+	return fs.NewNamespace(ns.ID, &ns.Config, nil), nil
+}
+
+func (db *Memory) ListNamespaces() ([]*fs.Namespace, error) {
+	defer db.readLock()()
+	ids := make([]string, 0, len(db.Namespace))
+	for id := range db.Namespace {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	list := make([]*fs.Namespace, 0, len(ids))
+	for _, id := range ids {
+		ns := db.Namespace[id]
+		list = append(list, fs.NewNamespace(ns.ID, &ns.Config, nil))
+	}
+	return list, nil
+}
+
+func (db *Memory) DeleteNamespace(id string) error {
+	defer db.writeLock()()
+	if _, ok := db.Namespace[id]; !ok {
+		return errors.NotFound("no such namespace: %s", id)
+	}
+	db.saveNamespace(id)
+	delete(db.Namespace, id)
+	delete(db.Files, id)
+	delete(db.children, id)
+	delete(db.inodes, id)
 	return nil
 }
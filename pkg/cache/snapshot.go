@@ -0,0 +1,162 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/gostor/gofs/pkg/errors"
+	"github.com/gostor/gofs/pkg/fs"
+)
+
+// SnapshotRoot returns the snapshottable directory of the namespace whose
+// tree has the full path p, and the path of p relative to it, or nil if p is
+// in none.
+func SnapshotRoot(c Cache, ns, p string) (*fs.File, string, error) {
+	root, err := c.Get(ns, fs.Root(ns).FullPath())
+	if errors.IsNotFound(err) {
+		return nil, "", nil
+	} else if err != nil {
+		return nil, "", err
+	}
+	for _, dir := range root.SnapshotDirs {
+		if p != dir && !strings.HasPrefix(p, dir+"/") {
+			continue
+		}
+		if dir == root.FullPath() {
+			return root, p[len(dir):], nil
+		}
+		f, err := c.Get(ns, dir)
+		if err != nil {
+			return nil, "", err
+		}
+		return f, p[len(dir):], nil
+	}
+	return nil, "", nil
+}
+
+// SnapshotFile returns the file rel of the snapshottable directory dir as it
+// was in the snapshot s, or NotFound if it did not exist. It is the first
+// copy of the file kept for s or a later snapshot, or the current file.
+//
+// The file returned is browsed below parent, its directory in the snapshot,
+// or the directory of the snapshots of dir for dir itself. It keeps the
+// object key of its data, and its links refer to the snapshot too.
+func SnapshotFile(c Cache, ns string, dir *fs.File, s fs.Snapshot, rel string, parent *fs.File) (*fs.File, error) {
+	full := dir.FullPath()
+	var f *fs.File
+	for _, t := range dir.Snapshots {
+		if t.ID < s.ID {
+			continue
+		}
+		saved, err := c.Get(ns, fs.SnapshotKey(full, t.ID, rel))
+		if errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		f = saved
+		break
+	}
+	if f == nil {
+		var err error
+		if f, err = c.Get(ns, full+rel); err != nil {
+			if errors.IsNotFound(err) {
+				return nil, errors.NotFound("no such file or directory: %s", fs.SnapshotPath(full, s.Name, rel))
+			}
+			return nil, err
+		}
+	}
+	if f.Absent {
+		return nil, errors.NotFound("no such file or directory: %s", fs.SnapshotPath(full, s.Name, rel))
+	}
+	if !f.IsDirectory() && !f.IsSymlink() && !f.IsLink() {
+		f.Object = f.ObjectKey()
+	}
+	if parent == nil {
+		parent = &fs.File{Path: path.Join(full, fs.SnapshotDir), Directory: true, Attr: dir.Attr}
+	}
+	f.Parent = parent
+	if rel == "" {
+		f.Path = s.Name
+	} else {
+		f.Path = path.Base(rel)
+	}
+	f.Snapshots = nil
+	f.SnapshotDirs = nil
+	if f.IsLink() {
+		f.Target = snapshotPath(full, s.Name, f.Target)
+	}
+	if len(f.Links) > 0 {
+		links := make([]string, len(f.Links))
+		for i, p := range f.Links {
+			links[i] = snapshotPath(full, s.Name, p)
+		}
+		f.Links = links
+	}
+	return f, nil
+}
+
+// SnapshotList returns the entries of the directory rel of dir in the
+// snapshot s, sorted by name. parent is the directory in the snapshot.
+func SnapshotList(c Cache, ns string, dir *fs.File, s fs.Snapshot, rel string, parent *fs.File) ([]*fs.File, error) {
+	full := dir.FullPath()
+	// the entries are those of the current directory or of its copies
+	dirs := []string{full + rel}
+	for _, t := range dir.Snapshots {
+		if t.ID >= s.ID {
+			dirs = append(dirs, fs.SnapshotKey(full, t.ID, rel))
+		}
+	}
+	names := map[string]bool{}
+	for _, d := range dirs {
+		children, err := c.List(ns, d)
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range children {
+			names[child.Path] = true
+		}
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	list := make([]*fs.File, 0, len(sorted))
+	for _, name := range sorted {
+		f, err := SnapshotFile(c, ns, dir, s, rel+"/"+name, parent)
+		if errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		list = append(list, f)
+	}
+	return list, nil
+}
+
+// snapshotPath returns the path the file at full path p is browsed at in the
+// snapshot name of dir, if it is in the tree of dir.
+func snapshotPath(dir, name, p string) string {
+	if p == dir || strings.HasPrefix(p, dir+"/") {
+		return fs.SnapshotPath(dir, name, p[len(dir):])
+	}
+	return p
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"hash"
+	"hash/crc32"
+	"io"
+	"net/http"
+
+	"github.com/gostor/gofs/pkg/api"
+)
+
+// checksum is a checksum of the content read, and its expected value.
+type checksum struct {
+	algorithm string
+	hash      hash.Hash
+	expected  []byte
+}
+
+// verifyingReader verifies the content of a file against the checksums sent
+// with it once it is read to the end.
+type verifyingReader struct {
+	io.ReadCloser
+	path      string
+	checksums []checksum
+}
+
+// newVerifyingReader returns a reader of body verifying the checksums of the
+// header. body is returned as is if the header has none.
+func newVerifyingReader(p string, body io.ReadCloser, header http.Header) io.ReadCloser {
+	r := &verifyingReader{ReadCloser: body, path: p}
+	if v, err := base64.StdEncoding.DecodeString(header.Get(api.ContentMD5Header)); err == nil && len(v) == md5.Size {
+		r.checksums = append(r.checksums, checksum{"MD5", md5.New(), v})
+	}
+	if v, err := hex.DecodeString(header.Get(api.ChecksumCRC32CHeader)); err == nil && len(v) == crc32.Size {
+		r.checksums = append(r.checksums, checksum{"CRC32C", crc32.New(crc32.MakeTable(crc32.Castagnoli)), v})
+	}
+	if v, err := hex.DecodeString(header.Get(api.ChecksumSHA256Header)); err == nil && len(v) == sha256.Size {
+		r.checksums = append(r.checksums, checksum{"SHA-256", sha256.New(), v})
+	}
+	if len(r.checksums) == 0 {
+		return body
+	}
+	return r
+}
+
+func (r *verifyingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	for _, c := range r.checksums {
+		c.hash.Write(p[:n])
+	}
+	if err == io.EOF {
+		for _, c := range r.checksums {
+			if actual := c.hash.Sum(nil); !bytes.Equal(actual, c.expected) {
+				return n, &ChecksumError{
+					Path:      r.path,
+					Algorithm: c.algorithm,
+					Expected:  hex.EncodeToString(c.expected),
+					Actual:    hex.EncodeToString(actual),
+				}
+			}
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/url"
+	"strconv"
+	"sync"
+
+	"github.com/gostor/gofs/pkg/api"
+)
+
+// DefaultChunkSize is the default size of the chunks of the files uploaded
+// in chunks.
+const DefaultChunkSize = 64 << 20
+
+// ChunkOptions are the options of CreateChunked.
+type ChunkOptions struct {
+	// ChunkSize is the size of the chunks, DefaultChunkSize if it is 0.
+	// The server may refuse the chunks smaller than its minimum.
+	ChunkSize int64
+	// Parallel is the number of chunks uploaded at once, 1 if it is 0.
+	Parallel int
+}
+
+// CreateChunked writes the size bytes of r to the file p, split in chunks of
+// a fixed size which are each stored in an object of their own. The chunks
+// are uploaded in parallel, a chunk the server finds corrupted being sent
+// again alone, and the file is then created of all of them at once. The
+// chunks of a failed upload are left to the garbage collection of the
+// namespace. Unlike Create, the checksums of the whole content are not
+// recorded, and opts.SHA256 is ignored.
+func (c *Client) CreateChunked(ctx context.Context, p string, r io.ReaderAt, size int64, opts CreateOptions, chunkOpts ChunkOptions) error {
+	chunkSize := chunkOpts.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	if size <= chunkSize {
+		return c.Create(ctx, p, io.NewSectionReader(r, 0, size), opts)
+	}
+	parallel := chunkOpts.Parallel
+	if parallel <= 0 {
+		parallel = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	chunks := make([]api.Chunk, (size+chunkSize-1)/chunkSize)
+	indices := make(chan int)
+	errs := make(chan error, parallel)
+	var wg sync.WaitGroup
+	for w := 0; w < parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				off := int64(i) * chunkSize
+				n := chunkSize
+				if size-off < n {
+					n = size - off
+				}
+				chunk, err := c.uploadChunk(ctx, p, io.NewSectionReader(r, off, n), opts.Overwrite)
+				if err != nil {
+					errs <- err
+					cancel()
+					return
+				}
+				chunks[i] = *chunk
+			}
+		}()
+	}
+feed:
+	for i := range chunks {
+		select {
+		case indices <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(indices)
+	wg.Wait()
+	close(errs)
+	if err := <-errs; err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.CommitChunks(ctx, p, chunks, opts)
+}
+
+// uploadChunk uploads the chunk r of the file p, again as long as the
+// server finds it corrupted, up to MaxRetries times.
+func (c *Client) uploadChunk(ctx context.Context, p string, r io.ReadSeeker, overwrite bool) (*api.Chunk, error) {
+	for attempt := 0; ; attempt++ {
+		chunk, err := c.UploadChunk(ctx, p, r, overwrite)
+		if err == nil || attempt >= c.MaxRetries || !IsChecksumError(err) {
+			return chunk, err
+		}
+		if _, err = r.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// UploadChunk uploads the content of r as a chunk of the file p, which
+// CommitChunks creates of its chunks. The server checks the chunk against
+// its MD5, computed first.
+func (c *Client) UploadChunk(ctx context.Context, p string, r io.ReadSeeker, overwrite bool) (*api.Chunk, error) {
+	h := md5.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	params := url.Values{}
+	params.Set("overwrite", strconv.FormatBool(overwrite))
+	params.Set("md5", hex.EncodeToString(h.Sum(nil)))
+	resp, err := c.do(ctx, "PUT", p, api.OpsUploadChunk, params, r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var chunk api.ChunkResponse
+	if err = json.NewDecoder(resp.Body).Decode(&chunk); err != nil {
+		return nil, err
+	}
+	return &chunk.Chunk, nil
+}
+
+// CommitChunks creates the file p of the chunks uploaded by UploadChunk, in
+// order. They must all have the size of the first one but the last, which
+// cannot be larger.
+func (c *Client) CommitChunks(ctx context.Context, p string, chunks []api.Chunk, opts CreateOptions) error {
+	data, err := json.Marshal(&api.Chunks{Chunk: chunks})
+	if err != nil {
+		return err
+	}
+	params := url.Values{}
+	params.Set("overwrite", strconv.FormatBool(opts.Overwrite))
+	if opts.Permission != 0 {
+		params.Set("permission", formatPermission(opts.Permission))
+	}
+	resp, err := c.do(ctx, "PUT", p, api.OpsCommitChunks, params, &jsonBody{bytes.NewReader(data)})
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
@@ -0,0 +1,431 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package client is a Go client for the GoFS metadata API.
+//
+// The client sends every request to the raft leader of the cluster, which it
+// discovers from the /cluster/status of any of its endpoints. Requests failing
+// because the leader has changed, or because of a transient error, are retried.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/auth"
+	"github.com/gostor/gofs/pkg/version"
+)
+
+const (
+	// DefaultMaxRetries is the default number of times a request is retried.
+	DefaultMaxRetries = 5
+	// DefaultBackoff is the default delay before the first retry.
+	DefaultBackoff = 100 * time.Millisecond
+)
+
+// Client talks to the metadata API of a GoFS cluster.
+type Client struct {
+	// MaxRetries is the number of times a failed request is retried.
+	MaxRetries int
+	// Backoff is the delay before the first retry, doubled on every retry.
+	Backoff time.Duration
+	// HTTPClient is used to send the requests.
+	HTTPClient *http.Client
+	// APIVersion is the version of the metadata API requested by the client.
+	// The server serves its current version if it is empty.
+	APIVersion string
+	// AccessKey and SecretKey sign the requests to the namespaces.
+	AccessKey string
+	SecretKey string
+	// Token is the bearer token of a service account. It is used instead
+	// of the keys if it is set.
+	Token string
+
+	endpoints []*url.URL
+
+	lock   sync.Mutex
+	leader *url.URL
+}
+
+// New returns a client for the cluster serving at the endpoints, e.g.
+// "http://127.0.0.1:9876".
+func New(endpoints ...string) (*Client, error) {
+	if len(endpoints) == 0 {
+		return nil, errors.New("bad parameter: no endpoint")
+	}
+	c := &Client{
+		MaxRetries: DefaultMaxRetries,
+		Backoff:    DefaultBackoff,
+		HTTPClient: http.DefaultClient,
+	}
+	for _, ep := range endpoints {
+		u, err := parseEndpoint(ep)
+		if err != nil {
+			return nil, err
+		}
+		c.endpoints = append(c.endpoints, u)
+	}
+	return c, nil
+}
+
+// parseEndpoint parses addresses like "127.0.0.1:9876", "tcp://127.0.0.1:9876"
+// or "http://127.0.0.1:9876".
+func parseEndpoint(ep string) (*url.URL, error) {
+	ep = strings.TrimSpace(ep)
+	if i := strings.Index(ep, "://"); i >= 0 && ep[:i] == "tcp" {
+		ep = ep[i+3:]
+	}
+	if !strings.Contains(ep, "://") {
+		ep = "http://" + ep
+	}
+	return url.Parse(ep)
+}
+
+// Leader returns the endpoint of the raft leader, discovering it if it is
+// not known yet.
+func (c *Client) Leader(ctx context.Context) (*url.URL, error) {
+	c.lock.Lock()
+	leader := c.leader
+	c.lock.Unlock()
+	if leader != nil {
+		return leader, nil
+	}
+	return c.discoverLeader(ctx)
+}
+
+// discoverLeader asks the endpoints for the current raft leader. If none of
+// them knows it, the first reachable endpoint is used.
+func (c *Client) discoverLeader(ctx context.Context) (*url.URL, error) {
+	var (
+		reachable *url.URL
+		lastErr   error
+	)
+	for _, ep := range c.endpoints {
+		status, err := c.clusterStatus(ctx, ep)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if reachable == nil {
+			reachable = ep
+		}
+		if status.Leader == "" {
+			continue
+		}
+		leader := ep
+		if !status.IsLeader {
+			if leader, err = parseEndpoint(status.Leader); err != nil {
+				lastErr = err
+				continue
+			}
+		}
+		c.setLeader(leader)
+		return leader, nil
+	}
+	if reachable == nil {
+		if lastErr == nil {
+			lastErr = errors.New("no reachable endpoint")
+		}
+		return nil, lastErr
+	}
+	c.setLeader(reachable)
+	return reachable, nil
+}
+
+func (c *Client) setLeader(u *url.URL) {
+	c.lock.Lock()
+	c.leader = u
+	c.lock.Unlock()
+}
+
+func (c *Client) clusterStatus(ctx context.Context, ep *url.URL) (*api.RaftClusterStatusResponse, error) {
+	u := *ep
+	u.Path = path.Join("/", u.Path, "cluster/status")
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.HTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, decodeError(resp)
+	}
+	var status api.RaftClusterStatusResponse
+	if err = json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// do sends the op request for the file p to the leader, and returns the
+// response if it succeeds. The request is retried when the leader changed
+// or a transient error happened, unless its body cannot be replayed. See
+// retryable for the requests which change the namespace.
+func (c *Client) do(ctx context.Context, method, p, op string, params url.Values, body io.Reader) (*http.Response, error) {
+	if params == nil {
+		params = url.Values{}
+	}
+	if op != "" {
+		params.Set("op", op)
+	}
+
+	backoff := c.Backoff
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, method, p, params, body)
+		if err == nil {
+			return resp, nil
+		}
+		if attempt >= c.MaxRetries || ctx.Err() != nil || !retryable(method, err) {
+			return nil, err
+		}
+		if body != nil {
+			seeker, ok := body.(io.Seeker)
+			if !ok {
+				return nil, err
+			}
+			if _, serr := seeker.Seek(0, io.SeekStart); serr != nil {
+				return nil, err
+			}
+		}
+		if IsNotLeader(err) || isNetError(err) {
+			// forget the leader, it is discovered again on the next attempt
+			c.setLeader(nil)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (c *Client) send(ctx context.Context, method, p string, params url.Values, body io.Reader) (*http.Response, error) {
+	leader, err := c.Leader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	u := *leader
+	if c.APIVersion != "" {
+		u.Path = path.Join("/", u.Path, "v"+c.APIVersion, p)
+	} else {
+		u.Path = path.Join("/", u.Path, p)
+	}
+	u.RawQuery = params.Encode()
+
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		// do not let the transport close a body which may be replayed
+		req.Body = ioutil.NopCloser(body)
+		if _, ok := body.(*jsonBody); ok {
+			req.Header.Set("Content-Type", "application/json")
+		}
+	}
+	if id, ok := ctx.Value(callerKey).(*callerID); ok {
+		req.Header.Set(auth.UidHeader, strconv.FormatUint(uint64(id.uid), 10))
+		req.Header.Set(auth.GidsHeader, joinGids(id.gids))
+	}
+	c.authenticate(req, p)
+	resp, err := c.HTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		return nil, decodeError(resp)
+	}
+	return resp, nil
+}
+
+// callerKey is the local user a request is sent for in the context.
+const callerKey = "caller"
+
+type callerID struct {
+	uid  uint32
+	gids []uint32
+}
+
+// WithCaller returns a copy of ctx whose requests act for the local user uid
+// with the groups gids, the primary one first. The server only honours it
+// for the trusted principals, like the keys of the namespaces configured so.
+func WithCaller(ctx context.Context, uid uint32, gids []uint32) context.Context {
+	return context.WithValue(ctx, callerKey, &callerID{uid: uid, gids: gids})
+}
+
+func joinGids(gids []uint32) string {
+	s := make([]string, len(gids))
+	for i, g := range gids {
+		s[i] = strconv.FormatUint(uint64(g), 10)
+	}
+	return strings.Join(s, ",")
+}
+
+// authenticate adds the credentials of the client to the request for the
+// file p.
+func (c *Client) authenticate(req *http.Request, p string) {
+	switch {
+	case c.Token != "":
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	case c.AccessKey != "":
+		ns := strings.SplitN(strings.TrimPrefix(path.Clean("/"+p), "/"), "/", 2)[0]
+		auth.Sign(req, ns, c.AccessKey, c.SecretKey, time.Now())
+	}
+}
+
+// doJSON sends the op request and decodes the JSON response into v.
+func (c *Client) doJSON(ctx context.Context, method, p, op string, params url.Values, v interface{}) error {
+	resp, err := c.do(ctx, method, p, op, params, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// jsonBody is a JSON request body, which can be replayed.
+type jsonBody struct {
+	*bytes.Reader
+}
+
+// sendJSON sends the JSON encoding of in to p, and decodes the response
+// into out unless it is nil.
+func (c *Client) sendJSON(ctx context.Context, method, p string, in, out interface{}) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(ctx, method, p, "", nil, &jsonBody{bytes.NewReader(data)})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func isNetError(err error) bool {
+	if uerr, ok := err.(*url.Error); ok {
+		err = uerr.Err
+	}
+	_, ok := err.(net.Error)
+	return ok
+}
+
+// isDialError returns true if err is a failure to connect to the server,
+// which thus never received the request.
+func isDialError(err error) bool {
+	if uerr, ok := err.(*url.Error); ok {
+		err = uerr.Err
+	}
+	oerr, ok := err.(*net.OpError)
+	return ok && oerr.Op == "dial"
+}
+
+// retryable returns true if the request sent with method failed because the
+// leader changed or because of a transient error. The requests which change
+// the namespace may have been applied when the connection broke or a gateway
+// failed, and retrying them could apply them twice. They are only retried
+// when they surely were not: when the server could not be reached, was not
+// the leader, or refused them with a RetriableException.
+func retryable(method string, err error) bool {
+	if IsNotLeader(err) || isDialError(err) {
+		return true
+	}
+	e, ok := err.(*RemoteError)
+	if ok && e.Exception == "RetriableException" {
+		return true
+	}
+	if method != "GET" && method != "HEAD" {
+		return false
+	}
+	if ok {
+		switch e.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	return isNetError(err)
+}
+
+// ServerVersion returns the version of the leader and of its metadata API.
+func (c *Client) ServerVersion(ctx context.Context) (*api.VersionResponse, error) {
+	leader, err := c.Leader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	u := *leader
+	u.Path = path.Join("/", u.Path, "version")
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.HTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, decodeError(resp)
+	}
+	var v api.VersionResponse
+	if err = json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// NegotiateAPIVersion sets APIVersion to the newest version supported by both
+// the client and the server.
+func (c *Client) NegotiateAPIVersion(ctx context.Context) error {
+	v, err := c.ServerVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if version.LessThan(version.APIVersion, v.MinAPIVersion) {
+		return fmt.Errorf("client API version %s is too old, the server requires at least %s", version.APIVersion, v.MinAPIVersion)
+	}
+	c.APIVersion = version.APIVersion
+	if version.LessThan(v.APIVersion, c.APIVersion) {
+		c.APIVersion = v.APIVersion
+	}
+	return nil
+}
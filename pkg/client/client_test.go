@@ -0,0 +1,366 @@
+package client
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/apiserver/httputils"
+	"github.com/gostor/gofs/pkg/errors"
+)
+
+// newTestServer returns a server which reports itself as the raft leader, and
+// serves the metadata requests with h.
+func newTestServer(h http.HandlerFunc) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/cluster/status" {
+			json.NewEncoder(w).Encode(api.RaftClusterStatusResponse{IsLeader: true, Leader: r.Host})
+			return
+		}
+		h(w, r)
+	}))
+}
+
+func TestGetFileStatus(t *testing.T) {
+	srv := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ns/dir" || r.URL.Query().Get("op") != api.OpsGetFileStatus {
+			t.Fatalf("unexpected request: %s", r.URL)
+		}
+		w.Write([]byte(`{"FileStatus":{"fileId":2,"permission":"755","type":"DIRECTORY"}}`))
+	})
+	defer srv.Close()
+
+	c, _ := New(srv.URL)
+	st, err := c.GetFileStatus(context.Background(), "/ns/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.FileID != 2 || st.Permission != "755" || st.Type != api.FileTypeDirectory {
+		t.Fatalf("unexpected status: %#v", st)
+	}
+}
+
+func TestCreate(t *testing.T) {
+	srv := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.Method != "PUT" || q.Get("op") != api.OpsFileCreate || q.Get("overwrite") != "true" || q.Get("permission") != "600" {
+			t.Fatalf("unexpected request: %s %s", r.Method, r.URL)
+		}
+		data, _ := ioutil.ReadAll(r.Body)
+		if string(data) != "hello" {
+			t.Fatalf("unexpected body: %q", data)
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+	defer srv.Close()
+
+	c, _ := New(srv.URL)
+	err := c.Create(context.Background(), "/ns/file", strings.NewReader("hello"), CreateOptions{Overwrite: true, Permission: 0600})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestListStatusPaging(t *testing.T) {
+	names := []string{"a", "b", "c", "d", "e"}
+	srv := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("op") != api.OpsListStatusBatch {
+			t.Fatalf("unexpected request: %s", r.URL)
+		}
+		i := 0
+		for i < len(names) && names[i] <= r.URL.Query().Get("startAfter") {
+			i++
+		}
+		j := i + 2
+		if j > len(names) {
+			j = len(names)
+		}
+		var resp api.DirectoryListingResponse
+		for _, name := range names[i:j] {
+			resp.DirectoryListing.PartialListing.FileStatuses.FileStatus = append(resp.DirectoryListing.PartialListing.FileStatuses.FileStatus, api.FileStatus{PathSuffix: name})
+		}
+		resp.DirectoryListing.RemainingEntries = len(names) - j
+		json.NewEncoder(w).Encode(resp)
+	})
+	defer srv.Close()
+
+	c, _ := New(srv.URL)
+	list, err := c.ListStatus(context.Background(), "/ns/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != len(names) {
+		t.Fatalf("expected %d entries, got %d", len(names), len(list))
+	}
+	for i, st := range list {
+		if st.PathSuffix != names[i] {
+			t.Fatalf("expected entry %d to be %s, got %s", i, names[i], st.PathSuffix)
+		}
+	}
+}
+
+func TestLeaderDiscoveryAndRetry(t *testing.T) {
+	var leaderURL string
+	leader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/cluster/status" {
+			json.NewEncoder(w).Encode(api.RaftClusterStatusResponse{IsLeader: true, Leader: leaderURL})
+			return
+		}
+		json.NewEncoder(w).Encode(api.BooleanResponse{Boolean: true})
+	}))
+	defer leader.Close()
+	leaderURL = leader.URL
+
+	followerCalls := 0
+	follower := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/cluster/status" {
+			// the first status is stale and points to the follower itself
+			if followerCalls == 0 {
+				json.NewEncoder(w).Encode(api.RaftClusterStatusResponse{IsLeader: true, Leader: "follower"})
+			} else {
+				json.NewEncoder(w).Encode(api.RaftClusterStatusResponse{Leader: leaderURL})
+			}
+			followerCalls++
+			return
+		}
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"RemoteException":{"exception":"StandbyException","message":"not the leader"}}`)
+	}))
+	defer follower.Close()
+
+	c, _ := New(follower.URL, leader.URL)
+	c.Backoff = 0
+	ok, err := c.Delete(context.Background(), "/ns/file", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("expected the file to be deleted")
+	}
+	if l, _ := c.Leader(context.Background()); l.String() != leader.URL {
+		t.Fatalf("expected leader %s, got %s", leader.URL, l)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	var calls int
+	status, body := http.StatusBadGateway, "bad gateway"
+	srv := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.Error(w, body, status)
+	})
+	defer srv.Close()
+	c, _ := New(srv.URL)
+	c.MaxRetries = 2
+	c.Backoff = 0
+
+	// a failed gateway may have forwarded the request
+	calls = 0
+	if _, err := c.GetFileStatus(context.Background(), "/ns/file"); err == nil || calls != 3 {
+		t.Fatalf("expected a GET to be sent 3 times, got %d: %v", calls, err)
+	}
+	calls = 0
+	if _, err := c.Delete(context.Background(), "/ns/file", false); err == nil || calls != 1 {
+		t.Fatalf("expected a DELETE to be sent once, got %d: %v", calls, err)
+	}
+	// a RetriableException is sent before the request is applied
+	status, body = http.StatusServiceUnavailable, `{"RemoteException":{"exception":"RetriableException","message":"leader unknown"}}`
+	calls = 0
+	if _, err := c.Delete(context.Background(), "/ns/file", false); err == nil || calls != 3 {
+		t.Fatalf("expected a DELETE to be sent 3 times, got %d: %v", calls, err)
+	}
+}
+
+func TestOpenVerifiesChecksums(t *testing.T) {
+	for _, tc := range []struct {
+		md5, crc32c string
+		corrupted   bool
+	}{
+		// the MD5 and the CRC32C of "hello"
+		{"XUFAKrxLKna5cZ2REBfFkg==", "9a71bb4c", false},
+		{"XUFAKrxLKna5cZ2REBfFkg==", "00000000", true},
+		{"AAAAAAAAAAAAAAAAAAAAAA==", "", true},
+		{"", "", false},
+	} {
+		srv := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+			if tc.md5 != "" {
+				w.Header().Set(api.ContentMD5Header, tc.md5)
+			}
+			if tc.crc32c != "" {
+				w.Header().Set(api.ChecksumCRC32CHeader, tc.crc32c)
+			}
+			fmt.Fprint(w, "hello")
+		})
+		c, _ := New(srv.URL)
+		rc, err := c.Open(context.Background(), "/ns/file")
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+		srv.Close()
+		if tc.corrupted != IsChecksumError(err) {
+			t.Fatalf("unexpected error for %+v: %v", tc, err)
+		}
+		if !tc.corrupted && string(data) != "hello" {
+			t.Fatalf("unexpected content: %q", data)
+		}
+	}
+}
+
+func TestRemoteError(t *testing.T) {
+	cases := []struct {
+		body      string
+		status    int
+		exception string
+		message   string
+	}{
+		{`{"RemoteException":{"exception":"FileNotFoundException","javaClassName":"java.io.FileNotFoundException","message":"no such file"}}`, http.StatusNotFound, "FileNotFoundException", "no such file"},
+		{"forbidden\n", http.StatusForbidden, "AccessControlException", "forbidden"},
+		{"oops", http.StatusInternalServerError, "IOException", "oops"},
+	}
+
+	for _, tc := range cases {
+		srv := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, tc.body, tc.status)
+		})
+		c, _ := New(srv.URL)
+		_, err := c.Delete(context.Background(), "/ns/file", false)
+		srv.Close()
+
+		e, ok := err.(*RemoteError)
+		if !ok {
+			t.Fatalf("expected a RemoteError, got %v", err)
+		}
+		if e.StatusCode != tc.status || e.Exception != tc.exception || e.Message != tc.message {
+			t.Fatalf("unexpected error for %q: %#v", tc.body, e)
+		}
+	}
+}
+
+func TestServerError(t *testing.T) {
+	for _, err := range []error{
+		errors.AlreadyExists("/ns/file already exists"),
+		errors.NotFound("/ns/file does not exist"),
+		errors.QuotaExceeded("the quota of /ns is exceeded"),
+		errors.NotLeader("not the leader"),
+	} {
+		srv := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+			httputils.WriteError(w, err)
+		})
+		c, _ := New(srv.URL)
+		c.MaxRetries = 0
+		_, rerr := c.Delete(context.Background(), "/ns/file", false)
+		srv.Close()
+
+		e, ok := rerr.(*RemoteError)
+		if !ok {
+			t.Fatalf("expected a RemoteError, got %v", rerr)
+		}
+		k := errors.KindOf(err)
+		if e.StatusCode != k.StatusCode || e.Exception != k.Exception || e.Message != err.Error() {
+			t.Fatalf("unexpected error for %v: %#v", err, e)
+		}
+	}
+	// the client tells the errors apart by their exception, whatever their
+	// status code
+	srv := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		httputils.WriteError(w, errors.NotFound("/ns/file does not exist"))
+	})
+	defer srv.Close()
+	c, _ := New(srv.URL)
+	if _, err := c.GetFileStatus(context.Background(), "/ns/file"); !IsNotFound(err) {
+		t.Fatalf("expected a FileNotFoundException, got %v", err)
+	}
+}
+
+func TestCreateChunked(t *testing.T) {
+	data := "hello, chunked world"
+	var lock sync.Mutex
+	uploaded := map[string]string{}
+	corrupted := false
+	srv := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.Method != "PUT" || r.URL.Path != "/ns/file" || q.Get("overwrite") != "true" {
+			t.Fatalf("unexpected request: %s %s", r.Method, r.URL)
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		lock.Lock()
+		defer lock.Unlock()
+		switch q.Get("op") {
+		case api.OpsUploadChunk:
+			sum := md5.Sum(body)
+			if q.Get("md5") != hex.EncodeToString(sum[:]) {
+				t.Fatalf("unexpected md5 %s of chunk %q", q.Get("md5"), body)
+			}
+			// the first upload of the second chunk is corrupted
+			if string(body) == "o, c" && !corrupted {
+				corrupted = true
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte(`{"RemoteException":{"exception":"ChecksumException","message":"corrupted"}}`))
+				return
+			}
+			key := fmt.Sprintf("objects/%d", len(uploaded))
+			uploaded[key] = string(body)
+			json.NewEncoder(w).Encode(api.ChunkResponse{Chunk: api.Chunk{Object: key, Length: int64(len(body)), MD5: q.Get("md5")}})
+		case api.OpsCommitChunks:
+			var chunks api.Chunks
+			if err := json.Unmarshal(body, &chunks); err != nil {
+				t.Fatal(err)
+			}
+			var content string
+			for _, ch := range chunks.Chunk {
+				content += uploaded[ch.Object]
+			}
+			if len(chunks.Chunk) != 5 || content != data || q.Get("permission") != "600" {
+				t.Fatalf("unexpected commit of %v: %q", chunks.Chunk, content)
+			}
+			w.WriteHeader(http.StatusCreated)
+		default:
+			t.Fatalf("unexpected request: %s", r.URL)
+		}
+	})
+	defer srv.Close()
+
+	c, _ := New(srv.URL)
+	err := c.CreateChunked(context.Background(), "/ns/file", strings.NewReader(data), int64(len(data)),
+		CreateOptions{Overwrite: true, Permission: 0600}, ChunkOptions{ChunkSize: 4, Parallel: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !corrupted || len(uploaded) != 5 {
+		t.Fatalf("unexpected uploads: %v", uploaded)
+	}
+}
+
+func TestOpenRange(t *testing.T) {
+	srv := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("op") != api.OpsOpen || q.Get("offset") != "2" || q.Get("length") != "3" {
+			t.Fatalf("unexpected request: %s", r.URL)
+		}
+		// the checksums of the whole content do not apply to a range
+		w.Header().Set(api.ContentMD5Header, "XUFAKrxLKna5cZ2REBfFkg==")
+		fmt.Fprint(w, "llo")
+	})
+	defer srv.Close()
+
+	c, _ := New(srv.URL)
+	rc, err := c.OpenRange(context.Background(), "/ns/file", 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if data, err := ioutil.ReadAll(rc); err != nil || string(data) != "llo" {
+		t.Fatalf("unexpected content %q: %v", data, err)
+	}
+}
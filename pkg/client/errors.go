@@ -0,0 +1,102 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/gostor/gofs/pkg/api"
+)
+
+// RemoteError is returned when the server fails a request.
+type RemoteError struct {
+	StatusCode int
+	api.RemoteException
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Exception, e.Message)
+}
+
+// exceptions maps the status codes to the exception of errors which have no
+// RemoteException body, following the kinds of pkg/errors. A status shared
+// by several kinds, such as 403, maps to the most general of them. A 503 is
+// left an IOException: sent by a proxy, it does not tell that the request
+// was refused before it was applied, as a RetriableException does.
+var exceptions = map[int]string{
+	http.StatusBadRequest:            "IllegalArgumentException",
+	http.StatusUnauthorized:          "SecurityException",
+	http.StatusForbidden:             "AccessControlException",
+	http.StatusNotFound:              "FileNotFoundException",
+	http.StatusRequestEntityTooLarge: "IllegalArgumentException",
+}
+
+func decodeError(resp *http.Response) error {
+	data, _ := ioutil.ReadAll(resp.Body)
+	e := &RemoteError{StatusCode: resp.StatusCode}
+	var re api.RemoteExceptionResponse
+	if err := json.Unmarshal(data, &re); err == nil && re.RemoteException.Exception != "" {
+		e.RemoteException = re.RemoteException
+		return e
+	}
+	e.Exception = exceptions[resp.StatusCode]
+	if e.Exception == "" {
+		e.Exception = "IOException"
+	}
+	e.Message = strings.TrimSpace(string(data))
+	return e
+}
+
+// IsNotFound returns true if err is caused by a missing file or directory.
+func IsNotFound(err error) bool {
+	e, ok := err.(*RemoteError)
+	return ok && e.Exception == "FileNotFoundException"
+}
+
+// ChecksumError is returned by the readers of Open when the content read does
+// not match its checksum.
+type ChecksumError struct {
+	Path      string
+	Algorithm string
+	Expected  string
+	Actual    string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("ChecksumException: the %s of %s is %s, expected %s", e.Algorithm, e.Path, e.Actual, e.Expected)
+}
+
+// IsChecksumError returns true if err is caused by corrupted data, detected
+// either by the client or by the server.
+func IsChecksumError(err error) bool {
+	if _, ok := err.(*ChecksumError); ok {
+		return true
+	}
+	e, ok := err.(*RemoteError)
+	return ok && e.Exception == "ChecksumException"
+}
+
+// IsNotLeader returns true if err is returned by a server which is not the
+// raft leader.
+func IsNotLeader(err error) bool {
+	e, ok := err.(*RemoteError)
+	return ok && e.Exception == "StandbyException"
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"net/url"
+	"path"
+	"strconv"
+
+	"github.com/gostor/gofs/pkg/api"
+)
+
+// The namespaces are managed by the superuser, with a bearer token.
+
+// CreateNamespace creates the namespace id, bound to the bucket of cfg.
+func (c *Client) CreateNamespace(ctx context.Context, id string, cfg *api.Config) (*api.Namespace, error) {
+	var ns api.Namespace
+	if err := c.sendJSON(ctx, "POST", path.Join("/namespaces", id), cfg, &ns); err != nil {
+		return nil, err
+	}
+	return &ns, nil
+}
+
+// GetNamespace returns the namespace id.
+func (c *Client) GetNamespace(ctx context.Context, id string) (*api.Namespace, error) {
+	var ns api.Namespace
+	if err := c.doJSON(ctx, "GET", path.Join("/namespaces", id), "", nil, &ns); err != nil {
+		return nil, err
+	}
+	return &ns, nil
+}
+
+// ListNamespaces returns the namespaces, sorted by ID.
+func (c *Client) ListNamespaces(ctx context.Context) ([]api.Namespace, error) {
+	var resp api.NamespacesResponse
+	if err := c.doJSON(ctx, "GET", "/namespaces", "", nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Namespaces, nil
+}
+
+// DeleteNamespace removes the namespace id, and the data of its files from
+// its bucket. It fails if the namespace has files, unless force is set.
+func (c *Client) DeleteNamespace(ctx context.Context, id string, force bool) error {
+	params := url.Values{}
+	params.Set("force", strconv.FormatBool(force))
+	return c.doJSON(ctx, "DELETE", path.Join("/namespaces", id), "", params, nil)
+}
+
+// GCStatus returns the statistics of the collections of the orphaned
+// objects of the namespace id on the server.
+func (c *Client) GCStatus(ctx context.Context, id string) (*api.GCStatusResponse, error) {
+	var resp api.GCStatusResponse
+	if err := c.doJSON(ctx, "GET", path.Join("/namespaces", id, "gc"), "", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// CollectGarbage collects the orphaned objects of the namespace id, or only
+// reports them with dryRun. It must be sent to the raft leader.
+func (c *Client) CollectGarbage(ctx context.Context, id string, dryRun bool) (*api.GCReport, error) {
+	params := url.Values{}
+	params.Set("dryrun", strconv.FormatBool(dryRun))
+	var resp api.GCReport
+	if err := c.doJSON(ctx, "POST", path.Join("/namespaces", id, "gc"), "", params, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Fsck checks the consistency of the namespace id and of its bucket, and
+// repairs what it can with repair, which must be sent to the raft leader.
+func (c *Client) Fsck(ctx context.Context, id string, repair bool) (*api.FsckReport, error) {
+	method := "GET"
+	if repair {
+		method = "POST"
+	}
+	var resp api.FsckReport
+	if err := c.doJSON(ctx, method, path.Join("/namespaces", id, "fsck"), "", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
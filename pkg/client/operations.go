@@ -0,0 +1,412 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/gostor/gofs/pkg/api"
+)
+
+// GetFileStatus returns the status of the file or directory p.
+func (c *Client) GetFileStatus(ctx context.Context, p string) (*api.FileStatus, error) {
+	var resp api.FileStatusResponse
+	if err := c.doJSON(ctx, "GET", p, api.OpsGetFileStatus, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.FileStatus, nil
+}
+
+// ListStatusBatch returns a batch of the entries of the directory p which
+// follow the entry named startAfter, and the number of remaining entries.
+func (c *Client) ListStatusBatch(ctx context.Context, p, startAfter string) ([]api.FileStatus, int, error) {
+	params := url.Values{}
+	if startAfter != "" {
+		params.Set("startAfter", startAfter)
+	}
+	var resp api.DirectoryListingResponse
+	if err := c.doJSON(ctx, "GET", p, api.OpsListStatusBatch, params, &resp); err != nil {
+		return nil, 0, err
+	}
+	listing := resp.DirectoryListing
+	return listing.PartialListing.FileStatuses.FileStatus, listing.RemainingEntries, nil
+}
+
+// ListStatus returns all the entries of the directory p, fetching them in
+// batches.
+func (c *Client) ListStatus(ctx context.Context, p string) ([]api.FileStatus, error) {
+	list := []api.FileStatus{}
+	startAfter := ""
+	for {
+		batch, remaining, err := c.ListStatusBatch(ctx, p, startAfter)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, batch...)
+		if remaining == 0 || len(batch) == 0 {
+			return list, nil
+		}
+		startAfter = batch[len(batch)-1].PathSuffix
+	}
+}
+
+// GetContentSummary returns the space usage of the directory tree p.
+func (c *Client) GetContentSummary(ctx context.Context, p string) (*api.ContentSummary, error) {
+	var resp api.ContentSummaryResponse
+	if err := c.doJSON(ctx, "GET", p, api.OpsGetContentSummary, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.ContentSummary, nil
+}
+
+// GetTrashRoot returns the trash root of the user in the namespace of p.
+func (c *Client) GetTrashRoot(ctx context.Context, p string) (string, error) {
+	var resp api.PathResponse
+	if err := c.doJSON(ctx, "GET", p, api.OpsGetTrashRoot, nil, &resp); err != nil {
+		return "", err
+	}
+	return resp.Path, nil
+}
+
+// RepairContentSummary recomputes the content summaries of the directory
+// tree p, and returns the repaired one.
+func (c *Client) RepairContentSummary(ctx context.Context, p string) (*api.ContentSummary, error) {
+	var resp api.ContentSummaryResponse
+	if err := c.doJSON(ctx, "PUT", p, api.OpsRepairContentSummary, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.ContentSummary, nil
+}
+
+// Mkdirs creates the directory p along with any missing parents.
+func (c *Client) Mkdirs(ctx context.Context, p string, perm os.FileMode) error {
+	params := url.Values{}
+	params.Set("permission", formatPermission(perm))
+	return c.doJSON(ctx, "PUT", p, api.OpsDirCreate, params, nil)
+}
+
+// CreateOptions are the options of Create.
+type CreateOptions struct {
+	Overwrite  bool
+	Permission os.FileMode
+	// SHA256 asks the server to record the SHA-256 of the content, along
+	// with its MD5 and CRC32C.
+	SHA256 bool
+}
+
+// Create writes the content of r to the file p. The request is only retried
+// if r implements io.Seeker.
+func (c *Client) Create(ctx context.Context, p string, r io.Reader, opts CreateOptions) error {
+	params := url.Values{}
+	params.Set("overwrite", strconv.FormatBool(opts.Overwrite))
+	if opts.Permission != 0 {
+		params.Set("permission", formatPermission(opts.Permission))
+	}
+	if opts.SHA256 {
+		params.Set("sha256", "true")
+	}
+	resp, err := c.do(ctx, "PUT", p, api.OpsFileCreate, params, r)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Append appends the content of r to the file p.
+func (c *Client) Append(ctx context.Context, p string, r io.Reader) error {
+	resp, err := c.do(ctx, "POST", p, api.OpsAppend, nil, r)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Truncate truncates the file p to size bytes, which cannot be more than it
+// has.
+func (c *Client) Truncate(ctx context.Context, p string, size int64) error {
+	params := url.Values{}
+	params.Set("newlength", strconv.FormatInt(size, 10))
+	return c.doJSON(ctx, "POST", p, api.OpsTruncate, params, nil)
+}
+
+// Open returns the content of the file p. The caller must close it. The
+// content is verified against the checksums the server sends with it, and
+// reading it fails with a ChecksumError at the end if it does not match.
+func (c *Client) Open(ctx context.Context, p string) (io.ReadCloser, error) {
+	resp, err := c.do(ctx, "GET", p, api.OpsOpen, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return newVerifyingReader(p, resp.Body, resp.Header), nil
+}
+
+// OpenRange returns the length bytes of the content of the file p at
+// offset, or the bytes up to its end if length is negative. The caller must
+// close it. Only the chunks of the file holding the bytes are read, and the
+// bytes are not verified against the checksums of the whole content.
+func (c *Client) OpenRange(ctx context.Context, p string, offset, length int64) (io.ReadCloser, error) {
+	params := url.Values{}
+	params.Set("offset", strconv.FormatInt(offset, 10))
+	if length >= 0 {
+		params.Set("length", strconv.FormatInt(length, 10))
+	}
+	resp, err := c.do(ctx, "GET", p, api.OpsOpen, params, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// GetFileChecksum returns the checksum of the file p, computed with the
+// algorithm, e.g. api.ChecksumMD5, or the composite CRC32C if it is empty.
+func (c *Client) GetFileChecksum(ctx context.Context, p, algorithm string) (*api.FileChecksum, error) {
+	params := url.Values{}
+	if algorithm != "" {
+		params.Set("algorithm", algorithm)
+	}
+	var resp api.FileChecksumResponse
+	if err := c.doJSON(ctx, "GET", p, api.OpsGetFileChecksum, params, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.FileChecksum, nil
+}
+
+// Rename moves the file or directory src to dst.
+func (c *Client) Rename(ctx context.Context, src, dst string) (bool, error) {
+	params := url.Values{}
+	params.Set("destination", path.Join("/", dst))
+	var resp api.BooleanResponse
+	if err := c.doJSON(ctx, "PUT", src, api.OpsRename, params, &resp); err != nil {
+		return false, err
+	}
+	return resp.Boolean, nil
+}
+
+// Rename2 moves the file or directory src to dst, which is replaced with
+// overwrite, as the rename2 of HDFS. Unlike Rename, it fails if the move is
+// not possible and dst is never a directory to move src into.
+func (c *Client) Rename2(ctx context.Context, src, dst string, overwrite bool) error {
+	params := url.Values{}
+	params.Set("destination", path.Join("/", dst))
+	params.Set("renameoptions", "NONE")
+	if overwrite {
+		params.Set("renameoptions", "OVERWRITE")
+	}
+	return c.doJSON(ctx, "PUT", src, api.OpsRename, params, nil)
+}
+
+// CreateSymlink creates the symlink link pointing to target, which may be
+// relative to the directory of link. The missing parents of link are created
+// with createParent.
+func (c *Client) CreateSymlink(ctx context.Context, link, target string, createParent bool) error {
+	params := url.Values{}
+	params.Set("destination", target)
+	params.Set("createParent", strconv.FormatBool(createParent))
+	return c.doJSON(ctx, "PUT", link, api.OpsCreateSymlink, params, nil)
+}
+
+// CreateHardLink creates the hard link link to the existing file.
+func (c *Client) CreateHardLink(ctx context.Context, link, existing string) error {
+	params := url.Values{}
+	params.Set("destination", path.Join("/", existing))
+	return c.doJSON(ctx, "PUT", link, api.OpsCreateHardLink, params, nil)
+}
+
+// Delete removes the file or directory p, or moves it to the trash if the
+// namespace has one. It returns false if p does not exist.
+func (c *Client) Delete(ctx context.Context, p string, recursive bool) (bool, error) {
+	return c.delete(ctx, p, recursive, false)
+}
+
+// DeleteSkipTrash removes the file or directory p at once, even if the
+// namespace has a trash. Only the admins may.
+func (c *Client) DeleteSkipTrash(ctx context.Context, p string, recursive bool) (bool, error) {
+	return c.delete(ctx, p, recursive, true)
+}
+
+func (c *Client) delete(ctx context.Context, p string, recursive, skipTrash bool) (bool, error) {
+	params := url.Values{}
+	params.Set("recursive", strconv.FormatBool(recursive))
+	if skipTrash {
+		params.Set("skiptrash", "true")
+	}
+	var resp api.BooleanResponse
+	if err := c.doJSON(ctx, "DELETE", p, api.OpsDelete, params, &resp); err != nil {
+		return false, err
+	}
+	return resp.Boolean, nil
+}
+
+// SetPermission changes the permission of the file or directory p, and its
+// sticky bit.
+func (c *Client) SetPermission(ctx context.Context, p string, perm os.FileMode) error {
+	n := uint64(perm.Perm())
+	if perm&os.ModeSticky != 0 {
+		n |= 01000
+	}
+	params := url.Values{}
+	params.Set("permission", strconv.FormatUint(n, 8))
+	return c.doJSON(ctx, "PUT", p, api.OpsSetPermission, params, nil)
+}
+
+// SetOwner changes the owner and the group of the file or directory p, the
+// numeric IDs of the users and groups. An empty owner or group is left
+// unchanged.
+func (c *Client) SetOwner(ctx context.Context, p, owner, group string) error {
+	params := url.Values{}
+	if owner != "" {
+		params.Set("owner", owner)
+	}
+	if group != "" {
+		params.Set("group", group)
+	}
+	return c.doJSON(ctx, "PUT", p, api.OpsSetOwner, params, nil)
+}
+
+// SetTimes changes the modification and access time of the file or
+// directory p. A zero time is left unchanged.
+func (c *Client) SetTimes(ctx context.Context, p string, mtime, atime time.Time) error {
+	params := url.Values{}
+	params.Set("modificationtime", formatTime(mtime))
+	params.Set("accesstime", formatTime(atime))
+	return c.doJSON(ctx, "PUT", p, api.OpsSetTimes, params, nil)
+}
+
+// GetQuotaUsage returns the usage of the directory tree p, and its quota.
+func (c *Client) GetQuotaUsage(ctx context.Context, p string) (*api.QuotaUsage, error) {
+	var resp api.QuotaUsageResponse
+	if err := c.doJSON(ctx, "GET", p, api.OpsGetQuotaUsage, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.QuotaUsage, nil
+}
+
+// SetQuota sets the name and the space quotas of the directory p. A quota of
+// -1 is cleared, and one of 0 left unchanged.
+func (c *Client) SetQuota(ctx context.Context, p string, names, space int64) error {
+	params := url.Values{}
+	if names != 0 {
+		params.Set("namespacequota", strconv.FormatInt(names, 10))
+	}
+	if space != 0 {
+		params.Set("storagespacequota", strconv.FormatInt(space, 10))
+	}
+	return c.doJSON(ctx, "PUT", p, api.OpsSetQuota, params, nil)
+}
+
+// ClearQuota clears the quotas of the directory p.
+func (c *Client) ClearQuota(ctx context.Context, p string) error {
+	return c.doJSON(ctx, "PUT", p, api.OpsClearQuota, nil, nil)
+}
+
+// GetACLStatus returns the ACL of the file or directory p.
+func (c *Client) GetACLStatus(ctx context.Context, p string) (*api.ACLStatus, error) {
+	var resp api.ACLStatusResponse
+	if err := c.doJSON(ctx, "GET", p, api.OpsGetACLStatus, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.ACLStatus, nil
+}
+
+// UpdateACL changes the ACL of the file or directory p with one of the ACL
+// operations, e.g. api.OpsModifyACLEntries. aclspec is ignored by
+// REMOVEDEFAULTACL and REMOVEACL.
+func (c *Client) UpdateACL(ctx context.Context, p, op, aclspec string) error {
+	params := url.Values{}
+	if aclspec != "" {
+		params.Set("aclspec", aclspec)
+	}
+	return c.doJSON(ctx, "PUT", p, op, params, nil)
+}
+
+// GetXAttrs returns the extended attributes of p named names, or all those
+// the caller may read if names is empty.
+func (c *Client) GetXAttrs(ctx context.Context, p string, names ...string) (map[string][]byte, error) {
+	params := url.Values{}
+	params.Set("encoding", api.XAttrEncodingBase64)
+	for _, name := range names {
+		params.Add("xattr.name", name)
+	}
+	var resp api.XAttrsResponse
+	if err := c.doJSON(ctx, "GET", p, api.OpsGetXAttrs, params, &resp); err != nil {
+		return nil, err
+	}
+	xattrs := make(map[string][]byte, len(resp.XAttrs))
+	for _, x := range resp.XAttrs {
+		v, err := api.DecodeXAttrValue(x.Value)
+		if err != nil {
+			return nil, err
+		}
+		xattrs[x.Name] = v
+	}
+	return xattrs, nil
+}
+
+// ListXAttrs returns the names of the extended attributes of p the caller
+// may read.
+func (c *Client) ListXAttrs(ctx context.Context, p string) ([]string, error) {
+	var resp api.XAttrNamesResponse
+	if err := c.doJSON(ctx, "GET", p, api.OpsListXAttrs, nil, &resp); err != nil {
+		return nil, err
+	}
+	var names []string
+	if err := json.Unmarshal([]byte(resp.XAttrNames), &names); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// SetXAttr sets the extended attribute name of p. flag is api.XAttrFlagCreate
+// or api.XAttrFlagReplace to require that the attribute does not exist or
+// exists, and empty otherwise.
+func (c *Client) SetXAttr(ctx context.Context, p, name string, value []byte, flag string) error {
+	v, _ := api.EncodeXAttrValue(value, api.XAttrEncodingBase64)
+	params := url.Values{}
+	params.Set("xattr.name", name)
+	params.Set("xattr.value", v)
+	if flag != "" {
+		params.Set("flag", flag)
+	}
+	return c.doJSON(ctx, "PUT", p, api.OpsSetXAttr, params, nil)
+}
+
+// RemoveXAttr removes the extended attribute name of p.
+func (c *Client) RemoveXAttr(ctx context.Context, p, name string) error {
+	params := url.Values{}
+	params.Set("xattr.name", name)
+	return c.doJSON(ctx, "PUT", p, api.OpsRemoveXAttr, params, nil)
+}
+
+func formatPermission(perm os.FileMode) string {
+	return strconv.FormatUint(uint64(perm.Perm()), 8)
+}
+
+// formatTime returns t in milliseconds since the epoch, or -1 for the zero
+// time.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-1"
+	}
+	return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+}
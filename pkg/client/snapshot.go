@@ -0,0 +1,78 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/gostor/gofs/pkg/api"
+)
+
+// AllowSnapshot makes the directory p snapshottable, which only admins may.
+func (c *Client) AllowSnapshot(ctx context.Context, p string) error {
+	return c.doJSON(ctx, "PUT", p, api.OpsAllowSnapshot, nil, nil)
+}
+
+// DisallowSnapshot makes the directory p not snapshottable, once its
+// snapshots are deleted.
+func (c *Client) DisallowSnapshot(ctx context.Context, p string) error {
+	return c.doJSON(ctx, "PUT", p, api.OpsDisallowSnapshot, nil, nil)
+}
+
+// CreateSnapshot creates the snapshot name of the snapshottable directory p,
+// named after the time if name is empty, and returns the path it is browsed
+// at.
+func (c *Client) CreateSnapshot(ctx context.Context, p, name string) (string, error) {
+	params := url.Values{}
+	if name != "" {
+		params.Set("snapshotname", name)
+	}
+	var resp api.PathResponse
+	if err := c.doJSON(ctx, "PUT", p, api.OpsCreateSnapshot, params, &resp); err != nil {
+		return "", err
+	}
+	return resp.Path, nil
+}
+
+// DeleteSnapshot deletes the snapshot name of the directory p.
+func (c *Client) DeleteSnapshot(ctx context.Context, p, name string) error {
+	params := url.Values{}
+	params.Set("snapshotname", name)
+	return c.doJSON(ctx, "DELETE", p, api.OpsDeleteSnapshot, params, nil)
+}
+
+// RenameSnapshot renames the snapshot oldName of the directory p to newName.
+func (c *Client) RenameSnapshot(ctx context.Context, p, oldName, newName string) error {
+	params := url.Values{}
+	params.Set("oldsnapshotname", oldName)
+	params.Set("snapshotname", newName)
+	return c.doJSON(ctx, "PUT", p, api.OpsRenameSnapshot, params, nil)
+}
+
+// GetSnapshotDiff returns the changes of the tree of the directory p from
+// the snapshot from to the snapshot to. An empty name is the current tree.
+func (c *Client) GetSnapshotDiff(ctx context.Context, p, from, to string) (*api.SnapshotDiffReport, error) {
+	params := url.Values{}
+	params.Set("oldsnapshotname", from)
+	params.Set("snapshotname", to)
+	var resp api.SnapshotDiffReportResponse
+	if err := c.doJSON(ctx, "GET", p, api.OpsGetSnapshotDiff, params, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.SnapshotDiffReport, nil
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+
+	"github.com/gostor/gofs/pkg/api"
+)
+
+// ListVersions returns the versions of the file p, oldest first.
+func (c *Client) ListVersions(ctx context.Context, p string) ([]api.FileVersion, error) {
+	var resp api.FileVersionsResponse
+	if err := c.doJSON(ctx, "GET", p, api.OpsListVersions, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.FileVersions.FileVersion, nil
+}
+
+// SetVersioning enables or disables the versioning of the files of the
+// directory tree p. At most maxVersions versions are kept of a file, for at
+// most maxAge minutes, 0 being unlimited.
+func (c *Client) SetVersioning(ctx context.Context, p string, enabled bool, maxVersions int, maxAge int64) error {
+	params := url.Values{}
+	params.Set("versioning", strconv.FormatBool(enabled))
+	if maxVersions != 0 {
+		params.Set("maxversions", strconv.Itoa(maxVersions))
+	}
+	if maxAge != 0 {
+		params.Set("maxage", strconv.FormatInt(maxAge, 10))
+	}
+	return c.doJSON(ctx, "PUT", p, api.OpsSetVersioning, params, nil)
+}
+
+// ClearVersioning clears the versioning policy of the directory p, which
+// then inherits that of its parent.
+func (c *Client) ClearVersioning(ctx context.Context, p string) error {
+	params := url.Values{}
+	params.Set("versioning", "inherit")
+	return c.doJSON(ctx, "PUT", p, api.OpsSetVersioning, params, nil)
+}
+
+// RestoreVersion makes the version of the file p its content again. The
+// content it replaces is kept as its latest version.
+func (c *Client) RestoreVersion(ctx context.Context, p string, version int64) error {
+	params := url.Values{}
+	params.Set("version", strconv.FormatInt(version, 10))
+	return c.doJSON(ctx, "PUT", p, api.OpsRestoreVersion, params, nil)
+}
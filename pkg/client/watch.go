@@ -0,0 +1,123 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/gostor/gofs/pkg/api"
+)
+
+// EventType is the kind of change reported by Watch.
+type EventType string
+
+const (
+	EventCreated  EventType = "created"
+	EventModified EventType = "modified"
+	EventDeleted  EventType = "deleted"
+)
+
+// Event is a change of a watched file or directory entry.
+type Event struct {
+	Type   EventType
+	Path   string
+	Status api.FileStatus
+}
+
+// Watch checks the file or the entries of the directory p every interval,
+// and sends an Event for every change found. The channel is closed once ctx
+// is done; polling errors are ignored until the next interval.
+func (c *Client) Watch(ctx context.Context, p string, interval time.Duration) (<-chan Event, error) {
+	last, err := c.watchState(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan Event)
+	go func() {
+		defer close(ch)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			state, err := c.watchState(ctx, p)
+			if err != nil {
+				if !IsNotFound(err) {
+					continue
+				}
+				state = map[string]api.FileStatus{}
+			}
+			for _, ev := range diffState(p, last, state) {
+				select {
+				case ch <- ev:
+				case <-ctx.Done():
+					return
+				}
+			}
+			last = state
+		}
+	}()
+	return ch, nil
+}
+
+// watchState returns the status of the entries of the directory p by name,
+// or the status of the file p with an empty name.
+func (c *Client) watchState(ctx context.Context, p string) (map[string]api.FileStatus, error) {
+	st, err := c.GetFileStatus(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	state := map[string]api.FileStatus{}
+	if st.Type != api.FileTypeDirectory {
+		state[""] = *st
+		return state, nil
+	}
+	list, err := c.ListStatus(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	for _, st := range list {
+		state[st.PathSuffix] = st
+	}
+	return state, nil
+}
+
+func diffState(p string, old, new map[string]api.FileStatus) []Event {
+	events := []Event{}
+	for name, st := range new {
+		prev, ok := old[name]
+		switch {
+		case !ok:
+			events = append(events, Event{Type: EventCreated, Path: path.Join(p, name), Status: st})
+		case prev != st:
+			events = append(events, Event{Type: EventModified, Path: path.Join(p, name), Status: st})
+		}
+	}
+	for name, st := range old {
+		if _, ok := new[name]; !ok {
+			events = append(events, Event{Type: EventDeleted, Path: path.Join(p, name), Status: st})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Path < events[j].Path })
+	return events
+}
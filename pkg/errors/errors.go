@@ -0,0 +1,214 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package errors defines the errors of GoFS.
+//
+// Every error has a kind, which tells the HTTP status code and the WebHDFS
+// RemoteException it is reported to the clients with, so that the API server
+// does not have to guess them from the error messages.
+package errors
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gostor/gofs/pkg/api"
+)
+
+// Kind is the kind of an error.
+type Kind struct {
+	// Exception is the name of the WebHDFS exception, e.g. FileNotFoundException.
+	Exception string
+	// JavaClassName is the Java class of the exception in HDFS.
+	JavaClassName string
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+}
+
+// The kinds of errors, with the status codes used by the WebHDFS server.
+var (
+	KindNotFound         = &Kind{"FileNotFoundException", "java.io.FileNotFoundException", http.StatusNotFound}
+	KindAlreadyExists    = &Kind{"FileAlreadyExistsException", "org.apache.hadoop.fs.FileAlreadyExistsException", http.StatusForbidden}
+	KindNotEmpty         = &Kind{"PathIsNotEmptyDirectoryException", "org.apache.hadoop.fs.PathIsNotEmptyDirectoryException", http.StatusForbidden}
+	KindNotDirectory     = &Kind{"ParentNotDirectoryException", "org.apache.hadoop.fs.ParentNotDirectoryException", http.StatusForbidden}
+	KindIsDirectory      = &Kind{"PathIsDirectoryException", "org.apache.hadoop.fs.PathIsDirectoryException", http.StatusForbidden}
+	KindPermissionDenied = &Kind{"AccessControlException", "org.apache.hadoop.security.AccessControlException", http.StatusForbidden}
+	KindUnauthenticated  = &Kind{"SecurityException", "java.lang.SecurityException", http.StatusUnauthorized}
+	KindNotLeader        = &Kind{"StandbyException", "org.apache.hadoop.ipc.StandbyException", http.StatusForbidden}
+	KindQuotaExceeded    = &Kind{"QuotaExceededException", "org.apache.hadoop.hdfs.protocol.QuotaExceededException", http.StatusForbidden}
+	KindBadParameter     = &Kind{"IllegalArgumentException", "java.lang.IllegalArgumentException", http.StatusBadRequest}
+	KindNotImplemented   = &Kind{"UnsupportedOperationException", "java.lang.UnsupportedOperationException", http.StatusBadRequest}
+	KindTooLarge         = &Kind{"IllegalArgumentException", "java.lang.IllegalArgumentException", http.StatusRequestEntityTooLarge}
+	KindRetriable        = &Kind{"RetriableException", "org.apache.hadoop.ipc.RetriableException", http.StatusServiceUnavailable}
+	KindCorrupted        = &Kind{"ChecksumException", "org.apache.hadoop.fs.ChecksumException", http.StatusInternalServerError}
+	KindInternal         = &Kind{"RuntimeException", "java.lang.RuntimeException", http.StatusInternalServerError}
+)
+
+// Error is an error of a given kind.
+type Error struct {
+	Kind    *Kind
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// New returns an error of kind k with a formatted message.
+func New(k *Kind, format string, a ...interface{}) error {
+	return &Error{Kind: k, Message: fmt.Sprintf(format, a...)}
+}
+
+// KindOf returns the kind of err, KindInternal if it has none.
+func KindOf(err error) *Kind {
+	if e, ok := err.(*Error); ok && e.Kind != nil {
+		return e.Kind
+	}
+	return KindInternal
+}
+
+// Is returns true if err is of kind k.
+func Is(err error, k *Kind) bool {
+	e, ok := err.(*Error)
+	return ok && e.Kind == k
+}
+
+// StatusCode returns the HTTP status code err is reported with.
+func StatusCode(err error) int {
+	return KindOf(err).StatusCode
+}
+
+// ToRemoteException returns the WebHDFS representation of err.
+func ToRemoteException(err error) api.RemoteException {
+	k := KindOf(err)
+	return api.RemoteException{
+		Exception:     k.Exception,
+		JavaClassName: k.JavaClassName,
+		Message:       err.Error(),
+	}
+}
+
+// NotFound returns an error for a missing file, directory or namespace.
+func NotFound(format string, a ...interface{}) error {
+	return New(KindNotFound, format, a...)
+}
+
+// AlreadyExists returns an error for a file which should not exist.
+func AlreadyExists(format string, a ...interface{}) error {
+	return New(KindAlreadyExists, format, a...)
+}
+
+// NotEmpty returns an error for a directory which should be empty.
+func NotEmpty(format string, a ...interface{}) error {
+	return New(KindNotEmpty, format, a...)
+}
+
+// NotDirectory returns an error for a file used as a directory.
+func NotDirectory(format string, a ...interface{}) error {
+	return New(KindNotDirectory, format, a...)
+}
+
+// IsDirectory returns an error for a directory used as a file.
+func IsDirectory(format string, a ...interface{}) error {
+	return New(KindIsDirectory, format, a...)
+}
+
+// PermissionDenied returns an error for an operation the caller is not
+// allowed to do.
+func PermissionDenied(format string, a ...interface{}) error {
+	return New(KindPermissionDenied, format, a...)
+}
+
+// Unauthenticated returns an error for a request without valid credentials.
+func Unauthenticated(format string, a ...interface{}) error {
+	return New(KindUnauthenticated, format, a...)
+}
+
+// NotLeader returns an error for a request which must be sent to the raft
+// leader.
+func NotLeader(format string, a ...interface{}) error {
+	return New(KindNotLeader, format, a...)
+}
+
+// QuotaExceeded returns an error for an operation exceeding a quota.
+func QuotaExceeded(format string, a ...interface{}) error {
+	return New(KindQuotaExceeded, format, a...)
+}
+
+// BadParameter returns an error for an invalid request.
+func BadParameter(format string, a ...interface{}) error {
+	return New(KindBadParameter, format, a...)
+}
+
+// NotImplemented returns an error for an unsupported operation.
+func NotImplemented(format string, a ...interface{}) error {
+	return New(KindNotImplemented, format, a...)
+}
+
+// TooLarge returns an error for a request body exceeding the size limit.
+func TooLarge(format string, a ...interface{}) error {
+	return New(KindTooLarge, format, a...)
+}
+
+// Retriable returns an error for a request which may succeed if it is retried.
+func Retriable(format string, a ...interface{}) error {
+	return New(KindRetriable, format, a...)
+}
+
+// Corrupted returns an error for data which does not match its checksum.
+func Corrupted(format string, a ...interface{}) error {
+	return New(KindCorrupted, format, a...)
+}
+
+// IsNotFound returns true if err is a NotFound error.
+func IsNotFound(err error) bool {
+	return Is(err, KindNotFound)
+}
+
+// IsAlreadyExists returns true if err is an AlreadyExists error.
+func IsAlreadyExists(err error) bool {
+	return Is(err, KindAlreadyExists)
+}
+
+// IsNotEmpty returns true if err is a NotEmpty error.
+func IsNotEmpty(err error) bool {
+	return Is(err, KindNotEmpty)
+}
+
+// IsNotDirectory returns true if err is a NotDirectory error.
+func IsNotDirectory(err error) bool {
+	return Is(err, KindNotDirectory)
+}
+
+// IsPermissionDenied returns true if err is a PermissionDenied error.
+func IsPermissionDenied(err error) bool {
+	return Is(err, KindPermissionDenied)
+}
+
+// IsNotLeader returns true if err is a NotLeader error.
+func IsNotLeader(err error) bool {
+	return Is(err, KindNotLeader)
+}
+
+// IsQuotaExceeded returns true if err is a QuotaExceeded error.
+func IsQuotaExceeded(err error) bool {
+	return Is(err, KindQuotaExceeded)
+}
+
+// IsCorrupted returns true if err is a Corrupted error.
+func IsCorrupted(err error) bool {
+	return Is(err, KindCorrupted)
+}
@@ -0,0 +1,477 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/errors"
+)
+
+// The types of the ACL entries.
+const (
+	ACLUser  = "user"
+	ACLGroup = "group"
+	ACLMask  = "mask"
+	ACLOther = "other"
+)
+
+// ACLEntry is an entry of a POSIX ACL.
+//
+// As in HDFS, the File only stores the entries which extend its permission
+// bits: the named users and groups and the owning group of the access ACL,
+// whose mask is stored in the group bits of the mode, and the whole default
+// ACL of a directory.
+type ACLEntry struct {
+	// Default is true for the entries of the default ACL of a directory,
+	// which its new children inherit.
+	Default bool   `json:"default,omitempty"`
+	Type    string `json:"type"`
+	// Name is the uid of a named user or the gid of a named group, and is
+	// empty for the owner, the owning group, the mask and the others.
+	Name string `json:"name,omitempty"`
+	// Perm is a combination of MayRead, MayWrite and MayExec.
+	Perm uint32 `json:"perm"`
+}
+
+// ParseACLSpec parses the comma separated ACL entries of the WebHDFS
+// aclspec parameter, e.g. "user::rwx,user:1000:r-x,default:group::r-x".
+// The entries have no permission if perm is false, as in the aclspec of
+// REMOVEACLENTRIES.
+func ParseACLSpec(spec string, perm bool) ([]ACLEntry, error) {
+	var entries []ACLEntry
+	for _, s := range strings.Split(spec, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		e, err := parseACLEntry(s, perm)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	if len(entries) == 0 {
+		return nil, errors.BadParameter("empty ACL spec")
+	}
+	return entries, nil
+}
+
+func parseACLEntry(s string, perm bool) (ACLEntry, error) {
+	var e ACLEntry
+	fields := strings.Split(s, ":")
+	if fields[0] == "default" {
+		e.Default = true
+		fields = fields[1:]
+	}
+	if n := len(fields); (perm && n != 3) || (!perm && n != 2 && n != 3) {
+		return e, errors.BadParameter("invalid ACL entry %q", s)
+	}
+	e.Type, e.Name = fields[0], fields[1]
+	switch e.Type {
+	case ACLUser, ACLGroup:
+		if e.Name != "" {
+			if _, err := strconv.ParseUint(e.Name, 10, 32); err != nil {
+				return e, errors.BadParameter("invalid ACL entry %q: %s is not a numeric id", s, e.Name)
+			}
+		}
+	case ACLMask, ACLOther:
+		if e.Name != "" {
+			return e, errors.BadParameter("invalid ACL entry %q: the %s entry has no name", s, e.Type)
+		}
+	default:
+		return e, errors.BadParameter("invalid ACL entry %q: unknown type %s", s, e.Type)
+	}
+	if len(fields) == 3 {
+		p, ok := parsePerm(fields[2])
+		if !ok {
+			return e, errors.BadParameter("invalid ACL entry %q: invalid permission %s", s, fields[2])
+		}
+		e.Perm = p
+	}
+	return e, nil
+}
+
+func parsePerm(s string) (uint32, bool) {
+	if len(s) != 3 {
+		return 0, false
+	}
+	var p uint32
+	for i, bit := range []uint32{MayRead, MayWrite, MayExec} {
+		switch s[i] {
+		case "rwx"[i]:
+			p |= bit
+		case '-':
+		default:
+			return 0, false
+		}
+	}
+	return p, true
+}
+
+// String returns e in the aclspec format.
+func (e ACLEntry) String() string {
+	s := e.Type + ":" + e.Name + ":" + maskString(e.Perm)
+	if e.Default {
+		return "default:" + s
+	}
+	return s
+}
+
+// FormatACLSpec returns the entries in the aclspec format.
+func FormatACLSpec(entries []ACLEntry) string {
+	s := make([]string, len(entries))
+	for i, e := range entries {
+		s[i] = e.String()
+	}
+	return strings.Join(s, ",")
+}
+
+// named returns true for the entries of the named users and groups.
+func (e ACLEntry) named() bool {
+	return e.Name != ""
+}
+
+// id returns the uid or gid of a named entry.
+func (e ACLEntry) id() uint32 {
+	n, _ := strconv.ParseUint(e.Name, 10, 32)
+	return uint32(n)
+}
+
+// sameKey returns true if e and o are entries of the same scope, type and
+// name, whatever their permission.
+func (e ACLEntry) sameKey(o ACLEntry) bool {
+	return e.Default == o.Default && e.Type == o.Type && e.Name == o.Name
+}
+
+// less orders the entries as getfacl does: the access entries first, and
+// the owner, the named users, the owning group, the named groups, the mask
+// and the others in each scope.
+func (e ACLEntry) less(o ACLEntry) bool {
+	if e.Default != o.Default {
+		return !e.Default
+	}
+	order := map[string]int{ACLUser: 0, ACLGroup: 1, ACLMask: 2, ACLOther: 3}
+	if e.Type != o.Type {
+		return order[e.Type] < order[o.Type]
+	}
+	if e.named() != o.named() {
+		return !e.named()
+	}
+	return e.id() < o.id()
+}
+
+func sortACL(entries []ACLEntry) {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].less(entries[j]) })
+}
+
+// HasACL returns true if f has an access or a default ACL.
+func (f *File) HasACL() bool {
+	return len(f.ACL) > 0
+}
+
+// hasAccessACL returns true if the group bits of f hold the mask of an
+// access ACL.
+func (f *File) hasAccessACL() bool {
+	for _, e := range f.ACL {
+		if !e.Default {
+			return true
+		}
+	}
+	return false
+}
+
+// ACLEntries returns the whole ACL of f, including the entries represented
+// by its permission bits.
+func (f *File) ACLEntries() []ACLEntry {
+	perm := uint32(f.Mode.Perm())
+	entries := []ACLEntry{
+		{Type: ACLUser, Perm: perm >> 6 & 7},
+		{Type: ACLOther, Perm: perm & 7},
+	}
+	if f.hasAccessACL() {
+		entries = append(entries, ACLEntry{Type: ACLMask, Perm: perm >> 3 & 7})
+	} else {
+		entries = append(entries, ACLEntry{Type: ACLGroup, Perm: perm >> 3 & 7})
+	}
+	entries = append(entries, f.ACL...)
+	sortACL(entries)
+	return entries
+}
+
+// ACLStatus returns the WebHDFS ACL status of f, whose entries exclude those
+// represented by its permission bits.
+func (f *File) ACLStatus() api.ACLStatus {
+	entries := make([]string, len(f.ACL))
+	for i, e := range f.ACL {
+		entries[i] = e.String()
+	}
+	return api.ACLStatus{
+		Entries:    entries,
+		Owner:      strconv.FormatUint(uint64(f.Uid), 10),
+		Group:      strconv.FormatUint(uint64(f.Gid), 10),
+		Permission: strconv.FormatUint(uint64(f.Mode.Perm()), 8),
+		StickyBit:  f.Mode&os.ModeSticky != 0,
+	}
+}
+
+// UpdateACL changes the ACL of f with the WebHDFS ACL operation op, whose
+// aclspec is spec:
+//
+//	SETACL            replaces the whole ACL
+//	MODIFYACLENTRIES  adds the entries of spec, or changes their permission
+//	REMOVEACLENTRIES  removes the entries of spec
+//	REMOVEDEFAULTACL  removes the default ACL
+//	REMOVEACL         removes all the entries which extend the permission bits
+//
+// The masks are computed from the entries of their scope, unless spec sets
+// them.
+func (f *File) UpdateACL(op string, spec []ACLEntry) error {
+	var entries []ACLEntry
+	switch op {
+	case api.OpsSetACL:
+		entries = spec
+	case api.OpsModifyACLEntries:
+		entries = removeMasks(f.ACLEntries(), spec)
+		for _, s := range spec {
+			entries = append(removeEntries(entries, func(e ACLEntry) bool { return e.sameKey(s) }), s)
+		}
+	case api.OpsRemoveACLEntries:
+		for _, s := range spec {
+			if !s.named() && s.Type != ACLMask {
+				return errors.BadParameter("invalid ACL spec: cannot remove the base entry %s", s)
+			}
+		}
+		entries = removeMasks(f.ACLEntries(), nil)
+		for _, s := range spec {
+			entries = removeEntries(entries, func(e ACLEntry) bool { return e.sameKey(s) })
+		}
+	case api.OpsRemoveDefaultACL:
+		entries = removeEntries(f.ACLEntries(), func(e ACLEntry) bool { return e.Default })
+	case api.OpsRemoveACL:
+		// the group bits get back the permission of the owning group, not
+		// the one of the mask
+		entries = removeEntries(f.ACLEntries(), func(e ACLEntry) bool {
+			return e.Default || e.named() || e.Type == ACLMask
+		})
+	default:
+		return errors.BadParameter("unknown ACL operation %q", op)
+	}
+	return f.setACLEntries(entries)
+}
+
+// removeMasks removes the masks of entries, except those of the scopes whose
+// mask is set by spec, so that they are computed again.
+func removeMasks(entries, spec []ACLEntry) []ACLEntry {
+	return removeEntries(entries, func(e ACLEntry) bool {
+		if e.Type != ACLMask {
+			return false
+		}
+		for _, s := range spec {
+			if s.sameKey(e) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// removeEntries returns a copy of entries without those matching remove.
+func removeEntries(entries []ACLEntry, remove func(ACLEntry) bool) []ACLEntry {
+	kept := make([]ACLEntry, 0, len(entries))
+	for _, e := range entries {
+		if !remove(e) {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// setACLEntries sets the whole ACL of f: the permission bits from its base
+// entries, and the entries which extend them.
+func (f *File) setACLEntries(entries []ACLEntry) error {
+	var access, def []ACLEntry
+	for i, e := range entries {
+		for _, o := range entries[:i] {
+			if e.sameKey(o) {
+				return errors.BadParameter("invalid ACL: duplicate entry %s", e)
+			}
+		}
+		if e.Default {
+			def = append(def, e)
+		} else {
+			access = append(access, e)
+		}
+	}
+	if len(def) > 0 && !f.IsDirectory() {
+		return errors.BadParameter("invalid ACL: %s is not a directory and cannot have a default ACL", f.FullPath())
+	}
+	user, group, other, ok := baseEntries(access)
+	if !ok {
+		return errors.BadParameter("invalid ACL: the access ACL needs the user, group and other entries")
+	}
+	access = withMask(access, false)
+	mask, extended := findEntry(access, ACLMask, false)
+	if len(def) > 0 {
+		// the missing base entries of the default ACL are copied from the
+		// access ACL
+		for _, e := range []ACLEntry{user, group, other} {
+			if _, ok := findEntry(def, e.Type, true); !ok {
+				e.Default = true
+				def = append(def, e)
+			}
+		}
+		def = withMask(def, true)
+	}
+
+	perm := user.Perm<<6 | group.Perm<<3 | other.Perm
+	acl := []ACLEntry{}
+	if extended {
+		perm = perm&^070 | mask.Perm<<3
+		acl = removeEntries(access, func(e ACLEntry) bool {
+			return !e.named() && e.Type != ACLGroup
+		})
+	}
+	acl = append(acl, def...)
+	sortACL(acl)
+	if len(acl) == 0 {
+		acl = nil
+	}
+	f.Mode = f.Mode&^os.ModePerm | os.FileMode(perm)
+	f.ACL = acl
+	return nil
+}
+
+// baseEntries returns the unnamed user, group and other entries.
+func baseEntries(entries []ACLEntry) (user, group, other ACLEntry, ok bool) {
+	var u, g, o bool
+	for _, e := range entries {
+		if e.named() {
+			continue
+		}
+		switch e.Type {
+		case ACLUser:
+			user, u = e, true
+		case ACLGroup:
+			group, g = e, true
+		case ACLOther:
+			other, o = e, true
+		}
+	}
+	return user, group, other, u && g && o
+}
+
+// findEntry returns the unnamed entry of type t in the scope.
+func findEntry(entries []ACLEntry, t string, def bool) (ACLEntry, bool) {
+	for _, e := range entries {
+		if e.Default == def && e.Type == t && !e.named() {
+			return e, true
+		}
+	}
+	return ACLEntry{}, false
+}
+
+// withMask adds the mask of the entries of a scope if it has named entries
+// and no mask: the union of the permissions of the group class.
+func withMask(entries []ACLEntry, def bool) []ACLEntry {
+	if _, ok := findEntry(entries, ACLMask, def); ok {
+		return entries
+	}
+	var perm uint32
+	named := false
+	for _, e := range entries {
+		if e.named() {
+			named = true
+		}
+		if e.named() || e.Type == ACLGroup {
+			perm |= e.Perm
+		}
+	}
+	if !named {
+		return entries
+	}
+	return append(entries, ACLEntry{Default: def, Type: ACLMask, Perm: perm})
+}
+
+// inheritACL applies the default ACL of dir to its new child f, created with
+// the permission perm. The access ACL of f is the default ACL restricted by
+// perm, and a new directory inherits the default ACL as well.
+func (dir *File) inheritACL(f *File, perm os.FileMode) error {
+	var entries []ACLEntry
+	for _, e := range dir.ACL {
+		if e.Default {
+			entries = append(entries, e)
+		}
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	_, extended := findEntry(entries, ACLMask, true)
+	access := make([]ACLEntry, 0, len(entries))
+	for _, e := range entries {
+		e.Default = false
+		if !e.named() {
+			switch {
+			case e.Type == ACLUser:
+				e.Perm &= uint32(perm) >> 6 & 7
+			case e.Type == ACLMask || (e.Type == ACLGroup && !extended):
+				e.Perm &= uint32(perm) >> 3 & 7
+			case e.Type == ACLOther:
+				e.Perm &= uint32(perm) & 7
+			}
+		}
+		access = append(access, e)
+	}
+	if f.IsDirectory() {
+		access = append(access, entries...)
+	}
+	return f.setACLEntries(access)
+}
+
+// accessACL checks the access of c, which is neither root nor the owner of
+// f, against the access ACL of f.
+func (f *File) accessACL(c *Caller, mask uint32) bool {
+	aclMask := uint32(f.Mode.Perm()) >> 3 & 7
+	for _, e := range f.ACL {
+		if !e.Default && e.Type == ACLUser && e.named() && e.id() == c.Uid {
+			return e.Perm&aclMask&mask == mask
+		}
+	}
+	matched := false
+	for _, e := range f.ACL {
+		if e.Default || e.Type != ACLGroup {
+			continue
+		}
+		gid := f.Gid
+		if e.named() {
+			gid = e.id()
+		}
+		if c.InGroup(gid) {
+			if e.Perm&aclMask&mask == mask {
+				return true
+			}
+			matched = true
+		}
+	}
+	if matched {
+		return false
+	}
+	return uint32(f.Mode.Perm())&7&mask == mask
+}
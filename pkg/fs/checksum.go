@@ -0,0 +1,103 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/gostor/gofs/pkg/errors"
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Checksums are the checksums of the content of a file, computed as it is
+// written: its MD5, which the object storages use as the ETag of the objects
+// uploaded at once, its CRC32C, and optionally its SHA-256.
+type Checksums struct {
+	MD5    []byte
+	CRC32C uint32
+	SHA256 []byte `json:",omitempty"`
+}
+
+// Hasher computes the checksums of the data written to it.
+type Hasher struct {
+	io.Writer
+	md5    hash.Hash
+	crc32c hash.Hash32
+	sha256 hash.Hash
+}
+
+// NewHasher returns a Hasher, which computes the SHA-256 too if withSHA256
+// is set.
+func NewHasher(withSHA256 bool) *Hasher {
+	h := &Hasher{md5: md5.New(), crc32c: crc32.New(castagnoli)}
+	w := []io.Writer{h.md5, h.crc32c}
+	if withSHA256 {
+		h.sha256 = sha256.New()
+		w = append(w, h.sha256)
+	}
+	h.Writer = io.MultiWriter(w...)
+	return h
+}
+
+// Checksums returns the checksums of the data written so far.
+func (h *Hasher) Checksums() *Checksums {
+	cs := &Checksums{MD5: h.md5.Sum(nil), CRC32C: h.crc32c.Sum32()}
+	if h.sha256 != nil {
+		cs.SHA256 = h.sha256.Sum(nil)
+	}
+	return cs
+}
+
+// SetChecksums records the checksums of the content of f.
+func (f *File) SetChecksums(cs *Checksums) {
+	f.Hash = cs.MD5
+	f.Checksum = fmt.Sprintf("%08x", cs.CRC32C)
+	f.SHA256 = cs.SHA256
+}
+
+// Checksums returns the checksums of the content of f, or nil for the files
+// written before they were recorded.
+func (f *File) Checksums() *Checksums {
+	crc, err := strconv.ParseUint(f.Checksum, 16, 32)
+	if len(f.Hash) == 0 || err != nil {
+		return nil
+	}
+	return &Checksums{MD5: f.Hash, CRC32C: uint32(crc), SHA256: f.SHA256}
+}
+
+// CheckETag checks the ETag of the object storing the data of the file p
+// against the MD5 of its content. The ETags of the objects uploaded in parts
+// are not the MD5 of their content, and are not checked.
+func (cs *Checksums) CheckETag(p, etag string) error {
+	etag = strings.Trim(etag, `"`)
+	if len(cs.MD5) == 0 || len(etag) != hex.EncodedLen(md5.Size) {
+		return nil
+	}
+	if !strings.EqualFold(etag, hex.EncodeToString(cs.MD5)) {
+		return errors.Corrupted("the data of %s is corrupted: the ETag of its object is %s, expected %x", p, etag, cs.MD5)
+	}
+	return nil
+}
@@ -18,8 +18,11 @@ package fs
 
 import (
 	"context"
+	"os"
+	"strings"
 
 	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/errors"
 )
 
 // Lookup -
@@ -188,43 +191,29 @@ func (dir *File) bucket(tx *meta.Tx) *meta.Bucket {
 */
 
 // Mkdir will make a new directory below current dir
-func (dir *File) Mkdir(ctx context.Context, req *api.MkdirRequest) error {
-	/*
-		subdir := File{
-			Parent:    dir,
-			namespace: dir.namespace,
-
-			Path: req.Name,
-
-			Mode: 0770 | os.ModeDir,
-			GID:  dir.mfs.config.gid,
-			UID:  dir.mfs.config.uid,
-
-			Chgtime: time.Now(),
-			Crtime:  time.Now(),
-			Mtime: time.Now(),
-			Atime: time.Now(),
-		}
-
-			tx, err := dir.mfs.db.Begin(true)
-			if err != nil {
-				return nil, err
-			}
-
-			defer tx.Rollback()
-
-			if err := subdir.store(tx); err != nil {
-				return nil, err
-			}
-
-			// Commit the transaction and check for error.
-			if err := tx.Commit(); err != nil {
-				return nil, err
-			}
-	*/
-
-	//return &subdir, nil
-	return nil
+func (dir *File) Mkdir(ctx context.Context, req *api.MkdirRequest) (*File, error) {
+	if !dir.IsDirectory() {
+		return nil, errors.NotDirectory("not a directory: %s", dir.FullPath())
+	}
+	subdir := &File{
+		Parent:    dir,
+		namespace: dir.namespace,
+		Path:      req.Name,
+		Directory: true,
+		Attr: Attr{
+			Mode:  os.ModeDir | (req.Mode &^ req.Umask).Perm() | req.Mode&os.ModeSticky,
+			Nlink: 2,
+			Uid:   req.Uid,
+			Gid:   dir.childGid(req.Gid),
+		},
+		Summary: &Summary{Directories: 1},
+	}
+	// the subdirectories of a setgid directory are setgid too
+	subdir.Mode |= dir.Mode & os.ModeSetgid
+	if err := dir.inheritACL(subdir, req.Mode.Perm()); err != nil {
+		return nil, err
+	}
+	return subdir, nil
 }
 
 // Remove will delete a file or directory from current directory
@@ -285,11 +274,105 @@ func (dir *File) store(tx *meta.Tx) error {
 
 // Create will return a new empty file in current dir, if the file is currently locked, it will
 // wait for the lock to be freed.
-func (dir *File) Create(ctx context.Context, req *api.CreateRequest) error {
-	return nil
+func (dir *File) Create(ctx context.Context, req *api.CreateRequest) (*File, error) {
+	if !dir.IsDirectory() {
+		return nil, errors.NotDirectory("not a directory: %s", dir.FullPath())
+	}
+	f := &File{
+		Parent:    dir,
+		namespace: dir.namespace,
+		Path:      req.Name,
+		Attr: Attr{
+			Mode:  (req.Mode &^ req.Umask).Perm(),
+			Nlink: 1,
+			Uid:   req.Uid,
+			Gid:   dir.childGid(req.Gid),
+		},
+	}
+	if err := dir.inheritACL(f, req.Mode.Perm()); err != nil {
+		return nil, err
+	}
+	return f, nil
 }
 
-// Rename will rename files
-func (dir *File) Rename(ctx context.Context, req *api.RenameRequest) error {
-	return nil
+// CreateSymlink creates a new symbolic link in dir, pointing to req.Target.
+func (dir *File) CreateSymlink(ctx context.Context, req *api.SymlinkRequest) (*File, error) {
+	if !dir.IsDirectory() {
+		return nil, errors.NotDirectory("not a directory: %s", dir.FullPath())
+	}
+	if req.Target == "" {
+		return nil, errors.BadParameter("empty symlink target")
+	}
+	return &File{
+		Parent:    dir,
+		namespace: dir.namespace,
+		Path:      req.NewName,
+		Symlink:   true,
+		Target:    req.Target,
+		Attr: Attr{
+			Mode:  os.ModeSymlink | 0777,
+			Size:  uint64(len(req.Target)),
+			Nlink: 1,
+			Uid:   req.Uid,
+			Gid:   dir.childGid(req.Gid),
+		},
+	}, nil
+}
+
+// CreateLink creates a new hard link in dir, referring to old. The caller adds the
+// link to the Links of old.
+func (dir *File) CreateLink(ctx context.Context, req *api.LinkRequest, old *File) (*File, error) {
+	if !dir.IsDirectory() {
+		return nil, errors.NotDirectory("not a directory: %s", dir.FullPath())
+	}
+	if old.IsDirectory() {
+		return nil, errors.IsDirectory("cannot link the directory %s", old.FullPath())
+	}
+	if old.IsLink() || old.IsSymlink() {
+		return nil, errors.BadParameter("cannot link %s, which is not a regular file", old.FullPath())
+	}
+	return &File{
+		Parent:    dir,
+		namespace: dir.namespace,
+		Path:      req.NewName,
+		Link:      true,
+		Target:    old.FullPath(),
+		Attr:      Attr{Inode: old.Inode, Mode: old.Mode},
+	}, nil
+}
+
+// Rename returns the file f of dir, named req.OldName, moved to the directory
+// newDir with the name req.NewName. The caller moves the entries of the tree
+// of f in the cache.
+func (dir *File) Rename(ctx context.Context, req *api.RenameRequest, f, newDir *File) (*File, error) {
+	if !dir.IsDirectory() {
+		return nil, errors.NotDirectory("not a directory: %s", dir.FullPath())
+	}
+	if !newDir.IsDirectory() {
+		return nil, errors.NotDirectory("not a directory: %s", newDir.FullPath())
+	}
+	if f.Path != req.OldName || req.NewDir != 0 && req.NewDir != newDir.Inode {
+		return nil, errors.BadParameter("invalid rename of %s", f.FullPath())
+	}
+	if req.NewName == "" || strings.Contains(req.NewName, "/") {
+		return nil, errors.BadParameter("invalid name %q", req.NewName)
+	}
+	if p := newDir.FullPath(); f.IsDirectory() && (p == f.FullPath() || strings.HasPrefix(p, f.FullPath()+"/")) {
+		return nil, errors.BadParameter("cannot move %s into its own subtree %s", f.FullPath(), p)
+	}
+	moved := *f
+	moved.Parent = newDir
+	moved.Path = req.NewName
+	moved.namespace = newDir.namespace
+	return &moved, nil
+}
+
+// childGid returns the group of a new child created by a caller whose
+// primary group is gid: the group of the directory if it is setgid, gid
+// otherwise.
+func (dir *File) childGid(gid uint32) uint32 {
+	if dir.Mode&os.ModeSetgid != 0 {
+		return dir.Gid
+	}
+	return gid
 }
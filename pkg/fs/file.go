@@ -20,6 +20,8 @@ import (
 	"context"
 	"path"
 	"path/filepath"
+	"strconv"
+	"time"
 
 	"github.com/gostor/gofs/pkg/api"
 )
@@ -33,8 +35,51 @@ type File struct {
 	Symlink   bool
 	Link      bool
 	Path      string
-	Checksum  string
-	Hash      []byte
+	// Checksum is the CRC32C of the content of a file, in hex, and Hash
+	// its MD5. See Checksums.
+	Checksum string
+	Hash     []byte
+	// SHA256 is the SHA-256 of the content, if it was asked for.
+	SHA256 []byte `json:",omitempty"`
+	// ACL are the entries of the access and default ACLs which extend the
+	// permission bits, see ACLEntry.
+	ACL []ACLEntry `json:",omitempty"`
+	// Xattrs are the extended attributes, by name.
+	Xattrs map[string][]byte `json:",omitempty"`
+	// Target is the path a symlink points to, or the full path of the file
+	// a hard link refers to.
+	Target string `json:",omitempty"`
+	// Links are the full paths of the hard links which refer to the file.
+	// The attributes and the data of the file are shared by its links,
+	// which only store their Target.
+	Links []string `json:",omitempty"`
+	// Object is the key of the data object in the bucket of the namespace,
+	// generated by NewObjectKey when the file is created, so that the data
+	// does not move with the file. The files created before the keys were
+	// are stored at their RemotePath.
+	Object string `json:",omitempty"`
+	// Segments are the segments of the content which follow the one
+	// stored in the Object of the files appended to, see Pieces.
+	Segments []Segment `json:",omitempty"`
+	// Quota is the quota of a directory.
+	Quota *Quota `json:",omitempty"`
+	// Summary are the aggregates of the tree of a directory.
+	Summary *Summary `json:",omitempty"`
+	// Snapshots are the snapshots of a snapshottable directory, oldest
+	// first, and SnapshotDirs the full paths of the snapshottable
+	// directories of a namespace, on its root.
+	Snapshots    []Snapshot `json:",omitempty"`
+	SnapshotDirs []string   `json:",omitempty"`
+	// Absent is set on the copies of the files saved for a snapshot which
+	// did not exist when it was taken.
+	Absent bool `json:",omitempty"`
+	// Versioning is the versioning policy of a directory, and Versions
+	// the previous contents of a regular file, oldest first.
+	Versioning *Versioning `json:",omitempty"`
+	Versions   []Version   `json:",omitempty"`
+	// Chunks are the chunks uploaded for the files of a directory which
+	// are not created yet.
+	Chunks []Chunk `json:",omitempty"`
 
 	namespace *Namespace
 }
@@ -51,19 +96,19 @@ func (f *File) IsLink() bool {
 	return f.Link
 }
 
-// Setattr - set attribute.
+// Setattr sets the attributes req.Valid selects. The raft operations run it
+// on every node, and then update the file in the cache.
 func (f *File) Setattr(ctx context.Context, req *api.SetattrRequest) error {
-	// update cache with new attributes
 	if req.Valid.Mode() {
 		f.Mode = req.Mode
 	}
 
 	if req.Valid.Uid() {
-		//f.UID = req.Uid
+		f.Uid = req.Uid
 	}
 
 	if req.Valid.Gid() {
-		//f.GID = req.Gid
+		f.Gid = req.Gid
 	}
 
 	if req.Valid.Size() {
@@ -83,7 +128,7 @@ func (f *File) Setattr(ctx context.Context, req *api.SetattrRequest) error {
 	}
 
 	if req.Valid.Chgtime() {
-		//f.Chgtime = req.Chgtime
+		f.Ctime = req.Chgtime
 	}
 
 	if req.Valid.Bkuptime() {
@@ -93,12 +138,22 @@ func (f *File) Setattr(ctx context.Context, req *api.SetattrRequest) error {
 	if req.Valid.Flags() {
 		f.Flags = req.Flags
 	}
-	//_, err := f.namespace.cache.Update(f.namespace.ID, f.FullPath(), f)
 	return nil
 }
 
+// ObjectKey returns the key of the data object of f.
+func (f *File) ObjectKey() string {
+	if f.Object != "" {
+		return f.Object
+	}
+	return f.RemotePath()
+}
+
 // RemotePath will return the full path on bucket
 func (f *File) RemotePath() string {
+	if f.Parent == nil {
+		return ""
+	}
 	return path.Join(f.Parent.RemotePath(), f.Path)
 }
 
@@ -127,3 +182,35 @@ func (f *File) FullPath() string {
 func (f *File) Getattr(ctx context.Context) (Attr, error) {
 	return f.Attr, nil
 }
+
+// FileStatus returns the WebHDFS status of the file.
+func (f *File) FileStatus() api.FileStatus {
+	st := api.FileStatus{
+		AccessTime:       millis(f.Atime),
+		FileID:           f.Inode,
+		Group:            strconv.FormatUint(uint64(f.Gid), 10),
+		Length:           int64(f.Size),
+		ModificationTime: millis(f.Mtime),
+		Owner:            strconv.FormatUint(uint64(f.Uid), 10),
+		Permission:       strconv.FormatUint(uint64(f.Mode.Perm()), 8),
+		Type:             api.FileTypeFile,
+		ACLBit:           f.HasACL(),
+	}
+	switch {
+	case f.IsDirectory():
+		st.Type = api.FileTypeDirectory
+	case f.IsSymlink():
+		st.Type = api.FileTypeSymlink
+		st.Symlink = f.Target
+	default:
+		st.Replication = 1
+	}
+	return st
+}
+
+func millis(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano() / int64(time.Millisecond)
+}
@@ -17,9 +17,15 @@ limitations under the License.
 package fs
 
 import (
+	"crypto/rand"
+	"fmt"
+	"os"
 	"path/filepath"
+	"regexp"
+	"sync"
 
 	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/errors"
 	"github.com/gostor/gofs/pkg/storage"
 )
 
@@ -28,6 +34,9 @@ type Namespace struct {
 	stor storage.Storage
 
 	api.Config
+
+	lock   sync.Mutex
+	bucket storage.Bucket
 }
 
 func NewNamespace(id string, cfg *api.Config, s storage.Storage) *Namespace {
@@ -38,11 +47,137 @@ func NewNamespace(id string, cfg *api.Config, s storage.Storage) *Namespace {
 	}
 }
 
+// namespaceID is the format of the namespace IDs, which are the first
+// component of the paths.
+var namespaceID = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// apiVersion matches the IDs which would be taken for the API version
+// prefix of the paths.
+var apiVersion = regexp.MustCompile(`^v[0-9]+$`)
+
+// reservedNamespaceIDs are the IDs which would clash with the other API
+// routes.
+var reservedNamespaceIDs = map[string]bool{
+	"cluster":    true,
+	"namespaces": true,
+	"version":    true,
+}
+
+// CheckNamespaceID checks that id is a valid namespace ID: 1 to 63 lower
+// case letters, digits and hyphens, not starting with a hyphen. The IDs of
+// the API routes and of the API versions, like v1, are reserved.
+func CheckNamespaceID(id string) error {
+	if !namespaceID.MatchString(id) {
+		return errors.BadParameter("invalid namespace ID %q: it must have 1 to 63 lower case letters, digits or hyphens", id)
+	}
+	if reservedNamespaceIDs[id] || apiVersion.MatchString(id) {
+		return errors.BadParameter("invalid namespace ID %q: it is reserved", id)
+	}
+	return nil
+}
+
+// Info returns the description of the namespace, without its secret key.
+func (ns *Namespace) Info() api.Namespace {
+	return api.Namespace{
+		ID:            ns.ID,
+		Bucket:        ns.Bucket,
+		Location:      ns.Location,
+		Endpoint:      ns.Endpoint,
+		AccessKey:     ns.AccessKey,
+		TrashInterval: ns.TrashInterval,
+		KeyUid:        ns.KeyUid,
+		KeyGids:       ns.KeyGids,
+		TrustedKeys:   ns.TrustedKeys,
+	}
+}
+
 func (ns *Namespace) Root() *File {
+	root := Root(ns.ID)
+	root.namespace = ns
+	return root
+}
+
+// Object returns the storage object holding the data of f.
+func (ns *Namespace) Object(f *File) (storage.Object, error) {
+	b, err := ns.connect()
+	if err != nil {
+		return nil, err
+	}
+	return b.Object(f.ObjectKey()), nil
+}
+
+// ListObjects returns the objects of the bucket of the namespace whose keys
+// start with prefix.
+func (ns *Namespace) ListObjects(prefix string) ([]storage.ObjectInfo, error) {
+	b, err := ns.connect()
+	if err != nil {
+		return nil, err
+	}
+	return b.List(prefix)
+}
+
+// CheckStorage checks that the bucket of the namespace exists and accepts
+// its credentials.
+func (ns *Namespace) CheckStorage() error {
+	_, err := ns.connect()
+	return err
+}
+
+// connect returns the bucket of the namespace, connecting to it on first
+// use.
+func (ns *Namespace) connect() (storage.Bucket, error) {
+	ns.lock.Lock()
+	defer ns.lock.Unlock()
+	if ns.bucket == nil {
+		if ns.stor == nil {
+			return nil, errors.New(errors.KindInternal, "namespace %s has no storage", ns.ID)
+		}
+		b, err := ns.stor.Bucket(ns.Config.Bucket, &ns.Config)
+		if err != nil {
+			return nil, err
+		}
+		if err = b.Auth(); err != nil {
+			return nil, err
+		}
+		ns.bucket = b
+	}
+	return ns.bucket, nil
+}
+
+// Root returns the root directory of the namespace id.
+func Root(id string) *File {
 	return &File{
 		Parent:    nil,
-		Path:      filepath.Join("/", ns.ID),
+		Path:      filepath.Join("/", id),
 		Directory: true,
-		Attr:      Attr{},
+		Attr: Attr{
+			Mode:  os.ModeDir | 0755,
+			Nlink: 2,
+		},
+		Summary: &Summary{Directories: 1},
+	}
+}
+
+// ObjectKeyPrefix is the prefix of the object keys generated for the files.
+const ObjectKeyPrefix = ".gofs/objects/"
+
+// NamespaceKeyPrefix returns the prefix of the object keys generated for the
+// files of the namespace ns. The namespaces may share a bucket, and each one
+// only ever sees its own objects under it.
+func NamespaceKeyPrefix(ns string) string {
+	return ObjectKeyPrefix + ns + "/"
+}
+
+// NewObjectKey returns a new random object key for a file of the namespace
+// ns, a UUID under NamespaceKeyPrefix, which unlike the RemotePath does not
+// depend on the path of the file.
+func NewObjectKey(ns string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
 	}
+	// version 4, variant 10
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%s%x-%x-%x-%x-%x", NamespaceKeyPrefix(ns), b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
 }
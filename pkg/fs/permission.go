@@ -0,0 +1,145 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"os"
+
+	"github.com/gostor/gofs/pkg/errors"
+)
+
+// The access masks, as in access(2).
+const (
+	MayExec  uint32 = 1
+	MayWrite uint32 = 2
+	MayRead  uint32 = 4
+)
+
+// Caller is the POSIX identity the file permissions are checked for.
+type Caller struct {
+	Uid uint32
+	// Gids are the groups of the caller, the primary one first.
+	Gids []uint32
+	// Authorize, if set, asks the authorization plugins whether the caller
+	// may access the file at full path p, which a path of the request
+	// resolves to.
+	Authorize func(p string) error
+}
+
+// RootCaller is the superuser, who is allowed everything.
+var RootCaller = &Caller{Uid: 0, Gids: []uint32{0}}
+
+// IsRoot returns true if c is the superuser.
+func (c *Caller) IsRoot() bool {
+	return c.Uid == 0
+}
+
+// Gid returns the primary group of the caller.
+func (c *Caller) Gid() uint32 {
+	if len(c.Gids) == 0 {
+		return c.Uid
+	}
+	return c.Gids[0]
+}
+
+// InGroup returns true if c is a member of the group gid.
+func (c *Caller) InGroup(gid uint32) bool {
+	for _, g := range c.Gids {
+		if g == gid {
+			return true
+		}
+	}
+	return false
+}
+
+// Access checks that c may access f with the mask, a combination of MayRead,
+// MayWrite and MayExec. The permission bits of the owner apply to the owner,
+// those of the group to its members, and the others to everybody else,
+// unless the access ACL of f has an entry for them.
+func (f *File) Access(c *Caller, mask uint32) error {
+	if c.IsRoot() {
+		return nil
+	}
+	perm := uint32(f.Mode.Perm())
+	var ok bool
+	switch {
+	case c.Uid == f.Uid:
+		ok = perm>>6&mask == mask
+	case f.hasAccessACL():
+		ok = f.accessACL(c, mask)
+	case c.InGroup(f.Gid):
+		ok = perm>>3&mask == mask
+	default:
+		ok = perm&mask == mask
+	}
+	if !ok {
+		return errors.PermissionDenied("permission denied: uid %d needs %s access to %s (%s)", c.Uid, maskString(mask), f.FullPath(), f.Mode)
+	}
+	return nil
+}
+
+// CheckSticky checks that c may remove or rename the child of the directory
+// dir. If the sticky bit of dir is set, only the owners of the child or of
+// dir may.
+func (dir *File) CheckSticky(c *Caller, child *File) error {
+	if dir.Mode&os.ModeSticky == 0 || c.IsRoot() || c.Uid == dir.Uid || c.Uid == child.Uid {
+		return nil
+	}
+	return errors.PermissionDenied("permission denied: sticky bit set on %s, and uid %d owns neither it nor %s", dir.FullPath(), c.Uid, child.Path)
+}
+
+// CheckChmod checks that c may change the mode of f, which only its owner
+// may do.
+func (f *File) CheckChmod(c *Caller) error {
+	if c.IsRoot() || c.Uid == f.Uid {
+		return nil
+	}
+	return errors.PermissionDenied("permission denied: uid %d does not own %s", c.Uid, f.FullPath())
+}
+
+// CheckChown checks that c may change the owner of f to uid and its group
+// to gid. Only the superuser may give a file away, and its owner may change
+// its group to one of its own groups.
+func (f *File) CheckChown(c *Caller, uid, gid uint32) error {
+	if c.IsRoot() {
+		return nil
+	}
+	if uid != f.Uid {
+		return errors.PermissionDenied("permission denied: only the superuser may change the owner of %s", f.FullPath())
+	}
+	if c.Uid != f.Uid {
+		return errors.PermissionDenied("permission denied: uid %d does not own %s", c.Uid, f.FullPath())
+	}
+	if gid != f.Gid && !c.InGroup(gid) {
+		return errors.PermissionDenied("permission denied: uid %d is not a member of group %d", c.Uid, gid)
+	}
+	return nil
+}
+
+func maskString(mask uint32) string {
+	s := []byte("---")
+	if mask&MayRead != 0 {
+		s[0] = 'r'
+	}
+	if mask&MayWrite != 0 {
+		s[1] = 'w'
+	}
+	if mask&MayExec != 0 {
+		s[2] = 'x'
+	}
+	return string(s)
+}
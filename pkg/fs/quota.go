@@ -0,0 +1,67 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"math"
+
+	"github.com/gostor/gofs/pkg/errors"
+)
+
+// The special values of the quota limits, as in HDFS.
+const (
+	// QuotaReset clears a limit.
+	QuotaReset int64 = -1
+	// QuotaDontSet leaves a limit unchanged.
+	QuotaDontSet int64 = math.MaxInt64
+)
+
+// Quota is the quota of a directory tree, whose usage is its Summary. As in
+// HDFS, the name quota limits the number of files and directories in the
+// tree, the directory itself included, and the space quota the total size of
+// its files. A limit of -1 is unset.
+type Quota struct {
+	Names int64
+	Space int64
+}
+
+// Update sets the limits of q to names and space, unless they are
+// QuotaDontSet. It returns false if no limit is left set.
+func (q *Quota) Update(names, space int64) bool {
+	if names != QuotaDontSet {
+		q.Names = names
+	}
+	if space != QuotaDontSet {
+		q.Space = space
+	}
+	return q.Names >= 0 || q.Space >= 0
+}
+
+// CheckQuota checks that the tree of the directory f may grow by d.
+func (f *File) CheckQuota(d Summary) error {
+	q, s := f.Quota, f.Summary
+	if q == nil || s == nil {
+		return nil
+	}
+	if names := d.Names(); names > 0 && q.Names >= 0 && s.Names()+names > q.Names {
+		return errors.QuotaExceeded("the name quota of %s is exceeded: quota=%d file count=%d", f.FullPath(), q.Names, s.Names()+names)
+	}
+	if d.Length > 0 && q.Space >= 0 && s.Length+d.Length > q.Space {
+		return errors.QuotaExceeded("the space quota of %s is exceeded: quota=%d diskspace consumed=%d", f.FullPath(), q.Space, s.Length+d.Length)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "time"
+
+// Segment is a part of the content of a file stored in an object of its
+// own, which is never changed: appending to a file adds a segment, and
+// truncating it drops its last segments, rewriting the one cut if any. The
+// chunks of the large files uploaded in parallel are their segments too.
+type Segment struct {
+	Object string
+	Size   int64
+}
+
+// Chunk is a chunk of a large file uploaded on its own, before the file is
+// created of its chunks. The directory of the file keeps its chunks until
+// then, so that a chunk is only used once, by the file it was uploaded for.
+type Chunk struct {
+	Object string
+	Size   int64
+	// MD5 is the MD5 of the chunk, in hex.
+	MD5 string
+	// Name is the name of the file in its directory, and Uid the user who
+	// uploaded the chunk.
+	Name     string    `json:",omitempty"`
+	Uid      uint32    `json:",omitempty"`
+	Uploaded time.Time `json:",omitempty"`
+}
+
+// Pieces returns the segments of the content of the regular file f, in
+// order: its object, which holds the beginning of the content, and then
+// its Segments.
+func (f *File) Pieces() []Segment {
+	return pieces(f.ObjectKey(), f.Size, f.Segments)
+}
+
+// Pieces returns the segments of the content of the version v, see
+// File.Pieces.
+func (v Version) Pieces() []Segment {
+	return pieces(v.Object, v.Attr.Size, v.Segments)
+}
+
+// pieces returns the segments of the content of size bytes stored in the
+// object head followed by the segments tail.
+func pieces(head string, size uint64, tail []Segment) []Segment {
+	n := int64(size)
+	for _, s := range tail {
+		n -= s.Size
+	}
+	return append([]Segment{{Object: head, Size: n}}, tail...)
+}
+
+// SetPieces makes the segments p, which must not be empty, the content of
+// the regular file f, see Pieces, and sets its size.
+func (f *File) SetPieces(p []Segment) {
+	if p[0].Object != f.ObjectKey() {
+		f.Object = p[0].Object
+	}
+	var size int64
+	for _, s := range p {
+		size += s.Size
+	}
+	f.Size = uint64(size)
+	f.Segments = nil
+	if len(p) > 1 {
+		f.Segments = append([]Segment(nil), p[1:]...)
+	}
+}
+
+// Cut returns the index of the segment of p in which a content truncated
+// to size ends, and the number of bytes of the segment it keeps. The
+// segment is rewritten unless it is kept whole.
+func Cut(p []Segment, size int64) (int, int64) {
+	var off int64
+	for i, s := range p {
+		if off+s.Size >= size {
+			return i, size - off
+		}
+		off += s.Size
+	}
+	return len(p) - 1, p[len(p)-1].Size
+}
+
+// Slice returns the segments of p holding the n bytes of the content at
+// offset off, and the offset in the first of them at which the bytes start.
+// The size of the last one is cut to the end of the bytes.
+func Slice(p []Segment, off, n int64) ([]Segment, int64) {
+	for len(p) > 0 && off >= p[0].Size {
+		off -= p[0].Size
+		p = p[1:]
+	}
+	var s []Segment
+	for end := off + n; len(p) > 0 && end > 0; p = p[1:] {
+		seg := p[0]
+		if seg.Size > end {
+			seg.Size = end
+		}
+		s = append(s, seg)
+		end -= seg.Size
+	}
+	return s, off
+}
+
+// SmallRuns returns the runs of at least two consecutive segments of p
+// smaller than size, which compaction merges, as the indices of their
+// first segment and of the segment following them.
+func SmallRuns(p []Segment, size int64) [][2]int {
+	var runs [][2]int
+	start := 0
+	for i := 0; i <= len(p); i++ {
+		if i < len(p) && p[i].Size < size {
+			continue
+		}
+		if i-start >= 2 {
+			runs = append(runs, [2]int{start, i})
+		}
+		start = i + 1
+	}
+	return runs
+}
+
+// ClearChecksums forgets the checksums of the content of f, which no longer
+// match it once it is appended to or truncated. They are then computed from
+// the data when they are asked for.
+func (f *File) ClearChecksums() {
+	f.Checksum, f.Hash, f.SHA256 = "", nil, nil
+}
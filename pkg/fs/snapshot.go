@@ -0,0 +1,92 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gostor/gofs/pkg/errors"
+)
+
+// SnapshotDir is the directory the snapshots of a snapshottable directory
+// are browsed in, as in HDFS. It is not listed.
+const SnapshotDir = ".snapshot"
+
+// Snapshot is a read-only image of the tree of a snapshottable directory.
+//
+// The snapshots share the metadata of the files with the current tree: a
+// file is only copied for the latest snapshot before it changes, at the
+// SnapshotKey of its path. A file then has in a snapshot the first copy of
+// the snapshot or of the later ones, or its current metadata if it has not
+// changed since.
+type Snapshot struct {
+	Name string
+	// ID orders the snapshots, and names the directory of their copies.
+	ID      uint64
+	Created time.Time
+}
+
+// SnapshotKey returns the full path the copy of the file rel, relative to
+// the snapshottable directory dir, is kept at for the snapshot id. rel is
+// empty for dir itself, or starts with a slash.
+func SnapshotKey(dir string, id uint64, rel string) string {
+	return path.Join(dir, SnapshotDir, strconv.FormatUint(id, 10)) + rel
+}
+
+// SnapshotPath returns the full path the file rel of dir is browsed at in
+// its snapshot name.
+func SnapshotPath(dir, name, rel string) string {
+	return path.Join(dir, SnapshotDir, name) + rel
+}
+
+// SplitSnapshotPath splits the full path p of a file browsed in a snapshot
+// into the snapshottable directory, the name of the snapshot and the path
+// relative to the directory. ok is false if p is not inside a snapshot.
+func SplitSnapshotPath(p string) (dir, name, rel string, ok bool) {
+	i := strings.Index(p+"/", "/"+SnapshotDir+"/")
+	if i < 0 {
+		return "", "", "", false
+	}
+	dir = p[:i]
+	rest := strings.TrimPrefix(p[i+len(SnapshotDir)+1:], "/")
+	if j := strings.IndexByte(rest, '/'); j >= 0 {
+		return dir, rest[:j], rest[j:], true
+	}
+	return dir, rest, "", true
+}
+
+// CheckSnapshotName checks that name may name a snapshot.
+func CheckSnapshotName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+		return errors.BadParameter("invalid snapshot name %q", name)
+	}
+	return nil
+}
+
+// FindSnapshot returns the index of the snapshot name of the directory f, or
+// -1 if it has none.
+func (f *File) FindSnapshot(name string) int {
+	for i, s := range f.Snapshots {
+		if s.Name == name {
+			return i
+		}
+	}
+	return -1
+}
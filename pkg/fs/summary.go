@@ -0,0 +1,72 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+// Summary are the aggregates of the tree of a directory, which the raft
+// operations keep up to date along the ancestors of the files they change.
+// As in the content summaries of HDFS, the directory itself is counted, the
+// links and the symlinks are files, and only the regular files have a
+// length. The directories without a Summary, created before the aggregates
+// were kept, are summarized by walking their tree.
+type Summary struct {
+	Files       int64
+	Directories int64
+	Length      int64
+}
+
+// Names returns the number of files and directories, which the name quota
+// limits.
+func (s Summary) Names() int64 {
+	return s.Files + s.Directories
+}
+
+// Add returns the sum of s and d.
+func (s Summary) Add(d Summary) Summary {
+	return Summary{Files: s.Files + d.Files, Directories: s.Directories + d.Directories, Length: s.Length + d.Length}
+}
+
+// Neg returns the opposite of s.
+func (s Summary) Neg() Summary {
+	return Summary{Files: -s.Files, Directories: -s.Directories, Length: -s.Length}
+}
+
+// Entry returns the summary of f alone, without its children.
+func (f *File) Entry() Summary {
+	if f.IsDirectory() {
+		return Summary{Directories: 1}
+	}
+	return Summary{Files: 1, Length: f.SpaceConsumed()}
+}
+
+// SpaceConsumed returns the space the data of f consumes. The links and the
+// symlinks consume none, the data being accounted to the file they refer to.
+func (f *File) SpaceConsumed() int64 {
+	if f.IsDirectory() || f.IsSymlink() || f.IsLink() {
+		return 0
+	}
+	return int64(f.Size)
+}
+
+// ChargeSummary adds d to the summary of the directory f, if it has one. The
+// summary is copied, since the cache may share it with other copies of f.
+func (f *File) ChargeSummary(d Summary) {
+	if f.Summary == nil {
+		return
+	}
+	s := f.Summary.Add(d)
+	f.Summary = &s
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The layout of the trash, as in HDFS. The deleted files of every user are
+// moved to the Current directory of their trash root, which is renamed to a
+// checkpoint named after its time periodically. The checkpoints are
+// expunged once the trash interval of the namespace elapsed.
+const (
+	// TrashDir is the directory of the trash roots, in the root of the
+	// namespace.
+	TrashDir = ".Trash"
+	// TrashCurrent is the directory of the trash root the files are moved
+	// to.
+	TrashCurrent = "Current"
+	// TrashCheckpointFormat is the time format of the names of the
+	// checkpoints, in UTC.
+	TrashCheckpointFormat = "060102150405"
+)
+
+// TrashRetention returns the time the deleted files are kept in the trash,
+// 0 if they are deleted at once.
+func (ns *Namespace) TrashRetention() time.Duration {
+	return time.Duration(ns.Config.TrashInterval) * time.Minute
+}
+
+// TrashRoot returns the full path of the trash root of the user uid.
+func (ns *Namespace) TrashRoot(uid uint32) string {
+	return path.Join(ns.Root().FullPath(), TrashDir, strconv.FormatUint(uint64(uid), 10))
+}
+
+// IsTrash returns true if the full path p is in the trash, where the files
+// deleted are removed rather than moved.
+func (ns *Namespace) IsTrash(p string) bool {
+	dir := path.Join(ns.Root().FullPath(), TrashDir)
+	return p == dir || strings.HasPrefix(p, dir+"/")
+}
+
+// TrashPath returns the full path in the Current directory of the trash root
+// of uid the file at full path p is moved to when it is deleted.
+func (ns *Namespace) TrashPath(uid uint32, p string) string {
+	return path.Join(ns.TrashRoot(uid), TrashCurrent, strings.TrimPrefix(p, ns.Root().FullPath()))
+}
+
+// LivePath returns the full path of the live file that the file at full
+// path p, browsed in a snapshot or moved to the trash, was at. It is p
+// itself for the live files.
+func (ns *Namespace) LivePath(p string) string {
+	trash := path.Join(ns.Root().FullPath(), TrashDir) + "/"
+	for {
+		if dir, _, rel, ok := SplitSnapshotPath(p); ok {
+			p = dir + rel
+			continue
+		}
+		// the trashed files are in a Current or checkpoint directory of
+		// the trash root of their user
+		if parts := strings.SplitN(strings.TrimPrefix(p, trash), "/", 3); strings.HasPrefix(p, trash) && len(parts) > 1 {
+			p = path.Join(ns.Root().FullPath(), strings.Join(parts[2:], "/"))
+			continue
+		}
+		return p
+	}
+}
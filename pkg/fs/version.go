@@ -0,0 +1,141 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"time"
+
+	"github.com/gostor/gofs/pkg/api"
+)
+
+// Versioning is the versioning policy of a directory tree. The files of the
+// tree keep their previous content as a Version when they are overwritten,
+// and the policy of the nearest directory which has one applies.
+type Versioning struct {
+	Enabled bool
+	// MaxVersions is the number of versions kept of a file, and MaxAge the
+	// minutes a version is kept for. Zero is unlimited.
+	MaxVersions int
+	MaxAge      int64
+}
+
+// Version is the content a file had before it was overwritten, kept under
+// the key of its data object along with the attributes of the file.
+type Version struct {
+	// Version numbers the versions of a file from 1, oldest first.
+	Version  int64
+	Object   string
+	Segments []Segment `json:",omitempty"`
+	Attr     Attr
+	Checksum string
+	Hash     []byte
+	SHA256   []byte `json:",omitempty"`
+	// Created is when the content was replaced.
+	Created time.Time
+}
+
+// VersioningOf returns the versioning policy of the files of the directory
+// dirs[0], dirs being it and its ancestors, or nil if it has none enabled.
+func VersioningOf(dirs []*File) *Versioning {
+	for _, f := range dirs {
+		if f.Versioning != nil {
+			if !f.Versioning.Enabled {
+				return nil
+			}
+			return f.Versioning
+		}
+	}
+	return nil
+}
+
+// PushVersion keeps the current content of the regular file f as its latest
+// version, replaced at created.
+func (f *File) PushVersion(created time.Time) {
+	n := int64(1)
+	if len(f.Versions) > 0 {
+		n = f.Versions[len(f.Versions)-1].Version + 1
+	}
+	// the versions may be shared with the copies of f in the cache
+	f.Versions = append(f.Versions[:len(f.Versions):len(f.Versions)], Version{
+		Version:  n,
+		Object:   f.ObjectKey(),
+		Segments: f.Segments,
+		Attr:     f.Attr,
+		Checksum: f.Checksum,
+		Hash:     f.Hash,
+		SHA256:   f.SHA256,
+		Created:  created,
+	})
+}
+
+// FindVersion returns the index of the version n of f, or -1 if it has
+// none.
+func (f *File) FindVersion(n int64) int {
+	for i, v := range f.Versions {
+		if v.Version == n {
+			return i
+		}
+	}
+	return -1
+}
+
+// PruneVersions removes the versions of f which the policy v no longer
+// keeps at now, and returns them.
+func (f *File) PruneVersions(v *Versioning, now time.Time) []Version {
+	keep := f.Versions
+	if v != nil && v.MaxAge > 0 {
+		limit := now.Add(-time.Duration(v.MaxAge) * time.Minute)
+		for len(keep) > 0 && keep[0].Created.Before(limit) {
+			keep = keep[1:]
+		}
+	}
+	if v != nil && v.MaxVersions > 0 && len(keep) > v.MaxVersions {
+		keep = keep[len(keep)-v.MaxVersions:]
+	}
+	pruned := f.Versions[:len(f.Versions)-len(keep)]
+	if len(pruned) == 0 {
+		return nil
+	}
+	f.Versions = append([]Version(nil), keep...)
+	return append([]Version(nil), pruned...)
+}
+
+// DataKeys returns the keys of the data objects of the regular file f, those
+// of the segments of its content and of its versions.
+func (f *File) DataKeys() []string {
+	var keys []string
+	for _, s := range f.Pieces() {
+		keys = append(keys, s.Object)
+	}
+	for _, v := range f.Versions {
+		for _, s := range v.Pieces() {
+			keys = append(keys, s.Object)
+		}
+	}
+	return keys
+}
+
+// FileVersion returns the WebHDFS-style description of the version v.
+func (v Version) FileVersion() api.FileVersion {
+	return api.FileVersion{
+		Version:          v.Version,
+		Length:           int64(v.Attr.Size),
+		ModificationTime: millis(v.Attr.Mtime),
+		ReplacedTime:     millis(v.Created),
+		Checksum:         v.Checksum,
+	}
+}
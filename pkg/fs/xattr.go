@@ -0,0 +1,149 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/errors"
+)
+
+// The namespaces of the extended attributes. Everybody may use the user
+// attributes, as the permission bits of the file allow, and only the
+// superuser the trusted ones.
+const (
+	XattrUser    = "user."
+	XattrTrusted = "trusted."
+)
+
+// The limits of the extended attributes, as in HDFS.
+const (
+	// MaxXattrNameLen is the maximum length of a name, without its
+	// namespace.
+	MaxXattrNameLen = 255
+	// MaxXattrSize is the maximum size of the name and the value of an
+	// attribute.
+	MaxXattrSize = 16384
+	// MaxXattrs is the maximum number of attributes of a file.
+	MaxXattrs = 32
+)
+
+// checkXattrName checks that name is in one of the supported namespaces.
+func checkXattrName(name string) error {
+	var suffix string
+	switch {
+	case strings.HasPrefix(name, XattrUser):
+		suffix = name[len(XattrUser):]
+	case strings.HasPrefix(name, XattrTrusted):
+		suffix = name[len(XattrTrusted):]
+	default:
+		return errors.BadParameter("invalid attribute name %q: the namespace must be user or trusted", name)
+	}
+	if suffix == "" || len(suffix) > MaxXattrNameLen {
+		return errors.BadParameter("invalid attribute name %q: the name must have 1 to %d characters", name, MaxXattrNameLen)
+	}
+	return nil
+}
+
+// CheckXattr checks that c may access the attribute name of f with the
+// mask, MayRead to get it and MayWrite to change it.
+func (f *File) CheckXattr(c *Caller, name string, mask uint32) error {
+	if err := checkXattrName(name); err != nil {
+		return err
+	}
+	if strings.HasPrefix(name, XattrTrusted) {
+		if !c.IsRoot() {
+			return errors.PermissionDenied("permission denied: only the superuser may access the trusted attributes")
+		}
+		return nil
+	}
+	return f.Access(c, mask)
+}
+
+// Getxattr returns the value of the extended attribute req.Name.
+func (f *File) Getxattr(ctx context.Context, req *api.GetxattrRequest, resp *api.GetxattrResponse) error {
+	v, ok := f.Xattrs[req.Name]
+	if !ok {
+		return errors.NotFound("no attribute %s on %s", req.Name, f.FullPath())
+	}
+	resp.Xattr = v
+	return nil
+}
+
+// Listxattr returns the names of the extended attributes, in order.
+func (f *File) Listxattr(ctx context.Context, req *api.ListxattrRequest, resp *api.ListxattrResponse) error {
+	resp.Append(f.XattrNames()...)
+	return nil
+}
+
+// XattrNames returns the names of the extended attributes, in order.
+func (f *File) XattrNames() []string {
+	names := make([]string, 0, len(f.Xattrs))
+	for name := range f.Xattrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Setxattr sets the extended attribute req.Name, whose limits are checked.
+func (f *File) Setxattr(ctx context.Context, req *api.SetxattrRequest) error {
+	if err := checkXattrName(req.Name); err != nil {
+		return err
+	}
+	if len(req.Name)+len(req.Xattr) > MaxXattrSize {
+		return errors.BadParameter("attribute %s is too large: the name and the value are limited to %d bytes", req.Name, MaxXattrSize)
+	}
+	_, exists := f.Xattrs[req.Name]
+	switch {
+	case exists && req.Flags&api.XattrCreate != 0:
+		return errors.AlreadyExists("attribute %s of %s already exists", req.Name, f.FullPath())
+	case !exists && req.Flags&api.XattrReplace != 0:
+		return errors.NotFound("no attribute %s on %s", req.Name, f.FullPath())
+	case !exists && len(f.Xattrs) >= MaxXattrs:
+		return errors.BadParameter("%s cannot have more than %d attributes", f.FullPath(), MaxXattrs)
+	}
+	// the map is copied, since the cache may share it with other copies of f
+	xattrs := make(map[string][]byte, len(f.Xattrs)+1)
+	for k, v := range f.Xattrs {
+		xattrs[k] = v
+	}
+	xattrs[req.Name] = append([]byte{}, req.Xattr...)
+	f.Xattrs = xattrs
+	return nil
+}
+
+// Removexattr removes the extended attribute req.Name.
+func (f *File) Removexattr(ctx context.Context, req *api.RemovexattrRequest) error {
+	if _, ok := f.Xattrs[req.Name]; !ok {
+		return errors.NotFound("no attribute %s on %s", req.Name, f.FullPath())
+	}
+	xattrs := make(map[string][]byte, len(f.Xattrs))
+	for k, v := range f.Xattrs {
+		if k != req.Name {
+			xattrs[k] = v
+		}
+	}
+	if len(xattrs) == 0 {
+		xattrs = nil
+	}
+	f.Xattrs = xattrs
+	return nil
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package master
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/errors"
+	"github.com/gostor/gofs/pkg/fs"
+	"github.com/gostor/gofs/pkg/raft"
+)
+
+func (m *Master) getACLStatus(ctx context.Context, p string) (interface{}, error) {
+	ns, full, err := m.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	f, err := m.access(caller(ctx), ns, full, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &api.ACLStatusResponse{ACLStatus: f.ACLStatus()}, nil
+}
+
+// updateACL changes the ACL of p with one of the ACL operations, which only
+// the owner of p may do.
+func (m *Master) updateACL(ctx context.Context, p, op string, form url.Values) (interface{}, error) {
+	ns, full, err := m.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	var spec []fs.ACLEntry
+	switch op {
+	case api.OpsSetACL, api.OpsModifyACLEntries, api.OpsRemoveACLEntries:
+		if form.Get("aclspec") == "" {
+			return nil, errors.BadParameter("missing aclspec parameter")
+		}
+		spec, err = fs.ParseACLSpec(form.Get("aclspec"), op != api.OpsRemoveACLEntries)
+		if err != nil {
+			return nil, err
+		}
+	}
+	c := caller(ctx)
+	f, err := m.access(c, ns, full, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err = f.CheckChmod(c); err != nil {
+		return nil, err
+	}
+	// check the new ACL before replicating the operation
+	if err = f.UpdateACL(op, spec); err != nil {
+		return nil, err
+	}
+	o := raft.NewOperation(op, ns.ID, full, "", nil, time.Now())
+	o.ACL = spec
+	if _, err = m.RaftServer.Do(o); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package master
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/errors"
+	"github.com/gostor/gofs/pkg/fs"
+	"github.com/gostor/gofs/pkg/raft"
+)
+
+// setPermission changes the permission bits and the sticky bit of p, which
+// only its owner may do.
+func (m *Master) setPermission(ctx context.Context, p string, form url.Values) (interface{}, error) {
+	s := form.Get("permission")
+	n, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || n > 01777 {
+		return nil, errors.BadParameter("invalid permission %q", s)
+	}
+	mode := os.FileMode(n & 0777)
+	if n&01000 != 0 {
+		mode |= os.ModeSticky
+	}
+	ns, full, err := m.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	c := caller(ctx)
+	f, err := m.access(c, ns, full, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err = f.CheckChmod(c); err != nil {
+		return nil, err
+	}
+	return m.setattr(ns, f, api.OpsSetPermission, api.SetattrMode, &fs.Attr{Mode: mode})
+}
+
+// setOwner changes the owner or the group of p, or both.
+func (m *Master) setOwner(ctx context.Context, p string, form url.Values) (interface{}, error) {
+	var valid api.SetattrValid
+	a := &fs.Attr{}
+	if s := form.Get("owner"); s != "" {
+		uid, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			return nil, errors.BadParameter("invalid owner %q", s)
+		}
+		a.Uid = uint32(uid)
+		valid |= api.SetattrUid
+	}
+	if s := form.Get("group"); s != "" {
+		gid, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			return nil, errors.BadParameter("invalid group %q", s)
+		}
+		a.Gid = uint32(gid)
+		valid |= api.SetattrGid
+	}
+	if valid == 0 {
+		return nil, errors.BadParameter("both the owner and the group are empty")
+	}
+	ns, full, err := m.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	c := caller(ctx)
+	f, err := m.access(c, ns, full, 0)
+	if err != nil {
+		return nil, err
+	}
+	uid, gid := f.Uid, f.Gid
+	if valid.Uid() {
+		uid = a.Uid
+	}
+	if valid.Gid() {
+		gid = a.Gid
+	}
+	if err = f.CheckChown(c, uid, gid); err != nil {
+		return nil, err
+	}
+	return m.setattr(ns, f, api.OpsSetOwner, valid, a)
+}
+
+// setTimes changes the modification time or the access time of p, or both,
+// which needs to write p as in HDFS.
+func (m *Master) setTimes(ctx context.Context, p string, form url.Values) (interface{}, error) {
+	var valid api.SetattrValid
+	a := &fs.Attr{}
+	mtime, err := timeValue(form, "modificationtime")
+	if err != nil {
+		return nil, err
+	}
+	if !mtime.IsZero() {
+		a.Mtime = mtime
+		valid |= api.SetattrMtime
+	}
+	atime, err := timeValue(form, "accesstime")
+	if err != nil {
+		return nil, err
+	}
+	if !atime.IsZero() {
+		a.Atime = atime
+		valid |= api.SetattrAtime
+	}
+	ns, full, err := m.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	c := caller(ctx)
+	f, err := m.access(c, ns, full, fs.MayWrite)
+	if err != nil {
+		return nil, err
+	}
+	if valid == 0 {
+		return nil, nil
+	}
+	return m.setattr(ns, f, api.OpsSetTimes, valid, a)
+}
+
+// setattr replicates the operation op setting the attributes of a which
+// valid selects on the file f.
+func (m *Master) setattr(ns *fs.Namespace, f *fs.File, op string, valid api.SetattrValid, a *fs.Attr) (interface{}, error) {
+	o := raft.NewOperation(op, ns.ID, f.FullPath(), "", a, time.Now())
+	o.Valid = valid
+	if _, err := m.RaftServer.Do(o); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// timeValue parses the form value k, a time in milliseconds since the epoch.
+// It returns the zero time if the value is missing or -1, which leaves the
+// time unchanged.
+func timeValue(form url.Values, k string) (time.Time, error) {
+	s := form.Get(k)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	ms, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || ms < -1 {
+		return time.Time{}, errors.BadParameter("invalid %s %q", k, s)
+	}
+	if ms == -1 {
+		return time.Time{}, nil
+	}
+	return time.Unix(0, ms*int64(time.Millisecond)), nil
+}
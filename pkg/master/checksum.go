@@ -0,0 +1,141 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package master
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/errors"
+	"github.com/gostor/gofs/pkg/fs"
+	"github.com/gostor/gofs/pkg/storage"
+)
+
+// getFileChecksum returns the checksum of the content of the file p, the
+// composite CRC32C unless the algorithm parameter asks for another one.
+func (m *Master) getFileChecksum(ctx context.Context, p string, form url.Values) (interface{}, error) {
+	alg := strings.ToUpper(form.Get("algorithm"))
+	switch alg {
+	case "":
+		alg = api.ChecksumCompositeCRC32C
+	case api.ChecksumCompositeCRC32C, api.ChecksumMD5, api.ChecksumSHA256:
+	default:
+		return nil, errors.BadParameter("invalid algorithm %q", form.Get("algorithm"))
+	}
+	ns, full, err := m.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	c := caller(ctx)
+	f, err := m.access(c, ns, full, 0)
+	if err != nil {
+		return nil, err
+	}
+	if f.IsDirectory() {
+		return nil, errors.IsDirectory("%s is a directory", full)
+	}
+	if err = f.Access(c, fs.MayRead); err != nil {
+		return nil, err
+	}
+	cs := f.Checksums()
+	if cs == nil || alg == api.ChecksumSHA256 && len(cs.SHA256) == 0 {
+		// the checksums which were not recorded are computed from the data
+		if cs, err = m.computeChecksums(ns, f, alg == api.ChecksumSHA256); err != nil {
+			return nil, err
+		}
+	}
+	var b []byte
+	switch alg {
+	case api.ChecksumCompositeCRC32C:
+		b = make([]byte, 4)
+		binary.BigEndian.PutUint32(b, cs.CRC32C)
+	case api.ChecksumMD5:
+		b = cs.MD5
+	case api.ChecksumSHA256:
+		b = cs.SHA256
+	}
+	return &api.FileChecksumResponse{
+		FileChecksum: api.FileChecksum{Algorithm: alg, Bytes: hex.EncodeToString(b), Length: len(b)},
+	}, nil
+}
+
+// computeChecksums reads the data of the file f to compute its checksums.
+func (m *Master) computeChecksums(ns *fs.Namespace, f *fs.File, withSHA256 bool) (*fs.Checksums, error) {
+	rc, err := m.openContent(ns, f)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	h := fs.NewHasher(withSHA256)
+	if _, err = io.Copy(h, rc); err != nil {
+		return nil, err
+	}
+	return h.Checksums(), nil
+}
+
+// checkObject checks the ETag of the object storing the data of the file p
+// against the checksums of its content, which are nil if they were not
+// recorded. The data which does not match is reported as corrupted.
+func checkObject(ns *fs.Namespace, p string, cs *fs.Checksums, obj storage.Object) error {
+	if cs == nil {
+		return nil
+	}
+	info, err := obj.Stat()
+	if err != nil {
+		log.Warnf("Failed to check the object of %s: %v", p, err)
+		return nil
+	}
+	if err = cs.CheckETag(p, info.ETag); err != nil {
+		reportCorruption(ns, p, info.Name, err)
+		return err
+	}
+	return nil
+}
+
+// reportCorruption reports the data of the file p which does not match its
+// checksums as a corruption event, which the operators may alert on.
+func reportCorruption(ns *fs.Namespace, p, object string, err error) {
+	log.WithFields(log.Fields{
+		"event":     "corruption",
+		"namespace": ns.ID,
+		"path":      p,
+		"object":    object,
+	}).Error(err)
+}
+
+// checksumHeaders returns the headers of the OPEN responses carrying the
+// checksums cs, none if they were not recorded.
+func checksumHeaders(cs *fs.Checksums) http.Header {
+	h := http.Header{}
+	if cs == nil {
+		return h
+	}
+	h.Set(api.ContentMD5Header, base64.StdEncoding.EncodeToString(cs.MD5))
+	h.Set(api.ChecksumCRC32CHeader, fmt.Sprintf("%08x", cs.CRC32C))
+	if len(cs.SHA256) > 0 {
+		h.Set(api.ChecksumSHA256Header, hex.EncodeToString(cs.SHA256))
+	}
+	return h
+}
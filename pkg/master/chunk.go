@@ -0,0 +1,173 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package master
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/errors"
+	"github.com/gostor/gofs/pkg/fs"
+	"github.com/gostor/gofs/pkg/raft"
+)
+
+// uploadChunk uploads the request body to a new object, as a chunk of the
+// file p which COMMITCHUNKS creates once all its chunks are uploaded. The
+// chunks of a file are uploaded in parallel. The upload fails if the MD5 of
+// the chunk does not match the md5 parameter, in hex, when it is set. The
+// chunk is then recorded in the directory of the file, until the file is
+// created of it or the garbage collection may remove it.
+func (m *Master) uploadChunk(ctx context.Context, p string, form url.Values, body io.Reader) (interface{}, error) {
+	var expected []byte
+	if s := form.Get("md5"); s != "" {
+		b, err := hex.DecodeString(s)
+		if err != nil || len(b) != md5.Size {
+			return nil, errors.BadParameter("invalid md5 %q", s)
+		}
+		expected = b
+	}
+	ns, full, err := m.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	real, f, err := m.createTarget(caller(ctx), ns, full, boolValue(form, "overwrite"))
+	if err != nil {
+		return nil, err
+	}
+
+	var names, size int64 = 1, 0
+	if f != nil {
+		names, size = 0, f.SpaceConsumed()
+	}
+	dir := path.Dir(real)
+	left, err := m.checkQuota(ns, dir, names)
+	if err != nil {
+		return nil, err
+	}
+	if left >= 0 {
+		body = &quotaReader{r: body, left: left + size, dir: dir}
+	}
+
+	key, err := fs.NewObjectKey(ns.ID)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := ns.Object(&fs.File{Object: key})
+	if err != nil {
+		return nil, err
+	}
+	h := fs.NewHasher(false)
+	n, err := obj.Put(io.TeeReader(body, h))
+	cs := h.Checksums()
+	if err == nil && expected != nil && !bytes.Equal(cs.MD5, expected) {
+		err = errors.Corrupted("the chunk of %s uploaded is corrupted: its MD5 is %x, expected %x", real, cs.MD5, expected)
+	}
+	if err == nil {
+		err = checkObject(ns, real, cs, obj)
+	}
+	if err != nil {
+		m.removeObject(ns, key)
+		return nil, err
+	}
+	chunk := api.Chunk{Object: key, Length: n, MD5: hex.EncodeToString(cs.MD5)}
+	op := raft.NewOperation(api.OpsUploadChunk, ns.ID, real, "", &fs.Attr{Uid: caller(ctx).Uid}, time.Now())
+	op.Chunks = []fs.Chunk{{Object: chunk.Object, Size: chunk.Length, MD5: chunk.MD5}}
+	op.Retention = m.GC.GracePeriod
+	if _, err = m.RaftServer.Do(op); err != nil {
+		m.removeObject(ns, key)
+		return nil, err
+	}
+	return &api.ChunkResponse{Chunk: chunk}, nil
+}
+
+// commitChunks creates the file p of the chunks listed in the request body,
+// in order, with a single raft operation, so that the file is created with
+// all its chunks or not at all. The operation checks that the chunks were
+// uploaded for the file by the caller, and takes them from its directory.
+// The chunks which are not committed are left for the commit to be retried,
+// until the garbage collection removes them.
+func (m *Master) commitChunks(ctx context.Context, p string, form url.Values, body io.Reader) (interface{}, error) {
+	var chunks api.Chunks
+	if err := json.NewDecoder(body).Decode(&chunks); err != nil {
+		return nil, errors.BadParameter("invalid chunks: %v", err)
+	}
+	ns, full, err := m.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	perm, err := permissionValue(form, 0644)
+	if err != nil {
+		return nil, err
+	}
+	overwrite := boolValue(form, "overwrite")
+
+	c := caller(ctx)
+	real, f, err := m.createTarget(c, ns, full, overwrite)
+	if err != nil {
+		return nil, err
+	}
+	list, err := m.checkChunks(ns, real, chunks.Chunk)
+	if err != nil {
+		return nil, err
+	}
+
+	op := raft.NewOperation(api.OpsCommitChunks, ns.ID, real, "", &fs.Attr{Mode: perm, Uid: c.Uid, Gid: c.Gid()}, time.Now())
+	op.Overwrite = overwrite
+	op.Chunks = list
+	ret, err := m.RaftServer.Do(op)
+	if err != nil {
+		return nil, err
+	}
+	if f != nil {
+		// the old content is kept if it became a version of the file
+		m.releaseReplaced(ns, f, ret)
+	}
+	return nil, nil
+}
+
+// checkChunks checks the chunks of the file p of ns, which all have the size
+// of the first one but the last, which cannot be larger, and are not smaller
+// than the segments the compaction merges. The raft operation then checks
+// that they were uploaded for the file.
+func (m *Master) checkChunks(ns *fs.Namespace, p string, chunks []api.Chunk) ([]fs.Chunk, error) {
+	if len(chunks) == 0 {
+		return nil, errors.BadParameter("no chunks to create %s of", p)
+	}
+	size := chunks[0].Length
+	if len(chunks) > 1 && size < m.Compaction.SegmentSize {
+		return nil, errors.BadParameter("chunks of %d bytes are smaller than the minimum of %d bytes", size, m.Compaction.SegmentSize)
+	}
+	list := make([]fs.Chunk, len(chunks))
+	for i, ch := range chunks {
+		if ch.Length <= 0 || ch.Length > size || i < len(chunks)-1 && ch.Length != size {
+			return nil, errors.BadParameter("chunk %d of %s has %d bytes, expected %d", i, p, ch.Length, size)
+		}
+		if !strings.HasPrefix(ch.Object, fs.NamespaceKeyPrefix(ns.ID)) {
+			return nil, errors.BadParameter("chunk %d of %s is not an object uploaded for it", i, p)
+		}
+		list[i] = fs.Chunk{Object: ch.Object, Size: ch.Length, MD5: ch.MD5}
+	}
+	return list, nil
+}
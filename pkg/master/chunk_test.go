@@ -0,0 +1,180 @@
+package master
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/errors"
+	"github.com/gostor/gofs/pkg/fs"
+	"github.com/gostor/gofs/pkg/raft"
+)
+
+func md5Hex(data string) string {
+	sum := md5.Sum([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestUploadChunks(t *testing.T) {
+	m, _ := newTestMaster(t)
+	m.RaftServer = raft.NewLocalServer(m.Name, m.Cache)
+	stor := newMemStorage()
+	ns := fs.NewNamespace("ns", &api.Config{}, stor)
+	m.Namespaces[ns.ID] = ns
+	m.Compaction.SegmentSize = 4
+
+	upload := func(data, sum string) (api.Chunk, error) {
+		ret, err := m.uploadChunk(withUid(1000), "/ns/home/u1/g", url.Values{"md5": {sum}}, strings.NewReader(data))
+		if err != nil {
+			return api.Chunk{}, err
+		}
+		return ret.(*api.ChunkResponse).Chunk, nil
+	}
+	c1, err := upload("hello", md5Hex("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(c1.Object, fs.NamespaceKeyPrefix("ns")) || c1.Length != 5 || c1.MD5 != md5Hex("hello") {
+		t.Fatalf("unexpected chunk: %+v", c1)
+	}
+	c2, err := upload("abc", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a chunk which does not match its MD5 is not kept
+	if _, err = upload("abd", md5Hex("abc")); !errors.Is(err, errors.KindCorrupted) {
+		t.Fatalf("expected a Corrupted error, got %v", err)
+	}
+	if len(stor.keys()) != 2 {
+		t.Fatalf("unexpected objects: %v", stor.keys())
+	}
+	// the chunks are uploaded by those who may create the file
+	if _, err = m.uploadChunk(withUid(2000), "/ns/home/u1/g", nil, strings.NewReader("x")); !errors.Is(err, errors.KindPermissionDenied) {
+		t.Fatalf("expected a PermissionDenied error, got %v", err)
+	}
+	if _, err = m.uploadChunk(withUid(1000), "/ns/home/u1/f", nil, strings.NewReader("x")); !errors.Is(err, errors.KindAlreadyExists) {
+		t.Fatalf("expected an AlreadyExists error, got %v", err)
+	}
+
+	commit := func(ctx context.Context, p string, chunks ...api.Chunk) error {
+		data, err := json.Marshal(&api.Chunks{Chunk: chunks})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = m.commitChunks(ctx, p, nil, bytes.NewReader(data))
+		return err
+	}
+	stale := c2
+	stale.MD5 = md5Hex("abd")
+	missing := c2
+	missing.Object = fs.NamespaceKeyPrefix("ns") + "missing"
+	for _, test := range []struct {
+		chunks []api.Chunk
+		kind   *errors.Kind
+	}{
+		{nil, errors.KindBadParameter},
+		// the last chunk cannot be larger than the others
+		{[]api.Chunk{c2, c1}, errors.KindBadParameter},
+		{[]api.Chunk{c1, c1}, errors.KindBadParameter},
+		{[]api.Chunk{c1, {Object: "home/u1/f", Length: 3, MD5: c2.MD5}}, errors.KindBadParameter},
+		{[]api.Chunk{c1, {Object: fs.NamespaceKeyPrefix("other") + "x", Length: 3, MD5: c2.MD5}}, errors.KindBadParameter},
+		{[]api.Chunk{c1, stale}, errors.KindBadParameter},
+		{[]api.Chunk{c1, missing}, errors.KindBadParameter},
+	} {
+		if err = commit(withUid(1000), "/ns/home/u1/g", test.chunks...); !errors.Is(err, test.kind) {
+			t.Fatalf("expected a %s error for %v, got %v", test.kind.Exception, test.chunks, err)
+		}
+	}
+	// the chunks cannot be smaller than the segments compaction merges
+	m.Compaction.SegmentSize = 8
+	if err = commit(withUid(1000), "/ns/home/u1/g", c1, c2); !errors.Is(err, errors.KindBadParameter) {
+		t.Fatalf("expected a BadParameter error, got %v", err)
+	}
+	m.Compaction.SegmentSize = 4
+	// the chunks are only used by the file and the user they are uploaded for
+	if err = commit(withUid(1000), "/ns/home/u1/h", c1, c2); !errors.Is(err, errors.KindBadParameter) {
+		t.Fatalf("expected a BadParameter error, got %v", err)
+	}
+	if err = commit(withUid(0), "/ns/home/u1/g", c1, c2); !errors.Is(err, errors.KindBadParameter) {
+		t.Fatalf("expected a BadParameter error, got %v", err)
+	}
+
+	if err = commit(withUid(1000), "/ns/home/u1/g", c1, c2); err != nil {
+		t.Fatal(err)
+	}
+	f, err := m.lookup(ns, "/ns/home/u1/g")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Object != c1.Object || f.Size != 8 || len(f.Segments) != 1 || f.Segments[0] != (fs.Segment{Object: c2.Object, Size: 3}) {
+		t.Fatalf("unexpected file: %#v", f)
+	}
+	if dir, _ := m.lookup(ns, "/ns/home/u1"); len(dir.Chunks) != 0 {
+		t.Fatalf("unexpected chunks left: %v", dir.Chunks)
+	}
+	// the chunks are taken by the file, and cannot be committed again
+	if err = commit(withUid(1000), "/ns/home/u1/g", c1, c2); !errors.Is(err, errors.KindAlreadyExists) {
+		t.Fatalf("expected an AlreadyExists error, got %v", err)
+	}
+	if err = commit(withUid(1000), "/ns/home/u1/i", c1, c2); !errors.Is(err, errors.KindBadParameter) {
+		t.Fatalf("expected a BadParameter error, got %v", err)
+	}
+}
+
+func TestOpenRange(t *testing.T) {
+	m, _ := newTestMaster(t)
+	stor := newMemStorage()
+	ns := fs.NewNamespace("ns", &api.Config{}, stor)
+	stor.add("o2", "hello", time.Now())
+	stor.add("o3", "abc", time.Now())
+	f := &fs.File{Object: "o1", Segments: []fs.Segment{{Object: "o2", Size: 5}, {Object: "o3", Size: 3}}, Attr: fs.Attr{Size: 13}}
+
+	read := func(offset, length string) string {
+		form := url.Values{"offset": {offset}, "length": {length}}
+		off, n, err := rangeValues(form, int64(f.Size))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rc, err := m.openRange(ns, f, off, n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rc.Close()
+		data, err := ioutil.ReadAll(rc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	// the missing object of the first 5 bytes is never read
+	for _, test := range []struct {
+		offset, length, data string
+	}{
+		{"5", "", "helloabc"},
+		{"7", "5", "lloab"},
+		{"10", "2", "ab"},
+		{"11", "100", "bc"},
+		{"13", "", ""},
+		{"6", "0", ""},
+	} {
+		if data := read(test.offset, test.length); data != test.data {
+			t.Fatalf("unexpected content %q at %s of length %s, expected %q", data, test.offset, test.length, test.data)
+		}
+	}
+	if _, err := m.openRange(ns, f, 4, 2); err == nil {
+		t.Fatal("expected an error for a missing object")
+	}
+	for _, form := range []url.Values{{"offset": {"14"}}, {"offset": {"-1"}}, {"length": {"-1"}}, {"offset": {"x"}}} {
+		if _, _, err := rangeValues(form, int64(f.Size)); !errors.Is(err, errors.KindBadParameter) {
+			t.Fatalf("expected a BadParameter error for %v, got %v", form, err)
+		}
+	}
+}
@@ -30,8 +30,16 @@ type MasterConfig struct {
 	Name        string
 	Router      *mux.Router
 	HttpServers []*http.Server
+	// ClusterSecret is shared by the raft peers, which authenticate their
+	// requests to each other with it. They are not if it is empty.
+	ClusterSecret string
 
 	// Cache releated fields
 	CacheType string
 	CacheDir  string
+
+	// GC configures the collection of the orphaned objects
+	GC GCConfig
+	// Compaction configures the compaction of the files appended to
+	Compaction CompactionConfig
 }
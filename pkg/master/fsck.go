@@ -0,0 +1,278 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package master
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/errors"
+	"github.com/gostor/gofs/pkg/fs"
+	"github.com/gostor/gofs/pkg/raft"
+)
+
+// Fsck checks that the metadata of the namespace id is consistent, and
+// agrees with its bucket. With repair, it fixes what it can through raft,
+// which only the raft leader may. Only the admins may check a namespace.
+func (m *Master) Fsck(ctx context.Context, id string, repair bool) (*api.FsckReport, error) {
+	if err := checkAdmin(ctx, "check the namespaces"); err != nil {
+		return nil, err
+	}
+	if repair {
+		if err := m.checkLeader(); err != nil {
+			return nil, err
+		}
+	}
+	ns, err := m.namespace(id)
+	if err != nil {
+		return nil, err
+	}
+	if err = ns.CheckStorage(); err != nil {
+		return nil, err
+	}
+	ck, err := m.fsck(ns, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if repair {
+		ck.applyRepairs()
+	}
+	report := ck.report
+	report.Finished = time.Now().UnixNano() / int64(time.Millisecond)
+	log.Infof("Checked namespace %s: %d files, %d directories, %d objects, %d problems, %d repaired",
+		ns.ID, report.Files, report.Directories, report.Objects, len(report.Problems), report.Repaired)
+	return report, nil
+}
+
+// checker checks the tree of a namespace, see fsck.
+type checker struct {
+	m      *Master
+	ns     *fs.Namespace
+	now    time.Time
+	report *api.FsckReport
+	// repairs are the raft operations repairing the problems of the
+	// report, by index, nil for those which cannot be.
+	repairs []*raft.Operation
+	// inodes map the inode numbers to the first file found with them.
+	inodes map[uint64]string
+}
+
+// fsck walks the tree of ns from its root and reports its problems along
+// with the operations repairing them. The files changed during the walk
+// may be reported, so the problems are worth a second check before being
+// repaired by hand.
+func (m *Master) fsck(ns *fs.Namespace, now time.Time) (*checker, error) {
+	ck := &checker{
+		m:      m,
+		ns:     ns,
+		now:    now,
+		report: &api.FsckReport{Namespace: ns.ID, Started: now.UnixNano() / int64(time.Millisecond)},
+		inodes: map[uint64]string{},
+	}
+	root, err := m.lookup(ns, ns.Root().FullPath())
+	if err != nil {
+		return nil, err
+	}
+	if _, err = ck.checkTree(root); err != nil {
+		return nil, err
+	}
+	return ck, nil
+}
+
+// problem reports a problem of the file p, which op repairs unless it is
+// nil.
+func (ck *checker) problem(p, kind string, op *raft.Operation, format string, args ...interface{}) {
+	ck.report.Problems = append(ck.report.Problems, api.FsckProblem{Path: p, Kind: kind, Message: fmt.Sprintf(format, args...)})
+	ck.repairs = append(ck.repairs, op)
+}
+
+// applyRepairs applies the repairs of the problems, in the order they were
+// found, so that the parents are linked back before their children.
+func (ck *checker) applyRepairs() {
+	ck.report.Repair = true
+	for i, op := range ck.repairs {
+		if op == nil {
+			continue
+		}
+		pb := &ck.report.Problems[i]
+		if _, err := ck.m.RaftServer.Do(op); err != nil {
+			log.Warnf("Failed to repair %s of %s: %v", pb.Kind, pb.Path, err)
+			pb.Message = fmt.Sprintf("%s, the repair failed: %v", pb.Message, err)
+			continue
+		}
+		pb.Repaired = true
+		ck.report.Repaired++
+	}
+}
+
+// checkTree checks the directory dir and its tree, and returns the summary
+// of its content, dir included.
+func (ck *checker) checkTree(dir *fs.File) (fs.Summary, error) {
+	full := dir.FullPath()
+	ck.report.Directories++
+	ck.checkInode(dir, full)
+	s := dir.Entry()
+	children, err := ck.m.Cache.List(ck.ns.ID, full)
+	if err != nil {
+		return fs.Summary{}, err
+	}
+	for _, child := range children {
+		p := path.Join(full, child.Path)
+		if child.Parent == nil || !child.Parent.IsDirectory() || child.Parent.FullPath() != full {
+			ck.problem(p, api.FsckBrokenParent, ck.op(api.OpsRepairParent, p),
+				"%s is stored in the directory %s, but not linked to it", p, full)
+			child.Parent = dir
+		}
+		if child.IsDirectory() {
+			cs, err := ck.checkTree(child)
+			if err != nil {
+				return fs.Summary{}, err
+			}
+			s = s.Add(cs)
+			continue
+		}
+		if err = ck.checkFile(child, p); err != nil {
+			return fs.Summary{}, err
+		}
+		s = s.Add(child.Entry())
+	}
+	if dir.Summary != nil && *dir.Summary != s {
+		ck.problem(full, api.FsckSummaryMismatch, ck.op(api.OpsRepairContentSummary, full),
+			"the summary of %s is %+v, but its content is %+v", full, *dir.Summary, s)
+	}
+	return s, nil
+}
+
+// checkFile checks the file f, whose path is p, which is not a directory.
+func (ck *checker) checkFile(f *fs.File, p string) error {
+	ck.report.Files++
+	switch {
+	case f.IsLink():
+		return ck.checkLink(f, p)
+	case f.IsSymlink():
+		ck.checkInode(f, p)
+		return nil
+	}
+	ck.checkInode(f, p)
+	for _, l := range f.Links {
+		link, err := ck.m.Cache.Get(ck.ns.ID, l)
+		if errors.IsNotFound(err) {
+			ck.problem(p, api.FsckBrokenLink, nil, "%s has the hard link %s, which does not exist", p, l)
+			continue
+		} else if err != nil {
+			return err
+		}
+		if !link.IsLink() || link.Target != p {
+			ck.problem(p, api.FsckBrokenLink, nil, "%s has the hard link %s, which does not refer to it", p, l)
+		}
+	}
+	if err := ck.checkPieces(p, f.Pieces(), f.Hash); err != nil {
+		return err
+	}
+	for _, v := range f.Versions {
+		if err := ck.checkPieces(fmt.Sprintf("%s (version %d)", p, v.Version), v.Pieces(), v.Hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkPieces checks the objects of the segments pieces of the content of
+// the file p, whose MD5 hash is that of the object if it has a single one.
+func (ck *checker) checkPieces(p string, pieces []fs.Segment, hash []byte) error {
+	if len(pieces) > 1 {
+		hash = nil
+	}
+	for _, s := range pieces {
+		if err := ck.checkObject(p, s.Object, s.Size, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkLink checks that the hard link f, whose path is p, and its file
+// refer to each other.
+func (ck *checker) checkLink(f *fs.File, p string) error {
+	target, err := ck.m.Cache.Get(ck.ns.ID, f.Target)
+	if errors.IsNotFound(err) {
+		ck.problem(p, api.FsckBrokenLink, nil, "the hard link %s refers to %s, which does not exist", p, f.Target)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if target.Inode != f.Inode {
+		ck.problem(p, api.FsckBrokenLink, nil, "the hard link %s has the inode number %d, but %s has %d", p, f.Inode, f.Target, target.Inode)
+	}
+	for _, l := range target.Links {
+		if l == p {
+			return nil
+		}
+	}
+	ck.problem(p, api.FsckBrokenLink, nil, "the hard link %s refers to %s, which does not list it", p, f.Target)
+	return nil
+}
+
+// checkInode checks that the inode number of f, whose path is p, is not the
+// number of another file. The files created before the inode numbers were
+// allocated have none.
+func (ck *checker) checkInode(f *fs.File, p string) {
+	if f.Inode == 0 {
+		return
+	}
+	if q, ok := ck.inodes[f.Inode]; ok {
+		ck.problem(p, api.FsckDuplicateInode, ck.op(api.OpsRenumber, p), "%s has the inode number %d of %s", p, f.Inode, q)
+		return
+	}
+	ck.inodes[f.Inode] = p
+}
+
+// checkObject checks that the object key exists, with the size and, for
+// the objects uploaded in a single part, the MD5 hash of the file p.
+func (ck *checker) checkObject(p, key string, size int64, hash []byte) error {
+	ck.report.Objects++
+	obj, err := ck.ns.Object(&fs.File{Object: key})
+	if err != nil {
+		return err
+	}
+	info, err := obj.Stat()
+	if errors.IsNotFound(err) {
+		ck.problem(p, api.FsckMissingObject, nil, "the object %s of %s does not exist", key, p)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if info.Size != size {
+		ck.problem(p, api.FsckSizeMismatch, nil, "the object %s has %d bytes, but %s has %d", key, info.Size, p, size)
+	}
+	// the ETags of the multipart uploads are not the MD5 of the content
+	etag := strings.Trim(info.ETag, `"`)
+	if len(hash) > 0 && etag != "" && !strings.Contains(etag, "-") && etag != hex.EncodeToString(hash) {
+		ck.problem(p, api.FsckETagMismatch, nil, "the object %s has the ETag %s, but the MD5 of %s is %x", key, etag, p, hash)
+	}
+	return nil
+}
+
+// op returns the raft operation of type t on the file p.
+func (ck *checker) op(t, p string) *raft.Operation {
+	return raft.NewOperation(t, ck.ns.ID, p, "", nil, ck.now)
+}
@@ -0,0 +1,81 @@
+package master
+
+import (
+	"crypto/md5"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/cache"
+	"github.com/gostor/gofs/pkg/fs"
+)
+
+func TestFsck(t *testing.T) {
+	m, _ := newTestMaster(t)
+	stor := newMemStorage()
+	ns := fs.NewNamespace("ns", &api.Config{}, stor)
+	m.Namespaces[ns.ID] = ns
+
+	lookup := func(p string) *fs.File {
+		f, err := m.lookup(ns, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	u1, tmp, home := lookup("/ns/home/u1"), lookup("/ns/tmp"), lookup("/ns/home")
+	file := func(parent *fs.File, name, object string, size uint64, ino uint64, data string) *fs.File {
+		hash := md5.Sum([]byte(data))
+		f := &fs.File{Parent: parent, Path: name, Object: object, Hash: hash[:], Attr: fs.Attr{Inode: ino, Mode: 0644, Size: size}}
+		if err := m.Cache.Add(ns.ID, f); err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	now := time.Now()
+	stor.add("home/u1/f", "", now)
+	stor.add("tmp/f", "xx", now)
+	file(u1, "e", "k4", 4, 0, "dcba")
+	stor.add("k4", "abcd", now)
+	file(u1, "g", "k1", 4, 7, "data")
+	stor.add("k1", "data", now)
+	file(tmp, "h", "k2", 3, 7, "abc")
+	if err := m.Cache.Add(ns.ID, &fs.File{Parent: tmp, Path: "l", Link: true, Target: "/ns/home/u1/g", Attr: fs.Attr{Inode: 7}}); err != nil {
+		t.Fatal(err)
+	}
+	// an entry of /ns/tmp linked to /ns/home
+	if err := m.Cache.Add(ns.ID, &fs.File{Parent: tmp, Path: "x", Object: "k3", Attr: fs.Attr{Size: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	m.Cache.(*cache.Memory).Files[ns.ID]["/ns/tmp/x"].Parent = home
+	stor.add("k3", "x", now)
+
+	ck, err := m.fsck(ns, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var problems []string
+	for i, pb := range ck.report.Problems {
+		op := ""
+		if o := ck.repairs[i]; o != nil {
+			op = " " + o.Type + " " + o.Filename
+		}
+		problems = append(problems, fmt.Sprintf("%s %s%s", pb.Path, pb.Kind, op))
+	}
+	expected := []string{
+		"/ns/home/u1/e ETAG_MISMATCH",
+		"/ns/tmp/f SIZE_MISMATCH",
+		"/ns/tmp/h DUPLICATE_INODE RENUMBER /ns/tmp/h",
+		"/ns/tmp/h MISSING_OBJECT",
+		"/ns/tmp/l BROKEN_LINK",
+		"/ns/tmp/x BROKEN_PARENT REPAIRPARENT /ns/tmp/x",
+		"/ns SUMMARY_MISMATCH REPAIRCONTENTSUMMARY /ns",
+	}
+	if fmt.Sprint(problems) != fmt.Sprint(expected) {
+		t.Fatalf("unexpected problems:\n%v\nexpected:\n%v", problems, expected)
+	}
+	if r := ck.report; r.Files != 7 || r.Directories != 4 || r.Objects != 6 {
+		t.Fatalf("unexpected counts: %+v", r)
+	}
+}
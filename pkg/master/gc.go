@@ -0,0 +1,198 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package master
+
+import (
+	"context"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/fs"
+)
+
+// GCConfig configures the collection of the orphaned objects, the data
+// objects no file refers to, which the failed uploads and the failed
+// removals leave in the buckets.
+type GCConfig struct {
+	// Interval is the interval between the collections, 0 to only run
+	// them on demand.
+	Interval time.Duration
+	// GracePeriod is the age below which the orphans are kept, since they
+	// may be uploads whose file is not committed yet.
+	GracePeriod time.Duration
+	// DeleteRate is the maximum number of objects deleted per second, 0
+	// for no limit.
+	DeleteRate int
+	// DryRun only reports the orphans of the periodic collections.
+	DryRun bool
+}
+
+// gcLoop collects the orphaned objects of the namespaces. Only the raft
+// leader does, so that the objects are not deleted twice.
+func (m *Master) gcLoop() {
+	for now := range time.Tick(m.GC.Interval) {
+		if !m.IsLeader() {
+			continue
+		}
+		list, err := m.Cache.ListNamespaces()
+		if err != nil {
+			log.Warnf("Failed to list the namespaces to collect their orphaned objects: %v", err)
+			continue
+		}
+		for _, n := range list {
+			ns, err := m.namespace(n.ID)
+			if err == nil {
+				_, err = m.collectGarbage(ns, m.GC.DryRun, now)
+			}
+			if err != nil {
+				log.Warnf("Failed to collect the orphaned objects of namespace %s: %v", n.ID, err)
+			}
+		}
+	}
+}
+
+// CollectGarbage collects the orphaned objects of the namespace id now, or
+// only reports them with dryRun. Only the admins may, on the raft leader.
+func (m *Master) CollectGarbage(ctx context.Context, id string, dryRun bool) (*api.GCReport, error) {
+	if err := checkAdmin(ctx, "collect the orphaned objects"); err != nil {
+		return nil, err
+	}
+	if err := m.checkLeader(); err != nil {
+		return nil, err
+	}
+	ns, err := m.namespace(id)
+	if err != nil {
+		return nil, err
+	}
+	return m.collectGarbage(ns, dryRun, time.Now())
+}
+
+// GCStatus returns the statistics of the collections of the orphaned
+// objects of the namespace id run by this server.
+func (m *Master) GCStatus(ctx context.Context, id string) (*api.GCStatusResponse, error) {
+	if err := checkAdmin(ctx, "collect the orphaned objects"); err != nil {
+		return nil, err
+	}
+	if _, err := m.Cache.GetNamespace(id); err != nil {
+		return nil, err
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	status := api.GCStatusResponse{}
+	if s := m.gcStatus[id]; s != nil {
+		status = *s
+	}
+	return &status, nil
+}
+
+// collectGarbage deletes the objects of the bucket of ns under the keys
+// generated for its files which no file refers to, once they are older
+// than the grace period, at most DeleteRate per second. The other objects
+// of the bucket, like those of the other namespaces sharing it, are not
+// owned by the namespace, and are left alone.
+func (m *Master) collectGarbage(ns *fs.Namespace, dryRun bool, now time.Time) (*api.GCReport, error) {
+	m.gcLock.Lock()
+	defer m.gcLock.Unlock()
+	report := &api.GCReport{Namespace: ns.ID, DryRun: dryRun, Started: now.UnixNano() / int64(time.Millisecond)}
+	err := m.deleteOrphans(ns, now, report)
+	report.Finished = time.Now().UnixNano() / int64(time.Millisecond)
+	if err != nil {
+		report.Error = err.Error()
+	}
+	m.recordGC(report)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Collected the orphaned objects of namespace %s: %d listed, %d orphaned, %d deleted, %d failed",
+		ns.ID, report.Listed, report.Orphaned, report.Deleted, report.Failed)
+	return report, nil
+}
+
+// deleteOrphans deletes the orphaned objects of ns older than the grace
+// period at now, or lists them in the report when it is a dry run.
+func (m *Master) deleteOrphans(ns *fs.Namespace, now time.Time, report *api.GCReport) error {
+	// the bucket is listed before the files are walked, so that the
+	// objects of the files committed in between are not seen as orphans
+	objects, err := ns.ListObjects(fs.NamespaceKeyPrefix(ns.ID))
+	if err != nil {
+		return err
+	}
+	refs, err := m.objectRefs(ns, true)
+	if err != nil {
+		return err
+	}
+	var tick <-chan time.Time
+	if m.GC.DeleteRate > 0 && !report.DryRun {
+		t := time.NewTicker(time.Second / time.Duration(m.GC.DeleteRate))
+		defer t.Stop()
+		tick = t.C
+	}
+	for _, info := range objects {
+		if info.IsDir {
+			continue
+		}
+		report.Listed++
+		if refs[info.Name] {
+			report.Referenced++
+			continue
+		}
+		if now.Sub(info.ModTime) < m.GC.GracePeriod {
+			report.Young++
+			continue
+		}
+		report.Orphaned++
+		report.OrphanedSize += info.Size
+		if report.DryRun {
+			report.Objects = append(report.Objects, info.Name)
+			continue
+		}
+		if tick != nil && report.Orphaned > 1 {
+			<-tick
+		}
+		obj, err := ns.Object(&fs.File{Object: info.Name})
+		if err == nil {
+			err = obj.Delete()
+		}
+		if err != nil {
+			log.Warnf("Failed to delete the orphaned object %s of namespace %s: %v", info.Name, ns.ID, err)
+			report.Failed++
+			continue
+		}
+		report.Deleted++
+		report.DeletedSize += info.Size
+	}
+	return nil
+}
+
+// recordGC adds the collection report to the statistics of its namespace.
+func (m *Master) recordGC(report *api.GCReport) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.gcStatus == nil {
+		m.gcStatus = map[string]*api.GCStatusResponse{}
+	}
+	s := m.gcStatus[report.Namespace]
+	if s == nil {
+		s = &api.GCStatusResponse{}
+		m.gcStatus[report.Namespace] = s
+	}
+	s.Runs++
+	s.Deleted += report.Deleted
+	s.DeletedSize += report.DeletedSize
+	s.Failed += report.Failed
+	s.LastRun = report
+}
@@ -0,0 +1,275 @@
+package master
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/errors"
+	"github.com/gostor/gofs/pkg/fs"
+	"github.com/gostor/gofs/pkg/raft"
+	"github.com/gostor/gofs/pkg/storage"
+)
+
+// memStorage is an in-memory storage.Storage with a single bucket.
+type memStorage struct {
+	lock    sync.Mutex
+	objects map[string]*storage.ObjectInfo
+	data    map[string][]byte
+}
+
+func newMemStorage() *memStorage {
+	return &memStorage{objects: map[string]*storage.ObjectInfo{}, data: map[string][]byte{}}
+}
+
+func (s *memStorage) Ping() error { return nil }
+
+func (s *memStorage) Bucket(name string, cfg *api.Config) (storage.Bucket, error) {
+	return memBucket{s}, nil
+}
+
+// add stores the object name with data, last modified at mtime.
+func (s *memStorage) add(name string, data string, mtime time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	sum := md5.Sum([]byte(data))
+	s.objects[name] = &storage.ObjectInfo{Name: name, Size: int64(len(data)), ModTime: mtime, ETag: hex.EncodeToString(sum[:])}
+	s.data[name] = []byte(data)
+}
+
+// keys returns the sorted keys of the objects.
+func (s *memStorage) keys() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var keys []string
+	for key := range s.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type memBucket struct {
+	s *memStorage
+}
+
+func (b memBucket) Auth() error   { return nil }
+func (b memBucket) Create() error { return nil }
+func (b memBucket) Delete() error { return nil }
+func (b memBucket) Get() error    { return nil }
+
+func (b memBucket) Object(name string) storage.Object {
+	return memObject{b.s, name}
+}
+
+func (b memBucket) List(prefix string) ([]storage.ObjectInfo, error) {
+	var list []storage.ObjectInfo
+	for _, key := range b.s.keys() {
+		if strings.HasPrefix(key, prefix) {
+			b.s.lock.Lock()
+			list = append(list, *b.s.objects[key])
+			b.s.lock.Unlock()
+		}
+	}
+	return list, nil
+}
+
+type memObject struct {
+	s    *memStorage
+	name string
+}
+
+func (o memObject) Stat() (*storage.ObjectInfo, error) {
+	o.s.lock.Lock()
+	defer o.s.lock.Unlock()
+	info, ok := o.s.objects[o.name]
+	if !ok {
+		return nil, storage.ErrNoSuchObject
+	}
+	i := *info
+	return &i, nil
+}
+
+func (o memObject) Get() (io.ReadCloser, error) {
+	o.s.lock.Lock()
+	defer o.s.lock.Unlock()
+	data, ok := o.s.data[o.name]
+	if !ok {
+		return nil, storage.ErrNoSuchObject
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (o memObject) Put(r io.Reader) (int64, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	o.s.add(o.name, string(data), time.Now())
+	return int64(len(data)), nil
+}
+
+func (o memObject) Copy(src string) error {
+	r, err := memObject{o.s, src}.Get()
+	if err != nil {
+		return err
+	}
+	_, err = o.Put(r)
+	return err
+}
+
+func (o memObject) Delete() error {
+	o.s.lock.Lock()
+	defer o.s.lock.Unlock()
+	delete(o.s.objects, o.name)
+	delete(o.s.data, o.name)
+	return nil
+}
+
+func TestCollectGarbage(t *testing.T) {
+	m, _ := newTestMaster(t)
+	stor := newMemStorage()
+	ns := fs.NewNamespace("ns", &api.Config{}, stor)
+	m.Namespaces[ns.ID] = ns
+	m.GC = GCConfig{GracePeriod: time.Hour, DeleteRate: 1000}
+	prefix := fs.NamespaceKeyPrefix(ns.ID)
+
+	u1, err := m.lookup(ns, "/ns/home/u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	live := prefix + "live"
+	if err = m.Cache.Add(ns.ID, &fs.File{Parent: u1, Path: "g", Object: live, Attr: fs.Attr{Mode: 0644, Size: 4}}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	old := now.Add(-2 * time.Hour)
+	stor.add(live, "data", old)
+	stor.add(prefix+"orphan", "orphan", old)
+	stor.add(prefix+"upload", "upload", now.Add(-time.Minute))
+	stor.add("outside", "outside", old)
+
+	report, err := m.collectGarbage(ns, true, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Listed != 3 || report.Referenced != 1 || report.Young != 1 || report.Orphaned != 1 || report.OrphanedSize != 6 || report.Deleted != 0 {
+		t.Fatalf("unexpected dry run report: %+v", report)
+	}
+	if len(report.Objects) != 1 || report.Objects[0] != prefix+"orphan" {
+		t.Fatalf("unexpected orphans: %v", report.Objects)
+	}
+	if len(stor.keys()) != 4 {
+		t.Fatalf("the dry run deleted objects: %v", stor.keys())
+	}
+
+	if report, err = m.collectGarbage(ns, false, now); err != nil {
+		t.Fatal(err)
+	}
+	if report.Deleted != 1 || report.DeletedSize != 6 || report.Failed != 0 || len(report.Objects) != 0 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	keys := stor.keys()
+	if len(keys) != 3 || keys[0] != prefix+"live" || keys[1] != prefix+"upload" || keys[2] != "outside" {
+		t.Fatalf("unexpected objects left: %v", keys)
+	}
+
+	// the namespaces sharing the bucket only collect their own objects
+	other := fs.NewNamespace("other", &api.Config{}, stor)
+	if err = m.Cache.AddNamespace(other); err != nil {
+		t.Fatal(err)
+	}
+	if err = m.Cache.Add(other.ID, other.Root()); err != nil {
+		t.Fatal(err)
+	}
+	m.Namespaces[other.ID] = other
+	otherPrefix := fs.NamespaceKeyPrefix(other.ID)
+	stor.add(otherPrefix+"live", "other", old)
+	if err = m.Cache.Add(other.ID, &fs.File{Parent: other.Root(), Path: "f", Object: otherPrefix + "live", Attr: fs.Attr{Mode: 0644, Size: 5}}); err != nil {
+		t.Fatal(err)
+	}
+	stor.add(otherPrefix+"orphan", "orphan", old)
+	if report, err = m.collectGarbage(ns, false, now); err != nil {
+		t.Fatal(err)
+	}
+	if report.Listed != 2 || report.Deleted != 0 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if report, err = m.collectGarbage(other, false, now); err != nil {
+		t.Fatal(err)
+	}
+	if report.Listed != 2 || report.Referenced != 1 || report.Deleted != 1 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	keys = stor.keys()
+	if len(keys) != 4 || keys[0] != prefix+"live" || keys[1] != prefix+"upload" || keys[2] != otherPrefix+"live" || keys[3] != "outside" {
+		t.Fatalf("unexpected objects left: %v", keys)
+	}
+
+	// the upload is collected once past the grace period
+	if report, err = m.collectGarbage(ns, false, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if report.Deleted != 1 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	status := m.gcStatus[ns.ID]
+	if status.Runs != 4 || status.Deleted != 2 || status.DeletedSize != 12 || status.LastRun != report {
+		t.Fatalf("unexpected statistics: %+v", status)
+	}
+}
+
+func TestDeleteNamespace(t *testing.T) {
+	m, _ := newTestMaster(t)
+	m.RaftServer = raft.NewLocalServer(m.Name, m.Cache)
+	stor := newMemStorage()
+	ns := fs.NewNamespace("ns", &api.Config{}, stor)
+	m.Namespaces[ns.ID] = ns
+
+	u1, err := m.lookup(ns, "/ns/home/u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefix := fs.NamespaceKeyPrefix(ns.ID)
+	if err = m.Cache.Add(ns.ID, &fs.File{Parent: u1, Path: "g", Object: prefix + "live", Attr: fs.Attr{Mode: 0644, Size: 4}}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	stor.add(prefix+"live", "data", now)
+	stor.add(prefix+"orphan", "orphan", now)
+	// the file created before the keys were, stored at its path, and the
+	// object of another namespace sharing the bucket
+	stor.add("home/u1/f", "old", now)
+	stor.add(fs.NamespaceKeyPrefix("other")+"live", "other", now)
+
+	if _, err = m.DeleteNamespace(context.Background(), ns.ID, false); !errors.IsNotEmpty(err) {
+		t.Fatalf("expected a NotEmpty error, got %v", err)
+	}
+	if len(stor.keys()) != 4 {
+		t.Fatalf("unexpected objects removed: %v", stor.keys())
+	}
+	refs, err := m.objectRefs(ns, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.DeleteNamespace(context.Background(), ns.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	keys := stor.keys()
+	if len(keys) != 2 || keys[0] != fs.NamespaceKeyPrefix("other")+"live" || keys[1] != "home/u1/f" {
+		t.Fatalf("unexpected objects left: %v", keys)
+	}
+	// the objects left behind are reported
+	if left := m.purgeObjects(ns, refs); len(left) != 2 || left[0] != "home/u1/f" || left[1] != "tmp/f" {
+		t.Fatalf("unexpected objects reported: %v", left)
+	}
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package master
+
+import (
+	"context"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/errors"
+	"github.com/gostor/gofs/pkg/fs"
+	"github.com/gostor/gofs/pkg/raft"
+)
+
+// createSymlink creates the symlink p pointing to the destination, which is
+// either a full path inside the namespace of p or a path relative to the
+// directory of p. The destination may not exist.
+func (m *Master) createSymlink(ctx context.Context, p string, form url.Values) (interface{}, error) {
+	ns, full, err := m.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	target := form.Get("destination")
+	if target == "" {
+		return nil, errors.BadParameter("missing destination parameter")
+	}
+	if root := ns.Root().FullPath(); path.IsAbs(target) && path.Clean(target) != root && !strings.HasPrefix(path.Clean(target), root+"/") {
+		return nil, errors.BadParameter("symlink target %s is outside of namespace %s", target, ns.ID)
+	}
+	createParent := boolValue(form, "createParent")
+
+	c := caller(ctx)
+	real, err := m.checkNewEntry(c, ns, full, createParent)
+	if err != nil {
+		return nil, err
+	}
+	o := raft.NewOperation(api.OpsCreateSymlink, ns.ID, real, target, &fs.Attr{Uid: c.Uid, Gid: c.Gid()}, time.Now())
+	o.Recursive = createParent
+	if _, err = m.RaftServer.Do(o); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// createHardLink creates the hard link p to the file at the destination,
+// which shares its attributes and data.
+func (m *Master) createHardLink(ctx context.Context, p string, form url.Values) (interface{}, error) {
+	ns, full, err := m.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	if form.Get("destination") == "" {
+		return nil, errors.BadParameter("missing destination parameter")
+	}
+	dstNs, dst, err := m.resolve(form.Get("destination"))
+	if err != nil {
+		return nil, err
+	}
+	if dstNs != ns {
+		return nil, errors.BadParameter("cannot link %s to %s in another namespace", full, dst)
+	}
+
+	c := caller(ctx)
+	old, err := m.access(c, ns, dst, 0)
+	if err != nil {
+		return nil, err
+	}
+	if old.IsDirectory() {
+		return nil, errors.IsDirectory("cannot link the directory %s", dst)
+	}
+	// as with protected_hardlinks, the others may only link the files
+	// they may read and write
+	if c.Uid != old.Uid {
+		if err = old.Access(c, fs.MayRead|fs.MayWrite); err != nil {
+			return nil, err
+		}
+	}
+	real, err := m.checkNewEntry(c, ns, full, false)
+	if err != nil {
+		return nil, err
+	}
+
+	o := raft.NewOperation(api.OpsCreateHardLink, ns.ID, real, old.FullPath(), nil, time.Now())
+	if old.Object == "" {
+		// the data of a file stored at its path moves to a key which its
+		// links can share
+		if o.Object, err = m.moveObject(ns, old); err != nil {
+			return nil, err
+		}
+	}
+	if _, err = m.RaftServer.Do(o); err != nil {
+		if o.Object != "" {
+			m.removeObject(ns, o.Object)
+		}
+		return nil, err
+	}
+	if o.Object != "" {
+		m.release(ns, []string{old.RemotePath()}, false)
+	}
+	return &api.BooleanResponse{Boolean: true}, nil
+}
+
+// checkNewEntry checks that c may create the file full, which must not
+// exist, and returns its resolved path. The parent directory must exist
+// unless createParent is set.
+func (m *Master) checkNewEntry(c *fs.Caller, ns *fs.Namespace, full string, createParent bool) (string, error) {
+	files, real, err := m.walk(c, ns, full, false)
+	if err != nil {
+		return "", err
+	}
+	last := files[len(files)-1]
+	if last.FullPath() == real {
+		return "", errors.AlreadyExists("%s already exists", full)
+	}
+	if !createParent && last.FullPath() != path.Dir(real) {
+		return "", errors.NotFound("no such file or directory: %s", path.Dir(real))
+	}
+	return real, last.Access(c, fs.MayWrite|fs.MayExec)
+}
+
+// moveObject copies the data of f to a new object key, and returns it.
+func (m *Master) moveObject(ns *fs.Namespace, f *fs.File) (string, error) {
+	return m.copyObject(ns, f.ObjectKey())
+}
+
+// copyObject copies the data object src to a new object key, and returns
+// it.
+func (m *Master) copyObject(ns *fs.Namespace, src string) (string, error) {
+	key, err := fs.NewObjectKey(ns.ID)
+	if err != nil {
+		return "", err
+	}
+	dst, err := ns.Object(&fs.File{Object: key})
+	if err != nil {
+		return "", err
+	}
+	if err = dst.Copy(src); err != nil {
+		m.removeObject(ns, key)
+		return "", err
+	}
+	return key, nil
+}
+
+// removeObject removes the data object key, logging the failures.
+func (m *Master) removeObject(ns *fs.Namespace, key string) {
+	obj, err := ns.Object(&fs.File{Object: key})
+	if err == nil {
+		err = obj.Delete()
+	}
+	if err != nil {
+		log.Warnf("Failed to remove the object %s of namespace %s: %v", key, ns.ID, err)
+	}
+}
@@ -0,0 +1,102 @@
+package master
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gostor/gofs/pkg/authorization"
+	"github.com/gostor/gofs/pkg/errors"
+	"github.com/gostor/gofs/pkg/fs"
+)
+
+func TestSymlinkResolution(t *testing.T) {
+	m, ns := newTestMaster(t)
+	add := func(dir, name, target string) {
+		parent, err := m.lookup(ns, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := &fs.File{Parent: parent, Path: name, Symlink: true, Target: target, Attr: fs.Attr{Mode: os.ModeSymlink | 0777}}
+		if err = m.Cache.Add(ns.ID, f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	add("/ns", "u1", "home/u1")
+	add("/ns/tmp", "abs", "/ns/home/u1/f")
+	add("/ns/tmp", "up", "../tmp/abs")
+	add("/ns/tmp", "out", "../..")
+	add("/ns/tmp", "loop1", "loop2")
+	add("/ns/tmp", "loop2", "loop1")
+
+	for _, tc := range []struct {
+		path string
+		real string
+	}{
+		{"/ns/u1/f", "/ns/home/u1/f"},
+		{"/ns/tmp/abs", "/ns/home/u1/f"},
+		{"/ns/tmp/up", "/ns/home/u1/f"},
+	} {
+		f, err := m.access(fs.RootCaller, ns, tc.path, 0)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.path, err)
+		}
+		if f.FullPath() != tc.real {
+			t.Fatalf("%s resolved to %s, expected %s", tc.path, f.FullPath(), tc.real)
+		}
+	}
+
+	// the last symlink is not followed unless asked
+	files, real, err := m.walk(fs.RootCaller, ns, "/ns/tmp/up", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := files[len(files)-1]; real != "/ns/tmp/up" || !f.IsSymlink() {
+		t.Fatalf("unexpected walk of /ns/tmp/up: %s %s", f.FullPath(), real)
+	}
+	// the permissions of the resolved path apply
+	if _, err = m.access(caller(withUid(1001)), ns, "/ns/tmp/abs", 0); !errors.IsPermissionDenied(err) {
+		t.Fatalf("expected a PermissionDenied error, got %v", err)
+	}
+	if _, err = m.access(fs.RootCaller, ns, "/ns/tmp/loop1", 0); !errors.Is(err, errors.KindBadParameter) {
+		t.Fatalf("expected a BadParameter error for a symlink loop, got %v", err)
+	}
+	if _, err = m.access(fs.RootCaller, ns, "/ns/tmp/out/x", 0); !errors.Is(err, errors.KindBadParameter) {
+		t.Fatalf("expected a BadParameter error for a symlink out of the namespace, got %v", err)
+	}
+
+	// the authorization plugins, which checked the path of the request, are
+	// asked about the path it resolves to
+	var asked []string
+	c := caller(authorization.WithAuthorizer(withUid(0), func(p string) error {
+		asked = append(asked, p)
+		if strings.HasPrefix(p, "/ns/home/") {
+			return errors.PermissionDenied("permission denied: %s", p)
+		}
+		return nil
+	}))
+	if _, err = m.access(c, ns, "/ns/tmp/abs", 0); !errors.IsPermissionDenied(err) {
+		t.Fatalf("expected a PermissionDenied error, got %v", err)
+	}
+	if _, err = m.access(c, ns, "/ns/tmp/f", 0); err != nil || len(asked) != 1 {
+		t.Fatalf("unexpected error %v, asked about %v", err, asked)
+	}
+	// and about the live path of the files of the trash and of the snapshots
+	for _, p := range []string{"/ns/.Trash/1000/Current/home/u1/f", "/ns/.Trash/1000/170301120000/home/u1", "/ns/home/.snapshot/s1/u1/f"} {
+		if _, _, err = m.walk(c, ns, p, true); !errors.IsPermissionDenied(err) {
+			t.Fatalf("%s: expected a PermissionDenied error, got %v", p, err)
+		}
+	}
+	for p, live := range map[string]string{
+		"/ns/.Trash":                               "/ns/.Trash",
+		"/ns/.Trash/1000":                          "/ns/.Trash/1000",
+		"/ns/.Trash/1000/Current":                  "/ns",
+		"/ns/home/.snapshot":                       "/ns/home",
+		"/ns/home/.snapshot/s1":                    "/ns/home",
+		"/ns/.Trash/1000/Current/d/.snapshot/s1/f": "/ns/d/f",
+	} {
+		if l := ns.LivePath(p); l != live {
+			t.Fatalf("unexpected live path %s of %s, expected %s", l, p, live)
+		}
+	}
+}
@@ -18,7 +18,15 @@ limitations under the License.
 package master
 
 import (
+	"context"
+	"io"
+	"net/url"
+	"sync"
+
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/auth"
 	"github.com/gostor/gofs/pkg/cache"
+	"github.com/gostor/gofs/pkg/errors"
 	"github.com/gostor/gofs/pkg/fs"
 	"github.com/gostor/gofs/pkg/raft"
 )
@@ -26,8 +34,18 @@ import (
 type Master struct {
 	Name       string
 	RaftServer *raft.RaftServer
+	// Namespaces are the namespaces in use, the registry is in the Cache.
 	Namespaces map[string]*fs.Namespace
 	Cache      cache.Cache
+	// GC configures the collection of the orphaned objects.
+	GC GCConfig
+	// Compaction configures the compaction of the files appended to.
+	Compaction CompactionConfig
+
+	lock sync.Mutex
+	// gcLock serializes the collections of the orphaned objects.
+	gcLock   sync.Mutex
+	gcStatus map[string]*api.GCStatusResponse
 }
 
 func NewMaster(cfg *MasterConfig) (*Master, error) {
@@ -35,16 +53,27 @@ func NewMaster(cfg *MasterConfig) (*Master, error) {
 	if err != nil {
 		return nil, err
 	}
-	rs, err := raft.NewRaftServer(cfg.Peers, cfg.HttpAddr, cfg.DataDir, cfg.PuleSeconds, cfg.Router, cfg.HttpServers[0], cc)
+	rs, err := raft.NewRaftServer(cfg.Peers, cfg.HttpAddr, cfg.DataDir, cfg.PuleSeconds, cfg.Router, cfg.HttpServers[0], cc, cfg.ClusterSecret)
 	if err != nil {
 		return nil, err
 	}
-	return &Master{
+	m := &Master{
 		Name:       cfg.HttpAddr,
 		RaftServer: rs,
 		Namespaces: map[string]*fs.Namespace{},
 		Cache:      cc,
-	}, nil
+		GC:         cfg.GC,
+		Compaction: cfg.Compaction,
+	}
+	go m.expungeLoop()
+	go m.pruneLoop()
+	if cfg.GC.Interval > 0 {
+		go m.gcLoop()
+	}
+	if cfg.Compaction.Interval > 0 {
+		go m.compactLoop()
+	}
+	return m, nil
 }
 
 func (m *Master) IsLeader() bool {
@@ -54,18 +83,132 @@ func (m *Master) IsLeader() bool {
 	return false
 }
 
-func (m *Master) GetPathHandler(path, op string) (interface{}, error) {
+// checkLeader fails with a NotLeader error unless the server is the raft
+// leader, for the requests only the leader serves.
+func (m *Master) checkLeader() error {
+	if m.RaftServer != nil && !m.IsLeader() {
+		leader, _ := m.RaftServer.Leader()
+		return errors.NotLeader("%s is not the raft leader, the current leader is %q", m.Name, leader)
+	}
 	return nil
 }
 
-func (m *Master) PutPathHandler() error {
-	return nil
+// GetPathHandler serves the GET operations on path.
+func (m *Master) GetPathHandler(ctx context.Context, path, op string, form url.Values) (interface{}, error) {
+	switch op {
+	case api.OpsGetFileStatus:
+		return m.getFileStatus(ctx, path)
+	case api.OpsListStatus:
+		return m.listStatus(ctx, path)
+	case api.OpsListStatusBatch:
+		return m.listStatusBatch(ctx, path, form.Get("startAfter"))
+	case api.OpsGetACLStatus:
+		return m.getACLStatus(ctx, path)
+	case api.OpsGetXAttrs:
+		return m.getXAttrs(ctx, path, form)
+	case api.OpsListXAttrs:
+		return m.listXAttrs(ctx, path)
+	case api.OpsGetFileChecksum:
+		return m.getFileChecksum(ctx, path, form)
+	case api.OpsGetContentSummary:
+		return m.getContentSummary(ctx, path)
+	case api.OpsGetTrashRoot:
+		return m.getTrashRoot(ctx, path)
+	case api.OpsGetQuotaUsage:
+		return m.getQuotaUsage(ctx, path)
+	case api.OpsGetSnapshotDiff, api.OpsSnapshotDiff:
+		return m.getSnapshotDiff(ctx, path, form)
+	case api.OpsListVersions:
+		return m.listVersions(ctx, path)
+	}
+	return nil, errors.NotImplemented("unsupported GET operation %q", op)
 }
 
-func (m *Master) PostPathHandler(path, op string) error {
-	return nil
+// PutPathHandler serves the PUT operations on path.
+func (m *Master) PutPathHandler(ctx context.Context, path, op string, form url.Values, body io.Reader) (interface{}, error) {
+	switch op {
+	case api.OpsDirCreate:
+		return m.mkdirs(ctx, path, form)
+	case api.OpsFileCreate:
+		return m.create(ctx, path, form, body)
+	case api.OpsRename:
+		return m.rename(ctx, path, form)
+	case api.OpsSetPermission:
+		return m.setPermission(ctx, path, form)
+	case api.OpsSetOwner:
+		return m.setOwner(ctx, path, form)
+	case api.OpsSetTimes:
+		return m.setTimes(ctx, path, form)
+	case api.OpsSetACL, api.OpsModifyACLEntries, api.OpsRemoveACLEntries, api.OpsRemoveDefaultACL, api.OpsRemoveACL:
+		return m.updateACL(ctx, path, op, form)
+	case api.OpsSetXAttr, api.OpsRemoveXAttr:
+		return m.updateXAttr(ctx, path, op, form)
+	case api.OpsCreateSymlink:
+		return m.createSymlink(ctx, path, form)
+	case api.OpsCreateHardLink:
+		return m.createHardLink(ctx, path, form)
+	case api.OpsSetQuota, api.OpsClearQuota:
+		return m.setQuota(ctx, path, op, form)
+	case api.OpsRepairContentSummary:
+		return m.repairContentSummary(ctx, path)
+	case api.OpsCreateSnapshot:
+		return m.createSnapshot(ctx, path, form)
+	case api.OpsRenameSnapshot:
+		return m.renameSnapshot(ctx, path, form)
+	case api.OpsAllowSnapshot, api.OpsDisallowSnapshot:
+		return m.allowSnapshot(ctx, path, op)
+	case api.OpsSetVersioning:
+		return m.setVersioning(ctx, path, form)
+	case api.OpsRestoreVersion:
+		return m.restoreVersion(ctx, path, form)
+	case api.OpsUploadChunk:
+		return m.uploadChunk(ctx, path, form, body)
+	case api.OpsCommitChunks:
+		return m.commitChunks(ctx, path, form, body)
+	}
+	return nil, errors.NotImplemented("unsupported PUT operation %q", op)
 }
 
-func (m *Master) DeletePathHandler(path, op string, r bool) error {
-	return nil
+// PostPathHandler serves the POST operations on path.
+func (m *Master) PostPathHandler(ctx context.Context, path, op string, form url.Values, body io.Reader) (interface{}, error) {
+	switch op {
+	case api.OpsAppend:
+		return m.append(ctx, path, form, body)
+	case api.OpsTruncate:
+		return m.truncate(ctx, path, form)
+	}
+	return nil, errors.NotImplemented("unsupported POST operation %q", op)
+}
+
+// DeletePathHandler serves the DELETE operations on path.
+func (m *Master) DeletePathHandler(ctx context.Context, path, op string, form url.Values) (interface{}, error) {
+	switch op {
+	case api.OpsDelete:
+		return m.delete(ctx, path, form)
+	case api.OpsDeleteSnapshot:
+		return m.deleteSnapshot(ctx, path, form)
+	}
+	return nil, errors.NotImplemented("unsupported DELETE operation %q", op)
+}
+
+// SecretKey returns the secret key paired with accessKey in the namespace
+// ns, so that the master checks the signatures of the requests, and the
+// identity configured for the keys. They act for nobody unless the
+// namespace sets their uid, and they are only trusted if it says so.
+func (m *Master) SecretKey(ns, accessKey string) (string, *auth.Principal, error) {
+	n, err := m.namespace(ns)
+	if err != nil {
+		return "", nil, err
+	}
+	if n.AccessKey == "" || n.AccessKey != accessKey {
+		return "", nil, errors.Unauthenticated("invalid access key for namespace %s", ns)
+	}
+	p := &auth.Principal{Uid: auth.Nobody, Gids: n.KeyGids, Trusted: n.TrustedKeys}
+	if n.KeyUid != nil {
+		p.Uid = *n.KeyUid
+	}
+	if len(p.Gids) == 0 {
+		p.Gids = []uint32{auth.Nobody}
+	}
+	return n.SecretKey, p, nil
 }
@@ -0,0 +1,437 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package master
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/errors"
+	"github.com/gostor/gofs/pkg/fs"
+	"github.com/gostor/gofs/pkg/raft"
+)
+
+// resolve splits the request path into its namespace and the full path of
+// the file inside the metadata cache.
+func (m *Master) resolve(p string) (*fs.Namespace, string, error) {
+	full := path.Clean("/" + p)
+	if full == "/" {
+		return nil, "", errors.BadParameter("path must start with a namespace")
+	}
+	id := strings.SplitN(full[1:], "/", 2)[0]
+	ns, err := m.namespace(id)
+	if err != nil {
+		return nil, "", err
+	}
+	return ns, full, nil
+}
+
+// lookup returns the metadata of the file at full path.
+func (m *Master) lookup(ns *fs.Namespace, full string) (*fs.File, error) {
+	f, err := m.Cache.Get(ns.ID, full)
+	if errors.IsNotFound(err) {
+		root := ns.Root()
+		if full == root.FullPath() {
+			return root, nil
+		}
+		return nil, errors.NotFound("no such file or directory: %s", full)
+	} else if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (m *Master) getFileStatus(ctx context.Context, p string) (interface{}, error) {
+	ns, full, err := m.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	f, err := m.access(caller(ctx), ns, full, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &api.FileStatusResponse{FileStatus: f.FileStatus()}, nil
+}
+
+// listLimit is the maximum number of entries returned by LISTSTATUS_BATCH.
+const listLimit = 1000
+
+// list returns the status of the entries of the directory p, or of p itself
+// if it is a file.
+func (m *Master) list(ctx context.Context, p string) ([]api.FileStatus, error) {
+	ns, full, err := m.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	c := caller(ctx)
+	f, err := m.access(c, ns, full, 0)
+	if err != nil {
+		return nil, err
+	}
+	if !f.IsDirectory() {
+		return []api.FileStatus{f.FileStatus()}, nil
+	}
+	if err = f.Access(c, fs.MayRead|fs.MayExec); err != nil {
+		return nil, err
+	}
+	children, err := m.children(ns, f)
+	if err != nil {
+		return nil, err
+	}
+	return m.statuses(ns, children), nil
+}
+
+// statuses returns the statuses of the entries of a directory.
+func (m *Master) statuses(ns *fs.Namespace, children []*fs.File) []api.FileStatus {
+	list := make([]api.FileStatus, 0, len(children))
+	for _, child := range children {
+		if child.IsLink() {
+			// a hard link has the status of the file it refers to
+			if f, err := m.get(ns, child.Target); err == nil {
+				child.Attr = f.Attr
+				child.ACL = f.ACL
+			}
+		}
+		st := child.FileStatus()
+		st.PathSuffix = child.Path
+		list = append(list, st)
+	}
+	return list
+}
+
+func (m *Master) listStatus(ctx context.Context, p string) (interface{}, error) {
+	list, err := m.list(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return &api.FileStatusesResponse{FileStatuses: api.FileStatuses{FileStatus: list}}, nil
+}
+
+// listStatusBatch returns at most listLimit entries of the directory p
+// following startAfter, read from the cache a batch at a time, or the status
+// of p alone if it is not a directory.
+func (m *Master) listStatusBatch(ctx context.Context, p, startAfter string) (interface{}, error) {
+	ns, full, err := m.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	c := caller(ctx)
+	f, err := m.access(c, ns, full, 0)
+	if err != nil {
+		return nil, err
+	}
+	var list []api.FileStatus
+	remaining := 0
+	if !f.IsDirectory() {
+		list = []api.FileStatus{f.FileStatus()}
+	} else {
+		if err = f.Access(c, fs.MayRead|fs.MayExec); err != nil {
+			return nil, err
+		}
+		var children []*fs.File
+		if children, remaining, err = m.childrenAfter(ns, f, startAfter, listLimit); err != nil {
+			return nil, err
+		}
+		list = m.statuses(ns, children)
+	}
+	return &api.DirectoryListingResponse{
+		DirectoryListing: api.DirectoryListing{
+			PartialListing:   api.FileStatusesResponse{FileStatuses: api.FileStatuses{FileStatus: list}},
+			RemainingEntries: remaining,
+		},
+	}, nil
+}
+
+func (m *Master) mkdirs(ctx context.Context, p string, form url.Values) (interface{}, error) {
+	ns, full, err := m.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	perm, err := permissionValue(form, 0755)
+	if err != nil {
+		return nil, err
+	}
+	c := caller(ctx)
+	files, real, err := m.walk(c, ns, full, true)
+	if err != nil {
+		return nil, err
+	}
+	if last := files[len(files)-1]; last.FullPath() != real {
+		// the missing directories are created in the deepest existing one
+		if !last.IsDirectory() {
+			return nil, errors.NotDirectory("not a directory: %s", last.FullPath())
+		}
+		if err = last.Access(c, fs.MayWrite|fs.MayExec); err != nil {
+			return nil, err
+		}
+	}
+	op := raft.NewOperation(api.OpsDirCreate, ns.ID, real, "", &fs.Attr{Mode: perm, Uid: c.Uid, Gid: c.Gid()}, time.Now())
+	if _, err = m.RaftServer.Do(op); err != nil {
+		return nil, err
+	}
+	return &api.BooleanResponse{Boolean: true}, nil
+}
+
+// create uploads the request body to the storage, and then commits the
+// metadata of the new file.
+func (m *Master) create(ctx context.Context, p string, form url.Values, body io.Reader) (interface{}, error) {
+	ns, full, err := m.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	perm, err := permissionValue(form, 0644)
+	if err != nil {
+		return nil, err
+	}
+	overwrite := boolValue(form, "overwrite")
+
+	c := caller(ctx)
+	real, f, err := m.createTarget(c, ns, full, overwrite)
+	if err != nil {
+		return nil, err
+	}
+
+	var names, size int64 = 1, 0
+	if f != nil {
+		names, size = 0, f.SpaceConsumed()
+	}
+	left, err := m.checkQuota(ns, path.Dir(real), names)
+	if err != nil {
+		return nil, err
+	}
+	if left >= 0 {
+		body = &quotaReader{r: body, left: left + size, dir: path.Dir(real)}
+	}
+
+	op := raft.NewOperation(api.OpsFileCreate, ns.ID, real, "", nil, time.Now())
+	op.Overwrite = overwrite
+	// the data is stored under a new key rather than at the path of the
+	// file or over its old data, which a snapshot may keep
+	if op.Object, err = fs.NewObjectKey(ns.ID); err != nil {
+		return nil, err
+	}
+	obj, err := ns.Object(&fs.File{Object: op.Object})
+	if err != nil {
+		return nil, err
+	}
+	h := fs.NewHasher(boolValue(form, "sha256"))
+	n, err := obj.Put(io.TeeReader(body, h))
+	if err == nil {
+		err = checkObject(ns, real, h.Checksums(), obj)
+	}
+	var ret interface{}
+	if err == nil {
+		op.FileAttr = &fs.Attr{Mode: perm, Size: uint64(n), Uid: c.Uid, Gid: c.Gid()}
+		op.Checksums = h.Checksums()
+		ret, err = m.RaftServer.Do(op)
+	}
+	if err != nil {
+		m.removeObject(ns, op.Object)
+		return nil, err
+	}
+	if f != nil {
+		// the old content is kept if it became a version of the file
+		m.releaseReplaced(ns, f, ret)
+	}
+	return nil, nil
+}
+
+// createTarget checks that the caller c may create the file full, and
+// returns its path once the links are resolved, and the existing file it
+// overwrites if any.
+func (m *Master) createTarget(c *fs.Caller, ns *fs.Namespace, full string, overwrite bool) (string, *fs.File, error) {
+	files, real, err := m.walk(c, ns, full, true)
+	if err != nil {
+		return "", nil, err
+	}
+	if _, _, _, ok := fs.SplitSnapshotPath(real); ok {
+		return "", nil, errors.PermissionDenied("permission denied: snapshot %s is read-only", real)
+	}
+	last := files[len(files)-1]
+	if last.FullPath() != real {
+		if last.FullPath() != path.Dir(real) {
+			return "", nil, errors.NotFound("no such file or directory: %s", path.Dir(real))
+		}
+		if err = last.Access(c, fs.MayWrite|fs.MayExec); err != nil {
+			return "", nil, err
+		}
+		return real, nil, nil
+	}
+	if last.IsDirectory() {
+		return "", nil, errors.IsDirectory("%s is a directory", full)
+	}
+	if !overwrite {
+		return "", nil, errors.AlreadyExists("%s already exists", full)
+	}
+	// overwriting replaces the content of the existing file, which its
+	// links share
+	if err = last.Access(c, fs.MayWrite); err != nil {
+		return "", nil, err
+	}
+	return real, last, nil
+}
+
+// OpenPathHandler returns the content of the file at path, or the length
+// bytes of it at offset, and the headers with its checksums.
+func (m *Master) OpenPathHandler(ctx context.Context, p string, form url.Values) (io.ReadCloser, http.Header, error) {
+	ns, full, err := m.resolve(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	c := caller(ctx)
+	f, err := m.access(c, ns, full, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	if f.IsDirectory() {
+		return nil, nil, errors.IsDirectory("%s is a directory", full)
+	}
+	if err = f.Access(c, fs.MayRead); err != nil {
+		return nil, nil, err
+	}
+	off, n, err := rangeValues(form, int64(f.Size))
+	if err != nil {
+		return nil, nil, err
+	}
+	if n < int64(f.Size) || len(f.Segments) > 0 {
+		// the checksums are those of the whole content, and are not
+		// recorded for the files made of segments
+		rc, err := m.openRange(ns, f, off, n)
+		return rc, http.Header{}, err
+	}
+	obj, err := ns.Object(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	cs := f.Checksums()
+	if err = checkObject(ns, f.FullPath(), cs, obj); err != nil {
+		return nil, nil, err
+	}
+	rc, err := obj.Get()
+	if err != nil {
+		return nil, nil, err
+	}
+	return rc, checksumHeaders(cs), nil
+}
+
+// delete removes the file or directory from the metadata, and then removes
+// the data of every deleted file from the storage. If the namespace has a
+// trash, the file is moved to the trash of the caller instead, unless it is
+// already in the trash or an admin sets skiptrash.
+func (m *Master) delete(ctx context.Context, p string, form url.Values) (interface{}, error) {
+	ns, full, err := m.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	recursive := boolValue(form, "recursive")
+	skipTrash := boolValue(form, "skiptrash")
+	if skipTrash {
+		if err = checkAdmin(ctx, "skip the trash"); err != nil {
+			return nil, err
+		}
+	}
+	c := caller(ctx)
+	// a link is removed, not the file it refers to
+	files, real, err := m.walk(c, ns, full, false)
+	if err != nil {
+		return nil, err
+	}
+	if n := len(files); n > 1 && files[n-1].FullPath() == real {
+		if err = m.checkDelete(c, ns, files[n-2], files[n-1], recursive); err != nil {
+			return nil, err
+		}
+		if !skipTrash && ns.TrashRetention() > 0 && !ns.IsTrash(real) {
+			if err = m.moveToTrash(c, ns, files[n-1], recursive); err != nil {
+				return nil, err
+			}
+			return &api.BooleanResponse{Boolean: true}, nil
+		}
+	}
+	op := raft.NewOperation(api.OpsDelete, ns.ID, real, "", nil, time.Now())
+	op.Recursive = recursive
+	ret, err := m.RaftServer.Do(op)
+	if err != nil {
+		return nil, err
+	}
+	removed, _ := ret.([]*fs.File)
+	m.removeData(ns, removed)
+	return &api.BooleanResponse{Boolean: len(removed) > 0}, nil
+}
+
+// removeData removes the data of the removed files which the snapshots do
+// not keep, logging the failures.
+func (m *Master) removeData(ns *fs.Namespace, removed []*fs.File) {
+	var keys []string
+	for _, f := range removed {
+		// the data is removed with the last link of a file
+		if f.IsDirectory() || f.IsSymlink() || f.IsLink() || f.Nlink > 0 {
+			continue
+		}
+		keys = append(keys, f.DataKeys()...)
+	}
+	m.release(ns, keys, false)
+}
+
+// boolValue transforms a form value in different formats into a boolean type.
+func boolValue(form url.Values, k string) bool {
+	s := strings.ToLower(strings.TrimSpace(form.Get(k)))
+	return !(s == "" || s == "0" || s == "no" || s == "false" || s == "none")
+}
+
+// rangeValues returns the offset and the length parameters of OPEN, which
+// select the bytes read of a content of size bytes, all of them by default.
+func rangeValues(form url.Values, size int64) (int64, int64, error) {
+	var off int64
+	if s := form.Get("offset"); s != "" {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || n < 0 || n > size {
+			return 0, 0, errors.BadParameter("invalid offset %q of a content of %d bytes", s, size)
+		}
+		off = n
+	}
+	n := size - off
+	if s := form.Get("length"); s != "" {
+		l, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || l < 0 {
+			return 0, 0, errors.BadParameter("invalid length %q", s)
+		}
+		if l < n {
+			n = l
+		}
+	}
+	return off, n, nil
+}
+
+// permissionValue parses the octal "permission" form value.
+func permissionValue(form url.Values, def os.FileMode) (os.FileMode, error) {
+	s := form.Get("permission")
+	if s == "" {
+		return def, nil
+	}
+	perm, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || perm > 0777 {
+		return 0, errors.BadParameter("invalid permission %q", s)
+	}
+	return os.FileMode(perm), nil
+}
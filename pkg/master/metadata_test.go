@@ -0,0 +1,66 @@
+package master
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/fs"
+)
+
+func TestListStatusBatch(t *testing.T) {
+	m, ns := newTestMaster(t)
+	tmp, err := m.lookup(ns, "/ns/tmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"c", "a", "b"} {
+		if err = m.Cache.Add(ns.ID, &fs.File{Parent: tmp, Path: name, Attr: fs.Attr{Mode: 0644}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = m.Cache.Add(ns.ID, &fs.File{Parent: tmp, Path: "d", Directory: true, Attr: fs.Attr{Mode: 0755}}); err != nil {
+		t.Fatal(err)
+	}
+
+	batch := func(p, startAfter string) ([]string, int) {
+		ret, err := m.listStatusBatch(context.Background(), p, startAfter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		listing := ret.(*api.DirectoryListingResponse).DirectoryListing
+		var names []string
+		for _, st := range listing.PartialListing.FileStatuses.FileStatus {
+			names = append(names, st.PathSuffix)
+		}
+		return names, listing.RemainingEntries
+	}
+	for _, test := range []struct {
+		startAfter string
+		names      string
+	}{
+		{"", "a b c d f"},
+		{"b", "c d f"},
+		{"bb", "c d f"},
+		{"f", ""},
+	} {
+		names, remaining := batch("/ns/tmp", test.startAfter)
+		if s := strings.Join(names, " "); s != test.names || remaining != 0 {
+			t.Fatalf("unexpected entries %q after %q, %d remaining, expected %q", s, test.startAfter, remaining, test.names)
+		}
+	}
+	// a file is listed alone
+	if names, remaining := batch("/ns/tmp/f", ""); len(names) != 1 || names[0] != "" || remaining != 0 {
+		t.Fatalf("unexpected entries of a file: %q, %d remaining", names, remaining)
+	}
+
+	// the batches are paged from the cache
+	list, remaining, err := m.Cache.ListAfter(ns.ID, tmp.FullPath(), "a", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Path != "b" || list[1].Path != "c" || remaining != 2 {
+		t.Fatalf("unexpected entries %v, %d remaining", list, remaining)
+	}
+}
@@ -0,0 +1,178 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package master
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/errors"
+	"github.com/gostor/gofs/pkg/fs"
+	"github.com/gostor/gofs/pkg/raft"
+	"github.com/gostor/gofs/pkg/storage"
+)
+
+// namespace returns the namespace id of the registry. The namespaces are
+// kept in m.Namespaces along with their connection to the storage, as long
+// as their configuration does not change.
+func (m *Master) namespace(id string) (*fs.Namespace, error) {
+	n, err := m.Cache.GetNamespace(id)
+	if err != nil {
+		return nil, err
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if ns, ok := m.Namespaces[id]; ok && reflect.DeepEqual(ns.Config, n.Config) {
+		return ns, nil
+	}
+	ns := fs.NewNamespace(id, &n.Config, storage.NewMinioStorage(n.Endpoint))
+	m.Namespaces[id] = ns
+	return ns, nil
+}
+
+// CreateNamespace creates the namespace id, whose bucket must exist and
+// accept the credentials of cfg.
+func (m *Master) CreateNamespace(ctx context.Context, id string, cfg *api.Config) (*api.Namespace, error) {
+	if err := checkAdmin(ctx, "manage the namespaces"); err != nil {
+		return nil, err
+	}
+	if err := fs.CheckNamespaceID(id); err != nil {
+		return nil, err
+	}
+	if cfg.Bucket == "" || cfg.Endpoint == "" {
+		return nil, errors.BadParameter("the bucket and the endpoint of namespace %s are required", id)
+	}
+	if _, err := m.Cache.GetNamespace(id); err == nil {
+		return nil, errors.AlreadyExists("namespace %s already exists", id)
+	}
+	ns := fs.NewNamespace(id, cfg, storage.NewMinioStorage(cfg.Endpoint))
+	if err := ns.CheckStorage(); err != nil {
+		return nil, err
+	}
+	op := raft.NewOperation(api.OpsCreateNamespace, id, "", "", nil, time.Now())
+	op.Config = cfg
+	if _, err := m.RaftServer.Do(op); err != nil {
+		return nil, err
+	}
+	m.lock.Lock()
+	m.Namespaces[id] = ns
+	m.lock.Unlock()
+	info := ns.Info()
+	return &info, nil
+}
+
+// GetNamespace returns the namespace id.
+func (m *Master) GetNamespace(ctx context.Context, id string) (*api.Namespace, error) {
+	if err := checkAdmin(ctx, "manage the namespaces"); err != nil {
+		return nil, err
+	}
+	ns, err := m.Cache.GetNamespace(id)
+	if err != nil {
+		return nil, err
+	}
+	info := ns.Info()
+	return &info, nil
+}
+
+// ListNamespaces returns the namespaces, sorted by ID.
+func (m *Master) ListNamespaces(ctx context.Context) (*api.NamespacesResponse, error) {
+	if err := checkAdmin(ctx, "manage the namespaces"); err != nil {
+		return nil, err
+	}
+	list, err := m.Cache.ListNamespaces()
+	if err != nil {
+		return nil, err
+	}
+	resp := &api.NamespacesResponse{Namespaces: []api.Namespace{}}
+	for _, ns := range list {
+		resp.Namespaces = append(resp.Namespaces, ns.Info())
+	}
+	return resp, nil
+}
+
+// DeleteNamespace removes the namespace id, which must be empty unless
+// force is set. The metadata of its files is removed, and then their data
+// too, best effort, since no collection of the orphaned objects covers the
+// namespace any more.
+func (m *Master) DeleteNamespace(ctx context.Context, id string, force bool) (*api.BooleanResponse, error) {
+	if err := checkAdmin(ctx, "manage the namespaces"); err != nil {
+		return nil, err
+	}
+	ns, err := m.namespace(id)
+	if err != nil {
+		return nil, err
+	}
+	// the objects are found before the files referring to them are removed
+	refs, err := m.objectRefs(ns, true)
+	if err != nil {
+		return nil, err
+	}
+	op := raft.NewOperation(api.OpsDeleteNamespace, id, "", "", nil, time.Now())
+	op.Recursive = force
+	if _, err = m.RaftServer.Do(op); err != nil {
+		return nil, err
+	}
+	m.lock.Lock()
+	delete(m.Namespaces, id)
+	m.lock.Unlock()
+	if left := m.purgeObjects(ns, refs); len(left) > 0 {
+		log.Warnf("%d objects of the deleted namespace %s are left in bucket %s, and no longer collected", len(left), id, ns.Bucket)
+		for _, key := range left {
+			log.Infof("Left the object %s of the deleted namespace %s", key, id)
+		}
+	}
+	return &api.BooleanResponse{Boolean: true}, nil
+}
+
+// purgeObjects removes the objects of the deleted namespace ns, all under
+// its key prefix, and returns the keys left behind: those which could not
+// be removed, and the keys refs of its files which are not under its
+// prefix. The files created before the keys were are stored at their
+// RemotePath, which another namespace sharing the bucket may use as well.
+func (m *Master) purgeObjects(ns *fs.Namespace, refs map[string]bool) []string {
+	var left []string
+	prefix := fs.NamespaceKeyPrefix(ns.ID)
+	for key := range refs {
+		if !strings.HasPrefix(key, prefix) {
+			left = append(left, key)
+		}
+	}
+	objects, err := ns.ListObjects(prefix)
+	if err != nil {
+		log.Warnf("Failed to list the objects of the deleted namespace %s: %v", ns.ID, err)
+		left = append(left, prefix)
+	}
+	for _, info := range objects {
+		if info.IsDir {
+			continue
+		}
+		obj, err := ns.Object(&fs.File{Object: info.Name})
+		if err == nil {
+			err = obj.Delete()
+		}
+		if err != nil {
+			log.Warnf("Failed to remove the object %s of the deleted namespace %s: %v", info.Name, ns.ID, err)
+			left = append(left, info.Name)
+		}
+	}
+	sort.Strings(left)
+	return left
+}
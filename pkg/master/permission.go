@@ -0,0 +1,191 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package master
+
+import (
+	"context"
+	"path"
+	"strings"
+
+	"github.com/gostor/gofs/pkg/auth"
+	"github.com/gostor/gofs/pkg/authorization"
+	"github.com/gostor/gofs/pkg/errors"
+	"github.com/gostor/gofs/pkg/fs"
+)
+
+// caller returns the identity the permissions of the request are checked
+// for. The requests are not authenticated if the authentication is
+// disabled, and they are then allowed everything the authorization plugins
+// allow.
+func caller(ctx context.Context) *fs.Caller {
+	c := fs.RootCaller
+	if p := auth.PrincipalFromContext(ctx); p != nil {
+		c = &fs.Caller{Uid: p.Uid, Gids: p.Gids}
+	}
+	if a := authorization.AuthorizerFromContext(ctx); a != nil {
+		authorized := *c
+		authorized.Authorize = a
+		c = &authorized
+	}
+	return c
+}
+
+// checkAdmin checks that the request may administer the cluster, to do
+// what. Only the service accounts of the admin group may, see
+// auth.AdminGroup, unless the authentication is disabled: the keys of a
+// namespace only give full control over its files.
+func checkAdmin(ctx context.Context, what string) error {
+	p := auth.PrincipalFromContext(ctx)
+	if p == nil || p.IsAdmin() {
+		return nil
+	}
+	return errors.PermissionDenied("permission denied: only the admins may %s", what)
+}
+
+// maxSymlinks is the maximum number of symlinks followed by a path walk.
+const maxSymlinks = 40
+
+// walk looks up the files along the full path, from the root of the
+// namespace down, checking that c may search every directory it traverses.
+// It stops at the first missing file, so the last returned file is the
+// deepest existing ancestor of the path, or the file itself.
+//
+// The symlinks and the hard links along the path are resolved, and so is
+// the last file if follow is set. walk returns the resolved path as well,
+// which is the full path of the last file if it exists. The authorization
+// plugins only checked the path of the request, so they are asked about the
+// resolved path too, or the live path of the files of the snapshots and of
+// the trash, which the same policies apply to.
+func (m *Master) walk(c *fs.Caller, ns *fs.Namespace, full string, follow bool) ([]*fs.File, string, error) {
+	p := full
+	for links := 0; ; links++ {
+		if links > maxSymlinks {
+			return nil, "", errors.BadParameter("too many levels of symbolic links in %s", p)
+		}
+		files, next, err := m.walkOnce(c, ns, full, follow)
+		if err == nil && next == full && c.Authorize != nil {
+			if live := ns.LivePath(full); live != p {
+				err = c.Authorize(live)
+			}
+		}
+		if err != nil || next == full {
+			return files, full, err
+		}
+		full = next
+	}
+}
+
+// walkOnce walks the path full until it meets a link to resolve, and then
+// returns the path to walk instead of full.
+func (m *Master) walkOnce(c *fs.Caller, ns *fs.Namespace, full string, follow bool) ([]*fs.File, string, error) {
+	dir := ns.Root()
+	if f, err := m.lookup(ns, dir.FullPath()); err == nil {
+		dir = f
+	}
+	files := []*fs.File{dir}
+	names := strings.Split(strings.TrimPrefix(full, dir.FullPath()), "/")
+	for i, name := range names {
+		if name == "" {
+			continue
+		}
+		if !dir.IsDirectory() {
+			return nil, "", errors.NotDirectory("not a directory: %s", dir.FullPath())
+		}
+		if err := dir.Access(c, fs.MayExec); err != nil {
+			return nil, "", err
+		}
+		f, err := m.child(ns, dir, name)
+		if errors.IsNotFound(err) {
+			break
+		} else if err != nil {
+			return nil, "", err
+		}
+		last := i == len(names)-1
+		switch {
+		case f.IsSymlink() && (follow || !last):
+			target, err := m.symlinkTarget(ns, dir, f)
+			if err != nil {
+				return nil, "", err
+			}
+			return files, path.Join(target, path.Join(names[i+1:]...)), nil
+		case f.IsLink() && follow:
+			// a hard link is the file it refers to
+			return files, f.Target, nil
+		}
+		files = append(files, f)
+		dir = f
+	}
+	return files, full, nil
+}
+
+// symlinkTarget returns the full path the symlink f of dir points to, which
+// must be inside the namespace.
+func (m *Master) symlinkTarget(ns *fs.Namespace, dir, f *fs.File) (string, error) {
+	target := f.Target
+	if !path.IsAbs(target) {
+		target = path.Join(dir.FullPath(), target)
+	}
+	target = path.Clean(target)
+	root := ns.Root().FullPath()
+	if target != root && !strings.HasPrefix(target, root+"/") {
+		return "", errors.BadParameter("symlink %s points outside of namespace %s", f.FullPath(), ns.ID)
+	}
+	return target, nil
+}
+
+// access looks up the file at full path, following the links, and checks
+// that c may access it with the mask after searching its ancestors.
+func (m *Master) access(c *fs.Caller, ns *fs.Namespace, full string, mask uint32) (*fs.File, error) {
+	files, real, err := m.walk(c, ns, full, true)
+	if err != nil {
+		return nil, err
+	}
+	f := files[len(files)-1]
+	if f.FullPath() != real {
+		return nil, errors.NotFound("no such file or directory: %s", full)
+	}
+	if mask != 0 {
+		if err = f.Access(c, mask); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// checkDelete checks that c may remove the file f from the directory dir,
+// and with recursive, the whole tree below it.
+func (m *Master) checkDelete(c *fs.Caller, ns *fs.Namespace, dir, f *fs.File, recursive bool) error {
+	if err := m.checkRemove(c, dir, f); err != nil {
+		return err
+	}
+	if !f.IsDirectory() || !recursive {
+		return nil
+	}
+	children, err := m.Cache.List(ns.ID, f.FullPath())
+	if err != nil || len(children) == 0 {
+		return err
+	}
+	// emptying a directory needs to list it too
+	if err = f.Access(c, fs.MayRead); err != nil {
+		return err
+	}
+	for _, child := range children {
+		if err = m.checkDelete(c, ns, f, child, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
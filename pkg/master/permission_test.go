@@ -0,0 +1,211 @@
+package master
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/auth"
+	"github.com/gostor/gofs/pkg/cache"
+	"github.com/gostor/gofs/pkg/errors"
+	"github.com/gostor/gofs/pkg/fs"
+	"github.com/gostor/gofs/pkg/raft"
+)
+
+// newTestMaster returns a master serving the namespace ns, whose tree is
+//
+//	/ns          root  0755
+//	/ns/home     root  0755
+//	/ns/home/u1  1000  0700
+//	/ns/home/u1/f  1000  0644
+//	/ns/tmp      root  1777
+//	/ns/tmp/f    1000  0644
+func newTestMaster(t *testing.T) (*Master, *fs.Namespace) {
+	c, err := cache.NewCache("memory", "", 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns := fs.NewNamespace("ns", &api.Config{}, nil)
+	if err = c.AddNamespace(ns); err != nil {
+		t.Fatal(err)
+	}
+	root := ns.Root()
+	dir := func(parent *fs.File, name string, uid uint32, mode os.FileMode) *fs.File {
+		return &fs.File{Parent: parent, Path: name, Directory: true, Attr: fs.Attr{Mode: os.ModeDir | mode, Uid: uid, Gid: uid}}
+	}
+	file := func(parent *fs.File, name string, uid uint32, mode os.FileMode) *fs.File {
+		return &fs.File{Parent: parent, Path: name, Attr: fs.Attr{Mode: mode, Uid: uid, Gid: uid}}
+	}
+	home := dir(root, "home", 0, 0755)
+	u1 := dir(home, "u1", 1000, 0700)
+	tmp := dir(root, "tmp", 0, 0777|os.ModeSticky)
+	for _, f := range []*fs.File{root, home, u1, file(u1, "f", 1000, 0644), tmp, file(tmp, "f", 1000, 0644)} {
+		if err = c.Add(ns.ID, f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &Master{Namespaces: map[string]*fs.Namespace{ns.ID: ns}, Cache: c}, ns
+}
+
+func withUid(uid uint32) context.Context {
+	return auth.WithPrincipal(context.Background(), &auth.Principal{Uid: uid, Gids: []uint32{uid}})
+}
+
+func TestSearchPermission(t *testing.T) {
+	m, _ := newTestMaster(t)
+
+	if _, err := m.getFileStatus(withUid(1000), "/ns/home/u1/f"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.getFileStatus(context.Background(), "/ns/home/u1/f"); err != nil {
+		t.Fatalf("unauthenticated requests are not checked: %v", err)
+	}
+	// u1 cannot be searched by the others
+	if _, err := m.getFileStatus(withUid(1001), "/ns/home/u1/f"); !errors.IsPermissionDenied(err) {
+		t.Fatalf("expected a PermissionDenied error, got %v", err)
+	}
+	if _, err := m.listStatus(withUid(1001), "/ns/home/u1"); !errors.IsPermissionDenied(err) {
+		t.Fatalf("expected a PermissionDenied error, got %v", err)
+	}
+	if _, err := m.listStatus(withUid(1001), "/ns/home"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.getFileStatus(withUid(1001), "/ns/home/u1/f/x"); !errors.IsPermissionDenied(err) {
+		t.Fatalf("expected a PermissionDenied error, got %v", err)
+	}
+	if _, err := m.getFileStatus(withUid(1000), "/ns/home/u1/f/x"); !errors.IsNotDirectory(err) {
+		t.Fatalf("expected a NotDirectory error, got %v", err)
+	}
+}
+
+func TestDeletePermission(t *testing.T) {
+	m, ns := newTestMaster(t)
+
+	cases := []struct {
+		uid       uint32
+		path      string
+		recursive bool
+		ok        bool
+	}{
+		// the sticky bit of /tmp protects f from the others
+		{1001, "/ns/tmp/f", false, false},
+		{1000, "/ns/tmp/f", false, true},
+		{0, "/ns/tmp/f", false, true},
+		// home is not writable by its users
+		{1000, "/ns/home/u1", true, false},
+		{1000, "/ns/home/u1/f", false, true},
+		{0, "/ns/home/u1", true, true},
+	}
+	for _, tc := range cases {
+		files, _, err := m.walk(caller(withUid(tc.uid)), ns, tc.path, false)
+		if err == nil {
+			n := len(files)
+			err = m.checkDelete(caller(withUid(tc.uid)), ns, files[n-2], files[n-1], tc.recursive)
+		}
+		if tc.ok && err != nil {
+			t.Fatalf("uid %d deleting %s: unexpected error %v", tc.uid, tc.path, err)
+		}
+		if !tc.ok && !errors.IsPermissionDenied(err) {
+			t.Fatalf("uid %d deleting %s: expected a PermissionDenied error, got %v", tc.uid, tc.path, err)
+		}
+	}
+}
+
+func TestSetattrPermission(t *testing.T) {
+	m, _ := newTestMaster(t)
+	form := func(kv ...string) url.Values {
+		v := url.Values{}
+		for i := 0; i < len(kv); i += 2 {
+			v.Set(kv[i], kv[i+1])
+		}
+		return v
+	}
+
+	// only the owner may change the permission
+	if _, err := m.setPermission(withUid(1001), "/ns/tmp/f", form("permission", "777")); !errors.IsPermissionDenied(err) {
+		t.Fatalf("expected a PermissionDenied error, got %v", err)
+	}
+	// only the superuser may give a file away, and its owner change its
+	// group to one of its own
+	if _, err := m.setOwner(withUid(1000), "/ns/tmp/f", form("owner", "1001")); !errors.IsPermissionDenied(err) {
+		t.Fatalf("expected a PermissionDenied error, got %v", err)
+	}
+	if _, err := m.setOwner(withUid(1000), "/ns/tmp/f", form("group", "1001")); !errors.IsPermissionDenied(err) {
+		t.Fatalf("expected a PermissionDenied error, got %v", err)
+	}
+	// setting the times needs to write the file
+	if _, err := m.setTimes(withUid(1001), "/ns/tmp/f", form("modificationtime", "0")); !errors.IsPermissionDenied(err) {
+		t.Fatalf("expected a PermissionDenied error, got %v", err)
+	}
+
+	for _, tc := range []struct {
+		op   string
+		form url.Values
+	}{
+		{api.OpsSetPermission, form("permission", "2755")},
+		{api.OpsSetPermission, form()},
+		{api.OpsSetOwner, form()},
+		{api.OpsSetOwner, form("owner", "u1")},
+		{api.OpsSetTimes, form("accesstime", "-2")},
+	} {
+		if _, err := m.PutPathHandler(withUid(1000), "/ns/tmp/f", tc.op, tc.form, nil); !errors.Is(err, errors.KindBadParameter) {
+			t.Fatalf("%s %v: expected a BadParameter error, got %v", tc.op, tc.form, err)
+		}
+	}
+}
+
+func TestRenamePermission(t *testing.T) {
+	m, ns := newTestMaster(t)
+
+	cases := []struct {
+		uid      uint32
+		src, dst string
+	}{
+		// the sticky bit of /tmp protects f from the others
+		{1001, "/ns/tmp/f", "/ns/tmp/g"},
+		// home is not writable by its users
+		{1000, "/ns/home/u1/f", "/ns/home/f"},
+		{1000, "/ns/home/u1", "/ns/tmp/u1"},
+	}
+	for _, tc := range cases {
+		err := m.doRename(caller(withUid(tc.uid)), ns, tc.src, tc.dst, false, false)
+		if !errors.IsPermissionDenied(err) {
+			t.Fatalf("uid %d renaming %s to %s: expected a PermissionDenied error, got %v", tc.uid, tc.src, tc.dst, err)
+		}
+	}
+	if err := m.doRename(fs.RootCaller, ns, "/ns/home", "/ns/home/u1/home", false, false); !errors.Is(err, errors.KindBadParameter) {
+		t.Fatalf("expected a BadParameter error moving a directory into its own subtree, got %v", err)
+	}
+	if err := m.doRename(fs.RootCaller, ns, "/ns/tmp/f", "/ns/home/u1/f", false, false); !errors.IsAlreadyExists(err) {
+		t.Fatalf("expected an AlreadyExists error, got %v", err)
+	}
+}
+
+func TestTrashPermission(t *testing.T) {
+	m, _ := newTestMaster(t)
+	m.RaftServer = raft.NewLocalServer(m.Name, m.Cache)
+
+	form := url.Values{"recursive": {"true"}, "skiptrash": {"true"}}
+	if _, err := m.delete(withUid(1000), "/ns/home/u1/f", form); !errors.IsPermissionDenied(err) {
+		t.Fatalf("expected a PermissionDenied error skipping the trash, got %v", err)
+	}
+	// only the service accounts of the admins group may, not those acting
+	// for the superuser
+	root := &auth.Principal{Name: "fuse", ServiceAccount: true, Uid: 0, Gids: []uint32{0}, Trusted: true}
+	if _, err := m.delete(auth.WithPrincipal(context.Background(), root), "/ns/home/u1/f", form); !errors.IsPermissionDenied(err) {
+		t.Fatalf("expected a PermissionDenied error skipping the trash, got %v", err)
+	}
+	admin := &auth.Principal{Name: "backup", Groups: []string{auth.AdminGroup}, ServiceAccount: true, Uid: 0, Gids: []uint32{0}}
+	if _, err := m.delete(auth.WithPrincipal(context.Background(), admin), "/ns/tmp/f", form); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := m.getTrashRoot(withUid(1000), "/ns/home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := resp.(*api.PathResponse).Path; p != "/ns/.Trash/1000" {
+		t.Fatalf("unexpected trash root %s", p)
+	}
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package master
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/errors"
+	"github.com/gostor/gofs/pkg/fs"
+	"github.com/gostor/gofs/pkg/raft"
+)
+
+// setQuota sets or clears the quota of the directory p. Only the admins
+// may, so that the tenants cannot lift the limits of their namespace.
+func (m *Master) setQuota(ctx context.Context, p, op string, form url.Values) (interface{}, error) {
+	if err := checkAdmin(ctx, "set the quotas"); err != nil {
+		return nil, err
+	}
+	ns, full, err := m.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	f, err := m.access(caller(ctx), ns, full, 0)
+	if err != nil {
+		return nil, err
+	}
+	if !f.IsDirectory() {
+		return nil, errors.NotDirectory("cannot set the quota of %s, which is not a directory", full)
+	}
+	o := raft.NewOperation(op, ns.ID, f.FullPath(), "", nil, time.Now())
+	if op == api.OpsSetQuota {
+		o.Quota = &fs.Quota{}
+		if o.Quota.Names, err = quotaValue(form, "namespacequota"); err != nil {
+			return nil, err
+		}
+		if o.Quota.Space, err = quotaValue(form, "storagespacequota"); err != nil {
+			return nil, err
+		}
+	}
+	if _, err = m.RaftServer.Do(o); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// quotaValue parses the quota form value k, which is fs.QuotaDontSet if it
+// is missing and -1 to clear the quota.
+func quotaValue(form url.Values, k string) (int64, error) {
+	s := form.Get(k)
+	if s == "" {
+		return fs.QuotaDontSet, nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < fs.QuotaReset || n == fs.QuotaDontSet {
+		return 0, errors.BadParameter("invalid %s %q", k, s)
+	}
+	return n, nil
+}
+
+func (m *Master) getQuotaUsage(ctx context.Context, p string) (interface{}, error) {
+	ns, full, err := m.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	f, err := m.access(caller(ctx), ns, full, 0)
+	if err != nil {
+		return nil, err
+	}
+	s, err := m.summary(ns, f)
+	if err != nil {
+		return nil, err
+	}
+	u := api.QuotaUsage{
+		FileAndDirectoryCount: s.Names(),
+		Quota:                 fs.QuotaReset,
+		SpaceConsumed:         s.Length,
+		SpaceQuota:            fs.QuotaReset,
+	}
+	if q := f.Quota; q != nil {
+		u.Quota, u.SpaceQuota = q.Names, q.Space
+	}
+	return &api.QuotaUsageResponse{QuotaUsage: u}, nil
+}
+
+// checkQuota checks that the quotas of the directory dir and its ancestors
+// let names files be created in dir, and returns the space they leave, or
+// -1 if it is not limited. The raft operation checks the quotas again, this
+// only avoids uploading the data of the files which would exceed them.
+func (m *Master) checkQuota(ns *fs.Namespace, dir string, names int64) (int64, error) {
+	left := int64(-1)
+	root := ns.Root().FullPath()
+	for p := dir; ; p = path.Dir(p) {
+		if f, err := m.Cache.Get(ns.ID, p); err == nil && f.Quota != nil {
+			if err = f.CheckQuota(fs.Summary{Files: names}); err != nil {
+				return 0, err
+			}
+			if q := f.Quota; q.Space >= 0 && f.Summary != nil {
+				n := q.Space - f.Summary.Length
+				if n < 0 {
+					n = 0
+				}
+				if left < 0 || n < left {
+					left = n
+				}
+			}
+		}
+		if p == root || p == "/" {
+			return left, nil
+		}
+	}
+}
+
+// quotaReader fails with a QuotaExceeded error once more than left bytes
+// are read, so that the upload of a file exceeding a space quota is aborted.
+type quotaReader struct {
+	r    io.Reader
+	left int64
+	dir  string
+}
+
+func (r *quotaReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if r.left -= int64(n); r.left < 0 {
+		return n, errors.QuotaExceeded("the space quota of %s is exceeded", r.dir)
+	}
+	return n, err
+}
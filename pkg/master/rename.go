@@ -0,0 +1,209 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package master
+
+import (
+	"context"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/errors"
+	"github.com/gostor/gofs/pkg/fs"
+	"github.com/gostor/gofs/pkg/raft"
+)
+
+// rename moves the file or directory tree p to the destination, in the same
+// namespace, as a single metadata operation.
+//
+// Without renameoptions, it follows the original HDFS semantics: a
+// destination directory receives p, and the rename returns false rather than
+// an error if p does not exist, the destination does, or it is inside the
+// tree of p. With renameoptions, NONE or OVERWRITE, the destination is
+// replaced by p with OVERWRITE, and the failures are errors.
+func (m *Master) rename(ctx context.Context, p string, form url.Values) (interface{}, error) {
+	ns, full, err := m.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	if form.Get("destination") == "" {
+		return nil, errors.BadParameter("missing destination parameter")
+	}
+	dstNs, dst, err := m.resolve(form.Get("destination"))
+	if err != nil {
+		return nil, err
+	}
+	if dstNs != ns {
+		return nil, errors.BadParameter("cannot rename %s to %s in another namespace", full, dst)
+	}
+	var overwrite bool
+	options := form.Get("renameoptions")
+	switch strings.ToUpper(options) {
+	case "", "NONE":
+	case "OVERWRITE":
+		overwrite = true
+	default:
+		return nil, errors.BadParameter("invalid renameoptions %q", options)
+	}
+
+	err = m.doRename(caller(ctx), ns, full, dst, options == "", overwrite)
+	if err != nil && options == "" {
+		switch {
+		case errors.IsNotFound(err), errors.IsAlreadyExists(err), errors.IsNotDirectory(err), errors.IsNotEmpty(err),
+			errors.Is(err, errors.KindBadParameter), errors.Is(err, errors.KindIsDirectory):
+			return &api.BooleanResponse{Boolean: false}, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &api.BooleanResponse{Boolean: true}, nil
+}
+
+// doRename checks that c may move the file full to dst, into dst if it is
+// an existing directory and into is set, and moves it.
+func (m *Master) doRename(c *fs.Caller, ns *fs.Namespace, full, dst string, into, overwrite bool) error {
+	// the links are renamed, not the files they refer to
+	files, src, err := m.walk(c, ns, full, false)
+	if err != nil {
+		return err
+	}
+	n := len(files)
+	if files[n-1].FullPath() != src {
+		return errors.NotFound("no such file or directory: %s", full)
+	}
+	if n < 2 {
+		return errors.BadParameter("cannot rename the root of namespace %s", ns.ID)
+	}
+	f := files[n-1]
+	if err = m.checkRemove(c, files[n-2], f); err != nil {
+		return err
+	}
+
+	files, real, err := m.walk(c, ns, dst, false)
+	if err != nil {
+		return err
+	}
+	if last := files[len(files)-1]; into && last.FullPath() == real && last.IsDirectory() {
+		// the destination directory receives the file
+		if files, real, err = m.walk(c, ns, path.Join(real, f.Path), false); err != nil {
+			return err
+		}
+	}
+	if real == src {
+		return nil
+	}
+	if strings.HasPrefix(real, src+"/") {
+		return errors.BadParameter("cannot move %s into its own subtree %s", src, real)
+	}
+	dir := files[len(files)-1]
+	if dir.FullPath() == real {
+		if len(files) < 2 {
+			return errors.BadParameter("cannot replace the root of namespace %s", ns.ID)
+		}
+		if !overwrite {
+			return errors.AlreadyExists("%s already exists", dst)
+		}
+		if err = m.checkRemove(c, files[len(files)-2], dir); err != nil {
+			return err
+		}
+		dir = files[len(files)-2]
+	} else if dir.FullPath() != path.Dir(real) {
+		return errors.NotFound("no such file or directory: %s", path.Dir(real))
+	}
+	if err = dir.Access(c, fs.MayWrite|fs.MayExec); err != nil {
+		return err
+	}
+	return m.move(ns, f, real, overwrite)
+}
+
+// move moves the file or directory tree f to the full path dst, which it
+// replaces with overwrite, and removes the data of the replaced files.
+func (m *Master) move(ns *fs.Namespace, f *fs.File, dst string, overwrite bool) error {
+	op := raft.NewOperation(api.OpsRename, ns.ID, f.FullPath(), dst, nil, time.Now())
+	op.Overwrite = overwrite
+	// the data of the files stored at their path is copied to object keys
+	// which do not change with it; the others are left alone
+	moved, err := m.pathObjects(ns, f)
+	if err != nil {
+		return err
+	}
+	for _, mf := range moved {
+		key, err := m.moveObject(ns, mf)
+		if err != nil {
+			m.removeObjects(ns, op.Objects)
+			return err
+		}
+		if op.Objects == nil {
+			op.Objects = map[string]string{}
+		}
+		op.Objects[mf.FullPath()] = key
+	}
+	ret, err := m.RaftServer.Do(op)
+	if err != nil {
+		m.removeObjects(ns, op.Objects)
+		return err
+	}
+	var keys []string
+	for _, mf := range moved {
+		keys = append(keys, mf.RemotePath())
+	}
+	m.release(ns, keys, false)
+	removed, _ := ret.([]*fs.File)
+	m.removeData(ns, removed)
+	return nil
+}
+
+// checkRemove checks that c may remove the file f from the directory dir.
+func (m *Master) checkRemove(c *fs.Caller, dir, f *fs.File) error {
+	if err := dir.Access(c, fs.MayWrite|fs.MayExec); err != nil {
+		return err
+	}
+	return dir.CheckSticky(c, f)
+}
+
+// pathObjects returns the files of the tree of f which are stored at their
+// RemotePath.
+func (m *Master) pathObjects(ns *fs.Namespace, f *fs.File) ([]*fs.File, error) {
+	if !f.IsDirectory() {
+		if f.IsSymlink() || f.IsLink() || f.Object != "" {
+			return nil, nil
+		}
+		return []*fs.File{f}, nil
+	}
+	children, err := m.Cache.List(ns.ID, f.FullPath())
+	if err != nil {
+		return nil, err
+	}
+	var files []*fs.File
+	for _, child := range children {
+		sub, err := m.pathObjects(ns, child)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, sub...)
+	}
+	return files, nil
+}
+
+// removeObjects removes the data objects of the keys, logging the failures.
+func (m *Master) removeObjects(ns *fs.Namespace, keys map[string]string) {
+	for _, key := range keys {
+		m.removeObject(ns, key)
+	}
+}
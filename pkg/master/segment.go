@@ -0,0 +1,363 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package master
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/errors"
+	"github.com/gostor/gofs/pkg/fs"
+	"github.com/gostor/gofs/pkg/raft"
+)
+
+// CompactionConfig configures the compaction of the files appended to,
+// whose small segments are merged once the files are no longer written.
+type CompactionConfig struct {
+	// Interval is the interval between the compactions, 0 to disable
+	// them.
+	Interval time.Duration
+	// QuietPeriod is how long a file must not have been modified before
+	// it is compacted.
+	QuietPeriod time.Duration
+	// SegmentSize is the size in bytes below which the segments are
+	// merged.
+	SegmentSize int64
+}
+
+// append uploads the request body to a new object, and then adds it as a
+// segment to the end of the content of the file p.
+func (m *Master) append(ctx context.Context, p string, form url.Values, body io.Reader) (interface{}, error) {
+	ns, f, err := m.segmented(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	dir := path.Dir(f.FullPath())
+	left, err := m.checkQuota(ns, dir, 0)
+	if err != nil {
+		return nil, err
+	}
+	if left >= 0 {
+		body = &quotaReader{r: body, left: left, dir: dir}
+	}
+	key, err := fs.NewObjectKey(ns.ID)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := ns.Object(&fs.File{Object: key})
+	if err != nil {
+		return nil, err
+	}
+	n, err := obj.Put(body)
+	if err == nil && n > 0 {
+		op := raft.NewOperation(api.OpsAppend, ns.ID, f.FullPath(), "", nil, time.Now())
+		op.Segments = []fs.Segment{{Object: key, Size: n}}
+		_, err = m.RaftServer.Do(op)
+	}
+	if err != nil || n == 0 {
+		m.removeObject(ns, key)
+	}
+	return nil, err
+}
+
+// truncate truncates the file p to the newlength parameter, which cannot be
+// larger than the file. The segments past the length are dropped, and the
+// part kept of the one it cuts is copied to a new segment.
+func (m *Master) truncate(ctx context.Context, p string, form url.Values) (interface{}, error) {
+	size, err := strconv.ParseInt(form.Get("newlength"), 10, 64)
+	if err != nil || size < 0 {
+		return nil, errors.BadParameter("invalid newlength %q", form.Get("newlength"))
+	}
+	ns, f, err := m.segmented(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	if size > int64(f.Size) {
+		return nil, errors.BadParameter("cannot truncate %s of %d bytes to %d bytes", f.FullPath(), f.Size, size)
+	}
+	op := raft.NewOperation(api.OpsTruncate, ns.ID, f.FullPath(), "", &fs.Attr{Size: uint64(size)}, time.Now())
+	pieces := f.Pieces()
+	if i, kept := fs.Cut(pieces, size); size < int64(f.Size) && kept != pieces[i].Size {
+		s, err := m.writeSegment(ns, []fs.Segment{{Object: pieces[i].Object, Size: kept}}, nil)
+		if err != nil {
+			return nil, err
+		}
+		op.Segments = []fs.Segment{s}
+		op.Replaced = []string{pieces[i].Object}
+	}
+	ret, err := m.RaftServer.Do(op)
+	if err != nil {
+		if len(op.Segments) > 0 {
+			m.removeObject(ns, op.Segments[0].Object)
+		}
+		return nil, err
+	}
+	m.releaseReplaced(ns, f, ret)
+	return &api.BooleanResponse{Boolean: true}, nil
+}
+
+// segmented returns the regular file p, which the caller may write.
+func (m *Master) segmented(ctx context.Context, p string) (*fs.Namespace, *fs.File, error) {
+	ns, full, err := m.resolve(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := m.access(caller(ctx), ns, full, fs.MayWrite)
+	if err != nil {
+		return nil, nil, err
+	}
+	if f.IsDirectory() {
+		return nil, nil, errors.IsDirectory("%s is a directory", full)
+	}
+	if _, _, _, ok := fs.SplitSnapshotPath(f.FullPath()); ok {
+		return nil, nil, errors.PermissionDenied("permission denied: snapshot %s is read-only", f.FullPath())
+	}
+	return ns, f, nil
+}
+
+// writeSegment copies the data of the segments pieces to a new object, and
+// returns the segment it makes. The checksums of the data are written to h
+// unless it is nil.
+func (m *Master) writeSegment(ns *fs.Namespace, pieces []fs.Segment, h *fs.Hasher) (fs.Segment, error) {
+	key, err := fs.NewObjectKey(ns.ID)
+	if err != nil {
+		return fs.Segment{}, err
+	}
+	obj, err := ns.Object(&fs.File{Object: key})
+	if err != nil {
+		return fs.Segment{}, err
+	}
+	var r io.Reader = &contentReader{ns: ns, pieces: pieces}
+	if h != nil {
+		r = io.TeeReader(r, h)
+	}
+	n, err := obj.Put(r)
+	if err != nil {
+		m.removeObject(ns, key)
+		return fs.Segment{}, err
+	}
+	return fs.Segment{Object: key, Size: n}, nil
+}
+
+// openContent returns the content of the regular file f, read from the
+// objects of its segments in turn.
+func (m *Master) openContent(ns *fs.Namespace, f *fs.File) (io.ReadCloser, error) {
+	return m.openRange(ns, f, 0, int64(f.Size))
+}
+
+// openRange returns the n bytes of the content of the regular file f at
+// offset off, only reading the objects of the segments holding them.
+func (m *Master) openRange(ns *fs.Namespace, f *fs.File, off, n int64) (io.ReadCloser, error) {
+	pieces, skip := fs.Slice(f.Pieces(), off, n)
+	if len(pieces) == 0 {
+		return ioutil.NopCloser(strings.NewReader("")), nil
+	}
+	r := &contentReader{ns: ns, pieces: pieces}
+	// the first object is opened at once, so that a missing one fails
+	// the request rather than its response
+	if err := r.next(skip); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// contentReader reads the content stored in the objects of the segments
+// pieces, opening them in turn.
+type contentReader struct {
+	ns     *fs.Namespace
+	pieces []fs.Segment
+	rc     io.ReadCloser
+	// key and left are the key of the object read, and the number of its
+	// bytes which are left to read.
+	key  string
+	left int64
+}
+
+// next opens the object of the next segment, and skips its first skip
+// bytes.
+func (r *contentReader) next(skip int64) error {
+	s := r.pieces[0]
+	obj, err := r.ns.Object(&fs.File{Object: s.Object})
+	if err != nil {
+		return err
+	}
+	rc, err := obj.Get()
+	if err != nil {
+		return err
+	}
+	if skip > 0 {
+		if err = skipObject(rc, s.Object, skip); err != nil {
+			rc.Close()
+			return err
+		}
+	}
+	r.pieces = r.pieces[1:]
+	r.rc, r.key, r.left = rc, s.Object, s.Size-skip
+	return nil
+}
+
+// skipObject skips the first n bytes of the object key read by rc, seeking
+// past them when the storage supports it rather than downloading them.
+func skipObject(rc io.ReadCloser, key string, n int64) error {
+	if s, ok := rc.(io.Seeker); ok {
+		_, err := s.Seek(n, io.SeekStart)
+		return err
+	}
+	skipped, err := io.CopyN(ioutil.Discard, rc, n)
+	if err == io.EOF {
+		return errors.Corrupted("the object %s is %d bytes shorter than its segment", key, n-skipped)
+	}
+	return err
+}
+
+func (r *contentReader) Read(b []byte) (int, error) {
+	for {
+		if r.rc == nil {
+			if len(r.pieces) == 0 {
+				return 0, io.EOF
+			}
+			if err := r.next(0); err != nil {
+				return 0, err
+			}
+		}
+		p := b
+		if int64(len(p)) > r.left {
+			p = p[:r.left]
+		}
+		n, err := 0, io.EOF
+		if len(p) > 0 {
+			n, err = r.rc.Read(p)
+		}
+		r.left -= int64(n)
+		if err == io.EOF {
+			if r.left > 0 {
+				return n, errors.Corrupted("the object %s is %d bytes shorter than its segment", r.key, r.left)
+			}
+			r.rc.Close()
+			r.rc = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (r *contentReader) Close() error {
+	if r.rc == nil {
+		return nil
+	}
+	return r.rc.Close()
+}
+
+// compactLoop compacts the files of the namespaces which have not been
+// modified for the quiet period. Only the raft leader compacts, the others
+// would repeat its work.
+func (m *Master) compactLoop() {
+	for now := range time.Tick(m.Compaction.Interval) {
+		if !m.IsLeader() {
+			continue
+		}
+		list, err := m.Cache.ListNamespaces()
+		if err != nil {
+			log.Warnf("Failed to list the namespaces to compact their files: %v", err)
+			continue
+		}
+		for _, n := range list {
+			ns, err := m.namespace(n.ID)
+			if err == nil {
+				var root *fs.File
+				if root, err = m.lookup(ns, ns.Root().FullPath()); err == nil {
+					err = m.compactTree(ns, root, now)
+				}
+			}
+			if err != nil {
+				log.Warnf("Failed to compact the files of namespace %s: %v", n.ID, err)
+			}
+		}
+	}
+}
+
+// compactTree compacts the files of the tree of the directory dir which
+// have not been modified for the quiet period at now.
+func (m *Master) compactTree(ns *fs.Namespace, dir *fs.File, now time.Time) error {
+	children, err := m.Cache.List(ns.ID, dir.FullPath())
+	if err != nil {
+		return err
+	}
+	for _, f := range children {
+		if f.IsDirectory() {
+			if err = m.compactTree(ns, f, now); err != nil {
+				return err
+			}
+			continue
+		}
+		if f.IsSymlink() || f.IsLink() || len(f.Segments) == 0 || now.Sub(f.Mtime) < m.Compaction.QuietPeriod {
+			continue
+		}
+		err = m.compact(ns, f, now)
+		if errors.Is(err, errors.KindRetriable) {
+			// the file is written again, and compacted later
+			log.Debugf("Skipped the compaction of %s: %v", f.FullPath(), err)
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compact merges the runs of the small segments of the file f into one
+// segment each.
+func (m *Master) compact(ns *fs.Namespace, f *fs.File, now time.Time) error {
+	pieces := f.Pieces()
+	for _, run := range fs.SmallRuns(pieces, m.Compaction.SegmentSize) {
+		merged := pieces[run[0]:run[1]]
+		op := raft.NewOperation(api.OpsCompact, ns.ID, f.FullPath(), "", nil, now)
+		// the checksums are recorded if the whole content is rewritten
+		var h *fs.Hasher
+		if len(merged) == len(pieces) {
+			h = fs.NewHasher(false)
+		}
+		s, err := m.writeSegment(ns, merged, h)
+		if err != nil {
+			return err
+		}
+		op.Segments = []fs.Segment{s}
+		for _, p := range merged {
+			op.Replaced = append(op.Replaced, p.Object)
+		}
+		if h != nil {
+			op.Checksums = h.Checksums()
+		}
+		ret, err := m.RaftServer.Do(op)
+		if err != nil {
+			m.removeObject(ns, s.Object)
+			return err
+		}
+		m.releaseReplaced(ns, f, ret)
+		f = ret.(*fs.File)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package master
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/errors"
+	"github.com/gostor/gofs/pkg/fs"
+)
+
+func TestContentReader(t *testing.T) {
+	m, _ := newTestMaster(t)
+	stor := newMemStorage()
+	ns := fs.NewNamespace("ns", &api.Config{}, stor)
+	now := time.Now()
+	stor.add("o1", "hello", now)
+	stor.add("o2", "", now)
+	stor.add("o3", " world", now)
+
+	f := &fs.File{Object: "o1", Segments: []fs.Segment{{Object: "o2"}, {Object: "o3", Size: 6}}, Attr: fs.Attr{Size: 11}}
+	rc, err := m.openContent(ns, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil || string(data) != "hello world" {
+		t.Fatalf("unexpected content %q: %v", data, err)
+	}
+
+	// a short object is reported rather than silently truncating the file
+	f.Segments[1].Size, f.Size = 8, 13
+	if rc, err = m.openContent(ns, f); err != nil {
+		t.Fatal(err)
+	}
+	_, err = ioutil.ReadAll(rc)
+	rc.Close()
+	if !errors.Is(err, errors.KindCorrupted) {
+		t.Fatalf("expected a Corrupted error, got %v", err)
+	}
+
+	f.Object = "missing"
+	if _, err = m.openContent(ns, f); err == nil {
+		t.Fatal("expected an error for a missing object")
+	}
+}
@@ -0,0 +1,486 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package master
+
+import (
+	"context"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/cache"
+	"github.com/gostor/gofs/pkg/errors"
+	"github.com/gostor/gofs/pkg/fs"
+	"github.com/gostor/gofs/pkg/raft"
+)
+
+// allowSnapshot makes the directory p snapshottable, or not with
+// DISALLOWSNAPSHOT. As the superuser in HDFS, only the admins may.
+func (m *Master) allowSnapshot(ctx context.Context, p, op string) (interface{}, error) {
+	if err := checkAdmin(ctx, "allow the snapshots"); err != nil {
+		return nil, err
+	}
+	ns, full, err := m.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	f, err := m.access(caller(ctx), ns, full, 0)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = m.RaftServer.Do(raft.NewOperation(op, ns.ID, f.FullPath(), "", nil, time.Now())); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// createSnapshot creates a snapshot of the snapshottable directory p, named
+// snapshotname or after the time, and returns the path it is browsed at.
+func (m *Master) createSnapshot(ctx context.Context, p string, form url.Values) (interface{}, error) {
+	ns, f, err := m.snapshotOwner(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	op := raft.NewOperation(api.OpsCreateSnapshot, ns.ID, f.FullPath(), "", nil, time.Now())
+	op.Snapshot = form.Get("snapshotname")
+	ret, err := m.RaftServer.Do(op)
+	if err != nil {
+		return nil, err
+	}
+	snapshot, _ := ret.(string)
+	return &api.PathResponse{Path: snapshot}, nil
+}
+
+// deleteSnapshot deletes the snapshot snapshotname of the directory p, and
+// the data only it kept.
+func (m *Master) deleteSnapshot(ctx context.Context, p string, form url.Values) (interface{}, error) {
+	ns, f, err := m.snapshotOwner(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	op := raft.NewOperation(api.OpsDeleteSnapshot, ns.ID, f.FullPath(), "", nil, time.Now())
+	if op.Snapshot = form.Get("snapshotname"); op.Snapshot == "" {
+		return nil, errors.BadParameter("missing snapshotname parameter")
+	}
+	ret, err := m.RaftServer.Do(op)
+	if err != nil {
+		return nil, err
+	}
+	dropped, _ := ret.([]*fs.File)
+	var keys []string
+	for _, f := range dropped {
+		if !f.IsDirectory() && !f.IsSymlink() && !f.IsLink() {
+			keys = append(keys, f.DataKeys()...)
+		}
+	}
+	// the current files may still have the data of the dropped copies
+	m.release(ns, keys, true)
+	return nil, nil
+}
+
+// renameSnapshot renames the snapshot oldsnapshotname of the directory p to
+// snapshotname.
+func (m *Master) renameSnapshot(ctx context.Context, p string, form url.Values) (interface{}, error) {
+	ns, f, err := m.snapshotOwner(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	op := raft.NewOperation(api.OpsRenameSnapshot, ns.ID, f.FullPath(), form.Get("snapshotname"), nil, time.Now())
+	if op.Snapshot = form.Get("oldsnapshotname"); op.Snapshot == "" {
+		return nil, errors.BadParameter("missing oldsnapshotname parameter")
+	}
+	if _, err = m.RaftServer.Do(op); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// snapshotOwner returns the directory p, whose snapshots the caller may
+// manage: only its owner and the superuser may.
+func (m *Master) snapshotOwner(ctx context.Context, p string) (*fs.Namespace, *fs.File, error) {
+	ns, full, err := m.resolve(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	c := caller(ctx)
+	f, err := m.access(c, ns, full, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !c.IsRoot() && c.Uid != f.Uid {
+		return nil, nil, errors.PermissionDenied("permission denied: only the owner of %s may manage its snapshots", full)
+	}
+	return ns, f, nil
+}
+
+// getSnapshotDiff reports the changes of the tree of the snapshottable
+// directory p from the snapshot oldsnapshotname to snapshotname. An empty
+// name is the current tree.
+func (m *Master) getSnapshotDiff(ctx context.Context, p string, form url.Values) (interface{}, error) {
+	ns, full, err := m.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	f, err := m.access(caller(ctx), ns, full, fs.MayRead|fs.MayExec)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := m.snapshotDir(ns, f.FullPath())
+	if err != nil {
+		return nil, err
+	}
+	report := api.SnapshotDiffReport{
+		SnapshotRoot: dir.FullPath(),
+		FromSnapshot: form.Get("oldsnapshotname"),
+		ToSnapshot:   form.Get("snapshotname"),
+	}
+	from, err := m.snapshotTree(ns, dir, report.FromSnapshot)
+	if err != nil {
+		return nil, err
+	}
+	to, err := m.snapshotTree(ns, dir, report.ToSnapshot)
+	if err != nil {
+		return nil, err
+	}
+	report.DiffList = diffTrees(from, to)
+	return &api.SnapshotDiffReportResponse{SnapshotDiffReport: report}, nil
+}
+
+// snapshotTree returns the files of the tree of the snapshottable directory
+// dir in its snapshot name, or currently if name is empty, by relative path.
+func (m *Master) snapshotTree(ns *fs.Namespace, dir *fs.File, name string) (map[string]*fs.File, error) {
+	tree := map[string]*fs.File{}
+	var walk func(rel string, f *fs.File) error
+	if name == "" {
+		walk = func(rel string, f *fs.File) error {
+			tree[rel] = f
+			if !f.IsDirectory() {
+				return nil
+			}
+			children, err := m.Cache.List(ns.ID, f.FullPath())
+			if err != nil {
+				return err
+			}
+			for _, child := range children {
+				if err = walk(rel+"/"+child.Path, child); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		return tree, walk("", dir)
+	}
+	i := dir.FindSnapshot(name)
+	if i < 0 {
+		return nil, errors.NotFound("no such snapshot %s of %s", name, dir.FullPath())
+	}
+	s := dir.Snapshots[i]
+	walk = func(rel string, f *fs.File) error {
+		tree[rel] = f
+		if !f.IsDirectory() {
+			return nil
+		}
+		children, err := cache.SnapshotList(m.Cache, ns.ID, dir, s, rel, f)
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			if err = walk(rel+"/"+child.Path, child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	root, err := cache.SnapshotFile(m.Cache, ns.ID, dir, s, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	return tree, walk("", root)
+}
+
+// diffTrees returns the changes from the tree from to the tree to. A file
+// which has the same inode at another path is renamed, and the files below
+// a created, deleted or renamed directory are only reported with it. The
+// directories whose entries changed are modified.
+func diffTrees(from, to map[string]*fs.File) []api.DiffReportEntry {
+	inodes := map[uint64]string{}
+	for rel, f := range to {
+		// the hard links share the inode of their file
+		if !f.IsLink() {
+			inodes[f.Inode] = rel
+		}
+	}
+	diff := []api.DiffReportEntry{}
+	touched := map[string]bool{}
+	renamed := map[string]string{}
+	deleted := map[string]bool{}
+	for _, rel := range sortedPaths(from) {
+		f := from[rel]
+		if t, ok := to[rel]; ok && t.Inode == f.Inode {
+			continue
+		}
+		if q, ok := inodes[f.Inode]; ok && !f.IsLink() && (from[q] == nil || from[q].Inode != f.Inode) {
+			renamed[rel] = q
+			if p, ok := renamed[parentOf(rel)]; ok && p == parentOf(q) && path.Base(rel) == path.Base(q) {
+				// the file moved along with its directory
+				if modified(f, to[q]) {
+					diff = append(diff, api.DiffReportEntry{SourcePath: relPath(rel), Type: api.DiffModify})
+				}
+				continue
+			}
+			diff = append(diff, api.DiffReportEntry{SourcePath: relPath(rel), TargetPath: relPath(q), Type: api.DiffRename})
+			touched[parentOf(rel)] = true
+			touched[parentOf(q)] = true
+			continue
+		}
+		deleted[rel] = true
+		if !deleted[parentOf(rel)] {
+			diff = append(diff, api.DiffReportEntry{SourcePath: relPath(rel), Type: api.DiffDelete})
+			touched[parentOf(rel)] = true
+		}
+	}
+
+	targets := map[string]bool{}
+	for _, q := range renamed {
+		targets[q] = true
+	}
+	created := map[string]bool{}
+	for _, rel := range sortedPaths(to) {
+		if f, ok := from[rel]; ok && f.Inode == to[rel].Inode || targets[rel] {
+			continue
+		}
+		created[rel] = true
+		if !created[parentOf(rel)] {
+			diff = append(diff, api.DiffReportEntry{SourcePath: relPath(rel), Type: api.DiffCreate})
+			touched[parentOf(rel)] = true
+		}
+	}
+
+	for rel, t := range to {
+		if f, ok := from[rel]; ok && f.Inode == t.Inode && (touched[rel] || modified(f, t)) {
+			diff = append(diff, api.DiffReportEntry{SourcePath: relPath(rel), Type: api.DiffModify})
+		}
+	}
+	sort.SliceStable(diff, func(i, j int) bool { return diff[i].SourcePath < diff[j].SourcePath })
+	return diff
+}
+
+// sortedPaths returns the paths of the tree, the directories first.
+func sortedPaths(tree map[string]*fs.File) []string {
+	paths := make([]string, 0, len(tree))
+	for rel := range tree {
+		paths = append(paths, rel)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// modified returns true if the file f changed since it was o.
+func modified(o, f *fs.File) bool {
+	return !o.Mtime.Equal(f.Mtime) || !o.Ctime.Equal(f.Ctime) || o.Size != f.Size || o.Mode != f.Mode ||
+		o.Uid != f.Uid || o.Gid != f.Gid || o.Target != f.Target ||
+		!o.IsDirectory() && o.ObjectKey() != f.ObjectKey()
+}
+
+// parentOf returns the relative path of the directory of the file rel.
+func parentOf(rel string) string {
+	if dir := path.Dir(rel); dir != "/" && dir != "." {
+		return dir
+	}
+	return ""
+}
+
+// relPath returns the path reported for the file rel, without its leading
+// slash as in HDFS.
+func relPath(rel string) string {
+	return strings.TrimPrefix(rel, "/")
+}
+
+// snapshotDir returns the snapshottable directory at full path.
+func (m *Master) snapshotDir(ns *fs.Namespace, full string) (*fs.File, error) {
+	dir, rel, err := cache.SnapshotRoot(m.Cache, ns.ID, full)
+	if err != nil {
+		return nil, err
+	}
+	if dir == nil || rel != "" {
+		return nil, errors.BadParameter("directory %s is not snapshottable", full)
+	}
+	return dir, nil
+}
+
+// child returns the entry name of the directory dir. The snapshots of a
+// snapshottable directory are browsed in its SnapshotDir entry, which is
+// not listed.
+func (m *Master) child(ns *fs.Namespace, dir *fs.File, name string) (*fs.File, error) {
+	full := path.Join(dir.FullPath(), name)
+	d, snapshot, rel, ok := fs.SplitSnapshotPath(full)
+	if !ok {
+		return m.Cache.Get(ns.ID, full)
+	}
+	sd, err := m.snapshotDir(ns, d)
+	if err != nil {
+		return nil, errors.NotFound("no such file or directory: %s", full)
+	}
+	if snapshot == "" {
+		// the snapshots are read-only
+		f := &fs.File{Parent: sd, Path: fs.SnapshotDir, Directory: true, Attr: sd.Attr}
+		f.Mode &^= 0222
+		return f, nil
+	}
+	i := sd.FindSnapshot(snapshot)
+	if i < 0 {
+		return nil, errors.NotFound("no such snapshot %s of %s", snapshot, d)
+	}
+	return cache.SnapshotFile(m.Cache, ns.ID, sd, sd.Snapshots[i], rel, dir)
+}
+
+// get returns the file at full path, which may be browsed in a snapshot.
+func (m *Master) get(ns *fs.Namespace, full string) (*fs.File, error) {
+	if _, _, _, ok := fs.SplitSnapshotPath(full); !ok {
+		return m.lookup(ns, full)
+	}
+	dir, err := m.get(ns, path.Dir(full))
+	if err != nil {
+		return nil, err
+	}
+	return m.child(ns, dir, path.Base(full))
+}
+
+// children returns the entries of the directory f, which may be browsed in
+// a snapshot, sorted by name.
+func (m *Master) children(ns *fs.Namespace, f *fs.File) ([]*fs.File, error) {
+	d, snapshot, rel, ok := fs.SplitSnapshotPath(f.FullPath())
+	if !ok {
+		return m.Cache.List(ns.ID, f.FullPath())
+	}
+	sd, err := m.snapshotDir(ns, d)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot == "" {
+		list := make([]*fs.File, 0, len(sd.Snapshots))
+		for _, s := range sd.Snapshots {
+			root, err := cache.SnapshotFile(m.Cache, ns.ID, sd, s, "", f)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, root)
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].Path < list[j].Path })
+		return list, nil
+	}
+	i := sd.FindSnapshot(snapshot)
+	if i < 0 {
+		return nil, errors.NotFound("no such snapshot %s of %s", snapshot, d)
+	}
+	return cache.SnapshotList(m.Cache, ns.ID, sd, sd.Snapshots[i], rel, f)
+}
+
+// childrenAfter returns at most limit entries of the directory f whose
+// names sort after the name after, and the number of entries left after them.
+func (m *Master) childrenAfter(ns *fs.Namespace, f *fs.File, after string, limit int) ([]*fs.File, int, error) {
+	if _, _, _, ok := fs.SplitSnapshotPath(f.FullPath()); !ok {
+		return m.Cache.ListAfter(ns.ID, f.FullPath(), after, limit)
+	}
+	list, err := m.children(ns, f)
+	if err != nil {
+		return nil, 0, err
+	}
+	i := sort.Search(len(list), func(i int) bool { return list[i].Path > after })
+	list = list[i:]
+	if len(list) > limit {
+		return list[:limit], len(list) - limit, nil
+	}
+	return list, 0, nil
+}
+
+// release removes the data objects keys, unless the snapshots refer to
+// them, or the current files if live is set.
+func (m *Master) release(ns *fs.Namespace, keys []string, live bool) {
+	if len(keys) == 0 {
+		return
+	}
+	refs, err := m.objectRefs(ns, live)
+	if err != nil {
+		log.Warnf("Failed to find the objects of namespace %s in use, keeping %d objects: %v", ns.ID, len(keys), err)
+		return
+	}
+	for _, key := range keys {
+		if !refs[key] {
+			m.removeObject(ns, key)
+		}
+	}
+}
+
+// objectRefs returns the keys of the data objects the snapshots of the
+// namespace refer to, and the current files too if live is set.
+func (m *Master) objectRefs(ns *fs.Namespace, live bool) (map[string]bool, error) {
+	refs := map[string]bool{}
+	root, err := m.lookup(ns, ns.Root().FullPath())
+	if err != nil {
+		return nil, err
+	}
+	if live {
+		if err = m.collectObjects(ns, root, refs); err != nil {
+			return nil, err
+		}
+	}
+	for _, full := range root.SnapshotDirs {
+		dir, err := m.lookup(ns, full)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range dir.Snapshots {
+			f, err := m.Cache.Get(ns.ID, fs.SnapshotKey(full, s.ID, ""))
+			if errors.IsNotFound(err) {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			if err = m.collectObjects(ns, f, refs); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return refs, nil
+}
+
+// collectObjects adds the object keys of the files of the tree of f and of
+// their versions to refs.
+func (m *Master) collectObjects(ns *fs.Namespace, f *fs.File, refs map[string]bool) error {
+	if !f.IsDirectory() {
+		if !f.IsSymlink() && !f.IsLink() && !f.Absent {
+			for _, key := range f.DataKeys() {
+				refs[key] = true
+			}
+		}
+		return nil
+	}
+	children, err := m.Cache.List(ns.ID, f.FullPath())
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		if err = m.collectObjects(ns, child, refs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package master
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gostor/gofs/pkg/fs"
+)
+
+func TestDiffTrees(t *testing.T) {
+	now := time.Now()
+	file := func(ino uint64, dir bool, object string) *fs.File {
+		return &fs.File{Directory: dir, Object: object, Attr: fs.Attr{Inode: ino, Mtime: now}}
+	}
+	from := map[string]*fs.File{
+		"":       file(1, true, ""),
+		"/a":     file(2, true, ""),
+		"/a/f":   file(3, false, "o1"),
+		"/a/g":   file(4, false, "o2"),
+		"/old":   file(5, true, ""),
+		"/old/x": file(6, false, "o3"),
+	}
+	to := map[string]*fs.File{
+		"":       file(1, true, ""),
+		"/b":     file(2, true, ""),
+		"/b/f":   file(3, false, "o4"),
+		"/b/g":   file(4, false, "o2"),
+		"/new":   file(7, true, ""),
+		"/new/y": file(8, false, "o5"),
+	}
+	diff := diffTrees(from, to)
+	if s := fmt.Sprint(diff); s != "[{  MODIFY} {a b RENAME} {a/f  MODIFY} {new  CREATE} {old  DELETE}]" {
+		t.Fatalf("unexpected diff: %s", s)
+	}
+}
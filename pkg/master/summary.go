@@ -0,0 +1,102 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package master
+
+import (
+	"context"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/cache"
+	"github.com/gostor/gofs/pkg/errors"
+	"github.com/gostor/gofs/pkg/fs"
+	"github.com/gostor/gofs/pkg/raft"
+)
+
+// summary returns the summary of the tree of f, which the directories keep
+// up to date. The tree is only walked for the files and the directories
+// which have none.
+func (m *Master) summary(ns *fs.Namespace, f *fs.File) (fs.Summary, error) {
+	if f.Summary != nil {
+		return *f.Summary, nil
+	}
+	return cache.Summarize(m.Cache, ns.ID, f)
+}
+
+// contentSummary returns the content summary of f, with its quota.
+func (m *Master) contentSummary(ns *fs.Namespace, f *fs.File) (*api.ContentSummaryResponse, error) {
+	s, err := m.summary(ns, f)
+	if err != nil {
+		return nil, err
+	}
+	cs := api.ContentSummary{
+		DirectoryCount: s.Directories,
+		FileCount:      s.Files,
+		Length:         s.Length,
+		Quota:          fs.QuotaReset,
+		SpaceConsumed:  s.Length,
+		SpaceQuota:     fs.QuotaReset,
+	}
+	if q := f.Quota; q != nil {
+		cs.Quota, cs.SpaceQuota = q.Names, q.Space
+	}
+	return &api.ContentSummaryResponse{ContentSummary: cs}, nil
+}
+
+func (m *Master) getContentSummary(ctx context.Context, p string) (interface{}, error) {
+	ns, full, err := m.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	f, err := m.access(caller(ctx), ns, full, 0)
+	if err != nil {
+		return nil, err
+	}
+	return m.contentSummary(ns, f)
+}
+
+// repairContentSummary recomputes the summaries of the directory tree p, in
+// case they no longer match its content, and returns its content summary.
+// Only the admins may, since it walks the whole tree.
+func (m *Master) repairContentSummary(ctx context.Context, p string) (interface{}, error) {
+	if err := checkAdmin(ctx, "repair the content summaries"); err != nil {
+		return nil, err
+	}
+	ns, full, err := m.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	f, err := m.access(caller(ctx), ns, full, 0)
+	if err != nil {
+		return nil, err
+	}
+	if !f.IsDirectory() {
+		return nil, errors.NotDirectory("not a directory: %s", full)
+	}
+	o := raft.NewOperation(api.OpsRepairContentSummary, ns.ID, f.FullPath(), "", nil, time.Now())
+	if _, err = m.RaftServer.Do(o); err != nil {
+		return nil, err
+	}
+	repaired, err := m.lookup(ns, f.FullPath())
+	if err != nil {
+		return nil, err
+	}
+	if old, s := f.Summary, repaired.Summary; old == nil || s != nil && *old != *s {
+		log.Infof("Repaired the content summary of %s: %+v, was %+v", repaired.FullPath(), s, old)
+	}
+	return m.contentSummary(ns, repaired)
+}
@@ -0,0 +1,189 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package master
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/errors"
+	"github.com/gostor/gofs/pkg/fs"
+	"github.com/gostor/gofs/pkg/raft"
+)
+
+// trashCheckInterval is the interval between the checks of the trash.
+const trashCheckInterval = time.Minute
+
+// getTrashRoot returns the trash root of the caller in the namespace of p.
+func (m *Master) getTrashRoot(ctx context.Context, p string) (interface{}, error) {
+	ns, _, err := m.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	return &api.PathResponse{Path: ns.TrashRoot(caller(ctx).Uid)}, nil
+}
+
+// moveToTrash moves the file f, deleted by c, to the trash root of c at the
+// same path below its Current directory. The paths of the files deleted
+// earlier are kept, and f then takes a name suffixed with the time.
+func (m *Master) moveToTrash(c *fs.Caller, ns *fs.Namespace, f *fs.File, recursive bool) error {
+	if f.IsDirectory() && !recursive {
+		children, err := m.Cache.List(ns.ID, f.FullPath())
+		if err != nil {
+			return err
+		}
+		if len(children) > 0 {
+			return errors.NotEmpty("directory %s is not empty", f.FullPath())
+		}
+	}
+	// as in HDFS, the suffix is the time in milliseconds
+	suffix := time.Now().UnixNano() / int64(time.Millisecond)
+	dst := ns.TrashPath(c.Uid, f.FullPath())
+	dir := path.Dir(dst)
+	err := m.makeTrash(c, ns, dir)
+	if errors.IsNotDirectory(err) {
+		// a file deleted earlier has the path of one of the parents
+		dir = fmt.Sprintf("%s%d", dir, suffix)
+		dst = path.Join(dir, path.Base(dst))
+		err = m.makeTrash(c, ns, dir)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err = m.Cache.Get(ns.ID, dst); err == nil {
+		dst = fmt.Sprintf("%s%d", dst, suffix)
+	}
+	if err = m.move(ns, f, dst, false); err != nil {
+		return err
+	}
+	log.Debugf("Moved %s to the trash at %s", f.FullPath(), dst)
+	return nil
+}
+
+// makeTrash creates the directory dir in the trash root of c, and the trash
+// directory of the namespace, which everybody may write as /tmp.
+func (m *Master) makeTrash(c *fs.Caller, ns *fs.Namespace, dir string) error {
+	if f, err := m.Cache.Get(ns.ID, dir); err == nil {
+		if !f.IsDirectory() {
+			return errors.NotDirectory("not a directory: %s", dir)
+		}
+		return nil
+	}
+	trash := path.Join(ns.Root().FullPath(), fs.TrashDir)
+	if _, err := m.Cache.Get(ns.ID, trash); errors.IsNotFound(err) {
+		op := raft.NewOperation(api.OpsDirCreate, ns.ID, trash, "", &fs.Attr{Mode: 0777 | os.ModeSticky}, time.Now())
+		if _, err = m.RaftServer.Do(op); err != nil {
+			return err
+		}
+	}
+	op := raft.NewOperation(api.OpsDirCreate, ns.ID, dir, "", &fs.Attr{Mode: 0700, Uid: c.Uid, Gid: c.Gid()}, time.Now())
+	_, err := m.RaftServer.Do(op)
+	return err
+}
+
+// expungeLoop checkpoints and expunges the trash of the namespaces. Only the
+// raft leader does, the others would repeat its operations.
+func (m *Master) expungeLoop() {
+	for now := range time.Tick(trashCheckInterval) {
+		if !m.IsLeader() {
+			continue
+		}
+		list, err := m.Cache.ListNamespaces()
+		if err != nil {
+			log.Warnf("Failed to list the namespaces to expunge their trash: %v", err)
+			continue
+		}
+		for _, n := range list {
+			if n.TrashInterval <= 0 {
+				continue
+			}
+			ns, err := m.namespace(n.ID)
+			if err == nil {
+				err = m.expungeTrash(ns, now)
+			}
+			if err != nil {
+				log.Warnf("Failed to expunge the trash of namespace %s: %v", n.ID, err)
+			}
+		}
+	}
+}
+
+// expungeTrash removes the checkpoints of the trash roots of ns older than
+// its trash interval along with the data of their files, and checkpoints
+// their Current directory once their newest checkpoint is as old. The files
+// deleted are so kept between one and two intervals.
+func (m *Master) expungeTrash(ns *fs.Namespace, now time.Time) error {
+	interval := ns.TrashRetention()
+	roots, err := m.Cache.List(ns.ID, path.Join(ns.Root().FullPath(), fs.TrashDir))
+	if err != nil {
+		return err
+	}
+	for _, root := range roots {
+		entries, err := m.Cache.List(ns.ID, root.FullPath())
+		if err != nil {
+			return err
+		}
+		var current *fs.File
+		var newest time.Time
+		for _, f := range entries {
+			if f.Path == fs.TrashCurrent {
+				current = f
+				continue
+			}
+			t, err := time.Parse(fs.TrashCheckpointFormat, f.Path)
+			if err != nil {
+				// not a checkpoint
+				continue
+			}
+			if now.Sub(t) < interval {
+				if t.After(newest) {
+					newest = t
+				}
+				continue
+			}
+			if err = m.expunge(ns, f); err != nil {
+				return err
+			}
+		}
+		if current != nil && now.Sub(newest) >= interval {
+			checkpoint := path.Join(root.FullPath(), now.UTC().Format(fs.TrashCheckpointFormat))
+			if err = m.move(ns, current, checkpoint, false); err != nil {
+				return err
+			}
+			log.Infof("Created the trash checkpoint %s", checkpoint)
+		}
+	}
+	return nil
+}
+
+// expunge removes the checkpoint f of the trash and the data of its files.
+func (m *Master) expunge(ns *fs.Namespace, f *fs.File) error {
+	op := raft.NewOperation(api.OpsDelete, ns.ID, f.FullPath(), "", nil, time.Now())
+	op.Recursive = true
+	ret, err := m.RaftServer.Do(op)
+	if err != nil {
+		return err
+	}
+	removed, _ := ret.([]*fs.File)
+	m.removeData(ns, removed)
+	log.Infof("Expunged the trash checkpoint %s", f.FullPath())
+	return nil
+}
@@ -0,0 +1,106 @@
+package master
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/errors"
+	"github.com/gostor/gofs/pkg/fs"
+	"github.com/gostor/gofs/pkg/raft"
+)
+
+func TestExpungeTrash(t *testing.T) {
+	m, _ := newTestMaster(t)
+	m.RaftServer = raft.NewLocalServer(m.Name, m.Cache)
+	stor := newMemStorage()
+	ns := fs.NewNamespace("ns", &api.Config{TrashInterval: 60}, stor)
+	m.Namespaces[ns.ID] = ns
+
+	// the clock of the test
+	now := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+	root, err := m.lookup(ns, ns.Root().FullPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	add := func(parent *fs.File, name string, dir bool, object string) *fs.File {
+		f := &fs.File{Parent: parent, Path: name, Directory: dir, Object: object, Attr: fs.Attr{Mode: 0644, Uid: 1000, Gid: 1000}}
+		if dir {
+			f.Mode = os.ModeDir | 0700
+		}
+		if object != "" {
+			stor.add(object, object, now)
+		}
+		if err := m.Cache.Add(ns.ID, f); err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	checkpoint := func(t time.Time) string {
+		return t.UTC().Format(fs.TrashCheckpointFormat)
+	}
+	trash := add(add(root, fs.TrashDir, true, ""), "1000", true, "")
+	add(add(trash, fs.TrashCurrent, true, ""), "f", false, "k1")
+	old := checkpoint(now.Add(-2 * time.Hour))
+	add(add(trash, old, true, ""), "f", false, "k2")
+	young := checkpoint(now.Add(-30 * time.Minute))
+	add(add(trash, young, true, ""), "f", false, "k3")
+
+	entries := func() []string {
+		list, err := m.Cache.List(ns.ID, trash.FullPath())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, f := range list {
+			names = append(names, f.Path)
+		}
+		return names
+	}
+
+	// the checkpoint older than the interval is expunged, and Current is
+	// kept since the newest checkpoint is younger
+	if err = m.expungeTrash(ns, now); err != nil {
+		t.Fatal(err)
+	}
+	if names := entries(); !reflect.DeepEqual(names, []string{young, fs.TrashCurrent}) {
+		t.Fatalf("unexpected trash entries %v", names)
+	}
+	if keys := stor.keys(); !reflect.DeepEqual(keys, []string{"k1", "k3"}) {
+		t.Fatalf("unexpected objects %v", keys)
+	}
+
+	// once the newest checkpoint is expunged too, Current is checkpointed
+	later := now.Add(31 * time.Minute)
+	if err = m.expungeTrash(ns, later); err != nil {
+		t.Fatal(err)
+	}
+	if names := entries(); !reflect.DeepEqual(names, []string{checkpoint(later)}) {
+		t.Fatalf("unexpected trash entries %v", names)
+	}
+	if keys := stor.keys(); !reflect.DeepEqual(keys, []string{"k1"}) {
+		t.Fatalf("unexpected objects %v", keys)
+	}
+	f, err := m.Cache.Get(ns.ID, path.Join(trash.FullPath(), checkpoint(later), "f"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Object != "k1" {
+		t.Fatalf("unexpected object %q of the checkpointed file", f.Object)
+	}
+	if _, err = m.Cache.Get(ns.ID, path.Join(trash.FullPath(), fs.TrashCurrent)); !errors.IsNotFound(err) {
+		t.Fatalf("expected Current to be moved, got %v", err)
+	}
+
+	// a checkpoint is only made once per interval
+	add(add(trash, fs.TrashCurrent, true, ""), "g", false, "k4")
+	if err = m.expungeTrash(ns, later.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if names := entries(); !reflect.DeepEqual(names, []string{checkpoint(later), fs.TrashCurrent}) {
+		t.Fatalf("unexpected trash entries %v", names)
+	}
+}
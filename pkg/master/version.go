@@ -0,0 +1,242 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package master
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/errors"
+	"github.com/gostor/gofs/pkg/fs"
+	"github.com/gostor/gofs/pkg/raft"
+)
+
+// versionCheckInterval is the interval between the prunings of the versions
+// older than the maximum age of their policy.
+const versionCheckInterval = 10 * time.Minute
+
+// listVersions returns the versions of the file p, oldest first.
+func (m *Master) listVersions(ctx context.Context, p string) (interface{}, error) {
+	ns, full, err := m.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	f, err := m.access(caller(ctx), ns, full, fs.MayRead)
+	if err != nil {
+		return nil, err
+	}
+	if f.IsDirectory() {
+		return nil, errors.IsDirectory("%s is a directory", full)
+	}
+	list := make([]api.FileVersion, 0, len(f.Versions))
+	for _, v := range f.Versions {
+		list = append(list, v.FileVersion())
+	}
+	return &api.FileVersionsResponse{FileVersions: api.FileVersions{FileVersion: list}}, nil
+}
+
+// setVersioning sets the versioning policy of the directory p. versioning
+// is true or false to enable or disable it, which the directories of its
+// tree inherit, or inherit to clear it. Only the owner of the directory and
+// the superuser may.
+func (m *Master) setVersioning(ctx context.Context, p string, form url.Values) (interface{}, error) {
+	ns, full, err := m.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	c := caller(ctx)
+	f, err := m.access(c, ns, full, 0)
+	if err != nil {
+		return nil, err
+	}
+	if !f.IsDirectory() {
+		return nil, errors.NotDirectory("cannot set the versioning of %s, which is not a directory", full)
+	}
+	if !c.IsRoot() && c.Uid != f.Uid {
+		return nil, errors.PermissionDenied("permission denied: only the owner of %s may set its versioning", full)
+	}
+	o := raft.NewOperation(api.OpsSetVersioning, ns.ID, f.FullPath(), "", nil, time.Now())
+	switch s := strings.ToLower(form.Get("versioning")); s {
+	case "true", "false":
+		maxVersions, err := limitValue(form, "maxversions")
+		if err != nil {
+			return nil, err
+		}
+		maxAge, err := limitValue(form, "maxage")
+		if err != nil {
+			return nil, err
+		}
+		o.Versioning = &fs.Versioning{Enabled: s == "true", MaxVersions: int(maxVersions), MaxAge: maxAge}
+	case "inherit":
+	default:
+		return nil, errors.BadParameter("invalid versioning %q: it must be true, false or inherit", form.Get("versioning"))
+	}
+	if _, err = m.RaftServer.Do(o); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// limitValue parses the form value k, a limit which is 0 if it is missing
+// or unlimited.
+func limitValue(form url.Values, k string) (int64, error) {
+	s := form.Get(k)
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(s, 10, 32)
+	if err != nil || n < 0 {
+		return 0, errors.BadParameter("invalid %s %q", k, s)
+	}
+	return n, nil
+}
+
+// restoreVersion makes the version of the file p its content again. The
+// data of the segments of the version is copied to new objects, which the
+// file takes, so that the version keeps its own.
+func (m *Master) restoreVersion(ctx context.Context, p string, form url.Values) (interface{}, error) {
+	ns, full, err := m.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.ParseInt(form.Get("version"), 10, 64)
+	if err != nil {
+		return nil, errors.BadParameter("invalid version %q", form.Get("version"))
+	}
+	f, err := m.access(caller(ctx), ns, full, fs.MayWrite)
+	if err != nil {
+		return nil, err
+	}
+	if f.IsDirectory() {
+		return nil, errors.IsDirectory("%s is a directory", full)
+	}
+	i := f.FindVersion(n)
+	if i < 0 {
+		return nil, errors.NotFound("no such version %d of %s", n, full)
+	}
+	o := raft.NewOperation(api.OpsRestoreVersion, ns.ID, f.FullPath(), "", nil, time.Now())
+	o.Version = n
+	var copies []string
+	for _, s := range f.Versions[i].Pieces() {
+		key, err := m.copyObject(ns, s.Object)
+		if err != nil {
+			for _, key := range copies {
+				m.removeObject(ns, key)
+			}
+			return nil, err
+		}
+		copies = append(copies, key)
+		o.Segments = append(o.Segments, fs.Segment{Object: key, Size: s.Size})
+	}
+	// the first segment is the object of the file
+	o.Object, o.Segments = o.Segments[0].Object, o.Segments[1:]
+	ret, err := m.RaftServer.Do(o)
+	if err != nil {
+		for _, key := range copies {
+			m.removeObject(ns, key)
+		}
+		return nil, err
+	}
+	m.releaseReplaced(ns, f, ret)
+	return nil, nil
+}
+
+// releaseReplaced removes the data objects of the regular file old which
+// the raft operation changing it returned the file ret without, such as
+// the versions it pruned.
+func (m *Master) releaseReplaced(ns *fs.Namespace, old *fs.File, ret interface{}) {
+	f, ok := ret.(*fs.File)
+	if !ok {
+		return
+	}
+	kept := map[string]bool{}
+	for _, key := range f.DataKeys() {
+		kept[key] = true
+	}
+	var keys []string
+	for _, key := range old.DataKeys() {
+		if !kept[key] {
+			keys = append(keys, key)
+		}
+	}
+	m.release(ns, keys, false)
+}
+
+// pruneLoop prunes the versions of the files of the namespaces which their
+// policy no longer keeps, since they are older than its maximum age. The
+// versions beyond the maximum number are pruned as the files are
+// overwritten. Only the raft leader prunes, the others would repeat its
+// operations.
+func (m *Master) pruneLoop() {
+	for now := range time.Tick(versionCheckInterval) {
+		if !m.IsLeader() {
+			continue
+		}
+		list, err := m.Cache.ListNamespaces()
+		if err != nil {
+			log.Warnf("Failed to list the namespaces to prune their versions: %v", err)
+			continue
+		}
+		for _, n := range list {
+			ns, err := m.namespace(n.ID)
+			if err == nil {
+				var root *fs.File
+				if root, err = m.lookup(ns, ns.Root().FullPath()); err == nil {
+					err = m.pruneTree(ns, root, nil, now)
+				}
+			}
+			if err != nil {
+				log.Warnf("Failed to prune the versions of namespace %s: %v", n.ID, err)
+			}
+		}
+	}
+}
+
+// pruneTree prunes the versions of the files of the tree of the directory
+// dir, whose parent has the versioning policy v, which the policy of dir
+// keeps no longer at now.
+func (m *Master) pruneTree(ns *fs.Namespace, dir *fs.File, v *fs.Versioning, now time.Time) error {
+	if dir.Versioning != nil {
+		v = fs.VersioningOf([]*fs.File{dir})
+	}
+	children, err := m.Cache.List(ns.ID, dir.FullPath())
+	if err != nil {
+		return err
+	}
+	for _, f := range children {
+		if f.IsDirectory() {
+			if err = m.pruneTree(ns, f, v, now); err != nil {
+				return err
+			}
+			continue
+		}
+		pruned := *f
+		if v == nil || len(pruned.PruneVersions(v, now)) == 0 {
+			continue
+		}
+		ret, err := m.RaftServer.Do(raft.NewOperation(api.OpsPruneVersions, ns.ID, f.FullPath(), "", nil, now))
+		if err != nil {
+			return err
+		}
+		m.releaseReplaced(ns, f, ret)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package master
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/errors"
+	"github.com/gostor/gofs/pkg/fs"
+	"github.com/gostor/gofs/pkg/raft"
+)
+
+// getXAttrs returns the attributes of p named by the xattr.name parameters,
+// or all those the caller may read.
+func (m *Master) getXAttrs(ctx context.Context, p string, form url.Values) (interface{}, error) {
+	ns, full, err := m.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	c := caller(ctx)
+	f, err := m.access(c, ns, full, 0)
+	if err != nil {
+		return nil, err
+	}
+	names := form["xattr.name"]
+	if len(names) == 0 {
+		names = readableXattrs(c, f)
+	}
+	encoding := form.Get("encoding")
+	xattrs := []api.XAttr{}
+	for _, name := range names {
+		if err = f.CheckXattr(c, name, fs.MayRead); err != nil {
+			return nil, err
+		}
+		var resp api.GetxattrResponse
+		if err = f.Getxattr(ctx, &api.GetxattrRequest{Name: name}, &resp); err != nil {
+			return nil, err
+		}
+		v, err := api.EncodeXAttrValue(resp.Xattr, encoding)
+		if err != nil {
+			return nil, errors.BadParameter("%v", err)
+		}
+		xattrs = append(xattrs, api.XAttr{Name: name, Value: v})
+	}
+	return &api.XAttrsResponse{XAttrs: xattrs}, nil
+}
+
+func (m *Master) listXAttrs(ctx context.Context, p string) (interface{}, error) {
+	ns, full, err := m.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	c := caller(ctx)
+	f, err := m.access(c, ns, full, 0)
+	if err != nil {
+		return nil, err
+	}
+	names, err := json.Marshal(readableXattrs(c, f))
+	if err != nil {
+		return nil, err
+	}
+	return &api.XAttrNamesResponse{XAttrNames: string(names)}, nil
+}
+
+// readableXattrs returns the names of the attributes of f which c may read.
+func readableXattrs(c *fs.Caller, f *fs.File) []string {
+	names := []string{}
+	for _, name := range f.XattrNames() {
+		if f.CheckXattr(c, name, fs.MayRead) == nil {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// updateXAttr sets or removes the attribute xattr.name of p.
+func (m *Master) updateXAttr(ctx context.Context, p, op string, form url.Values) (interface{}, error) {
+	ns, full, err := m.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	req := &api.SetxattrRequest{Name: form.Get("xattr.name")}
+	if op == api.OpsSetXAttr {
+		if req.Xattr, err = api.DecodeXAttrValue(form.Get("xattr.value")); err != nil {
+			return nil, errors.BadParameter("invalid xattr.value: %v", err)
+		}
+		if req.Flags, err = xattrFlags(form.Get("flag")); err != nil {
+			return nil, err
+		}
+	}
+	c := caller(ctx)
+	f, err := m.access(c, ns, full, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err = f.CheckXattr(c, req.Name, fs.MayWrite); err != nil {
+		return nil, err
+	}
+	// check the attribute before replicating the operation
+	if op == api.OpsSetXAttr {
+		err = f.Setxattr(ctx, req)
+	} else {
+		err = f.Removexattr(ctx, &api.RemovexattrRequest{Name: req.Name})
+	}
+	if err != nil {
+		return nil, err
+	}
+	o := raft.NewOperation(op, ns.ID, full, "", nil, time.Now())
+	o.Xattr = req
+	if _, err = m.RaftServer.Do(o); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// xattrFlags parses the flag parameter of SETXATTR, a comma separated list
+// of CREATE and REPLACE. The attribute may either exist or not if both or
+// none are set.
+func xattrFlags(s string) (uint32, error) {
+	var create, replace bool
+	for _, flag := range strings.Split(s, ",") {
+		switch strings.ToUpper(strings.TrimSpace(flag)) {
+		case api.XAttrFlagCreate:
+			create = true
+		case api.XAttrFlagReplace:
+			replace = true
+		case "":
+		default:
+			return 0, errors.BadParameter("invalid flag %q", flag)
+		}
+	}
+	switch {
+	case create && !replace:
+		return api.XattrCreate, nil
+	case replace && !create:
+		return api.XattrReplace, nil
+	}
+	return 0, nil
+}
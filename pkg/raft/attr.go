@@ -0,0 +1,71 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package raft
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/cache"
+	"github.com/gostor/gofs/pkg/errors"
+	"github.com/gostor/gofs/pkg/fs"
+)
+
+// setattr sets the attributes of FileAttr which Valid selects on the file
+// Filename, and its Ctime to CreatedAt. A new mode only replaces the
+// permission bits and the sticky bit, and a new size is charged to the
+// summaries of the ancestors of the file.
+func (o *Operation) setattr(c cache.Cache) (interface{}, error) {
+	f, err := o.lookup(c, o.Filename)
+	if err != nil {
+		return nil, err
+	}
+	if o.FileAttr == nil {
+		return nil, errors.BadParameter("missing attributes")
+	}
+	a := o.FileAttr
+	const perm = os.ModePerm | os.ModeSticky
+	req := &api.SetattrRequest{
+		Valid:   o.Valid | api.SetattrChgtime,
+		Size:    a.Size,
+		Atime:   a.Atime,
+		Mtime:   a.Mtime,
+		Mode:    f.Mode&^perm | a.Mode&perm,
+		Uid:     a.Uid,
+		Gid:     a.Gid,
+		Chgtime: o.CreatedAt,
+		Crtime:  a.Crtime,
+		Flags:   a.Flags,
+	}
+	if req.Valid.Size() {
+		if f.IsDirectory() || f.IsSymlink() || f.IsLink() {
+			return nil, errors.BadParameter("cannot set the size of %s, which is not a regular file", o.Filename)
+		}
+		d := fs.Summary{Length: int64(a.Size) - f.SpaceConsumed()}
+		if err = o.charge(c, filepath.Dir(f.FullPath()), d, true); err != nil {
+			return nil, err
+		}
+	}
+	if err = f.Setattr(context.Background(), req); err != nil {
+		return nil, err
+	}
+	if _, err = c.Update(o.Namespace, f.FullPath(), f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
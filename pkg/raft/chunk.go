@@ -0,0 +1,117 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package raft
+
+import (
+	"path/filepath"
+
+	"github.com/gostor/gofs/pkg/cache"
+	"github.com/gostor/gofs/pkg/errors"
+	"github.com/gostor/gofs/pkg/fs"
+)
+
+// uploadChunk records the chunk of Chunks, uploaded by the user FileAttr.Uid
+// for the file Filename, in the directory of the file. The chunks of the
+// directory recorded more than Retention ago are dropped, their objects
+// being left to the garbage collection.
+func (o *Operation) uploadChunk(c cache.Cache) (interface{}, error) {
+	if len(o.Chunks) != 1 {
+		return nil, errors.BadParameter("%d chunks of %s uploaded at once", len(o.Chunks), o.Filename)
+	}
+	dir, err := o.lookupParent(c, o.Filename)
+	if err != nil {
+		return nil, err
+	}
+	chunk := o.Chunks[0]
+	chunk.Name = filepath.Base(o.Filename)
+	chunk.Uid = o.FileAttr.Uid
+	chunk.Uploaded = o.CreatedAt
+	chunks := make([]fs.Chunk, 0, len(dir.Chunks)+1)
+	for _, ch := range dir.Chunks {
+		if o.Retention > 0 && o.CreatedAt.Sub(ch.Uploaded) > o.Retention {
+			continue
+		}
+		chunks = append(chunks, ch)
+	}
+	dir.Chunks = append(chunks, chunk)
+	if _, err = c.Update(o.Namespace, dir.FullPath(), dir); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// commitChunks creates the file Filename of Chunks, in order, like CREATE.
+// They must be recorded in the directory of the file by UPLOADCHUNK, for the
+// file and by the user FileAttr.Uid, with the same size and MD5. They are
+// dropped from the directory along the way, so that the chunks committed
+// twice at once only create one file.
+func (o *Operation) commitChunks(c cache.Cache) (interface{}, error) {
+	if len(o.Chunks) == 0 {
+		return nil, errors.BadParameter("no chunks to create %s of", o.Filename)
+	}
+	var ret interface{}
+	err := c.Batch(func(c cache.Cache) error {
+		dir, err := o.lookupParent(c, o.Filename)
+		if err != nil {
+			return err
+		}
+		name := filepath.Base(o.Filename)
+		uploaded := map[string]fs.Chunk{}
+		for _, ch := range dir.Chunks {
+			if ch.Name == name && ch.Uid == o.FileAttr.Uid {
+				uploaded[ch.Object] = ch
+			}
+		}
+		var size int64
+		for i, ch := range o.Chunks {
+			u, ok := uploaded[ch.Object]
+			if !ok || u.Size != ch.Size || u.MD5 != ch.MD5 {
+				return errors.BadParameter("chunk %d of %s is not an object uploaded for it", i, o.Filename)
+			}
+			// a chunk listed twice is only found once
+			delete(uploaded, ch.Object)
+			size += ch.Size
+		}
+		var chunks []fs.Chunk
+		for _, ch := range dir.Chunks {
+			if ch.Name != name || ch.Uid != o.FileAttr.Uid {
+				chunks = append(chunks, ch)
+			} else if _, ok := uploaded[ch.Object]; ok {
+				chunks = append(chunks, ch)
+			}
+		}
+		dir.Chunks = chunks
+		if _, err = c.Update(o.Namespace, dir.FullPath(), dir); err != nil {
+			return err
+		}
+
+		create := *o
+		attr := *o.FileAttr
+		attr.Size = uint64(size)
+		create.FileAttr = &attr
+		create.Object = o.Chunks[0].Object
+		create.Segments = nil
+		for _, ch := range o.Chunks[1:] {
+			create.Segments = append(create.Segments, fs.Segment{Object: ch.Object, Size: ch.Size})
+		}
+		ret, err = create.create(c)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package raft
+
+import (
+	"path/filepath"
+
+	"github.com/gostor/gofs/pkg/cache"
+	"github.com/gostor/gofs/pkg/errors"
+)
+
+// repairParent links the entry stored at Filename back to the directory it
+// is stored under, should its parent have been lost or point elsewhere.
+func (o *Operation) repairParent(c cache.Cache) (interface{}, error) {
+	f, err := c.Get(o.Namespace, o.Filename)
+	if errors.IsNotFound(err) {
+		return nil, errors.NotFound("no such file or directory: %s", o.Filename)
+	} else if err != nil {
+		return nil, err
+	}
+	parent, err := o.lookupParent(c, o.Filename)
+	if err != nil {
+		return nil, err
+	}
+	f.Parent = parent
+	f.Path = filepath.Base(o.Filename)
+	if _, err = c.Update(o.Namespace, o.Filename, f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// renumber gives the file Filename a new inode number, which its hard links
+// share, should it have the number of another file.
+func (o *Operation) renumber(c cache.Cache) (interface{}, error) {
+	f, err := o.lookup(c, o.Filename)
+	if err != nil {
+		return nil, err
+	}
+	if f.IsLink() {
+		return nil, errors.BadParameter("cannot renumber the hard link %s, which has the inode number of %s", o.Filename, f.Target)
+	}
+	ino, err := c.NextInode(o.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	f.Inode = ino
+	f.Ctime = o.CreatedAt
+	for _, p := range f.Links {
+		link, err := c.Get(o.Namespace, p)
+		if errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if !link.IsLink() || link.Target != o.Filename {
+			continue
+		}
+		link.Inode = ino
+		if _, err = c.Update(o.Namespace, p, link); err != nil {
+			return nil, err
+		}
+	}
+	if _, err = c.Update(o.Namespace, o.Filename, f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package raft
+
+import (
+	"sync"
+
+	"github.com/goraft/raft"
+	"github.com/gostor/gofs/pkg/cache"
+)
+
+// localServer is a raft server alone in its cluster, which applies the
+// operations at once to its cache, without a log.
+type localServer struct {
+	raft.Server
+	name  string
+	cache cache.Cache
+	lock  sync.Mutex
+}
+
+// NewLocalServer returns a RaftServer named name which leads a cluster of
+// its own, and applies the operations at once to c. It lets the tests of the
+// masters commit operations without a raft log.
+func NewLocalServer(name string, c cache.Cache) *RaftServer {
+	return &RaftServer{httpAddr: name, raftServer: &localServer{name: name, cache: c}}
+}
+
+func (s *localServer) Name() string {
+	return s.name
+}
+
+func (s *localServer) Leader() string {
+	return s.name
+}
+
+func (s *localServer) Context() interface{} {
+	return s.cache
+}
+
+// Do applies the operation command, one at a time as the raft log does.
+func (s *localServer) Do(command raft.Command) (interface{}, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if o, ok := command.(*Operation); ok {
+		return o.apply(s.cache)
+	}
+	return nil, nil
+}
@@ -16,14 +16,23 @@ limitations under the License.
 package raft
 
 import (
+	"context"
+	"path/filepath"
+	"strings"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/goraft/raft"
+	"github.com/gostor/gofs/pkg/api"
 	"github.com/gostor/gofs/pkg/cache"
+	"github.com/gostor/gofs/pkg/errors"
 	"github.com/gostor/gofs/pkg/fs"
 )
 
+func init() {
+	raft.RegisterCommand(&Operation{})
+}
+
 // This command writes a value to a key.
 type Operation struct {
 	Type      string    `json:"type"`
@@ -32,6 +41,47 @@ type Operation struct {
 	NewName   string    `json:"newname"`
 	FileAttr  *fs.Attr  `json:"attr"`
 	CreatedAt time.Time `json:"createdat"`
+	Overwrite bool      `json:"overwrite"`
+	Recursive bool      `json:"recursive"`
+	// ACL is the aclspec of the ACL operations.
+	ACL []fs.ACLEntry `json:"acl,omitempty"`
+	// Xattr is the attribute set or removed by the xattr operations.
+	Xattr *api.SetxattrRequest `json:"xattr,omitempty"`
+	// Object is the key of the data object of the file created, or the one
+	// a file is moved to before it is linked.
+	Object string `json:"object,omitempty"`
+	// Objects map the paths of the files renamed to the keys of the data
+	// objects they are moved to.
+	Objects map[string]string `json:"objects,omitempty"`
+	// Config is the configuration of the namespace created.
+	Config *api.Config `json:"config,omitempty"`
+	// Quota are the limits set by SETQUOTA.
+	Quota *fs.Quota `json:"quota,omitempty"`
+	// Checksums are the checksums of the content of the file created.
+	Checksums *fs.Checksums `json:"checksums,omitempty"`
+	// Valid selects the attributes of FileAttr set by SETPERMISSION,
+	// SETOWNER and SETTIMES.
+	Valid api.SetattrValid `json:"valid,omitempty"`
+	// Snapshot is the name of the snapshot of the snapshot operations, the
+	// new name of RENAMESNAPSHOT being NewName.
+	Snapshot string `json:"snapshot,omitempty"`
+	// Versioning is the policy set by SETVERSIONING, nil to clear it, and
+	// Version the version restored by RESTOREVERSION.
+	Versioning *fs.Versioning `json:"versioning,omitempty"`
+	Version    int64          `json:"version,omitempty"`
+	// Segments are the segments added to the content of a file: the one
+	// appended by APPEND, the one TRUNCATE rewrites the segment it cuts
+	// into, the one COMPACT merges segments into, the copies of the
+	// segments of the version RESTOREVERSION restores, and the chunks of
+	// the file COMMITCHUNKS creates, but the first one. Replaced are the
+	// keys of the segments TRUNCATE and COMPACT replace.
+	Segments []fs.Segment `json:"segments,omitempty"`
+	Replaced []string     `json:"replaced,omitempty"`
+	// Chunks are the chunk UPLOADCHUNK records, and the chunks the file
+	// COMMITCHUNKS creates is made of, in order. The chunks recorded more
+	// than Retention ago are dropped, unless it is 0.
+	Chunks    []fs.Chunk    `json:"chunks,omitempty"`
+	Retention time.Duration `json:"retention,omitempty"`
 }
 
 // Creates a new operation command.
@@ -55,6 +105,526 @@ func (o *Operation) CommandName() string {
 func (o *Operation) Apply(server raft.Server) (interface{}, error) {
 	log.Debugf("Raft Apply: [Type: %v, Namespace: %v, Filename: %v, Attr: [%#v]]", o.Type, o.Namespace, o.Filename, o.FileAttr)
 	cache := server.Context().(cache.Cache)
-	_ = cache
-	return nil, nil
+	return o.apply(cache)
+}
+
+func (o *Operation) apply(c cache.Cache) (interface{}, error) {
+	switch o.Type {
+	case api.OpsCreateNamespace:
+		return o.createNamespace(c)
+	case api.OpsDeleteNamespace:
+		return o.deleteNamespace(c)
+	case api.OpsAllowSnapshot:
+		return o.allowSnapshot(c)
+	case api.OpsDisallowSnapshot:
+		return o.disallowSnapshot(c)
+	case api.OpsCreateSnapshot:
+		return o.createSnapshot(c)
+	case api.OpsDeleteSnapshot:
+		return o.deleteSnapshot(c)
+	case api.OpsRenameSnapshot:
+		return o.renameSnapshot(c)
+	}
+	// the file operations keep the snapshots of the files they change
+	if err := o.checkSnapshots(c); err != nil {
+		return nil, err
+	}
+	c = &cowCache{Cache: c}
+	switch o.Type {
+	case api.OpsDirCreate:
+		return o.mkdirs(c)
+	case api.OpsFileCreate:
+		return o.create(c)
+	case api.OpsDelete:
+		return o.delete(c)
+	case api.OpsRename:
+		return o.rename(c)
+	case api.OpsSetPermission, api.OpsSetOwner, api.OpsSetTimes:
+		return o.setattr(c)
+	case api.OpsSetACL, api.OpsModifyACLEntries, api.OpsRemoveACLEntries, api.OpsRemoveDefaultACL, api.OpsRemoveACL:
+		return o.updateACL(c)
+	case api.OpsSetXAttr, api.OpsRemoveXAttr:
+		return o.updateXattr(c)
+	case api.OpsCreateSymlink:
+		return o.createSymlink(c)
+	case api.OpsCreateHardLink:
+		return o.createHardLink(c)
+	case api.OpsSetQuota, api.OpsClearQuota:
+		return o.setQuota(c)
+	case api.OpsRepairContentSummary:
+		return o.repairSummary(c)
+	case api.OpsSetVersioning:
+		return o.setVersioning(c)
+	case api.OpsRestoreVersion:
+		return o.restoreVersion(c)
+	case api.OpsPruneVersions:
+		return o.pruneVersions(c)
+	case api.OpsRepairParent:
+		return o.repairParent(c)
+	case api.OpsRenumber:
+		return o.renumber(c)
+	case api.OpsAppend:
+		return o.appendSegment(c)
+	case api.OpsTruncate:
+		return o.truncate(c)
+	case api.OpsCompact:
+		return o.compact(c)
+	case api.OpsUploadChunk:
+		return o.uploadChunk(c)
+	case api.OpsCommitChunks:
+		return o.commitChunks(c)
+	}
+	return nil, errors.BadParameter("unknown operation %q", o.Type)
+}
+
+// createNamespace registers the namespace along with its root directory.
+func (o *Operation) createNamespace(c cache.Cache) (interface{}, error) {
+	if err := fs.CheckNamespaceID(o.Namespace); err != nil {
+		return nil, err
+	}
+	if o.Config == nil {
+		return nil, errors.BadParameter("missing configuration of namespace %s", o.Namespace)
+	}
+	ns := fs.NewNamespace(o.Namespace, o.Config, nil)
+	if err := c.AddNamespace(ns); err != nil {
+		return nil, err
+	}
+	if _, err := o.root(c); err != nil {
+		return nil, err
+	}
+	return ns, nil
+}
+
+// deleteNamespace removes the namespace and its files, which it must not
+// have unless Recursive is set.
+func (o *Operation) deleteNamespace(c cache.Cache) (interface{}, error) {
+	if _, err := c.GetNamespace(o.Namespace); err != nil {
+		return nil, err
+	}
+	if !o.Recursive {
+		children, err := c.List(o.Namespace, fs.Root(o.Namespace).FullPath())
+		if err != nil {
+			return nil, err
+		}
+		if len(children) > 0 {
+			return nil, errors.NotEmpty("namespace %s is not empty", o.Namespace)
+		}
+	}
+	return nil, c.DeleteNamespace(o.Namespace)
+}
+
+// root returns the root directory of the namespace, creating it on first use.
+func (o *Operation) root(c cache.Cache) (*fs.File, error) {
+	root := fs.Root(o.Namespace)
+	if f, err := c.Get(o.Namespace, root.FullPath()); err == nil {
+		return f, nil
+	}
+	if err := o.init(c, root); err != nil {
+		return nil, err
+	}
+	return root, c.Add(o.Namespace, root)
+}
+
+// init assigns the inode number and timestamps of a new file.
+func (o *Operation) init(c cache.Cache, f *fs.File) error {
+	ino, err := c.NextInode(o.Namespace)
+	if err != nil {
+		return err
+	}
+	f.Inode = ino
+	f.Atime = o.CreatedAt
+	f.Mtime = o.CreatedAt
+	f.Ctime = o.CreatedAt
+	f.Crtime = o.CreatedAt
+	return nil
+}
+
+// lookupParent returns the directory that contains name.
+func (o *Operation) lookupParent(c cache.Cache, name string) (*fs.File, error) {
+	root, err := o.root(c)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(name)
+	if dir == root.FullPath() {
+		return root, nil
+	}
+	parent, err := c.Get(o.Namespace, dir)
+	if errors.IsNotFound(err) {
+		return nil, errors.NotFound("no such file or directory: %s", dir)
+	} else if err != nil {
+		return nil, err
+	}
+	if !parent.IsDirectory() {
+		return nil, errors.NotDirectory("not a directory: %s", dir)
+	}
+	return parent, nil
+}
+
+func (o *Operation) mkdirs(c cache.Cache) (interface{}, error) {
+	dir, err := o.root(c)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, name := range strings.Split(strings.TrimPrefix(o.Filename, dir.FullPath()), "/") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	for len(names) > 0 {
+		p := filepath.Join(dir.FullPath(), names[0])
+		f, err := c.Get(o.Namespace, p)
+		if errors.IsNotFound(err) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if !f.IsDirectory() {
+			return nil, errors.NotDirectory("not a directory: %s", p)
+		}
+		dir = f
+		names = names[1:]
+	}
+	if err = o.charge(c, dir.FullPath(), fs.Summary{Directories: int64(len(names))}, true); err != nil {
+		return nil, err
+	}
+	for i, name := range names {
+		sub, err := dir.Mkdir(context.Background(), &api.MkdirRequest{
+			Name: name,
+			Mode: o.FileAttr.Mode,
+			Uid:  o.FileAttr.Uid,
+			Gid:  o.FileAttr.Gid,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err = o.init(c, sub); err != nil {
+			return nil, err
+		}
+		// the tree of sub holds the directories created below it
+		sub.Summary = &fs.Summary{Directories: int64(len(names) - i)}
+		if err = c.Add(o.Namespace, sub); err != nil {
+			return nil, err
+		}
+		dir = sub
+	}
+	return dir, nil
+}
+
+func (o *Operation) create(c cache.Cache) (interface{}, error) {
+	parent, err := o.lookupParent(c, o.Filename)
+	if err != nil {
+		return nil, err
+	}
+	old, err := c.Get(o.Namespace, o.Filename)
+	if err == nil {
+		if old.IsDirectory() {
+			return nil, errors.IsDirectory("%s is a directory", o.Filename)
+		}
+		if !o.Overwrite {
+			return nil, errors.AlreadyExists("%s already exists", o.Filename)
+		}
+	}
+	f, err := parent.Create(context.Background(), &api.CreateRequest{
+		Name: filepath.Base(o.Filename),
+		Mode: o.FileAttr.Mode,
+		Uid:  o.FileAttr.Uid,
+		Gid:  o.FileAttr.Gid,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err = o.init(c, f); err != nil {
+		return nil, err
+	}
+	f.Size = o.FileAttr.Size
+	if o.Checksums != nil {
+		f.SetChecksums(o.Checksums)
+	}
+	d := f.Entry()
+	if old != nil {
+		d = d.Add(old.Entry().Neg())
+	}
+	if err = o.charge(c, parent.FullPath(), d, true); err != nil {
+		return nil, err
+	}
+	if old != nil {
+		// the links of the file refer to its new content
+		f.Inode = old.Inode
+		f.Crtime = old.Crtime
+		f.Nlink = old.Nlink
+		f.Links = old.Links
+		f.Object = old.Object
+	}
+	if o.Object != "" {
+		f.Object = o.Object
+	}
+	// the chunks of a large file follow the first one, stored in Object
+	f.Segments = o.Segments
+	if old != nil {
+		if err = o.keepVersion(c, parent.FullPath(), old, f); err != nil {
+			return nil, err
+		}
+	}
+	if err = c.Add(o.Namespace, f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// delete removes the file or directory tree, and returns the removed entries.
+func (o *Operation) delete(c cache.Cache) (interface{}, error) {
+	removed, err := o.remove(c)
+	if err != nil || len(removed) == 0 {
+		return removed, err
+	}
+	var d fs.Summary
+	for _, f := range removed {
+		d = d.Add(f.Entry().Neg())
+	}
+	if err = o.charge(c, filepath.Dir(o.Filename), d, false); err != nil {
+		return nil, err
+	}
+	return removed, nil
+}
+
+// remove removes the file or directory tree Filename, and returns the removed
+// entries.
+func (o *Operation) remove(c cache.Cache) ([]*fs.File, error) {
+	f, err := c.Get(o.Namespace, o.Filename)
+	if errors.IsNotFound(err) {
+		return []*fs.File{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if f.Parent == nil {
+		return nil, errors.BadParameter("cannot delete the root of namespace %s", o.Namespace)
+	}
+	removed := []*fs.File{}
+	if f.IsDirectory() {
+		children, err := c.List(o.Namespace, o.Filename)
+		if err != nil {
+			return nil, err
+		}
+		if len(children) > 0 && !o.Recursive {
+			return nil, errors.NotEmpty("directory %s is not empty", o.Filename)
+		}
+		for _, child := range children {
+			sub := *o
+			sub.Filename = child.FullPath()
+			sub.Recursive = true
+			r, err := sub.remove(c)
+			if err != nil {
+				return nil, err
+			}
+			removed = append(removed, r...)
+		}
+	}
+	if err = o.unlink(c, f); err != nil {
+		return nil, err
+	}
+	if err = c.Delete(o.Namespace, o.Filename); err != nil {
+		return nil, err
+	}
+	return append(removed, f), nil
+}
+
+// unlink updates the links of the file f, which is deleted. f.Nlink is left
+// to the number of the remaining links, so that the data of f is only
+// removed with its last link.
+func (o *Operation) unlink(c cache.Cache, f *fs.File) error {
+	switch {
+	case f.IsLink():
+		target, err := c.Get(o.Namespace, f.Target)
+		if err != nil {
+			return err
+		}
+		target.Links = removePath(target.Links, f.FullPath())
+		target.Nlink--
+		target.Ctime = o.CreatedAt
+		_, err = c.Update(o.Namespace, target.FullPath(), target)
+		return err
+	case f.IsDirectory() || f.IsSymlink():
+		return nil
+	}
+	if f.Nlink > 0 {
+		f.Nlink--
+	}
+	if len(f.Links) == 0 {
+		return nil
+	}
+	// the first link takes over the attributes and the data of f
+	first, err := c.Get(o.Namespace, f.Links[0])
+	if err != nil {
+		return err
+	}
+	next := *f
+	next.Parent = first.Parent
+	next.Path = first.Path
+	next.Links = f.Links[1:]
+	next.Ctime = o.CreatedAt
+	if _, err = c.Update(o.Namespace, first.FullPath(), &next); err != nil {
+		return err
+	}
+	// the data is now accounted to the tree of the first link
+	if err = o.charge(c, filepath.Dir(first.FullPath()), fs.Summary{Length: next.SpaceConsumed()}, false); err != nil {
+		return err
+	}
+	for _, p := range next.Links {
+		link, err := c.Get(o.Namespace, p)
+		if err != nil {
+			return err
+		}
+		link.Target = next.FullPath()
+		if _, err = c.Update(o.Namespace, p, link); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func removePath(paths []string, p string) []string {
+	kept := make([]string, 0, len(paths))
+	for _, q := range paths {
+		if q != p {
+			kept = append(kept, q)
+		}
+	}
+	return kept
+}
+
+// createSymlink creates the symlink Filename pointing to NewName, along with
+// its missing parents if Recursive is set.
+func (o *Operation) createSymlink(c cache.Cache) (interface{}, error) {
+	if o.Recursive {
+		sub := *o
+		sub.Filename = filepath.Dir(o.Filename)
+		sub.FileAttr = &fs.Attr{Mode: 0755, Uid: o.FileAttr.Uid, Gid: o.FileAttr.Gid}
+		if _, err := sub.mkdirs(c); err != nil {
+			return nil, err
+		}
+	}
+	parent, err := o.lookupParent(c, o.Filename)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = c.Get(o.Namespace, o.Filename); err == nil {
+		return nil, errors.AlreadyExists("%s already exists", o.Filename)
+	}
+	f, err := parent.CreateSymlink(context.Background(), &api.SymlinkRequest{
+		NewName: filepath.Base(o.Filename),
+		Target:  o.NewName,
+		Uid:     o.FileAttr.Uid,
+		Gid:     o.FileAttr.Gid,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err = o.charge(c, parent.FullPath(), f.Entry(), true); err != nil {
+		return nil, err
+	}
+	if err = o.init(c, f); err != nil {
+		return nil, err
+	}
+	if err = c.Add(o.Namespace, f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// createHardLink creates the hard link Filename to the file NewName, whose
+// data is moved to the Object key first if it is set.
+func (o *Operation) createHardLink(c cache.Cache) (interface{}, error) {
+	old, err := c.Get(o.Namespace, o.NewName)
+	if errors.IsNotFound(err) {
+		return nil, errors.NotFound("no such file or directory: %s", o.NewName)
+	} else if err != nil {
+		return nil, err
+	}
+	parent, err := o.lookupParent(c, o.Filename)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = c.Get(o.Namespace, o.Filename); err == nil {
+		return nil, errors.AlreadyExists("%s already exists", o.Filename)
+	}
+	link, err := parent.CreateLink(context.Background(), &api.LinkRequest{OldNode: old.Inode, NewName: filepath.Base(o.Filename)}, old)
+	if err != nil {
+		return nil, err
+	}
+	if o.Object != "" {
+		old.Object = o.Object
+	}
+	if old.Object == "" {
+		// the data would move with the path of the file
+		return nil, errors.BadParameter("%s has no object key", o.NewName)
+	}
+	if err = o.charge(c, parent.FullPath(), link.Entry(), true); err != nil {
+		return nil, err
+	}
+	old.Links = append(append([]string{}, old.Links...), o.Filename)
+	old.Nlink++
+	old.Ctime = o.CreatedAt
+	if _, err = c.Update(o.Namespace, o.NewName, old); err != nil {
+		return nil, err
+	}
+	if err = c.Add(o.Namespace, link); err != nil {
+		return nil, err
+	}
+	return old, nil
+}
+
+// lookup returns the file name, which may be the root of the namespace.
+func (o *Operation) lookup(c cache.Cache, name string) (*fs.File, error) {
+	root, err := o.root(c)
+	if err != nil {
+		return nil, err
+	}
+	if name == root.FullPath() {
+		return root, nil
+	}
+	f, err := c.Get(o.Namespace, name)
+	if errors.IsNotFound(err) {
+		return nil, errors.NotFound("no such file or directory: %s", name)
+	}
+	return f, err
+}
+
+func (o *Operation) updateACL(c cache.Cache) (interface{}, error) {
+	f, err := o.lookup(c, o.Filename)
+	if err != nil {
+		return nil, err
+	}
+	if err = f.UpdateACL(o.Type, o.ACL); err != nil {
+		return nil, err
+	}
+	f.Ctime = o.CreatedAt
+	if _, err = c.Update(o.Namespace, o.Filename, f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (o *Operation) updateXattr(c cache.Cache) (interface{}, error) {
+	f, err := o.lookup(c, o.Filename)
+	if err != nil {
+		return nil, err
+	}
+	if o.Xattr == nil {
+		return nil, errors.BadParameter("missing attribute")
+	}
+	if o.Type == api.OpsSetXAttr {
+		err = f.Setxattr(context.Background(), o.Xattr)
+	} else {
+		err = f.Removexattr(context.Background(), &api.RemovexattrRequest{Name: o.Xattr.Name})
+	}
+	if err != nil {
+		return nil, err
+	}
+	f.Ctime = o.CreatedAt
+	if _, err = c.Update(o.Namespace, o.Filename, f); err != nil {
+		return nil, err
+	}
+	return f, nil
 }
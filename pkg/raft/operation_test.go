@@ -0,0 +1,1094 @@
+package raft
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/cache"
+	"github.com/gostor/gofs/pkg/errors"
+	"github.com/gostor/gofs/pkg/fs"
+)
+
+func newTestCache(t *testing.T) cache.Cache {
+	c, err := cache.NewCache("memory", "", 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func applyOp(t *testing.T, c cache.Cache, o *Operation) interface{} {
+	ret, err := o.apply(c)
+	if err != nil {
+		t.Fatalf("%s %s: %v", o.Type, o.Filename, err)
+	}
+	return ret
+}
+
+func TestMkdirsAndCreate(t *testing.T) {
+	c := newTestCache(t)
+	now := time.Now()
+
+	applyOp(t, c, NewOperation(api.OpsDirCreate, "ns", "/ns/a/b", "", &fs.Attr{Mode: 0750}, now))
+	applyOp(t, c, NewOperation(api.OpsFileCreate, "ns", "/ns/a/b/f", "", &fs.Attr{Mode: 0640, Size: 5}, now))
+
+	f, err := c.Get("ns", "/ns/a/b/f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.IsDirectory() || f.Size != 5 || f.Mode != 0640 || f.Inode == 0 {
+		t.Fatalf("unexpected file: %#v", f.Attr)
+	}
+	list, err := c.List("ns", "/ns/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Path != "b" || !list[0].IsDirectory() {
+		t.Fatalf("unexpected listing of /ns/a: %v", list)
+	}
+
+	// creating an existing file fails unless it is overwritten
+	o := NewOperation(api.OpsFileCreate, "ns", "/ns/a/b/f", "", &fs.Attr{Mode: 0640, Size: 7}, now)
+	if _, err = o.apply(c); !errors.IsAlreadyExists(err) {
+		t.Fatalf("expected an AlreadyExists error, got %v", err)
+	}
+	o.Overwrite = true
+	h := fs.NewHasher(false)
+	h.Write([]byte("content"))
+	o.Checksums = h.Checksums()
+	applyOp(t, c, o)
+	if g, _ := c.Get("ns", "/ns/a/b/f"); g.Size != 7 || g.Inode != f.Inode {
+		t.Fatalf("unexpected overwritten file: %#v", g.Attr)
+	}
+	// the checksums are those of the new content
+	if g, _ := c.Get("ns", "/ns/a/b/f"); g.Checksum != "61af7533" || fmt.Sprintf("%x", g.Hash) != "9a0364b9e99bb480dd25e1f0284c8555" {
+		t.Fatalf("unexpected checksums: %s %x", g.Checksum, g.Hash)
+	}
+
+	// the object key of the new content replaces the path of the old one
+	o.Object = "objects/1"
+	applyOp(t, c, o)
+	if g, _ := c.Get("ns", "/ns/a/b/f"); g.Object != "objects/1" || g.ObjectKey() != "objects/1" {
+		t.Fatalf("unexpected object key: %q", g.Object)
+	}
+	o.Object = ""
+	applyOp(t, c, o)
+	if g, _ := c.Get("ns", "/ns/a/b/f"); g.Object != "objects/1" {
+		t.Fatalf("the object key must be kept when the file is overwritten in place, got %q", g.Object)
+	}
+
+	// the parent must exist
+	o = NewOperation(api.OpsFileCreate, "ns", "/ns/x/f", "", &fs.Attr{}, now)
+	if _, err = o.apply(c); !errors.IsNotFound(err) {
+		t.Fatalf("expected a NotFound error when the parent does not exist, got %v", err)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	c := newTestCache(t)
+	now := time.Now()
+
+	applyOp(t, c, NewOperation(api.OpsDirCreate, "ns", "/ns/a/b", "", &fs.Attr{Mode: 0755}, now))
+	applyOp(t, c, NewOperation(api.OpsFileCreate, "ns", "/ns/a/b/f", "", &fs.Attr{Mode: 0644}, now))
+
+	o := NewOperation(api.OpsDelete, "ns", "/ns/a", "", nil, now)
+	if _, err := o.apply(c); !errors.IsNotEmpty(err) {
+		t.Fatalf("expected a NotEmpty error when deleting a non-empty directory, got %v", err)
+	}
+	o.Recursive = true
+	removed := applyOp(t, c, o).([]*fs.File)
+	if len(removed) != 3 {
+		t.Fatalf("expected 3 removed entries, got %d", len(removed))
+	}
+	if _, err := c.Get("ns", "/ns/a/b/f"); err == nil {
+		t.Fatal("expected /ns/a/b/f to be removed")
+	}
+	if removed := applyOp(t, c, o).([]*fs.File); len(removed) != 0 {
+		t.Fatalf("expected nothing to be removed, got %d", len(removed))
+	}
+}
+
+func TestACL(t *testing.T) {
+	c := newTestCache(t)
+	now := time.Now()
+
+	applyOp(t, c, NewOperation(api.OpsDirCreate, "ns", "/ns/project", "", &fs.Attr{Mode: 0750, Uid: 1000, Gid: 1000}, now))
+	spec, err := fs.ParseACLSpec("user::rwx,group::r-x,other::---,user:1001:rwx,default:user:1001:rw-,default:group::r-x", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := NewOperation(api.OpsSetACL, "ns", "/ns/project", "", nil, now)
+	o.ACL = spec
+	applyOp(t, c, o)
+
+	dir, _ := c.Get("ns", "/ns/project")
+	// the mask is the union of the group class
+	if dir.Mode.Perm() != 0770 {
+		t.Fatalf("unexpected mode %v", dir.Mode)
+	}
+	expected := "user:1001:rwx,group::r-x,default:user::rwx,default:user:1001:rw-,default:group::r-x,default:mask::rwx,default:other::---"
+	if s := fs.FormatACLSpec(dir.ACL); s != expected {
+		t.Fatalf("expected the ACL %s, got %s", expected, s)
+	}
+	if err = dir.Access(&fs.Caller{Uid: 1001}, fs.MayWrite); err != nil {
+		t.Fatal(err)
+	}
+	if err = dir.Access(&fs.Caller{Uid: 1002, Gids: []uint32{1000}}, fs.MayWrite); !errors.IsPermissionDenied(err) {
+		t.Fatalf("expected a PermissionDenied error, got %v", err)
+	}
+
+	// a new file inherits the default ACL, restricted by its mode
+	applyOp(t, c, NewOperation(api.OpsFileCreate, "ns", "/ns/project/f", "", &fs.Attr{Mode: 0640, Uid: 1000, Gid: 1000}, now))
+	f, _ := c.Get("ns", "/ns/project/f")
+	if s := fs.FormatACLSpec(f.ACL); s != "user:1001:rw-,group::r-x" || f.Mode.Perm() != 0640 {
+		t.Fatalf("unexpected inherited ACL %s and mode %v", s, f.Mode)
+	}
+	if err = f.Access(&fs.Caller{Uid: 1001}, fs.MayRead); err != nil {
+		t.Fatal(err)
+	}
+	// the mask r-- restricts the named user
+	if err = f.Access(&fs.Caller{Uid: 1001}, fs.MayWrite); !errors.IsPermissionDenied(err) {
+		t.Fatalf("expected a PermissionDenied error, got %v", err)
+	}
+
+	spec, _ = fs.ParseACLSpec("user:1001", false)
+	o = NewOperation(api.OpsRemoveACLEntries, "ns", "/ns/project", "", nil, now)
+	o.ACL = spec
+	applyOp(t, c, o)
+	applyOp(t, c, NewOperation(api.OpsRemoveDefaultACL, "ns", "/ns/project", "", nil, now))
+	dir, _ = c.Get("ns", "/ns/project")
+	// without named entries, the ACL is represented by the mode alone
+	if dir.HasACL() || dir.Mode.Perm() != 0750 {
+		t.Fatalf("unexpected ACL %v and mode %v", dir.ACL, dir.Mode)
+	}
+	spec, _ = fs.ParseACLSpec("group:1001:rwx", true)
+	o = NewOperation(api.OpsModifyACLEntries, "ns", "/ns/project", "", nil, now)
+	o.ACL = spec
+	applyOp(t, c, o)
+	dir, _ = c.Get("ns", "/ns/project")
+	if s := fs.FormatACLSpec(dir.ACL); s != "group::r-x,group:1001:rwx" || dir.Mode.Perm() != 0770 {
+		t.Fatalf("unexpected ACL %s and mode %v", s, dir.Mode)
+	}
+	// the group bits get back the permission of the owning group
+	applyOp(t, c, NewOperation(api.OpsRemoveACL, "ns", "/ns/project", "", nil, now))
+	dir, _ = c.Get("ns", "/ns/project")
+	if dir.HasACL() || dir.Mode.Perm() != 0750 {
+		t.Fatalf("unexpected ACL %v and mode %v", dir.ACL, dir.Mode)
+	}
+
+	// a file cannot have a default ACL
+	spec, _ = fs.ParseACLSpec("default:user:1001:rwx", true)
+	o = NewOperation(api.OpsModifyACLEntries, "ns", "/ns/project/f", "", nil, now)
+	o.ACL = spec
+	if _, err = o.apply(c); !errors.Is(err, errors.KindBadParameter) {
+		t.Fatalf("expected a BadParameter error, got %v", err)
+	}
+}
+
+func TestXattrs(t *testing.T) {
+	c := newTestCache(t)
+	now := time.Now()
+
+	applyOp(t, c, NewOperation(api.OpsFileCreate, "ns", "/ns/f", "", &fs.Attr{Mode: 0644, Uid: 1000, Gid: 1000}, now))
+	setxattr := func(name string, value []byte, flags uint32) error {
+		o := NewOperation(api.OpsSetXAttr, "ns", "/ns/f", "", nil, now)
+		o.Xattr = &api.SetxattrRequest{Name: name, Xattr: value, Flags: flags}
+		_, err := o.apply(c)
+		return err
+	}
+	if err := setxattr("user.origin", []byte("ingest"), api.XattrCreate); err != nil {
+		t.Fatal(err)
+	}
+	if err := setxattr("user.origin", []byte("again"), api.XattrCreate); !errors.IsAlreadyExists(err) {
+		t.Fatalf("expected an AlreadyExists error, got %v", err)
+	}
+	if err := setxattr("user.missing", nil, api.XattrReplace); !errors.IsNotFound(err) {
+		t.Fatalf("expected a NotFound error, got %v", err)
+	}
+	if err := setxattr("system.origin", nil, 0); !errors.Is(err, errors.KindBadParameter) {
+		t.Fatalf("expected a BadParameter error for an unsupported namespace, got %v", err)
+	}
+	if err := setxattr("user.big", make([]byte, fs.MaxXattrSize), 0); !errors.Is(err, errors.KindBadParameter) {
+		t.Fatalf("expected a BadParameter error for a large value, got %v", err)
+	}
+	if err := setxattr("trusted.checked", []byte{1}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	f, _ := c.Get("ns", "/ns/f")
+	var resp api.GetxattrResponse
+	if err := f.Getxattr(context.Background(), &api.GetxattrRequest{Name: "user.origin"}, &resp); err != nil || string(resp.Xattr) != "ingest" {
+		t.Fatalf("unexpected value %q and error %v", resp.Xattr, err)
+	}
+	if names := f.XattrNames(); len(names) != 2 || names[0] != "trusted.checked" || names[1] != "user.origin" {
+		t.Fatalf("unexpected names %v", names)
+	}
+	owner := &fs.Caller{Uid: 1000, Gids: []uint32{1000}}
+	if err := f.CheckXattr(owner, "user.origin", fs.MayWrite); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.CheckXattr(owner, "trusted.checked", fs.MayRead); !errors.IsPermissionDenied(err) {
+		t.Fatalf("expected a PermissionDenied error, got %v", err)
+	}
+	if err := f.CheckXattr(&fs.Caller{Uid: 1001}, "user.origin", fs.MayWrite); !errors.IsPermissionDenied(err) {
+		t.Fatalf("expected a PermissionDenied error, got %v", err)
+	}
+
+	o := NewOperation(api.OpsRemoveXAttr, "ns", "/ns/f", "", nil, now)
+	o.Xattr = &api.SetxattrRequest{Name: "user.origin"}
+	applyOp(t, c, o)
+	if f, _ = c.Get("ns", "/ns/f"); len(f.Xattrs) != 1 {
+		t.Fatalf("unexpected attributes %v", f.Xattrs)
+	}
+}
+
+func TestLinks(t *testing.T) {
+	c := newTestCache(t)
+	now := time.Now()
+
+	applyOp(t, c, NewOperation(api.OpsDirCreate, "ns", "/ns/a", "", &fs.Attr{Mode: 0755}, now))
+	applyOp(t, c, NewOperation(api.OpsFileCreate, "ns", "/ns/a/f", "", &fs.Attr{Mode: 0644, Size: 5}, now))
+
+	o := NewOperation(api.OpsCreateSymlink, "ns", "/ns/b/s", "../a/f", &fs.Attr{Uid: 1000, Gid: 1000}, now)
+	if _, err := o.apply(c); !errors.IsNotFound(err) {
+		t.Fatalf("expected a NotFound error when the parent does not exist, got %v", err)
+	}
+	o.Recursive = true
+	applyOp(t, c, o)
+	s, err := c.Get("ns", "/ns/b/s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.IsSymlink() || s.Target != "../a/f" || s.Size != 6 || s.Uid != 1000 {
+		t.Fatalf("unexpected symlink: %#v", s)
+	}
+
+	// the data of a file without an object key cannot be shared
+	o = NewOperation(api.OpsCreateHardLink, "ns", "/ns/b/l1", "/ns/a/f", nil, now)
+	if _, err = o.apply(c); !errors.Is(err, errors.KindBadParameter) {
+		t.Fatalf("expected a BadParameter error, got %v", err)
+	}
+	o.Object = "objects/1"
+	applyOp(t, c, o)
+	applyOp(t, c, NewOperation(api.OpsCreateHardLink, "ns", "/ns/b/l2", "/ns/a/f", nil, now))
+	f, _ := c.Get("ns", "/ns/a/f")
+	if f.Nlink != 3 || len(f.Links) != 2 || f.Object != "objects/1" {
+		t.Fatalf("unexpected linked file: %#v", f)
+	}
+	o = NewOperation(api.OpsCreateHardLink, "ns", "/ns/b/l3", "/ns/a", nil, now)
+	if _, err = o.apply(c); !errors.Is(err, errors.KindIsDirectory) {
+		t.Fatalf("expected an IsDirectory error, got %v", err)
+	}
+
+	// removing a link releases it
+	removed := applyOp(t, c, NewOperation(api.OpsDelete, "ns", "/ns/b/l2", "", nil, now)).([]*fs.File)
+	if len(removed) != 1 || !removed[0].IsLink() {
+		t.Fatalf("unexpected removed files: %v", removed)
+	}
+	if f, _ = c.Get("ns", "/ns/a/f"); f.Nlink != 2 || len(f.Links) != 1 {
+		t.Fatalf("unexpected linked file: %#v", f)
+	}
+
+	// removing the file hands it over to its first link
+	removed = applyOp(t, c, NewOperation(api.OpsDelete, "ns", "/ns/a/f", "", nil, now)).([]*fs.File)
+	if len(removed) != 1 || removed[0].Nlink != 1 {
+		t.Fatalf("the data of a linked file must be kept: %v", removed)
+	}
+	l1, err := c.Get("ns", "/ns/b/l1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l1.IsLink() || l1.Nlink != 1 || len(l1.Links) != 0 || l1.Size != 5 || l1.Inode != f.Inode || l1.Object != "objects/1" {
+		t.Fatalf("unexpected promoted link: %#v", l1)
+	}
+	removed = applyOp(t, c, NewOperation(api.OpsDelete, "ns", "/ns/b/l1", "", nil, now)).([]*fs.File)
+	if len(removed) != 1 || removed[0].Nlink != 0 {
+		t.Fatalf("the data of the last link must be removed: %v", removed)
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	c := newTestCache(t)
+	now := time.Now()
+
+	for _, id := range []string{"", "Ns", "-ns", "v1", "namespaces", "ns/a"} {
+		o := NewOperation(api.OpsCreateNamespace, id, "", "", nil, now)
+		o.Config = &api.Config{Bucket: "b"}
+		if _, err := o.apply(c); !errors.Is(err, errors.KindBadParameter) {
+			t.Fatalf("expected a BadParameter error for the namespace %q, got %v", id, err)
+		}
+	}
+	o := NewOperation(api.OpsCreateNamespace, "ns", "", "", nil, now)
+	o.Config = &api.Config{Bucket: "b", Endpoint: "localhost:9000"}
+	applyOp(t, c, o)
+	if _, err := o.apply(c); !errors.IsAlreadyExists(err) {
+		t.Fatalf("expected an AlreadyExists error, got %v", err)
+	}
+	ns, err := c.GetNamespace("ns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ns.Bucket != "b" || ns.Endpoint != "localhost:9000" {
+		t.Fatalf("unexpected namespace: %#v", ns.Config)
+	}
+	if root, err := c.Get("ns", "/ns"); err != nil || !root.IsDirectory() || root.Inode == 0 {
+		t.Fatalf("unexpected root of the namespace: %v %v", root, err)
+	}
+
+	applyOp(t, c, NewOperation(api.OpsFileCreate, "ns", "/ns/f", "", &fs.Attr{Mode: 0644}, now))
+	o = NewOperation(api.OpsDeleteNamespace, "ns", "", "", nil, now)
+	if _, err = o.apply(c); !errors.IsNotEmpty(err) {
+		t.Fatalf("expected a NotEmpty error, got %v", err)
+	}
+	o.Recursive = true
+	applyOp(t, c, o)
+	if _, err = c.GetNamespace("ns"); !errors.IsNotFound(err) {
+		t.Fatalf("expected a NotFound error, got %v", err)
+	}
+	if _, err = c.Get("ns", "/ns/f"); !errors.IsNotFound(err) {
+		t.Fatalf("the files of a deleted namespace must be removed, got %v", err)
+	}
+	if list, _ := c.ListNamespaces(); len(list) != 0 {
+		t.Fatalf("unexpected namespaces: %v", list)
+	}
+}
+
+func TestQuota(t *testing.T) {
+	c := newTestCache(t)
+	now := time.Now()
+	usage := func(p string) (fs.Quota, fs.Summary) {
+		f, err := c.Get("ns", p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Quota == nil || f.Summary == nil {
+			t.Fatalf("%s has no quota", p)
+		}
+		return *f.Quota, *f.Summary
+	}
+	setQuota := func(p string, names, space int64) {
+		o := NewOperation(api.OpsSetQuota, "ns", p, "", nil, now)
+		o.Quota = &fs.Quota{Names: names, Space: space}
+		applyOp(t, c, o)
+	}
+
+	applyOp(t, c, NewOperation(api.OpsDirCreate, "ns", "/ns/a", "", &fs.Attr{Mode: 0755}, now))
+	applyOp(t, c, NewOperation(api.OpsFileCreate, "ns", "/ns/a/f", "", &fs.Attr{Mode: 0644, Size: 10}, now))
+
+	// the usage is counted when the quota is set
+	setQuota("/ns/a", 5, fs.QuotaDontSet)
+	setQuota("/ns", fs.QuotaDontSet, 100)
+	if q, u := usage("/ns/a"); q.Names != 5 || q.Space != -1 || u.Names() != 2 || u.Length != 10 {
+		t.Fatalf("unexpected quota of /ns/a: %+v %+v", q, u)
+	}
+	if q, u := usage("/ns"); q.Names != -1 || q.Space != 100 || u.Names() != 3 || u.Length != 10 {
+		t.Fatalf("unexpected quota of /ns: %+v %+v", q, u)
+	}
+
+	// the name quota counts the new directories
+	o := NewOperation(api.OpsDirCreate, "ns", "/ns/a/b/c/d/e", "", &fs.Attr{Mode: 0755}, now)
+	if _, err := o.apply(c); !errors.IsQuotaExceeded(err) {
+		t.Fatalf("expected a QuotaExceeded error, got %v", err)
+	}
+	if _, err := c.Get("ns", "/ns/a/b"); !errors.IsNotFound(err) {
+		t.Fatalf("a failed mkdirs must not create any directory, got %v", err)
+	}
+	applyOp(t, c, NewOperation(api.OpsDirCreate, "ns", "/ns/a/b/c", "", &fs.Attr{Mode: 0755}, now))
+	applyOp(t, c, NewOperation(api.OpsFileCreate, "ns", "/ns/a/b/g", "", &fs.Attr{Mode: 0644, Size: 50}, now))
+	if _, u := usage("/ns/a"); u.Names() != 5 || u.Length != 60 {
+		t.Fatalf("unexpected usage of /ns/a: %+v", u)
+	}
+	o = NewOperation(api.OpsCreateSymlink, "ns", "/ns/a/s", "f", &fs.Attr{}, now)
+	if _, err := o.apply(c); !errors.IsQuotaExceeded(err) {
+		t.Fatalf("expected a QuotaExceeded error, got %v", err)
+	}
+
+	// the space quota counts the size changes
+	o = NewOperation(api.OpsFileCreate, "ns", "/ns/a/b/g", "", &fs.Attr{Mode: 0644, Size: 91}, now)
+	o.Overwrite = true
+	if _, err := o.apply(c); !errors.IsQuotaExceeded(err) {
+		t.Fatalf("expected a QuotaExceeded error, got %v", err)
+	}
+	o.FileAttr.Size = 90
+	applyOp(t, c, o)
+	if _, u := usage("/ns"); u.Names() != 6 || u.Length != 100 {
+		t.Fatalf("unexpected usage of /ns: %+v", u)
+	}
+
+	// the data of a hard link is accounted to the tree of its file
+	o = NewOperation(api.OpsCreateHardLink, "ns", "/ns/l", "/ns/a/f", nil, now)
+	o.Object = "objects/1"
+	applyOp(t, c, o)
+	if _, u := usage("/ns/a"); u.Names() != 5 || u.Length != 100 {
+		t.Fatalf("unexpected usage of /ns/a: %+v", u)
+	}
+	applyOp(t, c, NewOperation(api.OpsDelete, "ns", "/ns/a/f", "", nil, now))
+	if _, u := usage("/ns/a"); u.Names() != 4 || u.Length != 90 {
+		t.Fatalf("unexpected usage of /ns/a: %+v", u)
+	}
+	if _, u := usage("/ns"); u.Names() != 6 || u.Length != 100 {
+		t.Fatalf("unexpected usage of /ns: %+v", u)
+	}
+
+	o = NewOperation(api.OpsDelete, "ns", "/ns/a/b", "", nil, now)
+	o.Recursive = true
+	applyOp(t, c, o)
+	if _, u := usage("/ns/a"); u.Names() != 1 || u.Length != 0 {
+		t.Fatalf("unexpected usage of /ns/a: %+v", u)
+	}
+
+	// the quota goes away with its last limit
+	setQuota("/ns/a", -1, fs.QuotaDontSet)
+	if f, _ := c.Get("ns", "/ns/a"); f.Quota != nil {
+		t.Fatalf("unexpected quota of /ns/a: %+v", f.Quota)
+	}
+	applyOp(t, c, NewOperation(api.OpsClearQuota, "ns", "/ns", "", nil, now))
+	if f, _ := c.Get("ns", "/ns"); f.Quota != nil {
+		t.Fatalf("unexpected quota of /ns: %+v", f.Quota)
+	}
+	o = NewOperation(api.OpsSetQuota, "ns", "/ns/l", "", nil, now)
+	o.Quota = &fs.Quota{Names: 1, Space: fs.QuotaDontSet}
+	if _, err := o.apply(c); !errors.IsNotDirectory(err) {
+		t.Fatalf("expected a NotDirectory error, got %v", err)
+	}
+}
+
+func TestContentSummary(t *testing.T) {
+	c := newTestCache(t)
+	now := time.Now()
+	summary := func(p string) fs.Summary {
+		f, err := c.Get("ns", p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Summary == nil {
+			t.Fatalf("%s has no summary", p)
+		}
+		return *f.Summary
+	}
+
+	applyOp(t, c, NewOperation(api.OpsDirCreate, "ns", "/ns/a/b/c", "", &fs.Attr{Mode: 0755}, now))
+	applyOp(t, c, NewOperation(api.OpsFileCreate, "ns", "/ns/a/b/c/f", "", &fs.Attr{Mode: 0644, Size: 10}, now))
+	applyOp(t, c, NewOperation(api.OpsFileCreate, "ns", "/ns/a/g", "", &fs.Attr{Mode: 0644, Size: 5}, now))
+	applyOp(t, c, NewOperation(api.OpsCreateSymlink, "ns", "/ns/a/b/s", "c/f", &fs.Attr{}, now))
+	o := NewOperation(api.OpsCreateHardLink, "ns", "/ns/l", "/ns/a/b/c/f", nil, now)
+	o.Object = "objects/1"
+	applyOp(t, c, o)
+	for p, want := range map[string]fs.Summary{
+		"/ns":       {Files: 4, Directories: 4, Length: 15},
+		"/ns/a":     {Files: 3, Directories: 3, Length: 15},
+		"/ns/a/b":   {Files: 2, Directories: 2, Length: 10},
+		"/ns/a/b/c": {Files: 1, Directories: 1, Length: 10},
+	} {
+		if s := summary(p); s != want {
+			t.Fatalf("unexpected summary of %s: %+v, expected %+v", p, s, want)
+		}
+	}
+
+	// deleting a linked file moves its data to the tree of the link
+	applyOp(t, c, NewOperation(api.OpsDelete, "ns", "/ns/a/b/c/f", "", nil, now))
+	if s := summary("/ns/a"); s != (fs.Summary{Files: 2, Directories: 3, Length: 5}) {
+		t.Fatalf("unexpected summary of /ns/a: %+v", s)
+	}
+	if s := summary("/ns"); s != (fs.Summary{Files: 3, Directories: 4, Length: 15}) {
+		t.Fatalf("unexpected summary of /ns: %+v", s)
+	}
+	o = NewOperation(api.OpsDelete, "ns", "/ns/a/b", "", nil, now)
+	o.Recursive = true
+	applyOp(t, c, o)
+	if s := summary("/ns"); s != (fs.Summary{Files: 2, Directories: 2, Length: 15}) {
+		t.Fatalf("unexpected summary of /ns: %+v", s)
+	}
+
+	// the summaries which drifted are recomputed
+	a, _ := c.Get("ns", "/ns/a")
+	a.Summary = &fs.Summary{Files: 7, Directories: 1}
+	if _, err := c.Update("ns", "/ns/a", a); err != nil {
+		t.Fatal(err)
+	}
+	root, _ := c.Get("ns", "/ns")
+	root.Summary = nil
+	if _, err := c.Update("ns", "/ns", root); err != nil {
+		t.Fatal(err)
+	}
+	f := applyOp(t, c, NewOperation(api.OpsRepairContentSummary, "ns", "/ns/a", "", nil, now)).(*fs.File)
+	if s := *f.Summary; s != (fs.Summary{Files: 1, Directories: 1, Length: 5}) {
+		t.Fatalf("unexpected summary of /ns/a: %+v", s)
+	}
+	applyOp(t, c, NewOperation(api.OpsRepairContentSummary, "ns", "/ns", "", nil, now))
+	if s := summary("/ns"); s != (fs.Summary{Files: 2, Directories: 2, Length: 15}) {
+		t.Fatalf("unexpected summary of /ns: %+v", s)
+	}
+	o = NewOperation(api.OpsRepairContentSummary, "ns", "/ns/l", "", nil, now)
+	if _, err := o.apply(c); !errors.IsNotDirectory(err) {
+		t.Fatalf("expected a NotDirectory error, got %v", err)
+	}
+}
+
+func TestSetattr(t *testing.T) {
+	c := newTestCache(t)
+	now := time.Now()
+	later := now.Add(time.Hour)
+	setattr := func(op, p string, valid api.SetattrValid, a *fs.Attr) *fs.File {
+		o := NewOperation(op, "ns", p, "", a, later)
+		o.Valid = valid
+		return applyOp(t, c, o).(*fs.File)
+	}
+
+	applyOp(t, c, NewOperation(api.OpsDirCreate, "ns", "/ns/d", "", &fs.Attr{Mode: 0755}, now))
+	applyOp(t, c, NewOperation(api.OpsFileCreate, "ns", "/ns/d/f", "", &fs.Attr{Mode: 0644, Size: 10}, now))
+	d, _ := c.Get("ns", "/ns/d")
+	d.Mode |= os.ModeSetgid
+	if _, err := c.Update("ns", "/ns/d", d); err != nil {
+		t.Fatal(err)
+	}
+
+	// the type of the file and its setgid bit are kept
+	d = setattr(api.OpsSetPermission, "/ns/d", api.SetattrMode, &fs.Attr{Mode: 0700 | os.ModeSticky})
+	if d.Mode != os.ModeDir|os.ModeSetgid|os.ModeSticky|0700 || !d.Ctime.Equal(later) {
+		t.Fatalf("unexpected attributes: %s %v", d.Mode, d.Ctime)
+	}
+	f := setattr(api.OpsSetOwner, "/ns/d/f", api.SetattrGid, &fs.Attr{Uid: 7, Gid: 8})
+	if f.Uid != 0 || f.Gid != 8 || !f.Ctime.Equal(later) {
+		t.Fatalf("unexpected attributes: %#v", f.Attr)
+	}
+	mtime := now.Add(-time.Hour)
+	f = setattr(api.OpsSetTimes, "/ns/d/f", api.SetattrMtime, &fs.Attr{Mtime: mtime, Atime: mtime})
+	if !f.Mtime.Equal(mtime) || f.Atime.Equal(mtime) {
+		t.Fatalf("unexpected times: %#v", f.Attr)
+	}
+	if g, _ := c.Get("ns", "/ns/d/f"); !g.Mtime.Equal(mtime) || g.Gid != 8 {
+		t.Fatalf("the attributes are not persisted: %#v", g.Attr)
+	}
+
+	// the size changes are charged to the ancestors
+	o := NewOperation(api.OpsSetQuota, "ns", "/ns/d", "", nil, now)
+	o.Quota = &fs.Quota{Names: fs.QuotaDontSet, Space: 20}
+	applyOp(t, c, o)
+	o = NewOperation(api.OpsSetTimes, "ns", "/ns/d/f", "", &fs.Attr{Size: 21}, now)
+	o.Valid = api.SetattrSize
+	if _, err := o.apply(c); !errors.IsQuotaExceeded(err) {
+		t.Fatalf("expected a QuotaExceeded error, got %v", err)
+	}
+	o.FileAttr.Size = 4
+	applyOp(t, c, o)
+	if root, _ := c.Get("ns", "/ns"); root.Summary.Length != 4 {
+		t.Fatalf("unexpected summary of /ns: %+v", root.Summary)
+	}
+}
+
+func TestRename(t *testing.T) {
+	c := newTestCache(t)
+	now := time.Now()
+	rename := func(src, dst string, overwrite bool, objects map[string]string) (interface{}, error) {
+		o := NewOperation(api.OpsRename, "ns", src, dst, nil, now)
+		o.Overwrite = overwrite
+		o.Objects = objects
+		return o.apply(c)
+	}
+
+	applyOp(t, c, NewOperation(api.OpsDirCreate, "ns", "/ns/a/b", "", &fs.Attr{Mode: 0755}, now))
+	applyOp(t, c, NewOperation(api.OpsDirCreate, "ns", "/ns/d", "", &fs.Attr{Mode: 0755}, now))
+	applyOp(t, c, NewOperation(api.OpsFileCreate, "ns", "/ns/a/b/f", "", &fs.Attr{Mode: 0644, Size: 10}, now))
+	applyOp(t, c, NewOperation(api.OpsFileCreate, "ns", "/ns/a/g", "", &fs.Attr{Mode: 0644, Size: 5}, now))
+	o := NewOperation(api.OpsCreateHardLink, "ns", "/ns/l", "/ns/a/g", nil, now)
+	o.Object = "objects/1"
+	applyOp(t, c, o)
+
+	if _, err := rename("/ns/a", "/ns/a/b/a", false, nil); !errors.Is(err, errors.KindBadParameter) {
+		t.Fatalf("expected a BadParameter error moving a directory into its own subtree, got %v", err)
+	}
+	if _, err := rename("/ns/a", "/ns/d/a", false, nil); !errors.Is(err, errors.KindBadParameter) {
+		t.Fatalf("expected a BadParameter error without the object key of /ns/a/b/f, got %v", err)
+	}
+	if _, err := rename("/ns/a", "/ns/x/a", false, map[string]string{"/ns/a/b/f": "objects/2"}); !errors.IsNotFound(err) {
+		t.Fatalf("expected a NotFound error, got %v", err)
+	}
+
+	// the whole tree moves at once
+	if _, err := rename("/ns/a", "/ns/d/a", false, map[string]string{"/ns/a/b/f": "objects/2"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"/ns/a", "/ns/a/b", "/ns/a/b/f", "/ns/a/g"} {
+		if _, err := c.Get("ns", p); !errors.IsNotFound(err) {
+			t.Fatalf("%s must be moved, got %v", p, err)
+		}
+	}
+	f, err := c.Get("ns", "/ns/d/a/b/f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Object != "objects/2" || f.Size != 10 {
+		t.Fatalf("unexpected moved file: %#v", f)
+	}
+	g, err := c.Get("ns", "/ns/d/a/g")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Object != "objects/1" || len(g.Links) != 1 || g.Links[0] != "/ns/l" {
+		t.Fatalf("unexpected moved file: %#v", g)
+	}
+	if l, _ := c.Get("ns", "/ns/l"); l.Target != "/ns/d/a/g" {
+		t.Fatalf("the link must refer to the moved file: %#v", l)
+	}
+	if d, _ := c.Get("ns", "/ns/d"); *d.Summary != (fs.Summary{Files: 2, Directories: 3, Length: 15}) {
+		t.Fatalf("unexpected summary of /ns/d: %+v", *d.Summary)
+	}
+	if root, _ := c.Get("ns", "/ns"); *root.Summary != (fs.Summary{Files: 3, Directories: 4, Length: 15}) {
+		t.Fatalf("unexpected summary of /ns: %+v", *root.Summary)
+	}
+
+	// the destination is only replaced with overwrite, by the same type
+	if _, err = rename("/ns/l", "/ns/d/a/b/f", false, nil); !errors.IsAlreadyExists(err) {
+		t.Fatalf("expected an AlreadyExists error, got %v", err)
+	}
+	if _, err = rename("/ns/d/a/b", "/ns/d/a/g", true, nil); !errors.IsNotDirectory(err) {
+		t.Fatalf("expected a NotDirectory error, got %v", err)
+	}
+	if _, err = rename("/ns/d/a/b", "/ns/d", true, nil); !errors.IsNotEmpty(err) {
+		t.Fatalf("expected a NotEmpty error, got %v", err)
+	}
+	removed, err := rename("/ns/l", "/ns/d/a/b/f", true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := removed.([]*fs.File); len(r) != 1 || r[0].Object != "objects/2" || r[0].Nlink != 0 {
+		t.Fatalf("unexpected replaced files: %v", r)
+	}
+	if g, _ = c.Get("ns", "/ns/d/a/g"); len(g.Links) != 1 || g.Links[0] != "/ns/d/a/b/f" {
+		t.Fatalf("the file must refer to its moved link: %#v", g)
+	}
+	if d, _ := c.Get("ns", "/ns/d/a/b"); *d.Summary != (fs.Summary{Files: 1, Directories: 1}) {
+		t.Fatalf("unexpected summary of /ns/d/a/b: %+v", *d.Summary)
+	}
+
+	// the quotas of the destination apply to the tree moved in
+	q := NewOperation(api.OpsSetQuota, "ns", "/ns/d/a/b", "", nil, now)
+	q.Quota = &fs.Quota{Names: 2}
+	applyOp(t, c, q)
+	if _, err = rename("/ns/d/a/g", "/ns/d/a/b/g", false, nil); !errors.IsQuotaExceeded(err) {
+		t.Fatalf("expected a QuotaExceeded error, got %v", err)
+	}
+
+	// a tree which fails to move is left as it was
+	applyOp(t, c, NewOperation(api.OpsDirCreate, "ns", "/ns/e", "", &fs.Attr{Mode: 0755}, now))
+	o = NewOperation(api.OpsFileCreate, "ns", "/ns/e/a", "", &fs.Attr{Mode: 0644, Size: 3}, now)
+	o.Object = "objects/3"
+	applyOp(t, c, o)
+	e, _ := c.Get("ns", "/ns/e")
+	if err = c.Add("ns", &fs.File{Parent: e, Path: "z", Link: true, Target: "/ns/missing"}); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := c.Get("ns", "/ns/d")
+	if _, err = rename("/ns/e", "/ns/d/e", false, nil); !errors.IsNotFound(err) {
+		t.Fatalf("expected a NotFound error for the link to a missing file, got %v", err)
+	}
+	for _, p := range []string{"/ns/e", "/ns/e/a", "/ns/e/z"} {
+		if _, err = c.Get("ns", p); err != nil {
+			t.Fatalf("%s must be kept: %v", p, err)
+		}
+	}
+	if _, err = c.Get("ns", "/ns/d/e/a"); !errors.IsNotFound(err) {
+		t.Fatalf("expected a NotFound error, got %v", err)
+	}
+	if d, _ := c.Get("ns", "/ns/d"); *d.Summary != *before.Summary {
+		t.Fatalf("unexpected summary of /ns/d: %+v", *d.Summary)
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	c := newTestCache(t)
+	now := time.Now()
+	create := func(p, object string, size uint64) {
+		o := NewOperation(api.OpsFileCreate, "ns", p, "", &fs.Attr{Mode: 0644, Size: size}, now)
+		o.Overwrite = true
+		o.Object = object
+		applyOp(t, c, o)
+	}
+	snapshot := func(typ, name, newName string) (interface{}, error) {
+		o := NewOperation(typ, "ns", "/ns/d", newName, nil, now)
+		o.Snapshot = name
+		return o.apply(c)
+	}
+	view := func(name, rel string) (*fs.File, error) {
+		d, err := c.Get("ns", "/ns/d")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cache.SnapshotFile(c, "ns", d, d.Snapshots[d.FindSnapshot(name)], rel, nil)
+	}
+	list := func(name, rel string) string {
+		d, _ := c.Get("ns", "/ns/d")
+		files, err := cache.SnapshotList(c, "ns", d, d.Snapshots[d.FindSnapshot(name)], rel, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := []string{}
+		for _, f := range files {
+			names = append(names, f.Path)
+		}
+		return fmt.Sprint(names)
+	}
+
+	o := NewOperation(api.OpsCreateNamespace, "ns", "", "", nil, now)
+	o.Config = &api.Config{}
+	applyOp(t, c, o)
+	applyOp(t, c, NewOperation(api.OpsDirCreate, "ns", "/ns/d/a", "", &fs.Attr{Mode: 0755}, now))
+	create("/ns/d/a/f", "o1", 5)
+	create("/ns/d/g", "o2", 3)
+	create("/ns/d/k", "o4", 1)
+	if _, err := snapshot(api.OpsCreateSnapshot, "s1", ""); !errors.Is(err, errors.KindBadParameter) {
+		t.Fatalf("expected a BadParameter error for a directory not snapshottable, got %v", err)
+	}
+	applyOp(t, c, NewOperation(api.OpsAllowSnapshot, "ns", "/ns/d", "", nil, now))
+	if _, err := NewOperation(api.OpsAllowSnapshot, "ns", "/ns/d/a", "", nil, now).apply(c); !errors.Is(err, errors.KindBadParameter) {
+		t.Fatalf("expected a BadParameter error for a nested snapshottable directory, got %v", err)
+	}
+	ret, err := snapshot(api.OpsCreateSnapshot, "s1", "")
+	if err != nil || ret != "/ns/d/.snapshot/s1" {
+		t.Fatalf("unexpected snapshot %v: %v", ret, err)
+	}
+	if _, err = snapshot(api.OpsCreateSnapshot, "s1", ""); !errors.IsAlreadyExists(err) {
+		t.Fatalf("expected an AlreadyExists error, got %v", err)
+	}
+
+	// the snapshot keeps the files as they were, while they change
+	create("/ns/d/a/f", "o3", 7)
+	applyOp(t, c, NewOperation(api.OpsDelete, "ns", "/ns/d/g", "", nil, now))
+	create("/ns/d/h", "o5", 2)
+	applyOp(t, c, NewOperation(api.OpsRename, "ns", "/ns/d/a", "/ns/d/b", nil, now))
+	if f, err := view("s1", "/a/f"); err != nil || f.Size != 5 || f.Object != "o1" {
+		t.Fatalf("unexpected file in the snapshot: %v %v", f, err)
+	}
+	if _, err = view("s1", "/h"); !errors.IsNotFound(err) {
+		t.Fatalf("expected a NotFound error for a file created since, got %v", err)
+	}
+	if l := list("s1", ""); l != "[a g k]" {
+		t.Fatalf("unexpected listing of the snapshot: %s", l)
+	}
+	if f, _ := c.Get("ns", "/ns/d/b/f"); f.Object != "o3" || f.Size != 7 {
+		t.Fatalf("unexpected current file: %#v", f)
+	}
+
+	// the snapshots are read-only, and their directory stays
+	if _, err = NewOperation(api.OpsDirCreate, "ns", "/ns/d/.snapshot/s1/x", "", &fs.Attr{Mode: 0755}, now).apply(c); !errors.IsPermissionDenied(err) {
+		t.Fatalf("expected a PermissionDenied error, got %v", err)
+	}
+	if _, err = NewOperation(api.OpsDelete, "ns", "/ns/d", "", nil, now).apply(c); !errors.Is(err, errors.KindBadParameter) {
+		t.Fatalf("expected a BadParameter error deleting a snapshottable directory, got %v", err)
+	}
+	if _, err = NewOperation(api.OpsDisallowSnapshot, "ns", "/ns/d", "", nil, now).apply(c); !errors.Is(err, errors.KindBadParameter) {
+		t.Fatalf("expected a BadParameter error with snapshots, got %v", err)
+	}
+
+	// the copies are kept by the state machine
+	b, err := NewStateMachine(c).Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newTestCache(t)
+	if err = NewStateMachine(r).Recovery(b); err != nil {
+		t.Fatal(err)
+	}
+	d, _ := r.Get("ns", "/ns/d")
+	if f, err := cache.SnapshotFile(r, "ns", d, d.Snapshots[0], "/g", nil); err != nil || f.Object != "o2" {
+		t.Fatalf("unexpected recovered file: %v %v", f, err)
+	}
+
+	if _, err = snapshot(api.OpsCreateSnapshot, "s2", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = snapshot(api.OpsRenameSnapshot, "s2", "s3"); err != nil {
+		t.Fatal(err)
+	}
+	create("/ns/d/k", "o6", 1)
+	if l := list("s3", ""); l != "[b h k]" {
+		t.Fatalf("unexpected listing of the renamed snapshot: %s", l)
+	}
+
+	// the copies of a deleted snapshot move to the previous one
+	ret, err = snapshot(api.OpsDeleteSnapshot, "s3", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f, err := view("s1", "/k"); err != nil || f.Object != "o4" {
+		t.Fatalf("unexpected file moved to the previous snapshot: %v %v", f, err)
+	}
+	objects := func(files []*fs.File) string {
+		keys := []string{}
+		for _, f := range files {
+			if !f.IsDirectory() {
+				keys = append(keys, f.Object)
+			}
+		}
+		sort.Strings(keys)
+		return fmt.Sprint(keys)
+	}
+	if o := objects(ret.([]*fs.File)); o != "[]" {
+		t.Fatalf("unexpected dropped objects: %s", o)
+	}
+	ret, err = snapshot(api.OpsDeleteSnapshot, "s1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o := objects(ret.([]*fs.File)); o != "[o1 o2 o4]" {
+		t.Fatalf("unexpected dropped objects: %s", o)
+	}
+	applyOp(t, c, NewOperation(api.OpsDisallowSnapshot, "ns", "/ns/d", "", nil, now))
+}
+
+func TestVersions(t *testing.T) {
+	c := newTestCache(t)
+	now := time.Now()
+	create := func(p, object string, size uint64, at time.Time) *fs.File {
+		o := NewOperation(api.OpsFileCreate, "ns", p, "", &fs.Attr{Mode: 0644, Size: size}, at)
+		o.Overwrite = true
+		o.Object = object
+		return applyOp(t, c, o).(*fs.File)
+	}
+	objects := func(f *fs.File) string {
+		keys := []string{}
+		for _, v := range f.Versions {
+			keys = append(keys, fmt.Sprintf("%d:%s", v.Version, v.Object))
+		}
+		return fmt.Sprint(keys)
+	}
+	setVersioning := func(dir string, v *fs.Versioning) {
+		o := NewOperation(api.OpsSetVersioning, "ns", dir, "", nil, now)
+		o.Versioning = v
+		applyOp(t, c, o)
+	}
+
+	applyOp(t, c, NewOperation(api.OpsDirCreate, "ns", "/ns/d/sub", "", &fs.Attr{Mode: 0755}, now))
+	create("/ns/d/sub/f", "o1", 5, now)
+	if f := create("/ns/d/sub/f", "o2", 3, now); len(f.Versions) != 0 {
+		t.Fatalf("unexpected versions without versioning: %s", objects(f))
+	}
+	if _, err := NewOperation(api.OpsSetVersioning, "ns", "/ns/d/sub/f", "", nil, now).apply(c); !errors.IsNotDirectory(err) {
+		t.Fatalf("expected a NotDirectory error, got %v", err)
+	}
+
+	// the policy of the nearest directory applies
+	setVersioning("/ns/d", &fs.Versioning{Enabled: true, MaxVersions: 2})
+	create("/ns/d/sub/f", "o3", 7, now)
+	create("/ns/d/sub/f", "o4", 1, now)
+	f := create("/ns/d/sub/f", "o5", 2, now)
+	if o := objects(f); o != "[2:o3 3:o4]" || f.Object != "o5" {
+		t.Fatalf("unexpected versions %s of %s", o, f.Object)
+	}
+	setVersioning("/ns/d/sub", &fs.Versioning{Enabled: false})
+	if f = create("/ns/d/sub/f", "o6", 2, now); objects(f) != "[2:o3 3:o4]" {
+		t.Fatalf("unexpected versions with versioning disabled: %s", objects(f))
+	}
+	setVersioning("/ns/d/sub", nil)
+
+	// a restore keeps the content it replaces
+	o := NewOperation(api.OpsRestoreVersion, "ns", "/ns/d/sub/f", "", nil, now)
+	o.Version = 9
+	o.Object = "o7"
+	if _, err := o.apply(c); !errors.IsNotFound(err) {
+		t.Fatalf("expected a NotFound error, got %v", err)
+	}
+	o.Version = 2
+	f = applyOp(t, c, o).(*fs.File)
+	if o := objects(f); o != "[3:o4 4:o6]" || f.Object != "o7" || f.Size != 7 {
+		t.Fatalf("unexpected restored file %s %d with versions %s", f.Object, f.Size, o)
+	}
+	d, _ := c.Get("ns", "/ns/d")
+	if d.Summary.Length != 7 {
+		t.Fatalf("unexpected length of the tree: %d", d.Summary.Length)
+	}
+
+	// the versions older than the maximum age are pruned
+	setVersioning("/ns/d", &fs.Versioning{Enabled: true, MaxAge: 60})
+	create("/ns/d/sub/f", "o8", 1, now.Add(30*time.Minute))
+	f = applyOp(t, c, NewOperation(api.OpsPruneVersions, "ns", "/ns/d/sub/f", "", nil, now.Add(90*time.Minute))).(*fs.File)
+	if o := objects(f); o != "[5:o7]" {
+		t.Fatalf("unexpected versions once pruned: %s", o)
+	}
+}
+
+func TestFsckRepairs(t *testing.T) {
+	c := newTestCache(t)
+	now := time.Now()
+
+	applyOp(t, c, NewOperation(api.OpsDirCreate, "ns", "/ns/a", "", &fs.Attr{Mode: 0755}, now))
+	o := NewOperation(api.OpsFileCreate, "ns", "/ns/a/f", "", &fs.Attr{Mode: 0644, Size: 5}, now)
+	o.Object = "objects/1"
+	applyOp(t, c, o)
+	applyOp(t, c, NewOperation(api.OpsCreateHardLink, "ns", "/ns/l", "/ns/a/f", nil, now))
+
+	// an entry whose parent was lost is linked back to its directory
+	f, _ := c.Get("ns", "/ns/a/f")
+	f.Parent = nil
+	c.(*cache.Memory).Files["ns"]["/ns/a/f"] = f
+	f = applyOp(t, c, NewOperation(api.OpsRepairParent, "ns", "/ns/a/f", "", nil, now)).(*fs.File)
+	if f.Parent == nil || f.FullPath() != "/ns/a/f" {
+		t.Fatalf("unexpected repaired file: %#v", f)
+	}
+	if _, err := NewOperation(api.OpsRepairParent, "ns", "/ns/a/g", "", nil, now).apply(c); !errors.IsNotFound(err) {
+		t.Fatalf("expected a NotFound error, got %v", err)
+	}
+
+	// a file renumbered takes its links along
+	dir, _ := c.Get("ns", "/ns/a")
+	ino := f.Inode
+	f = applyOp(t, c, NewOperation(api.OpsRenumber, "ns", "/ns/a/f", "", nil, now)).(*fs.File)
+	if f.Inode == ino || f.Inode == dir.Inode {
+		t.Fatalf("unexpected inode number %d, was %d", f.Inode, ino)
+	}
+	if l, _ := c.Get("ns", "/ns/l"); l.Inode != f.Inode {
+		t.Fatalf("the link has the inode number %d, expected %d", l.Inode, f.Inode)
+	}
+	if _, err := NewOperation(api.OpsRenumber, "ns", "/ns/l", "", nil, now).apply(c); !errors.Is(err, errors.KindBadParameter) {
+		t.Fatalf("expected a BadParameter error, got %v", err)
+	}
+}
+
+func TestSegments(t *testing.T) {
+	c := newTestCache(t)
+	now := time.Now()
+	layout := func(f *fs.File) string {
+		return fmt.Sprint(f.Size, f.Pieces())
+	}
+	op := func(t, name string, size uint64, segments []fs.Segment, replaced ...string) *Operation {
+		o := NewOperation(t, "ns", name, "", &fs.Attr{Size: size}, now)
+		o.Segments, o.Replaced = segments, replaced
+		return o
+	}
+
+	applyOp(t, c, NewOperation(api.OpsDirCreate, "ns", "/ns/a", "", &fs.Attr{Mode: 0755}, now))
+	o := NewOperation(api.OpsFileCreate, "ns", "/ns/a/f", "", &fs.Attr{Mode: 0644, Size: 5}, now)
+	o.Object = "o1"
+	o.Checksums = &fs.Checksums{MD5: []byte{1}}
+	applyOp(t, c, o)
+
+	applyOp(t, c, op(api.OpsAppend, "/ns/a/f", 0, []fs.Segment{{Object: "o2", Size: 3}}))
+	f := applyOp(t, c, op(api.OpsAppend, "/ns/a/f", 0, []fs.Segment{{Object: "o3", Size: 4}})).(*fs.File)
+	if s := layout(f); s != "12 [{o1 5} {o2 3} {o3 4}]" || f.Checksums() != nil {
+		t.Fatalf("unexpected appended file: %s %v", s, f.Checksums())
+	}
+	if a, _ := c.Get("ns", "/ns/a"); a.Summary.Length != 12 {
+		t.Fatalf("unexpected summary of /ns/a: %+v", *a.Summary)
+	}
+
+	// truncating at the end of a segment drops the next ones
+	f = applyOp(t, c, op(api.OpsTruncate, "/ns/a/f", 8, nil)).(*fs.File)
+	if s := layout(f); s != "8 [{o1 5} {o2 3}]" {
+		t.Fatalf("unexpected truncated file: %s", s)
+	}
+	// cutting a segment replaces it with its rewritten part
+	o = op(api.OpsTruncate, "/ns/a/f", 2, nil)
+	if _, err := o.apply(c); !errors.Is(err, errors.KindRetriable) {
+		t.Fatalf("expected a Retriable error, got %v", err)
+	}
+	o = op(api.OpsTruncate, "/ns/a/f", 2, []fs.Segment{{Object: "o4", Size: 2}}, "o1")
+	f = applyOp(t, c, o).(*fs.File)
+	if s := layout(f); s != "2 [{o4 2}]" || f.Object != "o4" || len(f.Segments) != 0 {
+		t.Fatalf("unexpected truncated file: %s", s)
+	}
+	if _, err := op(api.OpsTruncate, "/ns/a/f", 3, nil).apply(c); !errors.Is(err, errors.KindBadParameter) {
+		t.Fatalf("expected a BadParameter error, got %v", err)
+	}
+	if a, _ := c.Get("ns", "/ns/a"); a.Summary.Length != 2 {
+		t.Fatalf("unexpected summary of /ns/a: %+v", *a.Summary)
+	}
+
+	// compaction merges runs of segments, and keeps the content
+	for _, s := range []fs.Segment{{Object: "o5", Size: 1}, {Object: "o6", Size: 100}, {Object: "o7", Size: 1}, {Object: "o8", Size: 2}} {
+		applyOp(t, c, op(api.OpsAppend, "/ns/a/f", 0, []fs.Segment{s}))
+	}
+	f, _ = c.Get("ns", "/ns/a/f")
+	if runs := fs.SmallRuns(f.Pieces(), 10); fmt.Sprint(runs) != "[[0 2] [3 5]]" {
+		t.Fatalf("unexpected runs: %v", runs)
+	}
+	if _, err := op(api.OpsCompact, "/ns/a/f", 0, []fs.Segment{{Object: "o9", Size: 4}}, "o7", "o8").apply(c); !errors.Is(err, errors.KindRetriable) {
+		t.Fatalf("expected a Retriable error, got %v", err)
+	}
+	mtime := f.Mtime
+	f = applyOp(t, c, op(api.OpsCompact, "/ns/a/f", 0, []fs.Segment{{Object: "o9", Size: 3}}, "o7", "o8")).(*fs.File)
+	if s := layout(f); s != "106 [{o4 2} {o5 1} {o6 100} {o9 3}]" || !f.Mtime.Equal(mtime) {
+		t.Fatalf("unexpected compacted file: %s", s)
+	}
+	o = op(api.OpsCompact, "/ns/a/f", 0, []fs.Segment{{Object: "o10", Size: 106}}, "o4", "o5", "o6", "o9")
+	o.Checksums = &fs.Checksums{MD5: []byte{2}}
+	f = applyOp(t, c, o).(*fs.File)
+	if s := layout(f); s != "106 [{o10 106}]" || f.Checksums() == nil {
+		t.Fatalf("unexpected compacted file: %s", s)
+	}
+
+	// a file created of chunks stores the first one in its object
+	o = NewOperation(api.OpsFileCreate, "ns", "/ns/a/f", "", &fs.Attr{Mode: 0644, Size: 10}, now)
+	o.Overwrite = true
+	o.Object, o.Segments = "c1", []fs.Segment{{Object: "c2", Size: 4}, {Object: "c3", Size: 2}}
+	f = applyOp(t, c, o).(*fs.File)
+	if s := layout(f); s != "10 [{c1 4} {c2 4} {c3 2}]" || f.Checksums() != nil {
+		t.Fatalf("unexpected file of chunks: %s", s)
+	}
+	if a, _ := c.Get("ns", "/ns/a"); a.Summary.Length != 10 {
+		t.Fatalf("unexpected summary of /ns/a: %+v", *a.Summary)
+	}
+}
+
+func TestChunks(t *testing.T) {
+	c := newTestCache(t)
+	now := time.Now()
+	upload := func(p, object string, uploaded time.Time) {
+		o := NewOperation(api.OpsUploadChunk, "ns", p, "", &fs.Attr{Uid: 1000}, uploaded)
+		o.Chunks = []fs.Chunk{{Object: object, Size: 4, MD5: object}}
+		o.Retention = time.Hour
+		applyOp(t, c, o)
+	}
+	chunks := func() []string {
+		d, err := c.Get("ns", "/ns/d")
+		if err != nil {
+			t.Fatal(err)
+		}
+		objects := []string{}
+		for _, ch := range d.Chunks {
+			objects = append(objects, ch.Object)
+		}
+		return objects
+	}
+
+	applyOp(t, c, NewOperation(api.OpsDirCreate, "ns", "/ns/d", "", &fs.Attr{Mode: 0755}, now))
+	upload("/ns/d/f", "o1", now.Add(-2*time.Hour))
+	upload("/ns/d/f", "o2", now)
+	upload("/ns/d/f", "o3", now)
+	upload("/ns/d/g", "o4", now)
+	// the chunks older than the retention are dropped
+	if l := fmt.Sprint(chunks()); l != "[o2 o3 o4]" {
+		t.Fatalf("unexpected chunks %s", l)
+	}
+
+	commit := NewOperation(api.OpsCommitChunks, "ns", "/ns/d/f", "", &fs.Attr{Mode: 0644, Uid: 1000}, now)
+	commit.Chunks = []fs.Chunk{{Object: "o3", Size: 4, MD5: "o3"}, {Object: "o4", Size: 4, MD5: "o4"}}
+	if _, err := commit.apply(c); !errors.Is(err, errors.KindBadParameter) {
+		t.Fatalf("expected a BadParameter error for the chunk of another file, got %v", err)
+	}
+	commit.Chunks = []fs.Chunk{{Object: "o3", Size: 4, MD5: "o3"}, {Object: "o2", Size: 4, MD5: "o2"}}
+	applyOp(t, c, commit)
+	f, err := c.Get("ns", "/ns/d/f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Object != "o3" || f.Size != 8 || len(f.Segments) != 1 || f.Segments[0].Object != "o2" {
+		t.Fatalf("unexpected file: %#v", f)
+	}
+	if l := fmt.Sprint(chunks()); l != "[o4]" {
+		t.Fatalf("unexpected chunks %s", l)
+	}
+	if d, _ := c.Get("ns", "/ns/d"); *d.Summary != (fs.Summary{Files: 1, Directories: 1, Length: 8}) {
+		t.Fatalf("unexpected summary of /ns/d: %+v", *d.Summary)
+	}
+	// the chunks are used once
+	commit.Overwrite = true
+	if _, err = commit.apply(c); !errors.Is(err, errors.KindBadParameter) {
+		t.Fatalf("expected a BadParameter error, got %v", err)
+	}
+}
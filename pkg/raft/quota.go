@@ -0,0 +1,63 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package raft
+
+import (
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/cache"
+	"github.com/gostor/gofs/pkg/errors"
+	"github.com/gostor/gofs/pkg/fs"
+)
+
+// setQuota sets the limits of the quota of the directory Filename to those
+// of Quota, or clears them with CLRQUOTA. The usage of the tree is its
+// summary, which is counted first if the directory has none.
+func (o *Operation) setQuota(c cache.Cache) (interface{}, error) {
+	f, err := o.lookup(c, o.Filename)
+	if err != nil {
+		return nil, err
+	}
+	if !f.IsDirectory() {
+		return nil, errors.NotDirectory("cannot set the quota of %s, which is not a directory", o.Filename)
+	}
+	names, space := fs.QuotaReset, fs.QuotaReset
+	if o.Type == api.OpsSetQuota {
+		if o.Quota == nil {
+			return nil, errors.BadParameter("missing quota")
+		}
+		names, space = o.Quota.Names, o.Quota.Space
+	}
+	if f.Summary == nil {
+		s, err := cache.Summarize(c, o.Namespace, f)
+		if err != nil {
+			return nil, err
+		}
+		f.Summary = &s
+	}
+	q := fs.Quota{Names: fs.QuotaReset, Space: fs.QuotaReset}
+	if f.Quota != nil {
+		q = *f.Quota
+	}
+	if q.Update(names, space) {
+		f.Quota = &q
+	} else {
+		f.Quota = nil
+	}
+	if _, err = c.Update(o.Namespace, f.FullPath(), f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
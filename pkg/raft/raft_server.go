@@ -18,7 +18,6 @@ package raft
 import (
 	"bytes"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io/ioutil"
 	"math/rand"
@@ -34,7 +33,9 @@ import (
 	log "github.com/Sirupsen/logrus"
 	"github.com/goraft/raft"
 	"github.com/gorilla/mux"
+	"github.com/gostor/gofs/pkg/auth"
 	"github.com/gostor/gofs/pkg/cache"
+	"github.com/gostor/gofs/pkg/errors"
 )
 
 type RaftServer struct {
@@ -44,15 +45,22 @@ type RaftServer struct {
 	httpAddr   string
 	router     *mux.Router
 	httpServer *http.Server
+	// secret is shared by the peers, see auth.CheckPeer
+	secret string
+	client *http.Client
 }
 
-func NewRaftServer(peers []string, httpAddr string, dataDir string, pulseSeconds int, r *mux.Router, httpServer *http.Server, cache cache.Cache) (*RaftServer, error) {
+// NewRaftServer starts the raft server, and joins the peers with the secret
+// they share, which the requests of the peers must carry unless it is empty.
+func NewRaftServer(peers []string, httpAddr string, dataDir string, pulseSeconds int, r *mux.Router, httpServer *http.Server, cache cache.Cache, secret string) (*RaftServer, error) {
 	s := &RaftServer{
 		peers:      peers,
 		httpAddr:   httpAddr,
 		dataDir:    dataDir,
 		router:     r,
 		httpServer: httpServer,
+		secret:     secret,
+		client:     &http.Client{Transport: &auth.PeerTransport{Secret: secret, Base: http.DefaultTransport}},
 	}
 
 	if log.GetLevel() == log.DebugLevel {
@@ -62,6 +70,12 @@ func NewRaftServer(peers []string, httpAddr string, dataDir string, pulseSeconds
 	var err error
 	transporter := raft.NewHTTPTransporter("/cluster", 0)
 	transporter.Transport.MaxIdleConnsPerHost = 1024
+	if secret != "" {
+		// the transporter only lets its http.Transport be configured: the
+		// requests to the peers go through a RoundTripper registered for
+		// their scheme instead, which adds the secret
+		transporter.Transport.RegisterProtocol("http", &auth.PeerTransport{Secret: secret, Base: &http.Transport{MaxIdleConnsPerHost: 1024}})
+	}
 	log.Debugf("Starting RaftServer with IP:%v:", httpAddr)
 
 	// Clear old cluster configurations if peers are changed
@@ -72,11 +86,15 @@ func NewRaftServer(peers []string, httpAddr string, dataDir string, pulseSeconds
 		os.RemoveAll(path.Join(s.dataDir, "snapshot"))
 	}
 
-	s.raftServer, err = raft.NewServer(s.httpAddr, s.dataDir, transporter, nil, cache, "")
+	s.raftServer, err = raft.NewServer(s.httpAddr, s.dataDir, transporter, NewStateMachine(cache), cache, "")
 	if err != nil {
 		log.Error(err)
 		return nil, err
 	}
+	// the log is replayed on top of the last snapshot, if any
+	if err = s.raftServer.LoadSnapshot(); err != nil {
+		log.Debugf("No snapshot loaded: %v", err)
+	}
 	transporter.Install(s.raftServer, s)
 	s.raftServer.SetHeartbeatInterval(500 * time.Millisecond)
 	s.raftServer.SetElectionTimeout(time.Duration(pulseSeconds) * 500 * time.Millisecond)
@@ -121,11 +139,44 @@ func NewRaftServer(peers []string, httpAddr string, dataDir string, pulseSeconds
 		log.Infoln("Old conf,log,snapshot should have been removed.")
 	}
 
+	go s.snapshotLoop()
 	return s, nil
 }
 
+const (
+	// snapshotInterval is the interval between the checks for a snapshot.
+	snapshotInterval = time.Minute
+	// snapshotThreshold is the number of commands committed since the last
+	// snapshot which trigger a new one.
+	snapshotThreshold = 10000
+)
+
+// snapshotLoop takes a snapshot of the state once snapshotThreshold commands
+// were committed since the last one, which lets raft compact its log.
+func (s *RaftServer) snapshotLoop() {
+	last := s.raftServer.CommitIndex()
+	for range time.Tick(snapshotInterval) {
+		index := s.raftServer.CommitIndex()
+		if index-last < snapshotThreshold {
+			continue
+		}
+		if err := s.raftServer.TakeSnapshot(); err != nil {
+			log.Warnf("Failed to take a raft snapshot: %v", err)
+			continue
+		}
+		log.Infof("Took a raft snapshot at index %d", index)
+		last = index
+	}
+}
+
+// Do commits the command to the raft log, and returns the result of applying
+// it. It fails with a NotLeader error unless the server is the leader.
 func (s *RaftServer) Do(command raft.Command) (interface{}, error) {
-	return s.raftServer.Do(command)
+	ret, err := s.raftServer.Do(command)
+	if err == raft.NotLeaderError {
+		return nil, errors.NotLeader("%s is not the raft leader, the current leader is %q", s.httpAddr, s.raftServer.Leader())
+	}
+	return ret, err
 }
 
 func (s *RaftServer) Leader() (string, error) {
@@ -145,10 +196,18 @@ func (s *RaftServer) Peers() (members []string) {
 	return
 }
 
-// This is a hack around Gorilla mux not providing the correct net/http
-// HandleFunc() interface.
+// HandleFunc registers the handler of a raft transport route, which only
+// serves the requests of the peers. This is a hack around Gorilla mux not
+// providing the correct net/http HandleFunc() interface.
 func (s *RaftServer) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
-	s.router.HandleFunc(pattern, handler)
+	s.router.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		if err := auth.CheckPeer(r, s.secret); err != nil {
+			log.Infof("Rejected %s %s from %s: %v", r.Method, r.URL.Path, r.RemoteAddr, err)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		handler(w, r)
+	})
 }
 
 // Returns the connection string.
@@ -198,7 +257,7 @@ func (s *RaftServer) Join(peers []string) error {
 		target := fmt.Sprintf("http://%s/cluster/join", strings.TrimSpace(m))
 		log.Infoln("Attempting to connect to:", target)
 
-		err = postFollowingOneRedirect(target, "application/json", b)
+		err = postFollowingOneRedirect(s.client, target, "application/json", b)
 
 		if err != nil {
 			log.Infoln("Post returned error: ", err.Error())
@@ -211,13 +270,13 @@ func (s *RaftServer) Join(peers []string) error {
 		}
 	}
 
-	return errors.New("Could not connect to any cluster peers")
+	return fmt.Errorf("Could not connect to any cluster peers")
 }
 
 // a workaround because http POST following redirection misses request body
-func postFollowingOneRedirect(target string, contentType string, b bytes.Buffer) error {
+func postFollowingOneRedirect(client *http.Client, target string, contentType string, b bytes.Buffer) error {
 	backupReader := bytes.NewReader(b.Bytes())
-	resp, err := http.Post(target, contentType, &b)
+	resp, err := client.Post(target, contentType, &b)
 	if err != nil {
 		return err
 	}
@@ -230,7 +289,7 @@ func postFollowingOneRedirect(target string, contentType string, b bytes.Buffer)
 		urlStr := reply[1 : len(reply)-1]
 
 		log.Infoln("Post redirected to ", urlStr)
-		resp2, err2 := http.Post(urlStr, contentType, backupReader)
+		resp2, err2 := client.Post(urlStr, contentType, backupReader)
 		if err2 != nil {
 			return err2
 		}
@@ -241,7 +300,7 @@ func postFollowingOneRedirect(target string, contentType string, b bytes.Buffer)
 
 	log.Infoln("Post returned status: ", statusCode, string(data))
 	if statusCode != http.StatusOK {
-		return errors.New(string(data))
+		return fmt.Errorf("%s", data)
 	}
 
 	return nil
@@ -0,0 +1,304 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package raft
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/cache"
+	"github.com/gostor/gofs/pkg/errors"
+	"github.com/gostor/gofs/pkg/fs"
+)
+
+// rename moves the file or directory tree Filename to NewName, replacing
+// the destination if Overwrite is set, and returns the replaced entries. A
+// directory may only replace an empty directory, and a file a file.
+//
+// The files stored at their RemotePath take the object keys Objects maps
+// their old paths to, since their data does not move with them; the others
+// keep their objects. The changes are all made in a single batch of the
+// cache, so that the tree is never left half moved.
+func (o *Operation) rename(c cache.Cache) (interface{}, error) {
+	var removed []*fs.File
+	err := c.Batch(func(c cache.Cache) error {
+		var err error
+		removed, err = o.renameTree(c)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return removed, nil
+}
+
+// renameTree is rename, in the batch c.
+func (o *Operation) renameTree(c cache.Cache) ([]*fs.File, error) {
+	f, err := o.lookup(c, o.Filename)
+	if err != nil {
+		return nil, err
+	}
+	if f.Parent == nil {
+		return nil, errors.BadParameter("cannot rename the root of namespace %s", o.Namespace)
+	}
+	if o.NewName == o.Filename {
+		return []*fs.File{}, nil
+	}
+	srcDir, err := o.lookupParent(c, o.Filename)
+	if err != nil {
+		return nil, err
+	}
+	dstDir, err := o.lookupParent(c, o.NewName)
+	if err != nil {
+		return nil, err
+	}
+	req := &api.RenameRequest{NewDir: dstDir.Inode, OldName: f.Path, NewName: filepath.Base(o.NewName)}
+	if _, err = srcDir.Rename(context.Background(), req, f, dstDir); err != nil {
+		return nil, err
+	}
+	var freed fs.Summary
+	old, err := c.Get(o.Namespace, o.NewName)
+	if err == nil {
+		if freed, err = o.checkReplace(c, f, old); err != nil {
+			return nil, err
+		}
+		if old.Inode == f.Inode {
+			// both are links to the same file
+			return []*fs.File{}, nil
+		}
+	} else if !errors.IsNotFound(err) {
+		return nil, err
+	}
+	s := f.Entry()
+	if f.IsDirectory() {
+		if f.Summary != nil {
+			s = *f.Summary
+		} else if s, err = cache.Summarize(c, o.Namespace, f); err != nil {
+			return nil, err
+		}
+	}
+	if err = o.checkMove(c, srcDir.FullPath(), dstDir.FullPath(), s.Add(freed.Neg())); err != nil {
+		return nil, err
+	}
+	if err = o.checkObjects(c, f); err != nil {
+		return nil, err
+	}
+
+	removed := []*fs.File{}
+	if old != nil {
+		sub := *o
+		sub.Filename = o.NewName
+		sub.Recursive = false
+		ret, err := sub.delete(c)
+		if err != nil {
+			return nil, err
+		}
+		removed = ret.([]*fs.File)
+	}
+	if err = o.charge(c, srcDir.FullPath(), s.Neg(), false); err != nil {
+		return nil, err
+	}
+	if err = o.charge(c, dstDir.FullPath(), s, false); err != nil {
+		return nil, err
+	}
+	// the files and their parents have changed along the way
+	if f, err = c.Get(o.Namespace, o.Filename); err != nil {
+		return nil, err
+	}
+	if dstDir, err = o.lookup(c, dstDir.FullPath()); err != nil {
+		return nil, err
+	}
+	if err = o.move(c, f, dstDir, req.NewName); err != nil {
+		return nil, err
+	}
+	return removed, nil
+}
+
+// checkReplace checks that f may replace the existing file old, and returns
+// the summary of the entries freed by its removal.
+func (o *Operation) checkReplace(c cache.Cache, f, old *fs.File) (fs.Summary, error) {
+	if !o.Overwrite {
+		return fs.Summary{}, errors.AlreadyExists("%s already exists", o.NewName)
+	}
+	switch {
+	case old.IsDirectory() && !f.IsDirectory():
+		return fs.Summary{}, errors.IsDirectory("%s is a directory", o.NewName)
+	case !old.IsDirectory() && f.IsDirectory():
+		return fs.Summary{}, errors.NotDirectory("not a directory: %s", o.NewName)
+	case old.IsDirectory():
+		children, err := c.List(o.Namespace, o.NewName)
+		if err != nil {
+			return fs.Summary{}, err
+		}
+		if len(children) > 0 {
+			return fs.Summary{}, errors.NotEmpty("directory %s is not empty", o.NewName)
+		}
+	}
+	return old.Entry(), nil
+}
+
+// checkMove checks the quotas of the ancestors of the directory dst which
+// the tree moved from the directory src adds d to. Their common ancestors
+// keep their usage.
+func (o *Operation) checkMove(c cache.Cache, src, dst string, d fs.Summary) error {
+	dirs, err := o.ancestors(c, dst)
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		if p := dir.FullPath(); p == src || strings.HasPrefix(src, p+"/") {
+			return nil
+		}
+		if err = dir.CheckQuota(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkObjects checks that the files of the tree of f stored at their
+// RemotePath have a new object key in Objects.
+func (o *Operation) checkObjects(c cache.Cache, f *fs.File) error {
+	if isRegular(f) && f.Object == "" && o.Objects[f.FullPath()] == "" {
+		return errors.BadParameter("%s has no object key", f.FullPath())
+	}
+	if !f.IsDirectory() {
+		return nil
+	}
+	children, err := c.List(o.Namespace, f.FullPath())
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		if err = o.checkObjects(c, child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// move moves the file f, and the tree below it, to the directory dir with
+// the name. Every entry of the tree is stored again at its new path, along
+// with the links to and from the outside of the tree.
+func (o *Operation) move(c cache.Cache, f, dir *fs.File, name string) error {
+	from := f.FullPath()
+	var children []*fs.File
+	if f.IsDirectory() {
+		var err error
+		if children, err = c.List(o.Namespace, from); err != nil {
+			return err
+		}
+	}
+	moved, err := f.Parent.Rename(context.Background(), &api.RenameRequest{NewDir: dir.Inode, OldName: f.Path, NewName: name}, f, dir)
+	if err != nil {
+		return err
+	}
+	if from == o.Filename {
+		moved.Ctime = o.CreatedAt
+	}
+	if isRegular(moved) && moved.Object == "" {
+		moved.Object = o.Objects[from]
+	}
+	if err = o.relink(c, moved); err != nil {
+		return err
+	}
+	if err = c.Delete(o.Namespace, from); err != nil {
+		return err
+	}
+	if err = c.Add(o.Namespace, moved); err != nil {
+		return err
+	}
+	for _, child := range children {
+		if err = o.move(c, child, moved, child.Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// relink updates the paths the hard links of the moved file f refer to.
+// The links inside the moved tree are updated as they move themselves.
+func (o *Operation) relink(c cache.Cache, f *fs.File) error {
+	if f.IsLink() {
+		target := o.moved(f.Target)
+		if target == f.Target {
+			t, err := c.Get(o.Namespace, target)
+			if err != nil {
+				return err
+			}
+			t.Links = replacePath(t.Links, o.unmoved(f.FullPath()), f.FullPath())
+			if _, err = c.Update(o.Namespace, target, t); err != nil {
+				return err
+			}
+		}
+		f.Target = target
+		return nil
+	}
+	if len(f.Links) == 0 {
+		return nil
+	}
+	links := make([]string, len(f.Links))
+	for i, p := range f.Links {
+		links[i] = o.moved(p)
+		if links[i] != p {
+			continue
+		}
+		link, err := c.Get(o.Namespace, p)
+		if err != nil {
+			return err
+		}
+		link.Target = f.FullPath()
+		if _, err = c.Update(o.Namespace, p, link); err != nil {
+			return err
+		}
+	}
+	f.Links = links
+	return nil
+}
+
+// moved returns the path p, once the tree Filename moved to NewName.
+func (o *Operation) moved(p string) string {
+	if p == o.Filename || strings.HasPrefix(p, o.Filename+"/") {
+		return o.NewName + p[len(o.Filename):]
+	}
+	return p
+}
+
+// unmoved returns the path p had before the tree Filename moved to NewName.
+func (o *Operation) unmoved(p string) string {
+	if p == o.NewName || strings.HasPrefix(p, o.NewName+"/") {
+		return o.Filename + p[len(o.NewName):]
+	}
+	return p
+}
+
+func replacePath(paths []string, p, q string) []string {
+	replaced := make([]string, len(paths))
+	for i, r := range paths {
+		if r == p {
+			r = q
+		}
+		replaced[i] = r
+	}
+	return replaced
+}
+
+// isRegular returns true if f is a regular file, which has data.
+func isRegular(f *fs.File) bool {
+	return !f.IsDirectory() && !f.IsSymlink() && !f.IsLink()
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package raft
+
+import (
+	"path/filepath"
+
+	"github.com/gostor/gofs/pkg/cache"
+	"github.com/gostor/gofs/pkg/errors"
+	"github.com/gostor/gofs/pkg/fs"
+)
+
+// segmented returns the regular file Filename, whose segments the segment
+// operations change.
+func (o *Operation) segmented(c cache.Cache) (*fs.File, error) {
+	f, err := o.lookup(c, o.Filename)
+	if err != nil {
+		return nil, err
+	}
+	if !isRegular(f) {
+		return nil, errors.BadParameter("%s is not a regular file", o.Filename)
+	}
+	return f, nil
+}
+
+// appendSegment adds the segment of Segments to the end of the content of
+// the file Filename, whose size is charged to the summaries of the
+// ancestors of the file.
+func (o *Operation) appendSegment(c cache.Cache) (interface{}, error) {
+	f, err := o.segmented(c)
+	if err != nil {
+		return nil, err
+	}
+	if len(o.Segments) != 1 {
+		return nil, errors.BadParameter("missing segment")
+	}
+	s := o.Segments[0]
+	if err = o.charge(c, filepath.Dir(o.Filename), fs.Summary{Length: s.Size}, true); err != nil {
+		return nil, err
+	}
+	f.SetPieces(append(f.Pieces(), s))
+	f.ClearChecksums()
+	f.Mtime = o.CreatedAt
+	f.Ctime = o.CreatedAt
+	if _, err = c.Update(o.Namespace, o.Filename, f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// truncate truncates the content of the file Filename to the size of
+// FileAttr, which cannot be larger. The segments past the size are dropped,
+// and the segment cut is replaced by the one of Segments, holding the part
+// of it which is kept. The truncation fails as retriable if the content
+// changed since the segment was rewritten.
+func (o *Operation) truncate(c cache.Cache) (interface{}, error) {
+	f, err := o.segmented(c)
+	if err != nil {
+		return nil, err
+	}
+	if o.FileAttr == nil {
+		return nil, errors.BadParameter("missing size")
+	}
+	size := int64(o.FileAttr.Size)
+	if size > int64(f.Size) {
+		return nil, errors.BadParameter("cannot truncate %s of %d bytes to %d bytes", o.Filename, f.Size, size)
+	}
+	if size == int64(f.Size) {
+		return f, nil
+	}
+	p := f.Pieces()
+	i, kept := fs.Cut(p, size)
+	if kept == p[i].Size {
+		p = p[:i+1]
+	} else {
+		if len(o.Segments) != 1 || len(o.Replaced) != 1 || o.Replaced[0] != p[i].Object || o.Segments[0].Size != kept {
+			return nil, errors.Retriable("the content of %s changed while it was truncated", o.Filename)
+		}
+		p = append(p[:i:i], o.Segments[0])
+	}
+	if err = o.charge(c, filepath.Dir(o.Filename), fs.Summary{Length: size - int64(f.Size)}, false); err != nil {
+		return nil, err
+	}
+	f.SetPieces(p)
+	f.ClearChecksums()
+	f.Mtime = o.CreatedAt
+	f.Ctime = o.CreatedAt
+	if _, err = c.Update(o.Namespace, o.Filename, f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// compact replaces the consecutive segments of the file Filename whose keys
+// are Replaced with the segment of Segments, which holds their data. The
+// content does not change, so neither do the times of the file, and the
+// Checksums are recorded if the content is then a single segment. The
+// compaction fails as retriable if the segments changed meanwhile.
+func (o *Operation) compact(c cache.Cache) (interface{}, error) {
+	f, err := o.segmented(c)
+	if err != nil {
+		return nil, err
+	}
+	if len(o.Segments) != 1 || len(o.Replaced) == 0 {
+		return nil, errors.BadParameter("missing segments")
+	}
+	p := f.Pieces()
+	start := -1
+	for i, s := range p {
+		if s.Object == o.Replaced[0] {
+			start = i
+			break
+		}
+	}
+	var size int64
+	for i, key := range o.Replaced {
+		if start < 0 || start+i >= len(p) || p[start+i].Object != key {
+			return nil, errors.Retriable("the segments of %s changed while they were compacted", o.Filename)
+		}
+		size += p[start+i].Size
+	}
+	if size != o.Segments[0].Size {
+		return nil, errors.Retriable("the segments of %s changed while they were compacted", o.Filename)
+	}
+	merged := append(append(p[:start:start], o.Segments[0]), p[start+len(o.Replaced):]...)
+	f.SetPieces(merged)
+	if len(merged) == 1 && o.Checksums != nil {
+		f.SetChecksums(o.Checksums)
+	}
+	if _, err = c.Update(o.Namespace, o.Filename, f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,402 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package raft
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/cache"
+	"github.com/gostor/gofs/pkg/errors"
+	"github.com/gostor/gofs/pkg/fs"
+)
+
+// snapshotNameFormat is the time format of the default snapshot names, as
+// in HDFS.
+const snapshotNameFormat = "s20060102-150405.000"
+
+// cowCache saves the files of the snapshottable directories for their
+// latest snapshot before the file operations change them, see fs.Snapshot.
+type cowCache struct {
+	cache.Cache
+	// dirs are the snapshottable directories which have snapshots, which
+	// the file operations do not change.
+	dirs []*fs.File
+	// loaded is set once dirs are.
+	loaded bool
+}
+
+func (c *cowCache) Add(ns string, f *fs.File) error {
+	if err := c.preserve(ns, f.FullPath()); err != nil {
+		return err
+	}
+	return c.Cache.Add(ns, f)
+}
+
+func (c *cowCache) Update(ns, name string, new *fs.File) (*fs.File, error) {
+	if err := c.preserve(ns, name); err != nil {
+		return nil, err
+	}
+	if p := new.FullPath(); p != name {
+		if err := c.preserve(ns, p); err != nil {
+			return nil, err
+		}
+	}
+	return c.Cache.Update(ns, name, new)
+}
+
+func (c *cowCache) Delete(ns, name string) error {
+	if err := c.preserve(ns, name); err != nil {
+		return err
+	}
+	return c.Cache.Delete(ns, name)
+}
+
+// Batch runs fn with a view of the batch of the cache which saves the files
+// for the snapshots as well.
+func (c *cowCache) Batch(fn func(c cache.Cache) error) error {
+	return c.Cache.Batch(func(b cache.Cache) error {
+		return fn(&cowCache{Cache: b, dirs: c.dirs, loaded: c.loaded})
+	})
+}
+
+// preserve saves the file at full path p for the latest snapshot of its
+// snapshottable directory, unless it has been already.
+func (c *cowCache) preserve(ns, p string) error {
+	if !c.loaded {
+		root, err := c.Cache.Get(ns, fs.Root(ns).FullPath())
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		if root != nil {
+			for _, dir := range root.SnapshotDirs {
+				f := root
+				if dir != root.FullPath() {
+					if f, err = c.Cache.Get(ns, dir); err != nil {
+						return err
+					}
+				}
+				if len(f.Snapshots) > 0 {
+					c.dirs = append(c.dirs, f)
+				}
+			}
+		}
+		c.loaded = true
+	}
+	for _, dir := range c.dirs {
+		full := dir.FullPath()
+		if p == full || strings.HasPrefix(p, full+"/") {
+			_, err := c.save(ns, dir, dir.Snapshots[len(dir.Snapshots)-1].ID, p[len(full):])
+			return err
+		}
+	}
+	return nil
+}
+
+// save saves the file rel of the directory dir for the snapshot id, along
+// with its parents, and returns the copy. The files below a copy which is
+// Absent are not saved, since they did not exist either.
+func (c *cowCache) save(ns string, dir *fs.File, id uint64, rel string) (*fs.File, error) {
+	key := fs.SnapshotKey(dir.FullPath(), id, rel)
+	if f, err := c.Cache.Get(ns, key); err == nil {
+		return f, nil
+	} else if !errors.IsNotFound(err) {
+		return nil, err
+	}
+	parent := &fs.File{Path: path.Dir(key), Directory: true}
+	if rel != "" {
+		var err error
+		if parent, err = c.save(ns, dir, id, parentRel(rel)); err != nil {
+			return nil, err
+		}
+		if parent.Absent {
+			return parent, nil
+		}
+	}
+	f, err := c.Cache.Get(ns, dir.FullPath()+rel)
+	if errors.IsNotFound(err) {
+		f = &fs.File{Absent: true}
+	} else if err != nil {
+		return nil, err
+	} else {
+		// the data of the file is kept with its current key, and not its
+		// versions, which the file keeps
+		if isRegular(f) {
+			f.Object = f.ObjectKey()
+		}
+		f.Snapshots = nil
+		f.Versions = nil
+		f.Chunks = nil
+	}
+	f.Parent = parent
+	f.Path = path.Base(key)
+	return f, c.Cache.Add(ns, f)
+}
+
+// parentRel returns the relative path of the directory of the file rel.
+func parentRel(rel string) string {
+	if dir := path.Dir(rel); dir != "/" {
+		return dir
+	}
+	return ""
+}
+
+// snapshotDir returns the snapshottable directory Filename.
+func (o *Operation) snapshotDir(c cache.Cache) (*fs.File, error) {
+	root, err := o.root(c)
+	if err != nil {
+		return nil, err
+	}
+	f, err := o.lookup(c, o.Filename)
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range root.SnapshotDirs {
+		if dir == o.Filename {
+			return f, nil
+		}
+	}
+	return nil, errors.BadParameter("directory %s is not snapshottable", o.Filename)
+}
+
+// allowSnapshot makes the directory Filename snapshottable. The trees of
+// the snapshottable directories may not overlap.
+func (o *Operation) allowSnapshot(c cache.Cache) (interface{}, error) {
+	f, err := o.lookup(c, o.Filename)
+	if err != nil {
+		return nil, err
+	}
+	if !f.IsDirectory() {
+		return nil, errors.NotDirectory("not a directory: %s", o.Filename)
+	}
+	root, err := o.root(c)
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range root.SnapshotDirs {
+		switch {
+		case dir == o.Filename:
+			return f, nil
+		case strings.HasPrefix(o.Filename, dir+"/"), dir == root.FullPath():
+			return nil, errors.BadParameter("%s is in the tree of the snapshottable directory %s", o.Filename, dir)
+		case strings.HasPrefix(dir, o.Filename+"/"), o.Filename == root.FullPath():
+			return nil, errors.BadParameter("the tree of %s has the snapshottable directory %s", o.Filename, dir)
+		}
+	}
+	root.SnapshotDirs = append(append([]string{}, root.SnapshotDirs...), o.Filename)
+	sort.Strings(root.SnapshotDirs)
+	if _, err = c.Update(o.Namespace, root.FullPath(), root); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// disallowSnapshot makes the directory Filename not snapshottable, once its
+// snapshots are deleted.
+func (o *Operation) disallowSnapshot(c cache.Cache) (interface{}, error) {
+	f, err := o.snapshotDir(c)
+	if err != nil {
+		return nil, err
+	}
+	if len(f.Snapshots) > 0 {
+		return nil, errors.BadParameter("directory %s has %d snapshots, which must be deleted first", o.Filename, len(f.Snapshots))
+	}
+	root, err := o.root(c)
+	if err != nil {
+		return nil, err
+	}
+	root.SnapshotDirs = removePath(root.SnapshotDirs, o.Filename)
+	if _, err = c.Update(o.Namespace, root.FullPath(), root); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// createSnapshot creates the snapshot Snapshot of the directory Filename,
+// named after the time by default, and returns the path it is browsed at.
+func (o *Operation) createSnapshot(c cache.Cache) (interface{}, error) {
+	f, err := o.snapshotDir(c)
+	if err != nil {
+		return nil, err
+	}
+	name := o.Snapshot
+	if name == "" {
+		name = o.CreatedAt.UTC().Format(snapshotNameFormat)
+	}
+	if err = fs.CheckSnapshotName(name); err != nil {
+		return nil, err
+	}
+	if f.FindSnapshot(name) >= 0 {
+		return nil, errors.AlreadyExists("snapshot %s of %s already exists", name, o.Filename)
+	}
+	id, err := c.NextInode(o.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	f.Snapshots = append(append([]fs.Snapshot{}, f.Snapshots...), fs.Snapshot{Name: name, ID: id, Created: o.CreatedAt})
+	if _, err = c.Update(o.Namespace, o.Filename, f); err != nil {
+		return nil, err
+	}
+	return fs.SnapshotPath(o.Filename, name, ""), nil
+}
+
+// renameSnapshot renames the snapshot Snapshot of the directory Filename to
+// NewName.
+func (o *Operation) renameSnapshot(c cache.Cache) (interface{}, error) {
+	f, err := o.snapshotDir(c)
+	if err != nil {
+		return nil, err
+	}
+	i := f.FindSnapshot(o.Snapshot)
+	if i < 0 {
+		return nil, errors.NotFound("no such snapshot %s of %s", o.Snapshot, o.Filename)
+	}
+	if err = fs.CheckSnapshotName(o.NewName); err != nil {
+		return nil, err
+	}
+	if o.NewName == o.Snapshot {
+		return f, nil
+	}
+	if f.FindSnapshot(o.NewName) >= 0 {
+		return nil, errors.AlreadyExists("snapshot %s of %s already exists", o.NewName, o.Filename)
+	}
+	// the copies are kept by ID, and do not move
+	f.Snapshots = append([]fs.Snapshot{}, f.Snapshots...)
+	f.Snapshots[i].Name = o.NewName
+	if _, err = c.Update(o.Namespace, o.Filename, f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// deleteSnapshot deletes the snapshot Snapshot of the directory Filename,
+// and returns the copies of the files it dropped, whose data may be removed
+// unless another file refers to it.
+//
+// The copies the previous snapshot shares are moved to it, the others are
+// dropped.
+func (o *Operation) deleteSnapshot(c cache.Cache) (interface{}, error) {
+	f, err := o.snapshotDir(c)
+	if err != nil {
+		return nil, err
+	}
+	i := f.FindSnapshot(o.Snapshot)
+	if i < 0 {
+		return nil, errors.NotFound("no such snapshot %s of %s", o.Snapshot, o.Filename)
+	}
+	var prev *fs.Snapshot
+	if i > 0 {
+		prev = &f.Snapshots[i-1]
+	}
+	dropped := []*fs.File{}
+	if err = o.dropCopies(c, f.FullPath(), f.Snapshots[i].ID, prev, "", &dropped); err != nil {
+		return nil, err
+	}
+	f.Snapshots = append(append([]fs.Snapshot{}, f.Snapshots[:i]...), f.Snapshots[i+1:]...)
+	if _, err = c.Update(o.Namespace, o.Filename, f); err != nil {
+		return nil, err
+	}
+	return dropped, nil
+}
+
+// dropCopies removes the copy of the file rel of the directory dir kept for
+// the snapshot id, and then those of its tree. A copy moves to the previous
+// snapshot if it has none of its own, and had the file in its directory.
+func (o *Operation) dropCopies(c cache.Cache, dir string, id uint64, prev *fs.Snapshot, rel string, dropped *[]*fs.File) error {
+	key := fs.SnapshotKey(dir, id, rel)
+	f, err := c.Get(o.Namespace, key)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	children, err := c.List(o.Namespace, key)
+	if err != nil {
+		return err
+	}
+	keep := prev != nil
+	var parent *fs.File
+	if keep {
+		prevKey := fs.SnapshotKey(dir, prev.ID, rel)
+		if _, err = c.Get(o.Namespace, prevKey); err == nil {
+			keep = false
+		} else if !errors.IsNotFound(err) {
+			return err
+		}
+		if keep && rel == "" {
+			parent = &fs.File{Path: path.Dir(prevKey), Directory: true}
+		} else if keep {
+			parent, err = c.Get(o.Namespace, fs.SnapshotKey(dir, prev.ID, parentRel(rel)))
+			if err != nil {
+				return err
+			}
+			keep = !parent.Absent
+		}
+	}
+	if err = c.Delete(o.Namespace, key); err != nil {
+		return err
+	}
+	if keep {
+		moved := *f
+		moved.Parent = parent
+		moved.Path = path.Base(fs.SnapshotKey(dir, prev.ID, rel))
+		if err = c.Add(o.Namespace, &moved); err != nil {
+			return err
+		}
+	} else if !f.Absent {
+		*dropped = append(*dropped, f)
+	}
+	for _, child := range children {
+		if err = o.dropCopies(c, dir, id, prev, rel+"/"+child.Path, dropped); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkSnapshots checks that the file operation does not change a snapshot,
+// which is read-only, nor remove a snapshottable directory.
+func (o *Operation) checkSnapshots(c cache.Cache) error {
+	paths := []string{o.Filename}
+	switch o.Type {
+	case api.OpsRename, api.OpsCreateHardLink:
+		paths = append(paths, o.NewName)
+	}
+	for _, p := range paths {
+		if _, _, _, ok := fs.SplitSnapshotPath(p); ok {
+			return errors.PermissionDenied("permission denied: snapshot %s is read-only", p)
+		}
+	}
+	if o.Type != api.OpsDelete && o.Type != api.OpsRename {
+		return nil
+	}
+	root, err := c.Get(o.Namespace, fs.Root(o.Namespace).FullPath())
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		for _, dir := range root.SnapshotDirs {
+			if dir == p || strings.HasPrefix(dir, p+"/") {
+				return errors.BadParameter("cannot remove the snapshottable directory %s, which must be disallowed first", dir)
+			}
+		}
+	}
+	return nil
+}
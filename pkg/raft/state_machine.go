@@ -0,0 +1,172 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package raft
+
+import (
+	"encoding/json"
+	"path/filepath"
+
+	"github.com/gostor/gofs/pkg/cache"
+	"github.com/gostor/gofs/pkg/errors"
+	"github.com/gostor/gofs/pkg/fs"
+)
+
+// StateMachine saves the metadata cache in the raft snapshots, and recovers
+// it from them. The snapshots let raft compact its log, and bring the new
+// peers up to date, with the files and the usage of their quotas.
+type StateMachine struct {
+	cache cache.Cache
+}
+
+// NewStateMachine returns the state machine of the cache c.
+func NewStateMachine(c cache.Cache) *StateMachine {
+	return &StateMachine{cache: c}
+}
+
+// snapshot is the state saved in a raft snapshot.
+type snapshot struct {
+	Namespaces []namespaceSnapshot `json:"namespaces"`
+}
+
+// namespaceSnapshot is a namespace and its files, which are saved without
+// their parents, the parents first.
+type namespaceSnapshot struct {
+	Namespace *fs.Namespace `json:"namespace"`
+	Files     []fileEntry   `json:"files"`
+	// Inode is the largest inode number of the files.
+	Inode uint64 `json:"inode"`
+}
+
+type fileEntry struct {
+	Path string   `json:"path"`
+	File *fs.File `json:"file"`
+}
+
+// Save returns the snapshot of the cache.
+func (sm *StateMachine) Save() ([]byte, error) {
+	list, err := sm.cache.ListNamespaces()
+	if err != nil {
+		return nil, err
+	}
+	s := snapshot{Namespaces: []namespaceSnapshot{}}
+	for _, ns := range list {
+		n := namespaceSnapshot{Namespace: ns, Files: []fileEntry{}}
+		root, err := sm.cache.Get(ns.ID, fs.Root(ns.ID).FullPath())
+		if err == nil {
+			dirs := root.SnapshotDirs
+			if err = sm.saveTree(&n, root); err == nil {
+				err = sm.saveSnapshots(&n, dirs)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		s.Namespaces = append(s.Namespaces, n)
+	}
+	return json.Marshal(&s)
+}
+
+// saveTree adds f and the tree below it to n.
+func (sm *StateMachine) saveTree(n *namespaceSnapshot, f *fs.File) error {
+	full := f.FullPath()
+	if f.Inode > n.Inode {
+		n.Inode = f.Inode
+	}
+	f.Parent = nil
+	n.Files = append(n.Files, fileEntry{Path: full, File: f})
+	if !f.IsDirectory() {
+		return nil
+	}
+	children, err := sm.cache.List(n.Namespace.ID, full)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		if err = sm.saveTree(n, child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveSnapshots adds to n the copies of the files kept for the snapshots of
+// the directories dirs, which are not in their trees.
+func (sm *StateMachine) saveSnapshots(n *namespaceSnapshot, dirs []string) error {
+	for _, dir := range dirs {
+		f, err := sm.cache.Get(n.Namespace.ID, dir)
+		if err != nil {
+			return err
+		}
+		for _, s := range f.Snapshots {
+			// the IDs of the snapshots are allocated as the inode numbers
+			if s.ID > n.Inode {
+				n.Inode = s.ID
+			}
+			saved, err := sm.cache.Get(n.Namespace.ID, fs.SnapshotKey(dir, s.ID, ""))
+			if errors.IsNotFound(err) {
+				continue
+			} else if err != nil {
+				return err
+			}
+			if err = sm.saveTree(n, saved); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Recovery replaces the content of the cache with the snapshot b.
+func (sm *StateMachine) Recovery(b []byte) error {
+	var s snapshot
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	list, err := sm.cache.ListNamespaces()
+	if err != nil {
+		return err
+	}
+	for _, ns := range list {
+		if err = sm.cache.DeleteNamespace(ns.ID); err != nil {
+			return err
+		}
+	}
+	for _, n := range s.Namespaces {
+		id := n.Namespace.ID
+		if err = sm.cache.AddNamespace(n.Namespace); err != nil {
+			return err
+		}
+		dirs := map[string]*fs.File{}
+		for _, e := range n.Files {
+			f := e.File
+			f.Parent = dirs[filepath.Dir(e.Path)]
+			if f.Parent == nil && e.Path != fs.Root(id).FullPath() {
+				// the copies kept for a snapshot are in no directory
+				f.Parent = &fs.File{Path: filepath.Dir(e.Path), Directory: true}
+			}
+			if f.IsDirectory() {
+				dirs[e.Path] = f
+			}
+			if err = sm.cache.Add(id, f); err != nil {
+				return err
+			}
+		}
+		if err = sm.cache.SetInode(id, n.Inode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
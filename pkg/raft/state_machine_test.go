@@ -0,0 +1,63 @@
+package raft
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/fs"
+)
+
+func TestSnapshot(t *testing.T) {
+	c := newTestCache(t)
+	now := time.Now()
+
+	o := NewOperation(api.OpsCreateNamespace, "ns", "", "", nil, now)
+	o.Config = &api.Config{Bucket: "b", Endpoint: "localhost:9000"}
+	applyOp(t, c, o)
+	applyOp(t, c, NewOperation(api.OpsDirCreate, "ns", "/ns/a/b", "", &fs.Attr{Mode: 0755}, now))
+	o = NewOperation(api.OpsSetQuota, "ns", "/ns/a", "", nil, now)
+	o.Quota = &fs.Quota{Names: 10, Space: 100}
+	applyOp(t, c, o)
+	applyOp(t, c, NewOperation(api.OpsFileCreate, "ns", "/ns/a/b/f", "", &fs.Attr{Mode: 0644, Size: 42}, now))
+
+	b, err := NewStateMachine(c).Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the recovery replaces the state of the cache
+	r := newTestCache(t)
+	o = NewOperation(api.OpsCreateNamespace, "old", "", "", nil, now)
+	o.Config = &api.Config{}
+	applyOp(t, r, o)
+	if err = NewStateMachine(r).Recovery(b); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = r.GetNamespace("old"); err == nil {
+		t.Fatal("the namespaces missing from the snapshot must be removed")
+	}
+	if ns, err := r.GetNamespace("ns"); err != nil || ns.Bucket != "b" {
+		t.Fatalf("unexpected namespace: %v %v", ns, err)
+	}
+	f, err := r.Get("ns", "/ns/a/b/f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.FullPath() != "/ns/a/b/f" || f.Size != 42 {
+		t.Fatalf("unexpected file: %s %#v", f.FullPath(), f.Attr)
+	}
+	a, _ := r.Get("ns", "/ns/a")
+	if q, u := a.Quota, a.Summary; q == nil || u == nil || u.Names() != 3 || u.Length != 42 || q.Names != 10 || q.Space != 100 {
+		t.Fatalf("unexpected quota of /ns/a: %+v %+v", q, u)
+	}
+
+	// the usage is still maintained after the recovery, and the new files
+	// get new inode numbers
+	g := applyOp(t, r, NewOperation(api.OpsFileCreate, "ns", "/ns/a/g", "", &fs.Attr{Mode: 0644, Size: 8}, now)).(*fs.File)
+	if g.Inode <= f.Inode {
+		t.Fatalf("inode %d reused after the recovery", g.Inode)
+	}
+	if a, _ = r.Get("ns", "/ns/a"); a.Summary.Names() != 4 || a.Summary.Length != 50 {
+		t.Fatalf("unexpected usage of /ns/a: %+v", a.Summary)
+	}
+}
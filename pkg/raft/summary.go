@@ -0,0 +1,124 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package raft
+
+import (
+	"path/filepath"
+
+	"github.com/gostor/gofs/pkg/cache"
+	"github.com/gostor/gofs/pkg/errors"
+	"github.com/gostor/gofs/pkg/fs"
+)
+
+// charge adds d to the summaries of the directory dir and its ancestors. If
+// check is set, their quotas are checked first, so that an operation
+// exceeding one fails before changing anything.
+func (o *Operation) charge(c cache.Cache, dir string, d fs.Summary, check bool) error {
+	if d == (fs.Summary{}) {
+		return nil
+	}
+	dirs, err := o.ancestors(c, dir)
+	if err != nil {
+		return err
+	}
+	if check {
+		for _, f := range dirs {
+			if err = f.CheckQuota(d); err != nil {
+				return err
+			}
+		}
+	}
+	for _, f := range dirs {
+		if f.Summary == nil {
+			continue
+		}
+		f.ChargeSummary(d)
+		if _, err = c.Update(o.Namespace, f.FullPath(), f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ancestors returns the directory dir and its ancestors, up to the root of
+// the namespace.
+func (o *Operation) ancestors(c cache.Cache, dir string) ([]*fs.File, error) {
+	root := fs.Root(o.Namespace).FullPath()
+	dirs := []*fs.File{}
+	for p := dir; ; p = filepath.Dir(p) {
+		f, err := c.Get(o.Namespace, p)
+		if err == nil {
+			dirs = append(dirs, f)
+		} else if !errors.IsNotFound(err) {
+			return nil, err
+		}
+		if p == root || p == "/" {
+			return dirs, nil
+		}
+	}
+}
+
+// repairSummary recomputes the summaries of the directory tree Filename,
+// should they have drifted, and corrects those of its ancestors by the
+// difference. The ancestors are left alone if the directory had no summary,
+// so a whole namespace is repaired from its root.
+func (o *Operation) repairSummary(c cache.Cache) (interface{}, error) {
+	f, err := o.lookup(c, o.Filename)
+	if err != nil {
+		return nil, err
+	}
+	if !f.IsDirectory() {
+		return nil, errors.NotDirectory("not a directory: %s", o.Filename)
+	}
+	old := f.Summary
+	s, err := o.summarize(c, f)
+	if err != nil {
+		return nil, err
+	}
+	if old != nil && f.Parent != nil {
+		if err = o.charge(c, filepath.Dir(f.FullPath()), s.Add(old.Neg()), false); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// summarize recomputes and stores the summaries of the directories in the
+// tree of f, and returns that of f.
+func (o *Operation) summarize(c cache.Cache, f *fs.File) (fs.Summary, error) {
+	s := f.Entry()
+	if !f.IsDirectory() {
+		return s, nil
+	}
+	children, err := c.List(o.Namespace, f.FullPath())
+	if err != nil {
+		return fs.Summary{}, err
+	}
+	for _, child := range children {
+		cs, err := o.summarize(c, child)
+		if err != nil {
+			return fs.Summary{}, err
+		}
+		s = s.Add(cs)
+	}
+	if f.Summary == nil || *f.Summary != s {
+		f.Summary = &s
+		if _, err = c.Update(o.Namespace, f.FullPath(), f); err != nil {
+			return fs.Summary{}, err
+		}
+	}
+	return s, nil
+}
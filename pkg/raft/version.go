@@ -0,0 +1,142 @@
+/*
+Copyright 2017 The GoStor Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package raft
+
+import (
+	"path/filepath"
+
+	"github.com/gostor/gofs/pkg/cache"
+	"github.com/gostor/gofs/pkg/errors"
+	"github.com/gostor/gofs/pkg/fs"
+)
+
+// versioning returns the versioning policy of the files of the directory
+// dir, nil if it has none enabled.
+func (o *Operation) versioning(c cache.Cache, dir string) (*fs.Versioning, error) {
+	dirs, err := o.ancestors(c, dir)
+	if err != nil {
+		return nil, err
+	}
+	return fs.VersioningOf(dirs), nil
+}
+
+// keepVersion keeps the content of the file old, which f overwrites in the
+// directory dir, as the latest version of f if the versioning of dir is
+// enabled, and prunes the versions its policy no longer keeps. The earlier
+// versions of old are kept anyway.
+func (o *Operation) keepVersion(c cache.Cache, dir string, old, f *fs.File) error {
+	f.Versions = old.Versions
+	if !isRegular(old) || old.ObjectKey() == f.ObjectKey() {
+		// the data was overwritten in place
+		return nil
+	}
+	v, err := o.versioning(c, dir)
+	if err != nil || v == nil {
+		return err
+	}
+	old.PushVersion(o.CreatedAt)
+	f.Versions = old.Versions
+	f.PruneVersions(v, o.CreatedAt)
+	return nil
+}
+
+// setVersioning sets the versioning policy of the directory Filename, which
+// the directories of its tree inherit unless they have their own, or clears
+// it if Versioning is nil.
+func (o *Operation) setVersioning(c cache.Cache) (interface{}, error) {
+	f, err := o.lookup(c, o.Filename)
+	if err != nil {
+		return nil, err
+	}
+	if !f.IsDirectory() {
+		return nil, errors.NotDirectory("cannot set the versioning of %s, which is not a directory", o.Filename)
+	}
+	f.Versioning = nil
+	if v := o.Versioning; v != nil {
+		if v.MaxVersions < 0 || v.MaxAge < 0 {
+			return nil, errors.BadParameter("invalid versioning limits %d versions and %d minutes", v.MaxVersions, v.MaxAge)
+		}
+		policy := *v
+		f.Versioning = &policy
+	}
+	if _, err = c.Update(o.Namespace, f.FullPath(), f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// restoreVersion makes the version Version of the regular file Filename its
+// content again, stored under the Object key and the Segments its data was
+// copied to. The content replaced is kept as the latest version, so that a
+// restore can be undone, and the versions are then pruned as by an
+// overwrite.
+func (o *Operation) restoreVersion(c cache.Cache) (interface{}, error) {
+	f, err := o.lookup(c, o.Filename)
+	if err != nil {
+		return nil, err
+	}
+	if !isRegular(f) {
+		return nil, errors.BadParameter("cannot restore a version of %s, which is not a regular file", o.Filename)
+	}
+	i := f.FindVersion(o.Version)
+	if i < 0 {
+		return nil, errors.NotFound("no such version %d of %s", o.Version, o.Filename)
+	}
+	v := f.Versions[i]
+	if o.Object == "" || len(o.Segments) != len(v.Segments) {
+		return nil, errors.BadParameter("missing object keys")
+	}
+	dir := filepath.Dir(o.Filename)
+	if err = o.charge(c, dir, fs.Summary{Length: int64(v.Attr.Size) - f.SpaceConsumed()}, true); err != nil {
+		return nil, err
+	}
+	policy, err := o.versioning(c, dir)
+	if err != nil {
+		return nil, err
+	}
+	f.PushVersion(o.CreatedAt)
+	f.Object = o.Object
+	f.Segments = o.Segments
+	f.Size = v.Attr.Size
+	f.Checksum, f.Hash, f.SHA256 = v.Checksum, v.Hash, v.SHA256
+	f.Mtime = o.CreatedAt
+	f.Ctime = o.CreatedAt
+	f.PruneVersions(policy, o.CreatedAt)
+	if _, err = c.Update(o.Namespace, o.Filename, f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// pruneVersions removes the versions of the file Filename which the
+// versioning policy of its directory no longer keeps at CreatedAt.
+func (o *Operation) pruneVersions(c cache.Cache) (interface{}, error) {
+	f, err := o.lookup(c, o.Filename)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := o.versioning(c, filepath.Dir(o.Filename))
+	if err != nil {
+		return nil, err
+	}
+	if len(f.PruneVersions(policy, o.CreatedAt)) == 0 {
+		return f, nil
+	}
+	if _, err = c.Update(o.Namespace, o.Filename, f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
@@ -16,10 +16,12 @@ limitations under the License.
 package storage
 
 import (
-	"errors"
+	"io"
+	"path"
 	"time"
 
 	"github.com/gostor/gofs/pkg/api"
+	"github.com/gostor/gofs/pkg/errors"
 	minio "github.com/minio/minio-go"
 )
 
@@ -83,7 +85,20 @@ func (ms *MinioStorage) Bucket(name string, cfg *api.Config) (Bucket, error) {
 	}, nil
 }
 
+// Auth checks that the credentials of the bucket are accepted by the
+// storage, and that the bucket exists.
 func (mb *MinioBucket) Auth() error {
+	ok, err := mb.client.BucketExists(mb.Name)
+	if err != nil {
+		switch minio.ToErrorResponse(err).Code {
+		case "AccessDenied", "InvalidAccessKeyId", "SignatureDoesNotMatch":
+			return errors.PermissionDenied("access to bucket %s denied: %v", mb.Name, err)
+		}
+		return err
+	}
+	if !ok {
+		return ErrNoSuchBucket
+	}
 	return nil
 }
 
@@ -100,25 +115,81 @@ func (mb *MinioBucket) Get() error {
 }
 
 func (mb *MinioBucket) Object(name string) Object {
-	return &ObjectInfo{
-		Bucket: mb.Name,
+	return &MinioObject{
+		bucket: mb,
 		Name:   name,
 	}
 }
 
-func (mo *ObjectInfo) Stat() error {
-	return ErrNoSuchObject
+func (mb *MinioBucket) List(prefix string) ([]ObjectInfo, error) {
+	done := make(chan struct{})
+	defer close(done)
+	var list []ObjectInfo
+	for info := range mb.client.ListObjects(mb.Name, prefix, true, done) {
+		if info.Err != nil {
+			return nil, info.Err
+		}
+		list = append(list, ObjectInfo{
+			Bucket:      mb.Name,
+			Name:        info.Key,
+			ModTime:     info.LastModified,
+			Size:        info.Size,
+			ETag:        info.ETag,
+			ContentType: info.ContentType,
+		})
+	}
+	return list, nil
+}
+
+// MinioObject is an object stored in a MinioBucket.
+type MinioObject struct {
+	bucket *MinioBucket
+	Name   string
+}
+
+func (mo *MinioObject) Stat() (*ObjectInfo, error) {
+	info, err := mo.bucket.client.StatObject(mo.bucket.Name, mo.Name)
+	if err != nil {
+		if IsNoSuchObject(err) {
+			return nil, ErrNoSuchObject
+		}
+		return nil, err
+	}
+	return &ObjectInfo{
+		Bucket:      mo.bucket.Name,
+		Name:        info.Key,
+		ModTime:     info.LastModified,
+		Size:        info.Size,
+		ETag:        info.ETag,
+		ContentType: info.ContentType,
+	}, nil
+}
+
+func (mo *MinioObject) Get() (io.ReadCloser, error) {
+	return mo.bucket.client.GetObject(mo.bucket.Name, mo.Name)
+}
+
+func (mo *MinioObject) Put(r io.Reader) (int64, error) {
+	return mo.bucket.client.PutObject(mo.bucket.Name, mo.Name, r, "application/octet-stream")
+}
+
+func (mo *MinioObject) Copy(src string) error {
+	err := mo.bucket.client.CopyObject(mo.bucket.Name, mo.Name, path.Join(mo.bucket.Name, src), minio.NewCopyConditions())
+	if IsNoSuchObject(err) {
+		return ErrNoSuchObject
+	}
+	return err
 }
 
-func (mo *ObjectInfo) Delete() error {
-	return ErrNoSuchObject
+func (mo *MinioObject) Delete() error {
+	return mo.bucket.client.RemoveObject(mo.bucket.Name, mo.Name)
 }
 
 // ErrNoSuchObject - returned when object is not found.
-var ErrNoSuchObject = errors.New("No such object")
+var ErrNoSuchObject = errors.NotFound("No such object")
 
 // ErrNoSuchBucket - returned when bucket is not found.
-var ErrNoSuchBucket = errors.New("No such bucket")
+var ErrNoSuchBucket = errors.NotFound("No such bucket")
 
 // IsNoSuchObject - is err ErrNoSuchObject ?
 func IsNoSuchObject(err error) bool {
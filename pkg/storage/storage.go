@@ -18,10 +18,19 @@ limitations under the License.
 
 package storage
 
-import "github.com/gostor/gofs/pkg/api"
+import (
+	"io"
+
+	"github.com/gostor/gofs/pkg/api"
+)
 
 type Object interface {
-	Stat() error
+	Stat() (*ObjectInfo, error)
+	Get() (io.ReadCloser, error)
+	Put(r io.Reader) (int64, error)
+	// Copy replaces the object with a copy of the object src of the same
+	// bucket, made by the storage.
+	Copy(src string) error
 	Delete() error
 }
 
@@ -31,6 +40,8 @@ type Bucket interface {
 	Delete() error
 	Get() error
 	Object(name string) Object
+	// List returns the objects whose keys start with prefix.
+	List(prefix string) ([]ObjectInfo, error)
 }
 
 type Storage interface {
@@ -17,6 +17,55 @@ limitations under the License.
 // Package version provides the Version information.
 package version
 
+import (
+	"strconv"
+	"strings"
+)
+
 const (
 	Version = "0.1"
+
+	// APIVersion is the current version of the metadata API.
+	APIVersion = "1.0"
+	// MinAPIVersion is the oldest version of the metadata API still served.
+	MinAPIVersion = "1.0"
 )
+
+// Compare compares two version strings made of dot separated numbers.
+// It returns -1 if v < other, 1 if v > other and 0 if they are equal.
+func Compare(v, other string) int {
+	currTab := strings.Split(v, ".")
+	otherTab := strings.Split(other, ".")
+
+	max := len(currTab)
+	if len(otherTab) > max {
+		max = len(otherTab)
+	}
+	for i := 0; i < max; i++ {
+		var currInt, otherInt int
+
+		if len(currTab) > i {
+			currInt, _ = strconv.Atoi(currTab[i])
+		}
+		if len(otherTab) > i {
+			otherInt, _ = strconv.Atoi(otherTab[i])
+		}
+		if currInt > otherInt {
+			return 1
+		}
+		if otherInt > currInt {
+			return -1
+		}
+	}
+	return 0
+}
+
+// LessThan checks if a version is less than another
+func LessThan(v, other string) bool {
+	return Compare(v, other) == -1
+}
+
+// GreaterThan checks if a version is greater than another
+func GreaterThan(v, other string) bool {
+	return Compare(v, other) == 1
+}
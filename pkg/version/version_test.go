@@ -0,0 +1,29 @@
+package version
+
+import "testing"
+
+func TestCompare(t *testing.T) {
+	cases := []struct {
+		v, other string
+		expected int
+	}{
+		{"1.0", "1.0", 0},
+		{"1", "1.0", 0},
+		{"1.0", "1.1", -1},
+		{"1.10", "1.9", 1},
+		{"2.0", "1.99", 1},
+		{"1.0.1", "1.0", 1},
+	}
+
+	for _, c := range cases {
+		if a := Compare(c.v, c.other); a != c.expected {
+			t.Fatalf("Compare(%s, %s): expected %d, actual %d", c.v, c.other, c.expected, a)
+		}
+	}
+	if !LessThan("1.0", "1.1") || LessThan("1.1", "1.1") {
+		t.Fatal("unexpected LessThan result")
+	}
+	if !GreaterThan("1.2", "1.1") || GreaterThan("1.1", "1.1") {
+		t.Fatal("unexpected GreaterThan result")
+	}
+}